@@ -0,0 +1,179 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/spf13/cobra"
+	"github.com/tensorleap/helm-charts/pkg/local"
+	"github.com/tensorleap/helm-charts/pkg/log"
+	"github.com/tensorleap/helm-charts/pkg/server"
+)
+
+func storesFlagUsage() string {
+	names := []string{}
+	for _, store := range server.BackupStores {
+		names = append(names, string(store))
+	}
+	return fmt.Sprintf("Stores to include (%s), all when not set", strings.Join(names, ", "))
+}
+
+func NewBackupCmd() *cobra.Command {
+	var filePath string
+	var stores []string
+	cmd := &cobra.Command{
+		Use:   "backup",
+		Short: "Backup Tensorleap application data",
+		Long: `Backup Tensorleap application data
+  Stops the cluster while copying, archives the selected stores together with the installation params,
+  manifest and hostname, and starts the cluster again.
+    `,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.SetCommandName("backup")
+
+			targets, err := server.ParseBackupStores(stores)
+			if err != nil {
+				return err
+			}
+
+			_, err = server.InitDataDirFunc(cmd.Context(), "")
+			if err != nil {
+				return err
+			}
+
+			close, err := local.SetupInfra("backup")
+			if err != nil {
+				return err
+			}
+			defer close()
+
+			if filePath == "" {
+				filePath = fmt.Sprintf("tensorleap-backup_%s.tar.gz", time.Now().Format("2006-01-02_15-04-05"))
+			}
+			if err := os.MkdirAll(path.Dir(filePath), 0755); err != nil {
+				return err
+			}
+			archiveFile, err := os.Create(filePath)
+			if err != nil {
+				return err
+			}
+			defer archiveFile.Close()
+
+			log.SendCloudReport("info", "Starting backup", "Starting", &map[string]interface{}{"stores": targets})
+			meta, err := server.Backup(cmd.Context(), archiveFile, targets)
+			if err != nil {
+				archiveFile.Close()
+				os.Remove(filePath)
+				log.SendCloudReport("error", "Failed backup", "Failed", &map[string]interface{}{"error": err.Error()})
+				return err
+			}
+			log.SendCloudReport("info", "Successfully completed backup", "Success", nil)
+			log.Infof("Backup of %s saved to %s", formatStores(meta.Stores), filePath)
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&filePath, "file", "f", "", "Archive file path (default tensorleap-backup_<time>.tar.gz)")
+	cmd.Flags().StringSliceVar(&stores, "stores", nil, storesFlagUsage())
+	return cmd
+}
+
+func NewRestoreCmd() *cobra.Command {
+	var stores []string
+	var restoreConfig bool
+	var force bool
+	var yes bool
+	cmd := &cobra.Command{
+		Use:   "restore <backup-file>",
+		Short: "Restore Tensorleap application data from a backup",
+		Long: `Restore Tensorleap application data from a backup
+  The backup app version must match the installed one. The selected stores are replaced with the
+  backup content while the cluster is stopped, then the cluster is started again.
+    `,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.SetCommandName("restore")
+			archivePath := args[0]
+
+			var targets []server.CustomTarget
+			if len(stores) > 0 {
+				var err error
+				if targets, err = server.ParseBackupStores(stores); err != nil {
+					return err
+				}
+			}
+
+			_, err := server.InitDataDirFunc(cmd.Context(), "")
+			if err != nil {
+				return err
+			}
+
+			close, err := local.SetupInfra("restore")
+			if err != nil {
+				return err
+			}
+			defer close()
+
+			meta, err := server.ReadBackupMetadata(archivePath)
+			if err != nil {
+				return err
+			}
+			log.Infof("Backup created at %s by installer %s (tag %s, app version %s) contains: %s",
+				meta.CreatedAt.Format(time.RFC3339), meta.InstallerVersion, meta.Tag, meta.AppVersion, formatStores(meta.Stores))
+
+			if !yes {
+				toReplace := targets
+				if len(toReplace) == 0 {
+					toReplace = meta.Stores
+				}
+				confirmed := false
+				prompt := &survey.Confirm{
+					Message: fmt.Sprintf("The current %s data will be replaced. Proceed?", formatStores(toReplace)),
+					Default: false,
+				}
+				if err := survey.AskOne(prompt, &confirmed); err != nil {
+					return err
+				}
+				if !confirmed {
+					log.Println("Restore cancelled")
+					return nil
+				}
+			}
+
+			log.SendCloudReport("info", "Starting restore", "Starting", &map[string]interface{}{"stores": targets, "backup": meta})
+			_, err = server.Restore(cmd.Context(), archivePath, server.RestoreOptions{
+				Stores:        targets,
+				RestoreConfig: restoreConfig,
+				Force:         force,
+			})
+			if err != nil {
+				log.SendCloudReport("error", "Failed restore", "Failed", &map[string]interface{}{"error": err.Error()})
+				return err
+			}
+			log.SendCloudReport("info", "Successfully completed restore", "Success", nil)
+			log.Info("Successfully restored backup")
+			return nil
+		},
+	}
+	cmd.Flags().StringSliceVar(&stores, "stores", nil, storesFlagUsage())
+	cmd.Flags().BoolVar(&restoreConfig, "restore-config", false, "Also restore the installation params, manifest and hostname")
+	cmd.Flags().BoolVar(&force, "force", false, "Restore even when the backup app version differs from the installed one")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Do not ask for confirmation")
+	return cmd
+}
+
+func formatStores(stores []server.CustomTarget) string {
+	names := make([]string, len(stores))
+	for i, store := range stores {
+		names[i] = string(store)
+	}
+	return strings.Join(names, ", ")
+}
+
+func init() {
+	RootCommand.AddCommand(NewBackupCmd())
+	RootCommand.AddCommand(NewRestoreCmd())
+}
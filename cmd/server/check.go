@@ -2,18 +2,72 @@ package server
 
 import (
 	"fmt"
+	"io"
+	"strings"
+
 	"github.com/spf13/cobra"
+	"github.com/tensorleap/helm-charts/pkg/local"
+	"github.com/tensorleap/helm-charts/pkg/log"
+	"github.com/tensorleap/helm-charts/pkg/server"
 )
 
-func init() {
-	RootCommand.AddCommand(&cobra.Command{
-		Use:   "check",
-		Short: "Troubleshoot local installation issues",
+func NewCheckCmd() *cobra.Command {
+	var output string
+	cmd := &cobra.Command{
+		Use:     "check",
+		Aliases: []string{"doctor"},
+		Short:   "Troubleshoot local installation issues",
 		Long: `Troubleshoot local installation issues
   Run this if your local installation stopped working.
+  Checks docker, the cluster, helm releases, the registry, disk pressure and pods health.
+  Exits with a non-zero code when any check fails.
     `,
-		Run: func(cmd *cobra.Command, args []string) {
-			fmt.Println("Check command")
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := validateOutputFormat(output); err != nil {
+				return err
+			}
+			log.SetCommandName("check")
+
+			_, err := server.InitDataDirFunc(cmd.Context(), "")
+			if err != nil {
+				return err
+			}
+
+			close, err := local.SetupInfra("check")
+			if err != nil {
+				return err
+			}
+			defer close()
+
+			report := server.RunDoctor(cmd.Context())
+			if output == OutputJSON {
+				if err := printJSON(cmd.OutOrStdout(), report); err != nil {
+					return err
+				}
+			} else {
+				printDoctorReport(cmd.OutOrStdout(), report)
+			}
+
+			if report.HasFailures() {
+				cmd.SilenceUsage = true
+				return server.ErrDoctorChecksFailed
+			}
+			return nil
 		},
-	})
+	}
+	addOutputFlag(cmd, &output)
+	return cmd
+}
+
+func printDoctorReport(w io.Writer, report *server.DoctorReport) {
+	for _, check := range report.Checks {
+		fmt.Fprintf(w, "[%s] %s: %s\n", strings.ToUpper(string(check.Status)), check.Name, check.Message)
+		if check.Remediation != "" && check.Status != server.CheckPass {
+			fmt.Fprintf(w, "       -> %s\n", check.Remediation)
+		}
+	}
+}
+
+func init() {
+	RootCommand.AddCommand(NewCheckCmd())
 }
@@ -0,0 +1,263 @@
+package server
+
+import (
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/spf13/cobra"
+	"github.com/tensorleap/helm-charts/pkg/local"
+	"github.com/tensorleap/helm-charts/pkg/log"
+	"github.com/tensorleap/helm-charts/pkg/server"
+)
+
+func NewConfigCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "View and change the configuration of the installed server",
+		Long: `View and change the configuration of the installed server
+  Changes are staged with 'set' and 'unset' and take effect on 'apply', which runs a helm upgrade when
+  only the helm values change and asks before reinstalling when the cluster itself has to be recreated.
+    `,
+	}
+	cmd.AddCommand(newConfigGetCmd())
+	cmd.AddCommand(newConfigSetCmd())
+	cmd.AddCommand(newConfigUnsetCmd())
+	cmd.AddCommand(newConfigApplyCmd())
+	cmd.AddCommand(newConfigValidateCmd())
+	return cmd
+}
+
+func configKeysUsage() string {
+	usage := "Keys:\n"
+	for _, key := range server.ConfigKeys {
+		usage += fmt.Sprintf("  %-20s %s\n", key.Name, key.Description)
+	}
+	return usage
+}
+
+func newConfigGetCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "get [key]",
+		Short: "Print the installed configuration and the pending changes",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := server.InitDataDirFunc(cmd.Context(), ""); err != nil {
+				return err
+			}
+			current, pending, err := server.LoadConfigParams()
+			if err != nil {
+				return err
+			}
+
+			if len(args) == 1 {
+				key, err := server.GetConfigKey(args[0])
+				if err != nil {
+					return err
+				}
+				fmt.Fprintln(cmd.OutOrStdout(), key.Get(current))
+				if pending != nil && key.Get(pending) != key.Get(current) {
+					log.Infof("Pending change: %s (run `leap server config apply` to apply it)", key.Get(pending))
+				}
+				return nil
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			defer w.Flush()
+			fmt.Fprintln(w, "KEY\tVALUE\tPENDING")
+			for _, key := range server.ConfigKeys {
+				pendingValue := ""
+				if pending != nil && key.Get(pending) != key.Get(current) {
+					pendingValue = valueOrDash(key.Get(pending))
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\n", key.Name, valueOrDash(key.Get(current)), pendingValue)
+			}
+			return nil
+		},
+	}
+	cmd.SetUsageTemplate(cmd.UsageTemplate() + "\n" + configKeysUsage())
+	return cmd
+}
+
+func newConfigSetCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "set <key> <value>",
+		Short: "Stage a configuration change",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := server.InitDataDirFunc(cmd.Context(), ""); err != nil {
+				return err
+			}
+			if err := server.SetConfigValue(args[0], args[1]); err != nil {
+				return err
+			}
+			log.Infof("%s set, run `leap server config apply` to apply the pending changes", args[0])
+			return nil
+		},
+	}
+	cmd.SetUsageTemplate(cmd.UsageTemplate() + "\n" + configKeysUsage())
+	return cmd
+}
+
+func newConfigUnsetCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "unset <key>",
+		Short: "Stage resetting a configuration key to its default",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := server.InitDataDirFunc(cmd.Context(), ""); err != nil {
+				return err
+			}
+			if err := server.UnsetConfigValue(args[0]); err != nil {
+				return err
+			}
+			log.Infof("%s unset, run `leap server config apply` to apply the pending changes", args[0])
+			return nil
+		},
+	}
+	cmd.SetUsageTemplate(cmd.UsageTemplate() + "\n" + configKeysUsage())
+	return cmd
+}
+
+func newConfigApplyCmd() *cobra.Command {
+	var yes bool
+	var discard bool
+	var airgapPackPath string
+
+	cmd := &cobra.Command{
+		Use:   "apply",
+		Short: "Apply the pending configuration changes",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.SetCommandName("config-apply")
+
+			if _, err := server.InitDataDirFunc(cmd.Context(), ""); err != nil {
+				return err
+			}
+
+			if discard {
+				if err := server.DiscardPendingConfig(); err != nil {
+					return err
+				}
+				log.Info("Pending changes discarded")
+				return nil
+			}
+
+			close, err := local.SetupInfra("config-apply")
+			if err != nil {
+				return err
+			}
+			defer close()
+
+			plan, err := server.PlanConfigApply()
+			if err != nil {
+				return err
+			}
+			if len(plan.Changes) == 0 {
+				log.Info("No pending changes")
+				_, err := server.ApplyConfig(cmd.Context(), plan, "")
+				return err
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "KEY\tFROM\tTO")
+			for _, change := range plan.Changes {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", change.Key, valueOrDash(change.From), valueOrDash(change.To))
+			}
+			w.Flush()
+
+			switch plan.Action {
+			case server.ConfigApplyHelmUpgrade:
+				log.Info("Changes only affect the helm values, applying with helm upgrade")
+			case server.ConfigApplyReinstall:
+				log.Warn("Changes affect the cluster, the cluster will be recreated (data is kept but running jobs are stopped)")
+				if !yes {
+					confirmed := false
+					prompt := &survey.Confirm{
+						Message: "Reinstall the cluster to apply the changes?",
+						Default: false,
+					}
+					if err := survey.AskOne(prompt, &confirmed); err != nil {
+						return err
+					}
+					if !confirmed {
+						log.Println("Apply cancelled, the changes are still pending")
+						return nil
+					}
+				}
+			}
+
+			result, err := server.ApplyConfig(cmd.Context(), plan, airgapPackPath)
+			if err != nil {
+				return err
+			}
+			log.Infof("Configuration applied, you can access Tensorleap at %s", result.ServerURL)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Reinstall without asking when required")
+	cmd.Flags().BoolVar(&discard, "discard", false, "Discard the pending changes instead of applying them")
+	cmd.Flags().StringVar(&airgapPackPath, "airgap", "", "Installation pack of the installed tag, required to reinstall an airgap installation")
+	return cmd
+}
+
+const installConfigExample = `version: v1
+source:
+  tag: tensorleap-1.2.3   # or airgap: ./tensorleap-pack.tar.gz, or localDir: ./charts
+dataDir: /var/lib/tensorleap/standalone
+port: 4589
+registryPort: 5699
+domain: tensorleap.example.com
+proxyUrl: ""
+pipIndexUrl: https://pypi.example.com/simple
+gpus: 1                   # or gpuDevices: "0,1", or cpu: true
+cpuLimit: "8"
+clusterMemoryGb: 64
+datasetVolumes:
+  - /mnt/datasets
+  - /mnt/raw:/data/raw
+disableMetrics: false
+disableAuth: false
+clearImages: false
+diskPressureCleanup: false
+watchdogGrace: 10m        # how long pods may fail before the install stops
+tls:
+  cert: ./certs/server.crt
+  key: ./certs/server.key
+  chain: ./certs/chain.crt
+  port: 443`
+
+func newConfigValidateCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "validate <install-config-file>",
+		Short: "Validate an install config file without installing",
+		Long: `Validate an install config file without installing
+  The file is used with 'leap server install --config <file>'. All fields are optional except version,
+  relative paths are resolved against the directory of the file. Example:
+
+` + installConfigExample,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := server.LoadInstallConfig(args[0])
+			if err != nil {
+				return err
+			}
+			flags := &InstallFlags{}
+			installCmd := &cobra.Command{}
+			flags.SetFlags(installCmd)
+			if err := server.ApplyInstallConfig(installCmd.Flags(), cfg); err != nil {
+				return err
+			}
+			if err := server.ValidateInstallFlags(&flags.InstallFlags, &flags.InstallationSourceFlags); err != nil {
+				cmd.SilenceUsage = true
+				return err
+			}
+			log.Infof("%s is valid", args[0])
+			return nil
+		},
+	}
+}
+
+func init() {
+	RootCommand.AddCommand(NewConfigCmd())
+}
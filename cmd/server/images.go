@@ -0,0 +1,151 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	units "github.com/docker/go-units"
+	"github.com/spf13/cobra"
+	"github.com/tensorleap/helm-charts/pkg/containerd"
+	"github.com/tensorleap/helm-charts/pkg/local"
+	"github.com/tensorleap/helm-charts/pkg/log"
+	"github.com/tensorleap/helm-charts/pkg/server"
+	"github.com/tensorleap/helm-charts/pkg/zot"
+)
+
+func NewImagesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "images",
+		Short: "Manage the images stored by the server",
+	}
+	cmd.AddCommand(newImagesPruneCmd())
+	return cmd
+}
+
+func newImagesPruneCmd() *cobra.Command {
+	opts := server.ImagesPruneOptions{}
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Remove the images not used by the installed version",
+		Long: `Remove the images not used by the installed version from the node containerd and from the registry
+  Without --containerd or --registry both are pruned. Use --dry-run to see what would be removed and the space it frees.
+  Images used by containers or pinned, and registry tags sharing a digest with a kept tag, are kept.
+  The preserved engine-generic repos are only pruned by the registry retention policy, if one is set.
+    `,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := validateOutputFormat(output); err != nil {
+				return err
+			}
+			log.SetCommandName("images-prune")
+			if !opts.Containerd && !opts.Registry {
+				opts.Containerd, opts.Registry = true, true
+			}
+
+			if _, err := server.InitDataDirFunc(cmd.Context(), ""); err != nil {
+				return err
+			}
+			close, err := local.SetupInfra("images-prune")
+			if err != nil {
+				return err
+			}
+			defer close()
+
+			report, err := server.PruneImages(cmd.Context(), opts)
+			if err != nil {
+				return err
+			}
+			if output != OutputText {
+				return printOutput(cmd.OutOrStdout(), output, report)
+			}
+			printImagesPruneReport(cmd.OutOrStdout(), report)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&opts.DryRun, "dry-run", false, "Only report what would be removed")
+	cmd.Flags().BoolVar(&opts.Containerd, "containerd", false, "Prune the images of the node containerd")
+	cmd.Flags().BoolVar(&opts.Registry, "registry", false, "Prune the images of the registry")
+	addOutputFlag(cmd, &output)
+	return cmd
+}
+
+func printImagesPruneReport(out io.Writer, report *server.ImagesPruneReport) {
+	removedTitle := "Removed"
+	if report.DryRun {
+		removedTitle = "Would remove"
+	}
+
+	if r := report.Containerd; r != nil {
+		printContainerdImages(out, fmt.Sprintf("Containerd - %s", removedTitle), r.Removed)
+		printContainerdImages(out, "Containerd - in use, kept", r.InUse)
+	}
+	if r := report.Registry; r != nil {
+		printRegistryImages(out, fmt.Sprintf("Registry - %s", removedTitle), r.Removed)
+		printRegistryImages(out, "Registry - sharing a digest with a kept tag, kept", r.InUse)
+		if len(r.PreservedRepos) > 0 {
+			fmt.Fprintf(out, "\nRegistry - preserved repos: %s\n", strings.Join(r.PreservedRepos, ", "))
+		}
+	}
+	if r := report.Retention; r != nil {
+		printRegistryImages(out, fmt.Sprintf("Registry retention - %s", removedTitle), r.Removed)
+		printRegistryImages(out, "Registry retention - used by the installed version or running pods, kept", r.InUse)
+		printRegistryImages(out, "Registry retention - creation time unknown, skipped", r.Skipped)
+	}
+
+	reclaimedTitle := "RECLAIMED"
+	if report.DryRun {
+		reclaimedTitle = "RECLAIMABLE"
+	}
+	fmt.Fprintln(out)
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintf(w, "SOURCE\tREMOVED\tKEPT IN USE\t%s\n", reclaimedTitle)
+	if r := report.Containerd; r != nil {
+		// shared layers make the containerd sizes an upper bound
+		fmt.Fprintf(w, "containerd\t%d\t%d\tup to %s\n", len(r.Removed), len(r.InUse), units.HumanSize(float64(r.ReclaimedBytes)))
+	}
+	if r := report.Registry; r != nil {
+		fmt.Fprintf(w, "registry\t%d\t%d\t%s\n", len(r.Removed), len(r.InUse), units.HumanSize(float64(r.ReclaimedBytes)))
+	}
+	if r := report.Retention; r != nil {
+		fmt.Fprintf(w, "registry retention\t%d\t%d\t%s\n", len(r.Removed), len(r.InUse), units.HumanSize(float64(r.ReclaimedBytes)))
+	}
+}
+
+func printContainerdImages(out io.Writer, title string, images []containerd.Image) {
+	if len(images) == 0 {
+		return
+	}
+	fmt.Fprintf(out, "\n%s:\n", title)
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintln(w, "  IMAGE ID\tREFS\tSIZE\tUSED BY")
+	for _, image := range images {
+		usedBy := strings.Join(image.UsedBy, ", ")
+		if image.IsPinned() {
+			usedBy = "pinned"
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", image.ID, valueOrDash(strings.Join(image.Refs, ", ")), units.HumanSize(float64(image.Size)), valueOrDash(usedBy))
+	}
+}
+
+func printRegistryImages(out io.Writer, title string, images []zot.PrunedImage) {
+	if len(images) == 0 {
+		return
+	}
+	fmt.Fprintf(out, "\n%s:\n", title)
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintln(w, "  REPO\tTAGS\tDIGEST\tSIZE")
+	for _, image := range images {
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", image.Repo, strings.Join(image.Tags, ", "), image.Digest, units.HumanSize(float64(image.Size)))
+	}
+}
+
+func init() {
+	RootCommand.AddCommand(NewImagesCmd())
+}
@@ -21,29 +21,63 @@ type InstallFlags struct {
 func NewInstallCmd() *cobra.Command {
 	flags := &InstallFlags{}
 	var nonInteractive bool
+	var plan bool
+	var configPath string
+	var output string
 
 	cmd := &cobra.Command{
 		Use:   "install",
 		Short: InstallCmdDescription,
 		Long:  InstallCmdDescription,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			// Set non-interactive mode via environment variable
-			// This signals to use defaults and skip prompts
-			if nonInteractive {
-				os.Setenv("TL_USE_DEFAULT_OPTION", "true")
-			}
-
-			_, err := server.InitDataDirFunc(cmd.Context(), flags.DataDir)
-			if err != nil {
-				return err
-			}
-			_, err = RunInstallCmd(cmd, flags)
-			return err
+			return runWithOutput(cmd, output, func() (interface{}, error) {
+				if configPath != "" {
+					cfg, err := server.LoadInstallConfig(configPath)
+					if err != nil {
+						return nil, err
+					}
+					if err := server.ApplyInstallConfig(cmd.Flags(), cfg); err != nil {
+						return nil, err
+					}
+					// only a config install is validated strictly, a plain install normalizes its flags while it prompts for them
+					if err := server.ValidateInstallFlags(&flags.InstallFlags, &flags.InstallationSourceFlags); err != nil {
+						return nil, err
+					}
+					// the config file is the answer to every prompt
+					nonInteractive = true
+				}
+
+				// Set non-interactive mode via environment variable
+				// This signals to use defaults and skip prompts
+				if nonInteractive {
+					os.Setenv("TL_USE_DEFAULT_OPTION", "true")
+				}
+
+				if plan {
+					if err := initPlanRun(cmd, flags.DataDir); err != nil {
+						return nil, err
+					}
+					installPlan, err := RunInstallPlanCmd(cmd, flags)
+					if err == nil && output == OutputText {
+						printInstallPlan(cmd.OutOrStdout(), installPlan)
+					}
+					return installPlan, err
+				}
+
+				_, err := server.InitDataDirFunc(cmd.Context(), flags.DataDir)
+				if err != nil {
+					return nil, err
+				}
+				return RunInstallCmd(cmd, flags)
+			})
 		},
 	}
 
 	flags.SetFlags(cmd)
 	cmd.Flags().BoolVarP(&nonInteractive, "yes", "y", false, "Run in non-interactive mode (skip prompts)")
+	cmd.Flags().BoolVar(&plan, "plan", false, planFlagUsage)
+	cmd.Flags().StringVar(&configPath, "config", "", "Install config file (see `leap server config validate --help`), flags given on the command line take precedence; implies --yes")
+	addOutputFlag(cmd, &output)
 
 	return cmd
 }
@@ -76,7 +110,7 @@ func RunInstallCmd(cmd *cobra.Command, flags *InstallFlags) (*server.Installatio
 	}
 
 	// Pre-check reinstall before loading heavy assets (airgap images / chart downloads)
-	mnf, _, err := server.LoadManifestOnly(&flags.InstallationSourceFlags, previousMnf)
+	mnf, _, err := server.LoadManifestOnly(&flags.InstallationSourceFlags, previousMnf, false)
 	if err != nil {
 		return nil, err
 	}
@@ -90,7 +124,9 @@ func RunInstallCmd(cmd *cobra.Command, flags *InstallFlags) (*server.Installatio
 		return nil, err
 	}
 
-	mnf, isAirgap, infraChart, serverChart, err := server.InitInstallationProcess(&flags.InstallationSourceFlags, previousMnf, false)
+	endLoadPhase := log.StartPhase("Loading installation assets")
+	mnf, isAirgap, infraChart, serverChart, err := server.InitInstallationProcess(cmd.Context(), &flags.InstallationSourceFlags, previousMnf, false, installationParams)
+	endLoadPhase()
 	if err != nil {
 		return nil, err
 	}
@@ -101,7 +137,9 @@ func RunInstallCmd(cmd *cobra.Command, flags *InstallFlags) (*server.Installatio
 
 	log.SendCloudReport("info", "Starting install", "Starting", &map[string]interface{}{"manifest": mnf})
 
-	err = k3d.CheckDockerRequirements(mnf.Images.CheckDockerRequirement, isAirgap)
+	err = log.TimePhase("Checking docker requirements", func() error {
+		return k3d.CheckDockerRequirements(ctx, mnf.Images.CheckDockerRequirement, isAirgap)
+	})
 	if err != nil {
 		log.SendCloudReport("error", "Docker requirements not met", "Failed",
 			&map[string]interface{}{"error": err.Error()})
@@ -116,19 +154,19 @@ func RunInstallCmd(cmd *cobra.Command, flags *InstallFlags) (*server.Installatio
 		result, err = server.Reinstall(ctx, mnf, isAirgap, installationParams, infraChart, serverChart)
 		if err != nil {
 			log.SendCloudReport("error", "Failed reinstall", "Failed",
-				&map[string]interface{}{"error": err.Error()})
+				local.ReportTimeline(map[string]interface{}{"error": err.Error()}))
 			return nil, err
 		}
 	} else {
 		result, err = server.Install(ctx, mnf, isAirgap, installationParams, infraChart, serverChart)
 		if err != nil {
 			log.SendCloudReport("error", "Failed installation", "Failed",
-				&map[string]interface{}{"error": err.Error()})
+				local.ReportTimeline(map[string]interface{}{"error": err.Error()}))
 			return nil, err
 		}
 	}
 
-	log.SendCloudReport("info", "Successfully completed installation", "Success", nil)
+	log.SendCloudReport("info", "Successfully completed installation", "Success", local.ReportTimeline(nil))
 	log.Info("Successfully completed installation")
 
 	log.Infof("You can now access Tensorleap at %s", result.ServerURL)
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/tensorleap/helm-charts/pkg/log"
+	"github.com/tensorleap/helm-charts/pkg/server"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+const (
+	OutputText = "text"
+	OutputJSON = "json"
+	OutputYAML = "yaml"
+)
+
+func addOutputFlag(cmd *cobra.Command, output *string) {
+	cmd.Flags().StringVarP(output, "output", "o", OutputText, fmt.Sprintf("Output format (%s|%s|%s)", OutputText, OutputJSON, OutputYAML))
+}
+
+func validateOutputFormat(output string) error {
+	switch output {
+	case OutputText, OutputJSON, OutputYAML:
+		return nil
+	}
+	return fmt.Errorf("invalid output format '%s', expected one of: %s, %s, %s", output, OutputText, OutputJSON, OutputYAML)
+}
+
+func printJSON(w io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// printYAML uses the json tags of v, so both formats have the same field names
+func printYAML(w io.Writer, v interface{}) error {
+	data, err := sigsyaml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func printOutput(w io.Writer, output string, v interface{}) error {
+	if output == OutputYAML {
+		return printYAML(w, v)
+	}
+	return printJSON(w, v)
+}
+
+type commandErrorOutput struct {
+	Error *server.CommandError `json:"error"`
+}
+
+// runWithOutput runs a command that prints its result as json or yaml on stdout.
+// In these formats nothing else is written to stdout: logs, prompts and stray prints go to stderr,
+// and prompts take their defaults since there is no one to answer them.
+// A failure is printed as an error object with a category, and still returned for the exit code.
+func runWithOutput(cmd *cobra.Command, output string, run func() (interface{}, error)) error {
+	if err := validateOutputFormat(output); err != nil {
+		return err
+	}
+	if output == OutputText {
+		_, err := run()
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	stdout := os.Stdout
+	os.Stdout = os.Stderr
+	log.VerboseLoggerOutputs.Replace(stdout, os.Stderr)
+	defer func() {
+		os.Stdout = stdout
+		log.VerboseLoggerOutputs.Replace(os.Stderr, stdout)
+	}()
+	os.Setenv("TL_USE_DEFAULT_OPTION", "true")
+
+	result, err := run()
+	if err != nil {
+		cmd.SilenceUsage = true
+		if printErr := printOutput(out, output, commandErrorOutput{Error: server.NewCommandError(err)}); printErr != nil {
+			log.Warnf("Failed to print the error: %v", printErr)
+		}
+		return err
+	}
+	return printOutput(out, output, result)
+}
+
+// installedServerResult describes the installed server, for commands that don't install anything
+func installedServerResult() (*server.InstallationResult, error) {
+	params, err := server.LoadInstallationParamsFromPrevious()
+	if err == server.ErrNoInstallationParams {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return params.GetInstallationResult(), nil
+}
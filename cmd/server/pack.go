@@ -1,9 +1,13 @@
 package server
 
 import (
+	"fmt"
+	"io"
 	"os"
 	"path"
 
+	"github.com/docker/go-units"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/spf13/cobra"
 	"github.com/tensorleap/helm-charts/pkg/log"
 	"github.com/tensorleap/helm-charts/pkg/server/airgap"
@@ -15,15 +19,47 @@ func NewPackInstallationCmd() *cobra.Command {
 	var tag string
 	var local bool
 	var localDir string
+	var splitSize string
+	var since string
+	var imageFormat string
+	var platform string
 
 	cmd := &cobra.Command{
 		Use:     "pack-installation [installConfigPath]",
 		Aliases: []string{"pack"},
 		Short:   "Pack an air-gap installation of Tensorleap",
-		Long:    `Pack an air-gap installation of Tensorleap`,
+		Long: `Pack an air-gap installation of Tensorleap
+  With --split-size the pack is written as numbered parts (<output>.part001, ...) of at most that size,
+  listed in the SHA256SUMS index next to them, the entries of other files in it are kept. Install it by passing
+  the first part, or the index when it lists only this pack, to --airgap.
+  With --since (a previous manifest.yaml or tag) a delta pack is written, holding only the images and charts the
+  previous version does not have. It installs over that version, whose images must still be in docker or in the registry.
+  Images are fetched from their registries into an OCI image layout in the pack, storing shared layers once, so no
+  docker daemon is needed. Use --image-format docker to save them with docker for installers older than this format.
+    `,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			var mnf *manifest.InstallationManifest
 			var err error
+			var partSize int64
+			packOpts := airgap.PackOptions{}
+			switch imageFormat {
+			case "oci":
+			case "docker":
+				packOpts.DockerArchive = true
+			default:
+				return fmt.Errorf("invalid --image-format %s, expected oci or docker", imageFormat)
+			}
+			imagePlatform, err := v1.ParsePlatform(platform)
+			if err != nil {
+				return fmt.Errorf("invalid --platform %s: %w", platform, err)
+			}
+			packOpts.Platform = *imagePlatform
+			if splitSize != "" {
+				partSize, err = units.RAMInBytes(splitSize)
+				if err != nil {
+					return fmt.Errorf("invalid --split-size %s: %w", splitSize, err)
+				}
+			}
 			if len(args) > 0 {
 				installConfigPath := args[0]
 				mnf, err = manifest.Load(installConfigPath)
@@ -43,18 +79,44 @@ func NewPackInstallationCmd() *cobra.Command {
 					return err
 				}
 			}
+			if since != "" {
+				packOpts.Base, err = loadBaseManifest(since)
+				if err != nil {
+					return err
+				}
+			}
+			packMnf := func(outputFile io.Writer) error {
+				return airgap.Pack(mnf, outputFile, packOpts)
+			}
+
 			err = os.MkdirAll(path.Dir(output), 0755)
 			if err != nil {
 				return err
 			}
 
+			if partSize > 0 {
+				splitWriter, err := airgap.NewSplitWriter(output, partSize)
+				if err != nil {
+					return err
+				}
+				err = packMnf(splitWriter)
+				if closeErr := splitWriter.Close(); err == nil {
+					err = closeErr
+				}
+				if err != nil {
+					return err
+				}
+				log.Infof("Successfully pack air-gap installation, install it with --airgap %s", splitWriter.IndexPath())
+				return nil
+			}
+
 			outputFile, err := os.Create(output)
 			if err != nil {
 				return err
 			}
 			defer outputFile.Close()
 
-			err = airgap.Pack(mnf, outputFile)
+			err = packMnf(outputFile)
 			if err != nil {
 				return err
 			}
@@ -67,9 +129,21 @@ func NewPackInstallationCmd() *cobra.Command {
 	cmd.Flags().StringVarP(&output, "output", "o", "pack.tar", "Output file path")
 	cmd.Flags().BoolVarP(&local, "local", "l", false, "Build manifest from local helm charts (current directory)")
 	cmd.Flags().StringVar(&localDir, "local-dir", "", "Build manifest from local helm charts at the specified directory path")
+	cmd.Flags().StringVar(&splitSize, "split-size", "", "Split the pack into parts of at most this size (e.g. 4G) with a SHA256SUMS index")
+	cmd.Flags().StringVar(&imageFormat, "image-format", "oci", "How images are stored in the pack: oci (fetched from the registries, no docker needed) or docker (docker save)")
+	cmd.Flags().StringVar(&platform, "platform", "linux/amd64", "Platform of the images fetched into an oci pack")
+	cmd.Flags().StringVar(&since, "since", "", "Pack only what changed since this manifest.yaml path or tag")
 	return cmd
 }
 
+// loadBaseManifest loads the manifest a delta pack is based on, from a manifest file or else by its tag
+func loadBaseManifest(since string) (*manifest.InstallationManifest, error) {
+	if _, err := os.Stat(since); err == nil {
+		return manifest.Load(since)
+	}
+	return manifest.GetByTag(since)
+}
+
 func init() {
 	RootCommand.AddCommand(NewPackInstallationCmd())
 }
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/tensorleap/helm-charts/pkg/local"
+	"github.com/tensorleap/helm-charts/pkg/log"
+	"github.com/tensorleap/helm-charts/pkg/server"
+	"github.com/tensorleap/helm-charts/pkg/server/manifest"
+)
+
+const planFlagUsage = "Print what would change without changing anything"
+
+// initPlanRun points at the data dir without transferring data, and makes the plan take the default answers and
+// send no reports
+func initPlanRun(cmd *cobra.Command, dataDirFlag string) error {
+	os.Setenv("TL_USE_DEFAULT_OPTION", "true")
+	log.DisableReporting()
+	return server.InitDataDirNoTransferFunc(cmd.Context(), dataDirFlag)
+}
+
+// RunInstallPlanCmd resolves the install like RunInstallCmd does and returns what it would change
+func RunInstallPlanCmd(cmd *cobra.Command, flags *InstallFlags) (*server.InstallPlan, error) {
+	flags.BeforeRun(cmd)
+	log.SetCommandName("install")
+
+	previousMnf, err := manifest.Load(local.GetInstallationManifestPath())
+	if err != nil && err != manifest.ErrManifestNotFound {
+		return nil, err
+	}
+	installationParams, err := server.InitInstallationParamsFromFlags(&flags.InstallFlags, flags.IsAirGap())
+	if err != nil {
+		return nil, err
+	}
+	mnf, _, err := server.LoadManifestOnly(&flags.InstallationSourceFlags, previousMnf, false)
+	if err != nil {
+		return nil, err
+	}
+	previousParams, _ := server.LoadInstallationParamsFromPrevious()
+
+	return server.PlanInstallation(cmd.Context(), mnf, previousMnf, installationParams, previousParams)
+}
+
+// RunUpgradePlanCmd resolves the upgrade like RunUpgradeCmd does and returns what it would change
+func RunUpgradePlanCmd(cmd *cobra.Command, flags *UpgradeFlags) (*server.InstallPlan, error) {
+	log.SetCommandName("upgrade")
+
+	installationParams, _, err := server.InitInstallationParamsFromPreviousOrAsk()
+	if err != nil {
+		return nil, err
+	}
+	previousMnf, err := manifest.Load(local.GetInstallationManifestPath())
+	if err != nil && err != manifest.ErrManifestNotFound {
+		return nil, err
+	}
+	mnf, _, err := server.LoadManifestOnly(&flags.InstallationSourceFlags, previousMnf, true)
+	if err != nil {
+		return nil, err
+	}
+	previousParams, _ := server.LoadInstallationParamsFromPrevious()
+
+	return server.PlanInstallation(cmd.Context(), mnf, previousMnf, installationParams, previousParams)
+}
+
+func printInstallPlan(out io.Writer, plan *server.InstallPlan) {
+	clusterState := "not created"
+	if plan.ClusterRunning {
+		clusterState = "running"
+	} else if plan.ClusterExists {
+		clusterState = "stopped"
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Tag:\t%s -> %s\n", valueOrDash(plan.FromTag), plan.ToTag)
+	fmt.Fprintf(w, "App version:\t%s -> %s\n", valueOrDash(plan.FromAppVersion), plan.ToAppVersion)
+	fmt.Fprintf(w, "K3s image:\t%s -> %s\n", valueOrDash(plan.FromK3sImage), plan.ToK3sImage)
+	fmt.Fprintf(w, "Cluster:\t%s\n", clusterState)
+	w.Flush()
+
+	fmt.Fprintln(out, "\nReleases:")
+	w = tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  NAME\tFROM\tTO\tACTION")
+	for _, release := range plan.Releases {
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", release.Name, valueOrDash(release.FromVersion), release.ToVersion, release.Action)
+	}
+	w.Flush()
+
+	printFieldChanges(out, "Cluster params changes", plan.ClusterParamsChanges)
+	printFieldChanges(out, "Infra helm values changes", plan.InfraValuesChanges)
+
+	fmt.Fprintf(out, "\nImages to download (%d):\n", len(plan.ImagesToDownload))
+	for _, image := range plan.ImagesToDownload {
+		fmt.Fprintf(out, "  %s\n", image)
+	}
+
+	if plan.Reinstall {
+		fmt.Fprintln(out, "\nReinstall required (running jobs will be stopped), because:")
+		for _, reason := range plan.ReinstallReasons {
+			fmt.Fprintf(out, "  - %s\n", reason)
+		}
+	} else {
+		fmt.Fprintln(out, "\nReinstall required: no")
+	}
+
+	if len(plan.Warnings) > 0 {
+		fmt.Fprintln(out, "\nWarnings:")
+		for _, warning := range plan.Warnings {
+			fmt.Fprintf(out, "  - %s\n", warning)
+		}
+	}
+}
+
+func printFieldChanges(out io.Writer, title string, changes []server.FieldChange) {
+	if len(changes) == 0 {
+		fmt.Fprintf(out, "\n%s: none\n", title)
+		return
+	}
+	fmt.Fprintf(out, "\n%s:\n", title)
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  FIELD\tFROM\tTO")
+	for _, change := range changes {
+		fmt.Fprintf(w, "  %s\t%s\t%s\n", change.Field, valueOrDash(change.From), valueOrDash(change.To))
+	}
+	w.Flush()
+}
@@ -0,0 +1,417 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	units "github.com/docker/go-units"
+	"github.com/spf13/cobra"
+	"github.com/tensorleap/helm-charts/pkg/local"
+	"github.com/tensorleap/helm-charts/pkg/log"
+	"github.com/tensorleap/helm-charts/pkg/server"
+	"github.com/tensorleap/helm-charts/pkg/zot"
+)
+
+func NewRegistryCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "registry",
+		Short: "Manage the images in the in-cluster registry",
+		Long: `Manage the images in the in-cluster Zot registry
+  Images are referenced as <repo>:<tag>, a registry host prefix (e.g. tensorleap-registry:5000/) is ignored.
+  The server must be running.
+    `,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := server.InitDataDirFunc(cmd.Context(), ""); err != nil {
+				return err
+			}
+			return server.CheckRegistryReachable()
+		},
+	}
+	cmd.AddCommand(newRegistryLsCmd())
+	cmd.AddCommand(newRegistryTagsCmd())
+	cmd.AddCommand(newRegistryInspectCmd())
+	cmd.AddCommand(newRegistryRmCmd())
+	cmd.AddCommand(newRegistryPushCmd())
+	cmd.AddCommand(newRegistryUsageCmd())
+	cmd.AddCommand(newRegistryRetentionCmd())
+	return cmd
+}
+
+func newRegistryLsCmd() *cobra.Command {
+	var output string
+	cmd := &cobra.Command{
+		Use:   "ls",
+		Short: "List the repositories and their tags",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := validateOutputFormat(output); err != nil {
+				return err
+			}
+			registryURL := server.GetRegistryURL()
+			repoNames, err := zot.ListRepos(registryURL)
+			if err != nil {
+				return err
+			}
+			repos := []registryRepo{}
+			for _, name := range repoNames {
+				tags, err := zot.ListTags(registryURL, name)
+				if err != nil {
+					return err
+				}
+				repos = append(repos, registryRepo{Repo: name, Tags: tags})
+			}
+			if output != OutputText {
+				return printOutput(cmd.OutOrStdout(), output, repos)
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			defer w.Flush()
+			fmt.Fprintln(w, "REPO\tTAGS")
+			for _, repo := range repos {
+				fmt.Fprintf(w, "%s\t%s\n", repo.Repo, strings.Join(repo.Tags, ", "))
+			}
+			return nil
+		},
+	}
+	addOutputFlag(cmd, &output)
+	return cmd
+}
+
+type registryRepo struct {
+	Repo string   `json:"repo"`
+	Tags []string `json:"tags"`
+}
+
+func newRegistryTagsCmd() *cobra.Command {
+	var output string
+	cmd := &cobra.Command{
+		Use:   "tags <repo>",
+		Short: "List the tags of a repository with their digests and sizes",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := validateOutputFormat(output); err != nil {
+				return err
+			}
+			registryURL := server.GetRegistryURL()
+			tags, err := zot.ListTags(registryURL, args[0])
+			if err != nil {
+				return err
+			}
+			images := []*zot.ImageInfo{}
+			for _, tag := range tags {
+				info, err := zot.InspectImage(registryURL, args[0], tag)
+				if err != nil {
+					return err
+				}
+				images = append(images, info)
+			}
+			if output != OutputText {
+				return printOutput(cmd.OutOrStdout(), output, images)
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			defer w.Flush()
+			fmt.Fprintln(w, "TAG\tDIGEST\tSIZE")
+			for _, info := range images {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", info.Tag, info.Digest, units.HumanSize(float64(info.Size)))
+			}
+			return nil
+		},
+	}
+	addOutputFlag(cmd, &output)
+	return cmd
+}
+
+func newRegistryInspectCmd() *cobra.Command {
+	var output string
+	cmd := &cobra.Command{
+		Use:   "inspect <repo>:<tag>",
+		Short: "Show the digest, platforms and layers of an image",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := validateOutputFormat(output); err != nil {
+				return err
+			}
+			repo, tag, err := zot.ParseRef(args[0])
+			if err != nil {
+				return err
+			}
+			info, err := zot.InspectImage(server.GetRegistryURL(), repo, tag)
+			if err != nil {
+				return err
+			}
+			if output != OutputText {
+				return printOutput(cmd.OutOrStdout(), output, info)
+			}
+			printImageInfo(cmd.OutOrStdout(), info)
+			return nil
+		},
+	}
+	addOutputFlag(cmd, &output)
+	return cmd
+}
+
+func printImageInfo(out io.Writer, info *zot.ImageInfo) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Image:\t%s:%s\n", info.Repo, info.Tag)
+	fmt.Fprintf(w, "Pull name:\t%s/%s:%s\n", zot.InClusterRegistryHost, info.Repo, info.Tag)
+	fmt.Fprintf(w, "Digest:\t%s\n", info.Digest)
+	fmt.Fprintf(w, "Media type:\t%s\n", info.MediaType)
+	fmt.Fprintf(w, "Size:\t%s\n", units.HumanSize(float64(info.Size)))
+	w.Flush()
+
+	for _, platform := range info.Platforms {
+		title := "Layers"
+		if platform.Platform != "" {
+			title = fmt.Sprintf("Platform %s (%s)", platform.Platform, platform.Digest)
+		}
+		fmt.Fprintf(out, "\n%s:\n", title)
+		w = tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		for _, layer := range platform.Layers {
+			fmt.Fprintf(w, "  %s\t%s\n", layer.Digest, units.HumanSize(float64(layer.Size)))
+		}
+		w.Flush()
+	}
+}
+
+func newRegistryRmCmd() *cobra.Command {
+	var force bool
+	cmd := &cobra.Command{
+		Use:   "rm <repo>:<tag>...",
+		Short: "Delete image tags from the registry",
+		Long: `Delete image tags from the registry
+  Tags sharing their digest with another tag of the repo are not deleted, since deleting a digest deletes all its tags.
+  Images of the installed version are only deleted with --force. The space is reclaimed by the registry garbage collection.
+    `,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.SetCommandName("registry-rm")
+			registryURL := server.GetRegistryURL()
+			failed := 0
+			for _, ref := range args {
+				repo, tag, err := zot.ParseRef(ref)
+				if err != nil {
+					return err
+				}
+				if !force && server.IsManifestImageRef(repo, tag) {
+					log.Warnf("Not deleting %s:%s, it is an image of the installed version (use --force to delete it anyway)", repo, tag)
+					failed++
+					continue
+				}
+				if err := zot.DeleteTag(registryURL, repo, tag); err != nil {
+					log.Warnf("Not deleting %s:%s: %v", repo, tag, err)
+					failed++
+					continue
+				}
+				log.Infof("Deleted %s:%s", repo, tag)
+			}
+			if failed > 0 {
+				cmd.SilenceUsage = true
+				return fmt.Errorf("%d of %d images were not deleted", failed, len(args))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&force, "force", false, "Also delete images of the installed version")
+	return cmd
+}
+
+func newRegistryPushCmd() *cobra.Command {
+	var as string
+	cmd := &cobra.Command{
+		Use:   "push <local-image>",
+		Short: "Push a local docker image into the registry",
+		Long: `Push a local docker image into the registry
+  The image is stored under its repo and tag without the registry host, unless --as is given,
+  and pods pull it as tensorleap-registry:5000/<repo>:<tag>.
+    `,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.SetCommandName("registry-push")
+			ref := args[0]
+			if as != "" {
+				ref = as
+			}
+			repo, tag, err := zot.ParseRef(ref)
+			if err != nil {
+				return err
+			}
+			pullName, err := server.PushImageToRegistry(cmd.Context(), args[0], repo, tag)
+			if err != nil {
+				return err
+			}
+			log.Infof("Pushed, pods can use the image %s", pullName)
+			fmt.Fprintln(cmd.OutOrStdout(), pullName)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&as, "as", "", "Repo and tag to store the image as, e.g. tensorleap/engine-generic:my-build")
+	return cmd
+}
+
+func newRegistryUsageCmd() *cobra.Command {
+	var output string
+	cmd := &cobra.Command{
+		Use:   "usage",
+		Short: "Report the disk usage of each repository",
+		Long: `Report the disk usage of each repository, largest first
+  Layers shared between repositories are counted in each of them, the total counts them once.
+    `,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := validateOutputFormat(output); err != nil {
+				return err
+			}
+			usage, err := zot.GetUsage(server.GetRegistryURL())
+			if err != nil {
+				return err
+			}
+			if output != OutputText {
+				return printOutput(cmd.OutOrStdout(), output, usage)
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			defer w.Flush()
+			fmt.Fprintln(w, "REPO\tTAGS\tSIZE")
+			for _, repo := range usage.Repos {
+				fmt.Fprintf(w, "%s\t%d\t%s\n", repo.Repo, repo.Tags, units.HumanSize(float64(repo.Size)))
+			}
+			fmt.Fprintf(w, "TOTAL\t\t%s\n", units.HumanSize(float64(usage.TotalSize)))
+			return nil
+		},
+	}
+	addOutputFlag(cmd, &output)
+	return cmd
+}
+
+func newRegistryRetentionCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "retention",
+		Short: "Manage the retention policy of the preserved engine-generic images",
+		Long: `Manage the retention policy of the preserved engine-generic images
+  Custom engine-generic builds are never removed by the prune, the retention policy limits how many of them are kept.
+  The policy is applied after every install and by 'images prune', images used by the installed version or by
+  running pods are never deleted.
+    `,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			_, err := server.InitDataDirFunc(cmd.Context(), "")
+			return err
+		},
+	}
+	cmd.AddCommand(newRegistryRetentionShowCmd())
+	cmd.AddCommand(newRegistryRetentionSetCmd())
+	cmd.AddCommand(newRegistryRetentionApplyCmd())
+	return cmd
+}
+
+func newRegistryRetentionShowCmd() *cobra.Command {
+	var output string
+	cmd := &cobra.Command{
+		Use:   "show",
+		Short: "Show the retention policy",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := validateOutputFormat(output); err != nil {
+				return err
+			}
+			policy, err := server.GetRegistryRetention()
+			if err != nil {
+				return err
+			}
+			if output != OutputText {
+				return printOutput(cmd.OutOrStdout(), output, policy)
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), policy.String())
+			return nil
+		},
+	}
+	addOutputFlag(cmd, &output)
+	return cmd
+}
+
+func newRegistryRetentionSetCmd() *cobra.Command {
+	policy := zot.RetentionPolicy{}
+	var clear bool
+	cmd := &cobra.Command{
+		Use:   "set",
+		Short: "Set the retention policy",
+		Long: `Set the retention policy, limits that are not given keep their current value
+  An image exceeding any of the limits is deleted, 0 removes a limit and --clear removes the policy.
+    `,
+		Example: "  leap server registry retention set --keep-last 5 --max-age-days 30",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.SetCommandName("registry-retention-set")
+			current, err := server.GetRegistryRetention()
+			if err != nil {
+				return err
+			}
+			if clear {
+				current = &zot.RetentionPolicy{}
+			}
+			if cmd.Flags().Changed("keep-last") {
+				current.KeepLast = policy.KeepLast
+			}
+			if cmd.Flags().Changed("max-age-days") {
+				current.MaxAgeDays = policy.MaxAgeDays
+			}
+			if cmd.Flags().Changed("max-size-gb") {
+				current.MaxSizeGb = policy.MaxSizeGb
+			}
+			if err := server.SaveRegistryRetention(*current); err != nil {
+				return err
+			}
+			log.Infof("Registry retention policy: %s", current.String())
+			return nil
+		},
+	}
+	cmd.Flags().UintVar(&policy.KeepLast, "keep-last", 0, "Keep the N most recent images of each repo")
+	cmd.Flags().UintVar(&policy.MaxAgeDays, "max-age-days", 0, "Keep the images created in the last N days")
+	cmd.Flags().UintVar(&policy.MaxSizeGb, "max-size-gb", 0, "Keep the most recent images of each repo that fit in N GiB")
+	cmd.Flags().BoolVar(&clear, "clear", false, "Remove the current policy")
+	return cmd
+}
+
+func newRegistryRetentionApplyCmd() *cobra.Command {
+	var dryRun bool
+	var output string
+	cmd := &cobra.Command{
+		Use:   "apply",
+		Short: "Delete the preserved images exceeding the retention policy",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := validateOutputFormat(output); err != nil {
+				return err
+			}
+			log.SetCommandName("registry-retention-apply")
+			close, err := local.SetupInfra("registry-retention-apply")
+			if err != nil {
+				return err
+			}
+			defer close()
+
+			report, err := server.RunRegistryRetention(cmd.Context(), dryRun)
+			if err != nil {
+				return err
+			}
+			if output != OutputText {
+				return printOutput(cmd.OutOrStdout(), output, report)
+			}
+			removedTitle := "Removed"
+			if dryRun {
+				removedTitle = "Would remove"
+			}
+			printRegistryImages(cmd.OutOrStdout(), removedTitle, report.Removed)
+			printRegistryImages(cmd.OutOrStdout(), "Used by the installed version or running pods, kept", report.InUse)
+			printRegistryImages(cmd.OutOrStdout(), "Creation time unknown, skipped", report.Skipped)
+			fmt.Fprintf(cmd.OutOrStdout(), "\n%d removed, %s reclaimed\n", len(report.Removed), units.HumanSize(float64(report.ReclaimedBytes)))
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Only report what would be removed")
+	addOutputFlag(cmd, &output)
+	return cmd
+}
+
+func init() {
+	RootCommand.AddCommand(NewRegistryCmd())
+}
@@ -18,29 +18,32 @@ type ReinstallFlags struct {
 func NewReinstallCmd() *cobra.Command {
 	flags := &ReinstallFlags{}
 	var nonInteractive bool
+	var output string
 
 	cmd := &cobra.Command{
 		Use:   "reinstall",
 		Short: "Reinstall tensorleap",
 		Long:  "Reinstall tensorleap",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			// Set non-interactive mode via environment variable
-			// This signals to use defaults and skip prompts
-			if nonInteractive {
-				os.Setenv("TL_USE_DEFAULT_OPTION", "true")
-			}
-
-			isReinstalled, err := server.InitDataDirFunc(cmd.Context(), flags.DataDir)
-			if err != nil {
-				return err
-			}
-			_, err = RunReinstallCmd(cmd, flags, isReinstalled)
-			return err
+			return runWithOutput(cmd, output, func() (interface{}, error) {
+				// Set non-interactive mode via environment variable
+				// This signals to use defaults and skip prompts
+				if nonInteractive {
+					os.Setenv("TL_USE_DEFAULT_OPTION", "true")
+				}
+
+				isReinstalled, err := server.InitDataDirFunc(cmd.Context(), flags.DataDir)
+				if err != nil {
+					return nil, err
+				}
+				return RunReinstallCmd(cmd, flags, isReinstalled)
+			})
 		},
 	}
 
 	flags.SetFlags(cmd)
 	cmd.Flags().BoolVarP(&nonInteractive, "yes", "y", false, "Run in non-interactive mode (skip prompts)")
+	addOutputFlag(cmd, &output)
 	return cmd
 }
 
@@ -71,7 +74,7 @@ func RunReinstallCmd(cmd *cobra.Command, flags *ReinstallFlags, isAlreadyReinsta
 		return nil, err
 	}
 
-	mnf, isAirgap, infraChart, serverChart, err := server.InitInstallationProcess(&flags.InstallationSourceFlags, previousMnf, false)
+	mnf, isAirgap, infraChart, serverChart, err := server.InitInstallationProcess(cmd.Context(), &flags.InstallationSourceFlags, previousMnf, false, installationParams)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/tensorleap/helm-charts/pkg/local"
+	"github.com/tensorleap/helm-charts/pkg/log"
+	"github.com/tensorleap/helm-charts/pkg/server"
+)
+
+func NewRollbackCmd() *cobra.Command {
+	opts := server.RollbackOptions{}
+	var list bool
+	var nonInteractive bool
+
+	cmd := &cobra.Command{
+		Use:   "rollback",
+		Short: "Rollback to a previously installed version",
+		Long: `Rollback to a previously installed version
+  Uses helm rollback on both releases when their target revisions are still in the helm history,
+  upgrades to the previous charts when they are not, and reinstalls the cluster with the previous
+  manifest and params when the cluster configuration changed. Rolling back across app versions requires --backup with a backup
+  taken on the target version, the cluster is then reinstalled and the backup restored before the
+  target version starts.
+    `,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if nonInteractive {
+				os.Setenv("TL_USE_DEFAULT_OPTION", "true")
+			}
+			log.SetCommandName("rollback")
+
+			_, err := server.InitDataDirFunc(cmd.Context(), "")
+			if err != nil {
+				return err
+			}
+
+			close, err := local.SetupInfra("rollback")
+			if err != nil {
+				return err
+			}
+			defer close()
+
+			if list {
+				return printInstallationHistory(cmd)
+			}
+
+			if err := server.ValidateStandaloneDir(); err != nil {
+				return err
+			}
+			plan, err := server.PlanRollback(cmd.Context(), opts)
+			if err != nil {
+				return err
+			}
+
+			log.Infof("Rolling back from tag %s (app version %s) to tag %s (app version %s) using %s",
+				plan.CurrentMnf.Tag, plan.CurrentMnf.AppVersion, plan.TargetMnf.Tag, plan.TargetMnf.AppVersion, plan.Method)
+			if plan.Method == server.RollbackMethodReinstall {
+				isContinue, err := server.AskForReinstall()
+				if err != nil {
+					return err
+				}
+				if !isContinue {
+					return server.ErrReinstallAborted
+				}
+			}
+
+			result, err := server.ExecuteRollback(cmd.Context(), plan)
+			if err != nil {
+				return err
+			}
+			log.Infof("Successfully rolled back to tag %s, you can access Tensorleap at %s", plan.TargetMnf.Tag, result.ServerURL)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.ToTag, "to", "", "Tag to rollback to (default: the previously installed one)")
+	cmd.Flags().StringVar(&opts.BackupPath, "backup", "", "Backup taken on the target version, required when the app version changes")
+	cmd.Flags().StringVar(&opts.AirgapPackPath, "airgap", "", "Installation pack of the target tag, required for airgap installations")
+	cmd.Flags().BoolVar(&list, "list", false, "List the installation history")
+	cmd.Flags().BoolVarP(&nonInteractive, "yes", "y", false, "Run in non-interactive mode (skip prompts)")
+	return cmd
+}
+
+func printInstallationHistory(cmd *cobra.Command) error {
+	entries, err := server.ListInstallationHistory()
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		log.Info("Installation history is empty")
+		return nil
+	}
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintln(w, "REPLACED AT\tTAG\tAPP VERSION")
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", entry.SavedAt.Local().Format("2006-01-02 15:04:05"), entry.Tag, entry.AppVersion)
+	}
+	return nil
+}
+
+func init() {
+	RootCommand.AddCommand(NewRollbackCmd())
+}
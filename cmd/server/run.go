@@ -9,32 +9,37 @@ import (
 )
 
 func NewRunCmd() *cobra.Command {
+	var output string
+
 	cmd := &cobra.Command{
 		Use:     "run",
 		Aliases: []string{"up", "start"},
 		Short:   "Run Tensorleap server",
 		Long:    `Run Tensorleap server`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			log.SetCommandName("run")
+			return runWithOutput(cmd, output, func() (interface{}, error) {
+				log.SetCommandName("run")
 
-			_, err := server.InitDataDirFunc(cmd.Context(), "")
-			if err != nil {
-				return err
-			}
+				_, err := server.InitDataDirFunc(cmd.Context(), "")
+				if err != nil {
+					return nil, err
+				}
 
-			close, err := local.SetupInfra("run")
-			if err != nil {
-				return err
-			}
-			defer close()
+				close, err := local.SetupInfra("run")
+				if err != nil {
+					return nil, err
+				}
+				defer close()
 
-			err = k3d.RunCluster(cmd.Context())
-			if err != nil {
-				return err
-			}
-			return nil
+				err = k3d.RunCluster(cmd.Context())
+				if err != nil {
+					return nil, err
+				}
+				return installedServerResult()
+			})
 		},
 	}
+	addOutputFlag(cmd, &output)
 	return cmd
 }
 
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/tensorleap/helm-charts/pkg/local"
+	"github.com/tensorleap/helm-charts/pkg/log"
+	"github.com/tensorleap/helm-charts/pkg/server"
+)
+
+func NewStatusCmd() *cobra.Command {
+	var output string
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show the status of the local installation",
+		Long:  `Show the installed version, configuration, cluster state, helm releases and workloads readiness`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := validateOutputFormat(output); err != nil {
+				return err
+			}
+			log.SetCommandName("status")
+
+			_, err := server.InitDataDirFunc(cmd.Context(), "")
+			if err != nil {
+				return err
+			}
+
+			close, err := local.SetupInfra("status")
+			if err != nil {
+				return err
+			}
+			defer close()
+
+			status, err := server.GetServerStatus(cmd.Context())
+			if err != nil {
+				return err
+			}
+			if output == OutputJSON {
+				return printJSON(cmd.OutOrStdout(), status)
+			}
+			printServerStatus(cmd.OutOrStdout(), status)
+			return nil
+		},
+	}
+	addOutputFlag(cmd, &output)
+	return cmd
+}
+
+func printServerStatus(out io.Writer, status *server.ServerStatus) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+
+	if !status.Installed {
+		fmt.Fprintln(w, "Tensorleap is not installed, run 'leap server install'")
+	} else {
+		fmt.Fprintf(w, "Tag:\t%s\n", status.Tag)
+		fmt.Fprintf(w, "App version:\t%s\n", status.AppVersion)
+		fmt.Fprintf(w, "Installer version:\t%s\n", status.InstallerVersion)
+	}
+
+	if res := status.Installation; res != nil {
+		fmt.Fprintf(w, "URL:\t%s\n", res.ServerURL)
+		fmt.Fprintf(w, "Airgap:\t%t\n", res.IsAirgap)
+		gpu := "disabled"
+		if res.GpuEnabled {
+			gpu = "enabled"
+			if status.GpuDevices != "" {
+				gpu = fmt.Sprintf("devices %s", status.GpuDevices)
+			} else if status.Gpus > 0 {
+				gpu = fmt.Sprintf("%d gpus", status.Gpus)
+			}
+		}
+		fmt.Fprintf(w, "GPU:\t%s\n", gpu)
+		fmt.Fprintf(w, "Dataset volumes:\t%s\n", strings.Join(res.DatasetVolumes, ", "))
+	}
+
+	clusterState := "not found"
+	if status.Cluster.Exists {
+		clusterState = "stopped"
+		if status.Cluster.Running {
+			clusterState = "running"
+		}
+	}
+	fmt.Fprintf(w, "Cluster:\t%s\n", clusterState)
+
+	if len(status.Releases) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "RELEASE\tVERSION\tMANIFEST VERSION\tREVISION\tSTATUS")
+		for _, r := range status.Releases {
+			state := r.Status
+			if r.Error != "" {
+				state = fmt.Sprintf("error: %s", r.Error)
+			}
+			revision := "-"
+			if r.Revision > 0 {
+				revision = strconv.Itoa(r.Revision)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.Name, valueOrDash(r.Version), r.ManifestVersion, revision, state)
+		}
+	}
+
+	if len(status.Workloads) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "WORKLOAD\tREADY\tSTATUS")
+		for _, wl := range status.Workloads {
+			state := "ready"
+			if !wl.IsReady() {
+				state = "not ready"
+			}
+			fmt.Fprintf(w, "%s/%s\t%d/%d\t%s\n", strings.ToLower(wl.Kind), wl.Name, wl.Ready, wl.Desired, state)
+		}
+	}
+
+	for _, e := range status.Errors {
+		fmt.Fprintf(w, "\nError: %s\n", e)
+	}
+}
+
+func valueOrDash(v string) string {
+	if v == "" {
+		return "-"
+	}
+	return v
+}
+
+func init() {
+	RootCommand.AddCommand(NewStatusCmd())
+}
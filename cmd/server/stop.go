@@ -9,32 +9,37 @@ import (
 )
 
 func NewStopCmd() *cobra.Command {
+	var output string
+
 	cmd := &cobra.Command{
 		Use:     "stop",
 		Aliases: []string{"down"},
 		Short:   "Stop Tensorleap server",
 		Long:    `Stop Tensorleap server`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			log.SetCommandName("stop")
+			return runWithOutput(cmd, output, func() (interface{}, error) {
+				log.SetCommandName("stop")
 
-			_, err := server.InitDataDirFunc(cmd.Context(), "")
-			if err != nil {
-				return err
-			}
+				_, err := server.InitDataDirFunc(cmd.Context(), "")
+				if err != nil {
+					return nil, err
+				}
 
-			close, err := local.SetupInfra("stop")
-			if err != nil {
-				return err
-			}
-			defer close()
+				close, err := local.SetupInfra("stop")
+				if err != nil {
+					return nil, err
+				}
+				defer close()
 
-			err = k3d.StopCluster(cmd.Context())
-			if err != nil {
-				return err
-			}
-			return nil
+				err = k3d.StopCluster(cmd.Context())
+				if err != nil {
+					return nil, err
+				}
+				return installedServerResult()
+			})
 		},
 	}
+	addOutputFlag(cmd, &output)
 	return cmd
 }
 
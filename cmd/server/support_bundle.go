@@ -0,0 +1,69 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tensorleap/helm-charts/pkg/local"
+	"github.com/tensorleap/helm-charts/pkg/log"
+	"github.com/tensorleap/helm-charts/pkg/server"
+)
+
+func NewSupportBundleCmd() *cobra.Command {
+	var filePath string
+	cmd := &cobra.Command{
+		Use:   "support-bundle",
+		Short: "Collect logs and cluster state into an archive for troubleshooting",
+		Long: `Collect logs and cluster state into an archive for troubleshooting
+  Includes installer logs, the installation params (secrets redacted) and manifest, helm values and history,
+  pods, events and PVCs, pod logs, the k3d node logs, containerd images, the registry catalog and docker info.
+  Works without network access.
+    `,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.SetCommandName("support-bundle")
+
+			_, err := server.InitDataDirFunc(cmd.Context(), "")
+			if err != nil {
+				return err
+			}
+
+			close, err := local.SetupInfra("support-bundle")
+			if err != nil {
+				return err
+			}
+			defer close()
+
+			if filePath == "" {
+				filePath = fmt.Sprintf("tensorleap-support-bundle_%s.tar.gz", time.Now().Format("2006-01-02_15-04-05"))
+			}
+			if err := os.MkdirAll(path.Dir(filePath), 0755); err != nil {
+				return err
+			}
+			archiveFile, err := os.Create(filePath)
+			if err != nil {
+				return err
+			}
+
+			err = server.CreateSupportBundle(cmd.Context(), archiveFile)
+			if closeErr := archiveFile.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				// a partial bundle cannot be opened, do not leave it behind
+				_ = os.Remove(filePath)
+				return err
+			}
+			log.Infof("Support bundle saved to %s", filePath)
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&filePath, "file", "f", "", "Archive file path (default tensorleap-support-bundle_<time>.tar.gz)")
+	return cmd
+}
+
+func init() {
+	RootCommand.AddCommand(NewSupportBundleCmd())
+}
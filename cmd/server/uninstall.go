@@ -92,11 +92,11 @@ func RunUninstallCmd(cmd *cobra.Command, flags *UninstallFlags) error {
 
 	err = server.Uninstall(ctx, flags.Purge, flags.Cleanup, flags.ClearData)
 	if err != nil {
-		log.SendCloudReport("error", "Failed to uninstall", "Failed", &map[string]interface{}{"error": err.Error()})
+		log.SendCloudReport("error", "Failed to uninstall", "Failed", local.ReportTimeline(map[string]interface{}{"error": err.Error()}))
 		return err
 	}
 
-	log.SendCloudReport("info", "Successfully completed uninstall", "Success", nil)
+	log.SendCloudReport("info", "Successfully completed uninstall", "Success", local.ReportTimeline(nil))
 	return nil
 }
 
@@ -123,11 +123,11 @@ func runCustomUninstall(ctx context.Context) error {
 
 	log.SendCloudReport("info", "Starting custom uninstall", "Running", &map[string]interface{}{"targets": targets})
 	if err := server.UninstallCustom(ctx, targets); err != nil {
-		log.SendCloudReport("error", "Failed to uninstall", "Failed", &map[string]interface{}{"error": err.Error()})
+		log.SendCloudReport("error", "Failed to uninstall", "Failed", local.ReportTimeline(map[string]interface{}{"error": err.Error()}))
 		return err
 	}
 
-	log.SendCloudReport("info", "Successfully completed uninstall", "Success", nil)
+	log.SendCloudReport("info", "Successfully completed uninstall", "Success", local.ReportTimeline(nil))
 	return nil
 }
 
@@ -19,30 +19,46 @@ type UpgradeFlags struct {
 func NewUpgradeCmd() *cobra.Command {
 	flags := &UpgradeFlags{}
 	var nonInteractive bool
+	var plan bool
+	var output string
 
 	cmd := &cobra.Command{
 		Use:   "upgrade",
 		Short: UpgradeCmdDescription,
 		Long:  UpgradeCmdDescription,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			// Set non-interactive mode via environment variable
-			// This signals to use defaults and skip prompts
-			if nonInteractive {
-				os.Setenv("TL_USE_DEFAULT_OPTION", "true")
-			}
-
-			_, err := server.InitDataDirFunc(cmd.Context(), "")
-			if err != nil {
-				return err
-			}
-
-			_, err = RunUpgradeCmd(cmd, flags)
-			return err
+			return runWithOutput(cmd, output, func() (interface{}, error) {
+				// Set non-interactive mode via environment variable
+				// This signals to use defaults and skip prompts
+				if nonInteractive {
+					os.Setenv("TL_USE_DEFAULT_OPTION", "true")
+				}
+
+				if plan {
+					if err := initPlanRun(cmd, ""); err != nil {
+						return nil, err
+					}
+					upgradePlan, err := RunUpgradePlanCmd(cmd, flags)
+					if err == nil && output == OutputText {
+						printInstallPlan(cmd.OutOrStdout(), upgradePlan)
+					}
+					return upgradePlan, err
+				}
+
+				_, err := server.InitDataDirFunc(cmd.Context(), "")
+				if err != nil {
+					return nil, err
+				}
+
+				return RunUpgradeCmd(cmd, flags)
+			})
 		},
 	}
 
 	flags.SetFlags(cmd)
 	cmd.Flags().BoolVarP(&nonInteractive, "yes", "y", false, "Run in non-interactive mode (skip prompts)")
+	cmd.Flags().BoolVar(&plan, "plan", false, planFlagUsage)
+	addOutputFlag(cmd, &output)
 	return cmd
 }
 
@@ -77,7 +93,9 @@ func RunUpgradeCmd(cmd *cobra.Command, flags *UpgradeFlags) (*server.Installatio
 
 	// upgrade always moves to the latest version (honoring an explicit
 	// --tag if given); never prompt to stay on the current version.
-	mnf, isAirgap, infraChart, serverChart, err := server.InitInstallationProcess(&flags.InstallationSourceFlags, previousMnf, true)
+	endLoadPhase := log.StartPhase("Loading installation assets")
+	mnf, isAirgap, infraChart, serverChart, err := server.InitInstallationProcess(cmd.Context(), &flags.InstallationSourceFlags, previousMnf, true, installationParams)
+	endLoadPhase()
 	if err != nil {
 		return nil, err
 	}
@@ -97,9 +115,10 @@ func RunUpgradeCmd(cmd *cobra.Command, flags *UpgradeFlags) (*server.Installatio
 	if !found {
 		result, err = reinstall()
 		if err != nil {
+			log.SendCloudReport("error", "Failed upgrade", "Failed", local.ReportTimeline(map[string]interface{}{"error": err.Error()}))
 			return nil, err
 		}
-		log.SendCloudReport("info", "Successfully completed upgrade", "Success", nil)
+		log.SendCloudReport("info", "Successfully completed upgrade", "Success", local.ReportTimeline(nil))
 		return result, nil
 	}
 
@@ -112,18 +131,20 @@ func RunUpgradeCmd(cmd *cobra.Command, flags *UpgradeFlags) (*server.Installatio
 		log.SendCloudReport("info", "Reinstall required during upgrade", "Running", nil)
 		result, err = reinstall()
 		if err != nil {
+			log.SendCloudReport("error", "Failed upgrade", "Failed", local.ReportTimeline(map[string]interface{}{"error": err.Error()}))
 			return nil, err
 		}
-		log.SendCloudReport("info", "Successfully completed upgrade", "Success", nil)
+		log.SendCloudReport("info", "Successfully completed upgrade", "Success", local.ReportTimeline(nil))
 		return result, nil
 	}
 
 	result, err = server.Install(ctx, mnf, isAirgap, installationParams, infraChart, serverChart)
 	if err != nil {
+		log.SendCloudReport("error", "Failed upgrade", "Failed", local.ReportTimeline(map[string]interface{}{"error": err.Error()}))
 		return nil, err
 	}
 
-	log.SendCloudReport("info", "Successfully completed upgrade", "Success", nil)
+	log.SendCloudReport("info", "Successfully completed upgrade", "Success", local.ReportTimeline(nil))
 	return result, nil
 }
 
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/tensorleap/helm-charts/pkg/log"
+	"github.com/tensorleap/helm-charts/pkg/server"
+	"github.com/tensorleap/helm-charts/pkg/server/airgap"
+)
+
+func NewVerifyPackCmd() *cobra.Command {
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "verify-pack <file>",
+		Short: "Verify an air-gap installation pack without installing it",
+		Long: `Verify an air-gap installation pack without installing it
+  Checks the checksums of the parts of a split pack, the tar structure, the manifest, that every image of the
+  manifest is in the image archive (without loading it into docker), the helm charts, and that this CLI can
+  install the pack. The file is the pack, or for a split pack its first part or SHA256SUMS index.
+  Exits with an error when a check fails.
+    `,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.SetCommandName("verify-pack")
+			if err := validateOutputFormat(output); err != nil {
+				return err
+			}
+
+			report := server.VerifyPack(args[0])
+			out := cmd.OutOrStdout()
+			if output == OutputText {
+				printVerifyReport(out, report)
+			} else if err := printOutput(out, output, report); err != nil {
+				return err
+			}
+			if !report.Passed {
+				cmd.SilenceUsage = true
+				return server.ErrPackVerificationFailed
+			}
+			return nil
+		},
+	}
+	addOutputFlag(cmd, &output)
+	return cmd
+}
+
+func printVerifyReport(out io.Writer, report *airgap.VerifyReport) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, check := range report.Checks {
+		result := "PASS"
+		if !check.Passed {
+			result = "FAIL"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", result, check.Name, check.Detail)
+	}
+	w.Flush()
+
+	if report.Passed {
+		fmt.Fprintf(out, "\nPack %s passed verification\n", report.Pack)
+	} else {
+		fmt.Fprintf(out, "\nPack %s failed verification\n", report.Pack)
+	}
+}
+
+func init() {
+	RootCommand.AddCommand(NewVerifyPackCmd())
+}
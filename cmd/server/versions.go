@@ -0,0 +1,99 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/tensorleap/helm-charts/pkg/log"
+	"github.com/tensorleap/helm-charts/pkg/server"
+	"gopkg.in/yaml.v3"
+)
+
+func NewVersionsCmd() *cobra.Command {
+	var output string
+	var limit int
+
+	cmd := &cobra.Command{
+		Use:   "versions",
+		Short: "List the Tensorleap versions available to install",
+		Long: `List the Tensorleap versions available to install with --tag, newest first
+  When github can't be reached, the versions known locally (installed, installation history and helm cache) are listed.
+    `,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := validateOutputFormat(output); err != nil {
+				return err
+			}
+			if _, err := server.InitDataDirFunc(cmd.Context(), ""); err != nil {
+				return err
+			}
+
+			versions, offline, err := server.ListAvailableVersions(limit)
+			if err != nil {
+				return err
+			}
+			if output != OutputText {
+				return printOutput(cmd.OutOrStdout(), output, versions)
+			}
+			if offline {
+				log.Warn("Offline, showing only the versions known locally")
+			}
+			printAvailableVersions(cmd.OutOrStdout(), versions)
+			return nil
+		},
+	}
+	cmd.Flags().IntVar(&limit, "limit", 20, "Maximum number of versions to list, 0 for all")
+	addOutputFlag(cmd, &output)
+	cmd.AddCommand(newVersionsShowCmd())
+	return cmd
+}
+
+func newVersionsShowCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "show <tag>",
+		Short: "Print the installation manifest of a version, including its images",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := server.InitDataDirFunc(cmd.Context(), ""); err != nil {
+				return err
+			}
+			mnf, source, err := server.GetVersionManifest(args[0])
+			if err != nil {
+				return err
+			}
+			log.Infof("Manifest of %s (source: %s)", args[0], source)
+			if err := server.ValidateInstallerVersion(mnf.InstallerVersion); mnf.InstallerVersion != "" && err != nil {
+				log.Warnf("This version can't be installed with this CLI: %v", err)
+			}
+			b, err := yaml.Marshal(mnf)
+			if err != nil {
+				return err
+			}
+			_, err = cmd.OutOrStdout().Write(b)
+			return err
+		},
+	}
+}
+
+func printAvailableVersions(out io.Writer, versions []server.AvailableVersion) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintln(w, "TAG\tSERVER CHART\tINFRA CHART\tINSTALLER\tCOMPATIBILITY\tINSTALLED")
+	for _, v := range versions {
+		installed := ""
+		if v.Installed {
+			installed = "*"
+		}
+		compatibility := string(v.Compatibility)
+		if v.Error != "" {
+			compatibility = fmt.Sprintf("error: %s", v.Error)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", v.Tag, valueOrDash(v.ServerChartVersion), valueOrDash(v.InfraChartVersion), valueOrDash(v.InstallerVersion), compatibility, installed)
+	}
+}
+
+func init() {
+	RootCommand.AddCommand(NewVersionsCmd())
+}
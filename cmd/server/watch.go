@@ -0,0 +1,50 @@
+package server
+
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tensorleap/helm-charts/pkg/local"
+	"github.com/tensorleap/helm-charts/pkg/log"
+	"github.com/tensorleap/helm-charts/pkg/server"
+)
+
+func NewWatchCmd() *cobra.Command {
+	opts := server.WatchOptions{}
+	var cleanup bool
+
+	cmd := &cobra.Command{
+		Use:   "watch",
+		Short: "Watch the running server and report problems",
+		Long: `Watch the running server until interrupted, reporting when the cluster node has DiskPressure and when it clears
+  With disk pressure cleanup (--disk-pressure-cleanup, or the setting of the installation) the images not used
+  by the installed version are pruned from containerd and from the registry when the pressure starts.
+    `,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.SetCommandName("watch")
+			if cmd.Flags().Changed("disk-pressure-cleanup") {
+				opts.DiskPressureCleanup = &cleanup
+			}
+
+			if _, err := server.InitDataDirFunc(cmd.Context(), ""); err != nil {
+				return err
+			}
+			close, err := local.SetupInfra("watch")
+			if err != nil {
+				return err
+			}
+			defer close()
+
+			// the command context is canceled on Ctrl-C, see server.NotifyInterrupt
+			return server.Watch(cmd.Context(), opts)
+		},
+	}
+	cmd.Flags().DurationVar(&opts.Interval, "interval", 30*time.Second, "Interval between checks")
+	cmd.Flags().BoolVar(&cleanup, "disk-pressure-cleanup", false, "Prune unused images on DiskPressure, defaults to the setting of the installation")
+	return cmd
+}
+
+func init() {
+	RootCommand.AddCommand(NewWatchCmd())
+}
@@ -1,11 +1,21 @@
 package main
 
 import (
+	"context"
+	"os"
+
 	"github.com/tensorleap/helm-charts/cmd/server"
+	pkgserver "github.com/tensorleap/helm-charts/pkg/server"
 )
 
 func main() {
-	err := server.RootCommand.Execute()
+	ctx, stop := pkgserver.NotifyInterrupt(context.Background())
+	err := server.RootCommand.ExecuteContext(ctx)
+	interrupted := pkgserver.IsInterrupted(ctx)
+	stop()
+	if interrupted {
+		os.Exit(pkgserver.ExitCodeInterrupted)
+	}
 	if err != nil {
 		panic(err)
 	}
@@ -0,0 +1,222 @@
+package containerd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/distribution/reference"
+)
+
+// ContainerRunning is the CRI state of a running container
+const ContainerRunning = "CONTAINER_RUNNING"
+
+// PinnedLabel is the containerd label the CRI plugin sets on pinned images (e.g. pause), they are never pruned
+const PinnedLabel = "io.cri-containerd.pinned"
+
+// Image is an image of the node, as the CRI plugin of containerd reports it
+type Image struct {
+	// ID is the digest of the image config, the same for all the refs of the image
+	ID string `json:"id"`
+	// Refs are the tagged names of the image
+	Refs []string `json:"refs"`
+	// Digest is the manifest digest the image was pulled by, empty for images that were only imported
+	Digest      string   `json:"digest,omitempty"`
+	RepoDigests []string `json:"repoDigests"`
+	Size        int64    `json:"size"`
+	// Labels are the CRI image annotations, with PinnedLabel set for pinned images
+	Labels map[string]string `json:"labels"`
+	// UsedBy are the containers, running or not, created from the image as <pod>/<container>
+	UsedBy []string `json:"usedBy"`
+}
+
+func (image *Image) IsPinned() bool {
+	return image.Labels[PinnedLabel] == "pinned"
+}
+
+func (image *Image) IsInUse() bool {
+	return len(image.UsedBy) > 0
+}
+
+type Container struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Pod     string `json:"pod"`
+	ImageID string `json:"imageId"`
+	State   string `json:"state"`
+}
+
+type Inventory struct {
+	Images     []Image     `json:"images"`
+	Containers []Container `json:"containers"`
+}
+
+// RunningImages returns the images of the running containers
+func (inventory *Inventory) RunningImages() []Image {
+	running := map[string]bool{}
+	for _, container := range inventory.Containers {
+		if container.State == ContainerRunning {
+			running[container.ImageID] = true
+		}
+	}
+	images := []Image{}
+	for _, image := range inventory.Images {
+		if running[image.ID] {
+			images = append(images, image)
+		}
+	}
+	return images
+}
+
+// GetInventory lists the images and containers of the node through crictl's json output
+func GetInventory(ctx context.Context, dockerName string) (*Inventory, error) {
+	imagesJSON, err := crictl(ctx, dockerName, "images", "-o", "json")
+	if err != nil {
+		return nil, err
+	}
+	containersJSON, err := crictl(ctx, dockerName, "ps", "-a", "-o", "json")
+	if err != nil {
+		return nil, err
+	}
+	return ParseInventory(imagesJSON, containersJSON)
+}
+
+func crictl(ctx context.Context, dockerName string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "docker", append([]string{"exec", dockerName, "crictl"}, args...)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("crictl %s: %w\n%s", strings.Join(args, " "), err, stderr.String())
+	}
+	return stdout.Bytes(), nil
+}
+
+type crictlImages struct {
+	Images []struct {
+		ID          string   `json:"id"`
+		RepoTags    []string `json:"repoTags"`
+		RepoDigests []string `json:"repoDigests"`
+		// Size is a uint64 encoded as a string
+		Size string `json:"size"`
+		Spec *struct {
+			Annotations map[string]string `json:"annotations"`
+		} `json:"spec"`
+		Pinned bool `json:"pinned"`
+	} `json:"images"`
+}
+
+type crictlContainers struct {
+	Containers []struct {
+		ID       string `json:"id"`
+		Metadata struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+		Image struct {
+			Image string `json:"image"`
+		} `json:"image"`
+		// ImageRef is the image ID, or a repo digest on newer runtimes
+		ImageRef string            `json:"imageRef"`
+		State    string            `json:"state"`
+		Labels   map[string]string `json:"labels"`
+	} `json:"containers"`
+}
+
+// ParseInventory parses the output of `crictl images -o json` and `crictl ps -a -o json`
+func ParseInventory(imagesJSON, containersJSON []byte) (*Inventory, error) {
+	var rawImages crictlImages
+	if err := json.Unmarshal(imagesJSON, &rawImages); err != nil {
+		return nil, fmt.Errorf("parsing crictl images: %w", err)
+	}
+	var rawContainers crictlContainers
+	if err := json.Unmarshal(containersJSON, &rawContainers); err != nil {
+		return nil, fmt.Errorf("parsing crictl containers: %w", err)
+	}
+
+	inventory := &Inventory{Images: []Image{}, Containers: []Container{}}
+	imageIndex := map[string]int{}
+	for _, raw := range rawImages.Images {
+		image := Image{
+			ID:          strings.ToLower(raw.ID),
+			Refs:        withoutNone(raw.RepoTags),
+			RepoDigests: withoutNone(raw.RepoDigests),
+			Labels:      map[string]string{},
+			UsedBy:      []string{},
+		}
+		if raw.Size != "" {
+			size, err := strconv.ParseInt(raw.Size, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("parsing size of image %s: %w", raw.ID, err)
+			}
+			image.Size = size
+		}
+		if len(image.RepoDigests) > 0 {
+			_, image.Digest, _ = strings.Cut(image.RepoDigests[0], "@")
+		}
+		if raw.Spec != nil {
+			for k, v := range raw.Spec.Annotations {
+				image.Labels[k] = v
+			}
+		}
+		if raw.Pinned {
+			image.Labels[PinnedLabel] = "pinned"
+		}
+		imageIndex[image.ID] = len(inventory.Images)
+		for _, repoDigest := range image.RepoDigests {
+			imageIndex[repoDigest] = len(inventory.Images)
+		}
+		inventory.Images = append(inventory.Images, image)
+	}
+
+	for _, raw := range rawContainers.Containers {
+		container := Container{
+			ID:    raw.ID,
+			Name:  raw.Metadata.Name,
+			Pod:   raw.Labels["io.kubernetes.pod.namespace"] + "/" + raw.Labels["io.kubernetes.pod.name"],
+			State: raw.State,
+		}
+		i, ok := imageIndex[strings.ToLower(raw.ImageRef)]
+		if !ok {
+			i, ok = imageIndex[strings.ToLower(raw.Image.Image)]
+		}
+		if ok {
+			image := &inventory.Images[i]
+			container.ImageID = image.ID
+			image.UsedBy = append(image.UsedBy, container.Pod+"/"+container.Name)
+		} else {
+			container.ImageID = raw.ImageRef
+		}
+		inventory.Containers = append(inventory.Containers, container)
+	}
+
+	for i := range inventory.Images {
+		sort.Strings(inventory.Images[i].UsedBy)
+	}
+	sort.SliceStable(inventory.Images, func(i, j int) bool { return inventory.Images[i].ID < inventory.Images[j].ID })
+	sort.SliceStable(inventory.Containers, func(i, j int) bool { return inventory.Containers[i].ID < inventory.Containers[j].ID })
+	return inventory, nil
+}
+
+// NormalizeRef returns the fully qualified form of an image reference, e.g. alpine:3 -> docker.io/library/alpine:3
+func NormalizeRef(ref string) string {
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return ref
+	}
+	return named.String()
+}
+
+// withoutNone drops the <none> placeholders some runtimes list for untagged images
+func withoutNone(values []string) []string {
+	result := []string{}
+	for _, value := range values {
+		if !strings.Contains(value, "<none>") {
+			result = append(result, value)
+		}
+	}
+	return result
+}
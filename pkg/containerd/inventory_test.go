@@ -0,0 +1,115 @@
+package containerd
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+// loadTestInventory reads the crictl fixtures. They are still hand-written in the schema of `crictl images -o json`
+// and `crictl ps -a -o json`, their ids and digests are not real. They are to be replaced by a capture from a k3s
+// node with `make capture-crictl-fixtures`, which also regenerates the golden file.
+func loadTestInventory(t *testing.T) *Inventory {
+	imagesJSON, err := os.ReadFile(filepath.Join("testdata", "crictl-images.json"))
+	require.NoError(t, err)
+	containersJSON, err := os.ReadFile(filepath.Join("testdata", "crictl-ps.json"))
+	require.NoError(t, err)
+
+	inventory, err := ParseInventory(imagesJSON, containersJSON)
+	require.NoError(t, err)
+	return inventory
+}
+
+func TestParseInventory(t *testing.T) {
+	inventory := loadTestInventory(t)
+
+	got, err := json.MarshalIndent(inventory, "", "  ")
+	require.NoError(t, err)
+	got = append(got, '\n')
+
+	goldenPath := filepath.Join("testdata", "inventory.golden.json")
+	if *update {
+		require.NoError(t, os.WriteFile(goldenPath, got, 0644))
+	}
+	want, err := os.ReadFile(goldenPath)
+	require.NoError(t, err)
+	assert.Equal(t, string(want), string(got))
+}
+
+func TestParseInventoryInvalid(t *testing.T) {
+	_, err := ParseInventory([]byte("IMAGE  TAG  IMAGE ID  SIZE"), []byte(`{"containers": []}`))
+	assert.Error(t, err)
+
+	_, err = ParseInventory([]byte(`{"images": [{"id": "sha256:a", "size": "12MB"}]}`), []byte(`{"containers": []}`))
+	assert.Error(t, err)
+}
+
+func TestParseInventoryUntagged(t *testing.T) {
+	imagesJSON := `{"images": [{"id": "sha256:a", "repoTags": ["<none>:<none>"], "repoDigests": ["<none>@<none>"], "size": "10", "pinned": false}]}`
+	inventory, err := ParseInventory([]byte(imagesJSON), []byte(`{"containers": []}`))
+	require.NoError(t, err)
+	require.Len(t, inventory.Images, 1)
+	assert.Empty(t, inventory.Images[0].Refs)
+	assert.Empty(t, inventory.Images[0].RepoDigests)
+	assert.Empty(t, inventory.Images[0].Digest)
+}
+
+func TestPlanPrune(t *testing.T) {
+	inventory := loadTestInventory(t)
+
+	report := planPrune(inventory, []string{
+		"public.ecr.aws/tensorleap/engine:latest",
+		"mongo:6.0.5",
+	})
+
+	ids := func(images []Image) []string {
+		result := []string{}
+		for _, image := range images {
+			result = append(result, image.ID)
+		}
+		return result
+	}
+	assert.ElementsMatch(t, []string{
+		"sha256:2e2ce6e9b62a0e9f3e8f3ab1d0bd4ac6f1c3e8c21f0d7e5e0b9c7f0a1d4e5f60",
+		"sha256:bb53a6b4fb16f0fc3f0f3ee87b19d7abae1d0e5e6c5c4f9b61fc7c1b0c8d2a17",
+	}, ids(report.Kept))
+	// coredns and redis are running, the old engine has an exited container and pause is pinned
+	assert.ElementsMatch(t, []string{
+		"sha256:6270bb605e12e581514ada5fd5b3216f727db55dc87d5889c790e4c760683fee",
+		"sha256:ead0a4a53df89fd173874b46093b6e62d8c72967bbf606d672c9e8c9b601a4fc",
+		"sha256:9f8e7d6c5b4a39281706f5e4d3c2b1a0f9e8d7c6b5a4938271605f4e3d2c1b0a",
+		"sha256:5a4b3c2d1e0f9a8b7c6d5e4f3a2b1c0d9e8f7a6b5c4d3e2f1a0b9c8d7e6f5a4b",
+	}, ids(report.InUse))
+	assert.Equal(t, []string{
+		"sha256:0c1d2e3f4a5b6c7d8e9f0a1b2c3d4e5f6a7b8c9d0e1f2a3b4c5d6e7f8a9b0c1d",
+	}, ids(report.Removed))
+	assert.Equal(t, int64(2105338880), report.ReclaimedBytes)
+}
+
+func TestRunningImages(t *testing.T) {
+	inventory := loadTestInventory(t)
+
+	ids := []string{}
+	for _, image := range inventory.RunningImages() {
+		ids = append(ids, image.ID)
+	}
+	// the engine container has exited
+	assert.Equal(t, []string{
+		"sha256:5a4b3c2d1e0f9a8b7c6d5e4f3a2b1c0d9e8f7a6b5c4d3e2f1a0b9c8d7e6f5a4b",
+		"sha256:ead0a4a53df89fd173874b46093b6e62d8c72967bbf606d672c9e8c9b601a4fc",
+	}, ids)
+}
+
+func TestNormalizeRef(t *testing.T) {
+	assert.Equal(t, "docker.io/library/alpine:3.18.3", NormalizeRef("alpine:3.18.3"))
+	assert.Equal(t, "docker.io/rancher/mirrored-pause:3.6", NormalizeRef("rancher/mirrored-pause:3.6"))
+	assert.Equal(t, "public.ecr.aws/tensorleap/engine:latest", NormalizeRef("public.ecr.aws/tensorleap/engine:latest"))
+	assert.Equal(t, "Not A Ref", NormalizeRef("Not A Ref"))
+}
@@ -1,231 +1,89 @@
 package containerd
 
 import (
-	"bytes"
 	"context"
-	"fmt"
-	"os/exec"
 	"strings"
 
 	"github.com/tensorleap/helm-charts/pkg/log"
 )
 
-type imgRow struct {
-	Name   string
-	Digest string
+type PruneReport struct {
+	DryRun bool `json:"dryRun"`
+	// Removed are the images deleted, or on dry run the images that would be deleted
+	Removed []Image `json:"removed"`
+	// InUse are images not in the keep list that are kept because containers use them or they are pinned
+	InUse []Image `json:"inUse"`
+	Kept  []Image `json:"kept"`
+	// ReclaimedBytes is an upper bound, layers shared with kept images are not freed
+	ReclaimedBytes int64 `json:"reclaimedBytes"`
 }
 
-func PruneContainerdExceptImageList(ctx context.Context, dockerName, namespace string, keepImages []string, dryRun bool) error {
-	rows, err := listImages(ctx, dockerName, namespace)
+// PruneContainerdExceptImageList removes the images of the node that are not in keepImages,
+// images used by a container (running or not) and pinned images are kept
+func PruneContainerdExceptImageList(ctx context.Context, dockerName string, keepImages []string, dryRun bool) (*PruneReport, error) {
+	inventory, err := GetInventory(ctx, dockerName)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if len(rows) == 0 {
+	if len(inventory.Images) == 0 {
 		log.Infof("no images found in Containerd")
-		return nil
+		return &PruneReport{DryRun: dryRun, Removed: []Image{}, InUse: []Image{}, Kept: []Image{}}, nil
 	}
 
-	digestToRefs := map[string][]string{}
-	for _, r := range rows {
-		dg := strings.ToLower(r.Digest)
-		if dg == "" {
-			continue
-		}
-		if _, ok := digestToRefs[dg]; !ok {
-			digestToRefs[dg] = []string{}
-		}
-		if r.Name != "" {
-			digestToRefs[dg] = append(digestToRefs[dg], r.Name)
-		}
-	}
-
-	keepSet := buildKeepSets(keepImages)
-	deleteDigests := make([]string, 0)
-	keepImageDigests := make(map[string]bool, 0)
-	for _, r := range rows {
-		if r.Name == "" || r.Digest == "" {
-			continue
-		}
-		imageAndTag := strings.Split(r.Name, ":")
-		if len(imageAndTag) == 2 {
-			if tags, ok := keepSet[imageAndTag[0]]; ok && tags[imageAndTag[1]] {
-				keepImageDigests[r.Digest] = true
-				continue
-			}
-		}
+	report := planPrune(inventory, keepImages)
+	report.DryRun = dryRun
+	for _, image := range report.InUse {
+		log.Warnf("⚠️  in use, will NOT delete: %s (%s)", image.ID, strings.Join(image.Refs, ", "))
 	}
-	for _, r := range rows {
-		if r.Digest == "" {
-			continue
-		}
-		if _, ok := keepImageDigests[r.Digest]; ok {
-			continue
-		}
-		deleteDigests = append(deleteDigests, r.Digest)
-	}
-
-	if len(deleteDigests) == 0 {
+	if len(report.Removed) == 0 {
 		log.Infof("nothing to delete from Containerd")
-		return nil
+		return report, nil
 	}
 
-	inUse, err := digestsInUse(ctx, dockerName, namespace, deleteDigests)
-	if err != nil {
-		return err
+	args := []string{"rmi"}
+	for _, image := range report.Removed {
+		args = append(args, image.ID)
 	}
-
-	if len(inUse) > 0 {
-		tmp := deleteDigests[:0]
-		for _, dg := range deleteDigests {
-			if _, used := inUse[dg]; !used {
-				tmp = append(tmp, dg)
-			} else {
-				log.Warnf("⚠️  in use, will NOT delete: %s", dg)
-			}
-		}
-		deleteDigests = tmp
-	}
-
-	if len(deleteDigests) == 0 {
-		log.Infof("no deletable digests (all in use)")
-		return nil
-	}
-
-	args := []string{"exec", dockerName, "ctr", "-n", namespace, "images", "rm"}
-	digestRefs := make(map[string]string, 0)
-	for _, dg := range deleteDigests {
-		refs := digestToRefs[dg]
-		for _, ref := range refs {
-			digestRefs[ref] = ref
-		}
-		digestRefs[dg] = dg
-	}
-	for key := range digestRefs {
-		args = append(args, digestRefs[key])
-	}
-
 	if dryRun {
-		log.Infof("[dry-run] docker %s", strings.Join(args, " "))
-		return nil
+		log.Infof("[dry-run] crictl %s", strings.Join(args, " "))
+		return report, nil
 	}
 
-	log.Infof("Deleting %d images from Containerd", len(deleteDigests))
-
-	cmd := exec.CommandContext(ctx, "docker", args...)
-	var out bytes.Buffer
-	cmd.Stdout, cmd.Stderr = &out, &out
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("delete failed: %v\n%s", err, out.String())
-	}
-	log.Infof("Deleted %d images from Containerd", len(deleteDigests))
-	return nil
-}
-
-// --- helpers ---
-
-func listImages(ctx context.Context, dockerName, ns string) ([]imgRow, error) {
-	cmd := exec.CommandContext(ctx, "docker", "exec", dockerName, "ctr", "-n", ns, "images", "ls")
-	var out bytes.Buffer
-	cmd.Stdout, cmd.Stderr = &out, &out
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("list images: %w\n%s", err, out.String())
-	}
-	lines := linesTrim(out.String())
-	if len(lines) <= 1 {
-		return nil, nil
-	}
-	var rows []imgRow
-	for i, line := range lines {
-		if i == 0 && strings.Contains(line, "REF") { // header
-			continue
-		}
-		fields := strings.Fields(line)
-		if len(fields) == 0 {
-			continue
-		}
-		name := fields[0]
-		if name == "<none>" || name == "-" {
-			name = ""
-		}
-		var dg string
-		for _, f := range fields {
-			if strings.HasPrefix(f, "sha256:") {
-				dg = f
-				break
-			}
-		}
-		rows = append(rows, imgRow{Name: name, Digest: dg})
+	log.Infof("Deleting %d images from Containerd", len(report.Removed))
+	if _, err := crictl(ctx, dockerName, args...); err != nil {
+		return nil, err
 	}
-	return rows, nil
+	log.Infof("Deleted %d images from Containerd", len(report.Removed))
+	return report, nil
 }
 
-func digestsInUse(ctx context.Context, dockerName, ns string, dgs []string) (map[string]struct{}, error) {
-	set := make(map[string]struct{})
-	first12 := make([]string, 0, len(dgs))
-	for _, d := range dgs {
-		if len(d) >= 19 { // "sha256:" + 12
-			first12 = append(first12, d[:19])
-		} else {
-			first12 = append(first12, d)
-		}
+// planPrune splits the inventory to the images to keep, the ones kept because they are in use and the ones to remove
+func planPrune(inventory *Inventory, keepImages []string) *PruneReport {
+	keepSet := make(map[string]bool, len(keepImages))
+	for _, image := range keepImages {
+		keepSet[NormalizeRef(image)] = true
 	}
-
-	check := func(args ...string) error {
-		cmd := exec.CommandContext(ctx, "docker", append([]string{"exec", dockerName, "ctr", "-n", ns}, args...)...)
-		var out bytes.Buffer
-		cmd.Stdout, cmd.Stderr = &out, &out
-		if err := cmd.Run(); err != nil {
-			// treat "no such" as empty
-			if !strings.Contains(out.String(), "not found") {
-				return fmt.Errorf("%s: %v\n%s", strings.Join(args, " "), err, out.String())
+	isKept := func(image *Image) bool {
+		for _, ref := range append(append([]string{}, image.Refs...), image.RepoDigests...) {
+			if keepSet[NormalizeRef(ref)] {
+				return true
 			}
 		}
-		text := out.String()
-		for _, p := range first12 {
-			if strings.Contains(text, p) {
-				// find full match (best effort)
-				for _, full := range dgs {
-					if strings.HasPrefix(full, p) {
-						set[full] = struct{}{}
-					}
-				}
-			}
-		}
-		return nil
-	}
-
-	if err := check("containers", "ls"); err != nil {
-		return nil, err
-	}
-	if err := check("snapshots", "ls"); err != nil {
-		return nil, err
+		return false
 	}
-	return set, nil
-}
-
-func buildKeepSets(imageTags []string) map[string]map[string]bool {
-	keepByName := make(map[string]map[string]bool)
-	for _, imageTag := range imageTags {
-		imageAndTag := strings.Split(imageTag, ":")
-		if len(imageAndTag) != 2 {
-			continue
-		}
-		if keepByName[imageAndTag[0]] == nil {
-			keepByName[imageAndTag[0]] = make(map[string]bool)
-		}
-		keepByName[imageAndTag[0]][imageAndTag[1]] = true
-	}
-	return keepByName
-}
 
-func linesTrim(s string) []string {
-	all := strings.Split(strings.TrimSpace(s), "\n")
-	out := make([]string, 0, len(all))
-	for _, l := range all {
-		l = strings.TrimSpace(l)
-		if l != "" {
-			out = append(out, l)
+	report := &PruneReport{Removed: []Image{}, InUse: []Image{}, Kept: []Image{}}
+	for i := range inventory.Images {
+		image := inventory.Images[i]
+		switch {
+		case isKept(&image):
+			report.Kept = append(report.Kept, image)
+		case image.IsInUse() || image.IsPinned():
+			report.InUse = append(report.InUse, image)
+		default:
+			report.Removed = append(report.Removed, image)
+			report.ReclaimedBytes += image.Size
 		}
 	}
-	return out
+	return report
 }
@@ -14,6 +14,7 @@ import (
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
 	"github.com/spf13/pflag"
 	"github.com/tensorleap/helm-charts/pkg/log"
 	"k8s.io/utils/strings/slices"
@@ -77,7 +78,7 @@ func isRateLimitError(err error) bool {
 
 func DownloadDockerImages(dockerCli Client, imageNames []string, outputFile io.Writer) error {
 	// First pull all images using the existing PullDockerImages function
-	err := PullDockerImages(dockerCli, imageNames)
+	err := PullDockerImages(context.Background(), dockerCli, imageNames)
 	if err != nil {
 		return err
 	}
@@ -100,16 +101,16 @@ func DownloadDockerImages(dockerCli Client, imageNames []string, outputFile io.W
 	return nil
 }
 
-// PullDockerImages pulls images with rate limiting per registry without saving
-func PullDockerImages(dockerCli Client, imageNames []string) error {
+// PullDockerImages pulls images with rate limiting per registry without saving, the pulls stop when ctx is done
+func PullDockerImages(parent context.Context, dockerCli Client, imageNames []string) error {
 	pullerLimiter, err := NewPullerLimiter(imageNames)
 	if err != nil {
 		return err
 	}
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(parent)
 	defer cancel()
 
-	errChan := make(chan error)
+	errChan := make(chan error, len(imageNames))
 	breakLoop := false
 	wg := sync.WaitGroup{}
 
@@ -157,9 +158,15 @@ func PullDockerImages(dockerCli Client, imageNames []string) error {
 					}
 				}
 
+				if ctx.Err() != nil {
+					break
+				}
 				log.Printf("Failed to pull image: %s (attempt %d/%d), error: %v\n", imageName, attempt, maxRetries, err)
 				if attempt < maxRetries {
-					time.Sleep(retryDelay)
+					select {
+					case <-ctx.Done():
+					case <-time.After(retryDelay):
+					}
 				} else {
 					cancelWithError(fmt.Errorf("failed to pull image %s after %d attempts: %w", imageName, maxRetries, err))
 					break
@@ -170,6 +177,9 @@ func PullDockerImages(dockerCli Client, imageNames []string) error {
 
 	wg.Wait()
 
+	if err := parent.Err(); err != nil {
+		return err
+	}
 	select {
 	case err := <-errChan:
 		return fmt.Errorf("pull operations were stopped due to an error: %v", err)
@@ -266,3 +276,25 @@ func RemoveImages(dockerCli client.APIClient, imageNames []string) error {
 	}
 	return nil
 }
+
+// PushImage pushes a local image under another name, the added tag is removed afterwards
+func PushImage(ctx context.Context, dockerCli client.APIClient, imageName, targetName string) error {
+	if err := dockerCli.ImageTag(ctx, imageName, targetName); err != nil {
+		return fmt.Errorf("failed to tag %s as %s: %w", imageName, targetName, err)
+	}
+	defer func() {
+		if _, err := dockerCli.ImageRemove(context.Background(), targetName, image.RemoveOptions{}); err != nil {
+			log.Warnf("failed to remove tag %s: %v", targetName, err)
+		}
+	}()
+
+	resp, err := dockerCli.ImagePush(ctx, targetName, image.PushOptions{RegistryAuth: "empty auth"})
+	if err != nil {
+		return fmt.Errorf("docker failed to push the image '%s': %w", targetName, err)
+	}
+	defer resp.Close()
+	if err := jsonmessage.DisplayJSONMessagesStream(resp, log.VerboseLogger.Out, 0, false, nil); err != nil {
+		return fmt.Errorf("docker failed to push the image '%s': %w", targetName, err)
+	}
+	return nil
+}
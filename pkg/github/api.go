@@ -57,6 +57,22 @@ func GetReleasesPage(owner, repo string, page, per_page int) ([]Release, error)
 	return releases, nil
 }
 
+// GetAllReleases pages through all the releases of the repo, in API order
+func GetAllReleases(owner, repo string) ([]Release, error) {
+	const perPage = 100
+	releases := []Release{}
+	for page := 1; ; page++ {
+		pageReleases, err := GetReleasesPage(owner, repo, page, perPage)
+		if err != nil {
+			return nil, err
+		}
+		releases = append(releases, pageReleases...)
+		if len(pageReleases) < perPage {
+			return releases, nil
+		}
+	}
+}
+
 func GetTagArtifact(owner, repo, fileName, tag string) ([]byte, error) {
 	url := fmt.Sprintf("https://github.com/%s/%s/releases/download/%s/%s", owner, repo, tag, fileName)
 
@@ -105,6 +105,28 @@ func DownloadIfNotCached(repo, chartName, version string) (string, error) {
 	return cachedPath, nil
 }
 
+// ListCachedVersions returns the versions of the chart in the helm cache
+func ListCachedVersions(chartName string) ([]string, error) {
+	dirEntries, err := os.ReadDir(filepath.Join(local.GetHelmCacheDir(), chartName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	versions := []string{}
+	for _, dirEntry := range dirEntries {
+		if version, ok := strings.CutSuffix(dirEntry.Name(), ".tgz"); ok && !dirEntry.IsDir() {
+			versions = append(versions, version)
+		}
+	}
+	return versions, nil
+}
+
+// LoadCached loads a chart from the helm cache without downloading it
+func LoadCached(chartName, version string) (*Chart, error) {
+	return loader.Load(filepath.Join(local.GetHelmCacheDir(), chartName, fmt.Sprintf("%s.tgz", version)))
+}
+
 // GetVersion returns version of a helm chart if version is empty it returns the latest version
 func GetVersion(repoUrl, chartName, version string) (*repo.ChartVersion, error) {
 
@@ -0,0 +1,128 @@
+package helm
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/tensorleap/helm-charts/pkg/log"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+// FindRevisionByChartVersion returns the newest revision that ran the given chart version successfully, 0 if none
+func FindRevisionByChartVersion(config *HelmConfig, releaseName, chartVersion string) (int, error) {
+	history, err := GetReleaseHistory(config, releaseName)
+	if err != nil {
+		return 0, err
+	}
+	for i := len(history) - 1; i >= 0; i-- {
+		rel := history[i]
+		if rel.Chart == nil || rel.Chart.Metadata == nil || rel.Info == nil {
+			continue
+		}
+		if rel.Chart.Metadata.Version != chartVersion {
+			continue
+		}
+		if rel.Info.Status == release.StatusDeployed || rel.Info.Status == release.StatusSuperseded {
+			return rel.Version, nil
+		}
+	}
+	return 0, nil
+}
+
+func RollbackChart(config *HelmConfig, releaseName string, revision int) error {
+	log.SendCloudReport("info", "Rolling back helm chart", "Running", &map[string]interface{}{"releaseName": releaseName, "revision": revision})
+	log.Printf("Rolling back %s to revision %d (will take few minutes)", releaseName, revision)
+
+	client := action.NewRollback(config.ActionConfig)
+	client.Version = revision
+	client.Wait = true
+	client.Timeout = 4 * time.Hour
+
+	if err := client.Run(releaseName); err != nil {
+		log.SendCloudReport("error", "Failed rolling back helm chart", "Failed",
+			&map[string]interface{}{"releaseName": releaseName, "revision": revision, "error": err.Error()})
+		return err
+	}
+
+	log.SendCloudReport("info", "Successfully rolled back helm chart", "Running", nil)
+	return nil
+}
+
+// RollbackInterruptedRelease undoes a helm action that was interrupted while the release was pending, so the next
+// install can continue from the previous state: a pending install is uninstalled and a pending upgrade or rollback
+// is rolled back to the last deployed revision. Without a deployed revision the release is marked as failed.
+// It does not wait for the resources and returns false when the release was not pending.
+func RollbackInterruptedRelease(config *HelmConfig, releaseName string) (bool, error) {
+	history, err := GetReleaseHistory(config, releaseName)
+	if err == ErrNoRelease {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	latest := history[len(history)-1]
+	if latest.Info == nil || !latest.Info.Status.IsPending() {
+		return false, nil
+	}
+
+	if latest.Info.Status == release.StatusPendingInstall {
+		log.Warnf("Uninstalling the interrupted install of %s", releaseName)
+		return true, uninstallRelease(config, releaseName)
+	}
+
+	for i := len(history) - 2; i >= 0; i-- {
+		rel := history[i]
+		if rel.Info == nil || (rel.Info.Status != release.StatusDeployed && rel.Info.Status != release.StatusSuperseded) {
+			continue
+		}
+		log.Warnf("Rolling back the interrupted %s of %s to revision %d", latest.Info.Status, releaseName, rel.Version)
+		client := action.NewRollback(config.ActionConfig)
+		client.Version = rel.Version
+		client.Timeout = 5 * time.Minute
+		return true, client.Run(releaseName)
+	}
+	return true, MarkReleaseFailed(config, releaseName, "interrupted")
+}
+
+// ResetUnfinishedRelease prepares the release of an unfinished install to be installed again: a pending release is
+// rolled back as by RollbackInterruptedRelease, and a release that never deployed is uninstalled since helm cannot
+// upgrade it. It returns true when the release was changed.
+func ResetUnfinishedRelease(config *HelmConfig, releaseName string) (bool, error) {
+	reset, err := RollbackInterruptedRelease(config, releaseName)
+	if err != nil {
+		return reset, err
+	}
+	history, err := GetReleaseHistory(config, releaseName)
+	if err == ErrNoRelease {
+		return reset, nil
+	} else if err != nil {
+		return reset, err
+	}
+	for _, rel := range history {
+		if rel.Info != nil && (rel.Info.Status == release.StatusDeployed || rel.Info.Status == release.StatusSuperseded) {
+			return reset, nil
+		}
+	}
+	log.Warnf("Uninstalling %s, it was never deployed by the unfinished install", releaseName)
+	return true, uninstallRelease(config, releaseName)
+}
+
+func uninstallRelease(config *HelmConfig, releaseName string) error {
+	client := action.NewUninstall(config.ActionConfig)
+	client.Timeout = 5 * time.Minute
+	_, err := client.Run(releaseName)
+	return err
+}
+
+// MarkReleaseFailed marks the latest revision of a pending release as failed, its resources are left as they are
+func MarkReleaseFailed(config *HelmConfig, releaseName, reason string) error {
+	latest, err := config.ActionConfig.Releases.Last(releaseName)
+	if err != nil {
+		return err
+	}
+	if latest.Info == nil || !latest.Info.Status.IsPending() {
+		return nil
+	}
+	latest.SetStatus(release.StatusFailed, fmt.Sprintf("Release %q failed: %s", releaseName, reason))
+	return config.ActionConfig.Releases.Update(latest)
+}
@@ -0,0 +1,119 @@
+package helm
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+func newTestHelmConfig(t *testing.T, statuses ...release.Status) *HelmConfig {
+	actionConfig := &action.Configuration{
+		Releases:     storage.Init(driver.NewMemory()),
+		KubeClient:   &kubefake.PrintingKubeClient{Out: io.Discard},
+		Capabilities: chartutil.DefaultCapabilities,
+		Log:          func(string, ...interface{}) {},
+	}
+	testChart := &chart.Chart{Metadata: &chart.Metadata{Name: "tensorleap", Version: "1.0.0", APIVersion: "v2"}}
+	for i, status := range statuses {
+		rel := &release.Release{Name: "tensorleap", Namespace: "tensorleap", Version: i + 1, Chart: testChart, Info: &release.Info{Status: status}}
+		require.NoError(t, actionConfig.Releases.Create(rel))
+	}
+	return &HelmConfig{Namespace: "tensorleap", ActionConfig: actionConfig}
+}
+
+func TestRollbackInterruptedRelease(t *testing.T) {
+	latestStatus := func(t *testing.T, config *HelmConfig) release.Status {
+		rel, err := config.ActionConfig.Releases.Last("tensorleap")
+		require.NoError(t, err)
+		return rel.Info.Status
+	}
+
+	t.Run("pending install is uninstalled", func(t *testing.T) {
+		config := newTestHelmConfig(t, release.StatusPendingInstall)
+		recovered, err := RollbackInterruptedRelease(config, "tensorleap")
+		require.NoError(t, err)
+		assert.True(t, recovered)
+		exists, err := IsHelmReleaseExists(config, "tensorleap")
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("pending upgrade is rolled back", func(t *testing.T) {
+		config := newTestHelmConfig(t, release.StatusSuperseded, release.StatusDeployed, release.StatusPendingUpgrade)
+		recovered, err := RollbackInterruptedRelease(config, "tensorleap")
+		require.NoError(t, err)
+		assert.True(t, recovered)
+		rel, err := config.ActionConfig.Releases.Last("tensorleap")
+		require.NoError(t, err)
+		assert.Equal(t, 4, rel.Version)
+		assert.Equal(t, release.StatusDeployed, rel.Info.Status)
+	})
+
+	t.Run("pending upgrade without a deployed revision is marked failed", func(t *testing.T) {
+		config := newTestHelmConfig(t, release.StatusFailed, release.StatusPendingUpgrade)
+		recovered, err := RollbackInterruptedRelease(config, "tensorleap")
+		require.NoError(t, err)
+		assert.True(t, recovered)
+		assert.Equal(t, release.StatusFailed, latestStatus(t, config))
+	})
+
+	t.Run("deployed release is left as is", func(t *testing.T) {
+		config := newTestHelmConfig(t, release.StatusDeployed)
+		recovered, err := RollbackInterruptedRelease(config, "tensorleap")
+		require.NoError(t, err)
+		assert.False(t, recovered)
+		assert.Equal(t, release.StatusDeployed, latestStatus(t, config))
+	})
+
+	t.Run("missing release", func(t *testing.T) {
+		recovered, err := RollbackInterruptedRelease(newTestHelmConfig(t), "tensorleap")
+		require.NoError(t, err)
+		assert.False(t, recovered)
+	})
+}
+
+func TestMarkReleaseFailed(t *testing.T) {
+	config := newTestHelmConfig(t, release.StatusPendingInstall)
+	require.NoError(t, MarkReleaseFailed(config, "tensorleap", "pods are failing"))
+	rel, err := config.ActionConfig.Releases.Last("tensorleap")
+	require.NoError(t, err)
+	assert.Equal(t, release.StatusFailed, rel.Info.Status)
+	assert.Contains(t, rel.Info.Description, "pods are failing")
+}
+
+func TestResetUnfinishedRelease(t *testing.T) {
+	t.Run("never deployed release is uninstalled", func(t *testing.T) {
+		config := newTestHelmConfig(t, release.StatusFailed)
+		reset, err := ResetUnfinishedRelease(config, "tensorleap")
+		require.NoError(t, err)
+		assert.True(t, reset)
+		exists, err := IsHelmReleaseExists(config, "tensorleap")
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("failed upgrade of a deployed release is kept", func(t *testing.T) {
+		config := newTestHelmConfig(t, release.StatusSuperseded, release.StatusFailed)
+		reset, err := ResetUnfinishedRelease(config, "tensorleap")
+		require.NoError(t, err)
+		assert.False(t, reset)
+		exists, err := IsHelmReleaseExists(config, "tensorleap")
+		require.NoError(t, err)
+		assert.True(t, exists)
+	})
+
+	t.Run("missing release", func(t *testing.T) {
+		reset, err := ResetUnfinishedRelease(newTestHelmConfig(t), "tensorleap")
+		require.NoError(t, err)
+		assert.False(t, reset)
+	})
+}
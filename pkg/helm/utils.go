@@ -14,6 +14,7 @@ import (
 	"github.com/tensorleap/helm-charts/pkg/local"
 	"github.com/tensorleap/helm-charts/pkg/log"
 	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
 	"helm.sh/helm/v3/pkg/cli"
 	"helm.sh/helm/v3/pkg/release"
 	"helm.sh/helm/v3/pkg/storage/driver"
@@ -108,6 +109,28 @@ func IsHelmReleasePendingOrFailed(config *HelmConfig, releaseName string) (bool,
 	return isPendingOrFailed, status, nil
 }
 
+// GetReleaseHistory returns all the revisions of the release, oldest first
+func GetReleaseHistory(config *HelmConfig, releaseName string) ([]*release.Release, error) {
+	client := action.NewHistory(config.ActionConfig)
+	client.Max = 0
+	history, err := client.Run(releaseName)
+	if err == driver.ErrReleaseNotFound {
+		return nil, ErrNoRelease
+	}
+	return history, err
+}
+
+// GetReleaseChart returns the chart the release is currently deployed with
+func GetReleaseChart(config *HelmConfig, releaseName string) (*chart.Chart, error) {
+	rel, err := action.NewGet(config.ActionConfig).Run(releaseName)
+	if err == driver.ErrReleaseNotFound {
+		return nil, ErrNoRelease
+	} else if err != nil {
+		return nil, err
+	}
+	return rel.Chart, nil
+}
+
 func GetHelmReleaseVersion(config *HelmConfig, releaseName string) (string, error) {
 	client := action.NewHistory(config.ActionConfig)
 	client.Max = 0 // 0 means fetch all history
@@ -346,7 +369,11 @@ type HelmConfig struct {
 	Settings     *cli.EnvSettings
 }
 
-func CreateHelmConfig(kubeConfigPath string, kubeContext, namespace string) (*HelmConfig, error) {
+// CreateHelmConfig creates the config of the helm actions, install and upgrade stop waiting when ctx is canceled.
+// Helm fails an action at once when its context is canceled, which used to leave the release pending, so the config
+// used to hold a background context. Install and upgrade now run with RunWithContext and the next install resets the
+// release they leave pending with ResetUnfinishedRelease, so ctx may be canceled. The other actions ignore ctx.
+func CreateHelmConfig(ctx context.Context, kubeConfigPath string, kubeContext, namespace string) (*HelmConfig, error) {
 	settings := cli.New()
 	settings.SetNamespace(namespace)
 	settings.KubeContext = kubeContext
@@ -355,8 +382,6 @@ func CreateHelmConfig(kubeConfigPath string, kubeContext, namespace string) (*He
 		settings.KubeConfig = kubeConfigPath
 	}
 
-	// Any other context with cancel will failed immediately when running helm actions, using background context solve it
-	ctx := context.Background()
 	helmDriver := os.Getenv("HELM_DRIVER")
 
 	actionConfig := new(action.Configuration)
@@ -2,6 +2,7 @@ package k3d
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -69,7 +70,14 @@ func RemoveImageCachingVolume(ctx context.Context) error {
 
 func CreateCluster(ctx context.Context, manifest *manifest.InstallationManifest, params *CreateK3sClusterParams, localContainerdDir string) (cluster *Cluster, err error) {
 	log.SendCloudReport("info", "Creating cluster", "Running", &map[string]interface{}{"params": params})
-	clusterConfig := createClusterConfig(ctx, manifest, params, localContainerdDir)
+	cpuLimit, err := getCPUsLimit(params.CpuLimit)
+	if err != nil {
+		return nil, err
+	}
+	clusterConfig, err := createClusterConfig(ctx, manifest, params, localContainerdDir)
+	if err != nil {
+		return nil, err
+	}
 
 	if params.ImageCachingMethod == ImageCachingDockerVolume {
 		_, err = docker.CreateVolumeIfNotExists(ctx, CONTAINERD_VOLUME_NAME, nil)
@@ -94,14 +102,14 @@ func CreateCluster(ctx context.Context, manifest *manifest.InstallationManifest,
 		log.Println("Failed to create cluster >>> Rolling Back")
 		log.SendCloudReport("error", "Failed creating cluster", "Failed",
 			&map[string]interface{}{"selectedRuntime": runtimes.SelectedRuntime, "error": err.Error()})
-		if err := k3dCluster.ClusterDelete(ctx, runtimes.SelectedRuntime, &clusterConfig.Cluster, k3d.ClusterDeleteOpts{SkipRegistryCheck: true}); err != nil {
-			log.Println(err)
-			log.Fatalln("Cluster creation FAILED, also FAILED to rollback changes!")
+		// the rollback must run also when the creation was interrupted
+		if deleteErr := k3dCluster.ClusterDelete(context.WithoutCancel(ctx), runtimes.SelectedRuntime, &clusterConfig.Cluster, k3d.ClusterDeleteOpts{SkipRegistryCheck: true}); deleteErr != nil {
 			log.SendCloudReport("error", "Failed rolling back cluster changes", "Failed",
-				&map[string]interface{}{"error": err.Error()})
+				&map[string]interface{}{"error": deleteErr.Error()})
+			return nil, fmt.Errorf("cluster creation failed and rolling back its changes also failed: %w", errors.Join(err, deleteErr))
 		}
 		log.SendCloudReport("error", "Successfully rolled back cluster changes", "Failed", nil)
-		log.Fatalln("Cluster creation FAILED, all changes have been rolled back!")
+		return nil, fmt.Errorf("cluster creation failed, all changes have been rolled back: %w", err)
 	}
 	log.Printf("Cluster '%s' created successfully!\n", clusterConfig.Cluster.Name)
 	log.SendCloudReport("info", "Created cluster successfully", "Running", nil)
@@ -122,9 +130,8 @@ func CreateCluster(ctx context.Context, manifest *manifest.InstallationManifest,
 	}
 
 	if params.CpuLimit != "" {
-		cpuLimit := getCPUsLimit(params.CpuLimit)
 		if err := applyCpuLimit(strconv.Itoa(cpuLimit)); err != nil {
-			log.Fatalf("Failed to apply CPU limit: %v", err)
+			return nil, fmt.Errorf("failed to apply CPU limit: %w", err)
 		}
 
 		log.Infof("CPU limit applied to all k3d containers: %d\n", cpuLimit)
@@ -400,10 +407,10 @@ func buildK3sExtraArgs() []conf.K3sArgWithNodeFilters {
 	}
 }
 
-func createClusterConfig(ctx context.Context, manifest *manifest.InstallationManifest, params *CreateK3sClusterParams, localContainerdDir string) *conf.ClusterConfig {
+func createClusterConfig(ctx context.Context, manifest *manifest.InstallationManifest, params *CreateK3sClusterParams, localContainerdDir string) (*conf.ClusterConfig, error) {
 	freePort, err := cliutil.GetFreePort()
 	if err != nil {
-		log.Fatalln(err)
+		return nil, err
 	}
 
 	image := manifest.Images.K3s
@@ -417,7 +424,7 @@ func createClusterConfig(ctx context.Context, manifest *manifest.InstallationMan
 	}
 	mirrorConfig, err := CreateMirrorFromManifest(manifest, ZotInternalPort, params.IsAirgap)
 	if err != nil {
-		log.Fatalln(err)
+		return nil, err
 	}
 
 	var containerdDir string
@@ -513,34 +520,38 @@ func createClusterConfig(ctx context.Context, manifest *manifest.InstallationMan
 
 	k3dClusterConfig, err := config.TransformSimpleToClusterConfig(ctx, runtimes.SelectedRuntime, simpleK3dConfig, "")
 	if err != nil {
-		log.Fatalln(err)
+		return nil, err
 	}
 
-	k3dClusterConfig, err = config.ProcessClusterConfig(*k3dClusterConfig)
-	if err != nil {
-		log.Fatalln(err)
-	}
+	return config.ProcessClusterConfig(*k3dClusterConfig)
+}
 
-	return k3dClusterConfig
+// ParseCPULimit validates a --cpu-limit value, a positive number of cores
+func ParseCPULimit(value string) (int, error) {
+	cpuLimit, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || cpuLimit <= 0 {
+		return 0, fmt.Errorf("invalid CPU limit: %s. Must be a positive integer", value)
+	}
+	return cpuLimit, nil
 }
 
-func getCPUsLimit(paramsCpuLimit string) int {
+func getCPUsLimit(paramsCpuLimit string) (int, error) {
 	maxCPUs := runtime.NumCPU()
 	log.Infof("Maximum CPUs available: %d\n", maxCPUs)
 
 	if paramsCpuLimit == "" {
-		return maxCPUs
+		return maxCPUs, nil
 	}
 
-	cpuLimit, err := strconv.Atoi(paramsCpuLimit)
+	cpuLimit, err := ParseCPULimit(paramsCpuLimit)
 	if err != nil {
-		log.Fatalf("Invalid CPU limit: %s. Must be a valid integer.", paramsCpuLimit)
+		return 0, err
 	}
 
 	if cpuLimit < maxCPUs {
-		return cpuLimit
+		return cpuLimit, nil
 	}
-	return maxCPUs
+	return maxCPUs, nil
 }
 
 func UninstallCluster(ctx context.Context) error {
@@ -5,96 +5,129 @@ import (
 	"fmt"
 	"time"
 
+	units "github.com/docker/go-units"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/tools/clientcmd"
 
+	"github.com/tensorleap/helm-charts/pkg/k8s"
 	"github.com/tensorleap/helm-charts/pkg/log"
 )
 
 const (
-	diskPressureCheckInterval  = 15 * time.Second
 	diskPressureRepeatInterval = 2 * time.Minute
+	// the kubelet keeps reporting DiskPressure for its transition period (5m by default) after space is freed,
+	// so the cleanup is not repeated before that
+	diskPressureRemediationInterval = 10 * time.Minute
 )
 
-type DiskPressureMonitor struct {
-	cancel context.CancelFunc
-	done   chan struct{}
-}
-
-// StartDiskPressureMonitor begins a background goroutine that periodically
-// checks the k3d node for the DiskPressure condition. When detected, it warns
-// the user with actionable guidance. The monitor should be stopped by calling
-// Stop() when helm operations complete.
-func StartDiskPressureMonitor(kubeConfigPath, kubeContext string) (*DiskPressureMonitor, error) {
-	restConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
-		&clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeConfigPath},
-		&clientcmd.ConfigOverrides{CurrentContext: kubeContext},
-	).ClientConfig()
-	if err != nil {
-		return nil, fmt.Errorf("failed to build kubeconfig for disk-pressure monitor: %w", err)
-	}
+// DiskPressureRemediation frees disk space on the node and returns the bytes it reclaimed
+type DiskPressureRemediation func(ctx context.Context) (int64, error)
 
-	clientset, err := kubernetes.NewForConfig(restConfig)
+// WatchDiskPressure checks the node for DiskPressure until ctx is done, logging when the
+// pressure starts and clears, and calling remediate when it is set
+func WatchDiskPressure(ctx context.Context, kubeConfigPath, kubeContext string, interval time.Duration, remediate DiskPressureRemediation) error {
+	clientset, err := k8s.NewClientset(kubeConfigPath, kubeContext)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create kubernetes client for disk-pressure monitor: %w", err)
+		return fmt.Errorf("disk-pressure watch: %w", err)
 	}
-
-	ctx, cancel := context.WithCancel(context.Background())
-	done := make(chan struct{})
-
-	go monitorDiskPressure(ctx, clientset, done)
-
-	return &DiskPressureMonitor{cancel: cancel, done: done}, nil
+	watcher := newDiskPressureWatcher(clientset, remediate, func() {
+		log.Warn("Disk pressure detected on the cluster node, pods may be evicted and images garbage collected.")
+	})
+	watcher.check(ctx)
+	watcher.run(ctx, interval)
+	return nil
 }
 
-func (m *DiskPressureMonitor) Stop() {
-	m.cancel()
-	<-m.done
+type diskPressureWatcher struct {
+	clientset        kubernetes.Interface
+	remediate        DiskPressureRemediation
+	warn             func()
+	now              func() time.Time
+	underPressure    bool
+	lastWarnedAt     time.Time
+	lastRemediatedAt time.Time
 }
 
-func monitorDiskPressure(ctx context.Context, clientset kubernetes.Interface, done chan struct{}) {
-	defer close(done)
+func newDiskPressureWatcher(clientset kubernetes.Interface, remediate DiskPressureRemediation, warn func()) *diskPressureWatcher {
+	return &diskPressureWatcher{clientset: clientset, remediate: remediate, warn: warn, now: time.Now}
+}
 
-	ticker := time.NewTicker(diskPressureCheckInterval)
+func (w *diskPressureWatcher) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
-	var lastWarnedAt time.Time
-
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			if !hasDiskPressure(ctx, clientset) {
-				continue
-			}
+			w.check(ctx)
+		}
+	}
+}
 
-			now := time.Now()
-			if lastWarnedAt.IsZero() || now.Sub(lastWarnedAt) >= diskPressureRepeatInterval {
-				lastWarnedAt = now
-				emitDiskPressureWarning()
+func (w *diskPressureWatcher) check(ctx context.Context) {
+	pressure, err := HasDiskPressure(ctx, w.clientset)
+	if err != nil {
+		return
+	}
+	now := w.now()
+
+	if !pressure {
+		if w.underPressure {
+			if w.lastRemediatedAt.IsZero() {
+				log.Info("Disk pressure cleared.")
+			} else {
+				log.Infof("Disk pressure cleared %s after the cleanup.", now.Sub(w.lastRemediatedAt).Round(time.Second))
 			}
 		}
+		w.underPressure = false
+		w.lastWarnedAt = time.Time{}
+		w.lastRemediatedAt = time.Time{}
+		return
+	}
+
+	w.underPressure = true
+	if w.lastWarnedAt.IsZero() || now.Sub(w.lastWarnedAt) >= diskPressureRepeatInterval {
+		w.lastWarnedAt = now
+		w.warn()
+		if !w.lastRemediatedAt.IsZero() {
+			log.Warnf("Disk pressure has not cleared %s after the cleanup.", now.Sub(w.lastRemediatedAt).Round(time.Second))
+		}
+	}
+
+	if w.remediate == nil || (!w.lastRemediatedAt.IsZero() && now.Sub(w.lastRemediatedAt) < diskPressureRemediationInterval) {
+		return
+	}
+	w.lastRemediatedAt = now
+	log.Info("Cleaning up unused images to relieve the disk pressure...")
+	reclaimed, err := w.remediate(ctx)
+	if err != nil {
+		log.Warnf("Disk pressure cleanup failed: %v", err)
+		log.SendCloudReport("error", "Disk pressure cleanup failed", "Running", &map[string]interface{}{"error": err.Error()})
+		return
 	}
+	log.Infof("Disk pressure cleanup reclaimed up to %s, waiting for the node to report the pressure cleared.", units.HumanSize(float64(reclaimed)))
+	log.SendCloudReport("info", "Disk pressure cleanup", "Running", &map[string]interface{}{"reclaimedBytes": reclaimed})
 }
 
-func hasDiskPressure(ctx context.Context, clientset kubernetes.Interface) bool {
+// HasDiskPressure reports whether any cluster node has the DiskPressure condition
+func HasDiskPressure(ctx context.Context, clientset kubernetes.Interface) (bool, error) {
 	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
 	if err != nil {
-		return false
+		return false, err
 	}
 
 	for _, node := range nodes.Items {
 		for _, condition := range node.Status.Conditions {
 			if condition.Type == corev1.NodeDiskPressure && condition.Status == corev1.ConditionTrue {
-				return true
+				return true, nil
 			}
 		}
 	}
 
-	return false
+	return false, nil
 }
 
 func emitDiskPressureWarning() {
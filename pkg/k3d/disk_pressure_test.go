@@ -0,0 +1,83 @@
+package k3d
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func setNodeDiskPressure(t *testing.T, clientset *fake.Clientset, pressure bool) {
+	status := corev1.ConditionFalse
+	if pressure {
+		status = corev1.ConditionTrue
+	}
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "k3d-tensorleap-server-0"},
+		Status: corev1.NodeStatus{Conditions: []corev1.NodeCondition{
+			{Type: corev1.NodeDiskPressure, Status: status},
+		}},
+	}
+	_, err := clientset.CoreV1().Nodes().Update(context.Background(), node, metav1.UpdateOptions{})
+	require.NoError(t, err)
+}
+
+func TestDiskPressureWatcherRemediation(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "k3d-tensorleap-server-0"}})
+
+	remediations, warnings := 0, 0
+	watcher := newDiskPressureWatcher(clientset, func(ctx context.Context) (int64, error) {
+		remediations++
+		return 1 << 30, nil
+	}, func() { warnings++ })
+	now := time.Now()
+	watcher.now = func() time.Time { return now }
+
+	watcher.check(ctx)
+	assert.Equal(t, 0, remediations, "no remediation without pressure")
+
+	setNodeDiskPressure(t, clientset, true)
+	watcher.check(ctx)
+	assert.True(t, watcher.underPressure)
+	assert.Equal(t, 1, remediations)
+	assert.Equal(t, 1, warnings)
+
+	// the kubelet keeps the condition for a while after the cleanup
+	now = now.Add(watchdogCheckInterval)
+	watcher.check(ctx)
+	assert.Equal(t, 1, remediations)
+	assert.Equal(t, 1, warnings)
+
+	now = now.Add(diskPressureRemediationInterval)
+	watcher.check(ctx)
+	assert.Equal(t, 2, remediations)
+	assert.Equal(t, 2, warnings)
+
+	setNodeDiskPressure(t, clientset, false)
+	watcher.check(ctx)
+	assert.False(t, watcher.underPressure)
+	assert.True(t, watcher.lastRemediatedAt.IsZero())
+
+	setNodeDiskPressure(t, clientset, true)
+	watcher.check(ctx)
+	assert.Equal(t, 3, remediations, "a new pressure episode is remediated right away")
+}
+
+func TestDiskPressureWatcherWithoutRemediation(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	warnings := 0
+	watcher := newDiskPressureWatcher(clientset, nil, func() { warnings++ })
+	_, err := clientset.CoreV1().Nodes().Create(context.Background(), &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "k3d-tensorleap-server-0"}}, metav1.CreateOptions{})
+	require.NoError(t, err)
+	setNodeDiskPressure(t, clientset, true)
+
+	watcher.check(context.Background())
+	assert.Equal(t, 1, warnings)
+	assert.True(t, watcher.lastRemediatedAt.IsZero())
+}
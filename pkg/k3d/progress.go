@@ -0,0 +1,231 @@
+package k3d
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/tensorleap/helm-charts/pkg/k8s"
+	"github.com/tensorleap/helm-charts/pkg/log"
+)
+
+const (
+	progressRefreshInterval = 2 * time.Second
+	progressLogInterval     = 30 * time.Second
+	progressMaxPulls        = 5
+)
+
+type rolloutPhase struct {
+	name     string
+	release  string
+	started  time.Time
+	duration time.Duration
+}
+
+// rolloutStatus is a snapshot of the rollout that is rendered to the terminal or the log
+type rolloutStatus struct {
+	done      []rolloutPhase
+	current   *rolloutPhase
+	workloads []k8s.Workload
+	pulls     []k8s.ImagePull
+}
+
+// RolloutProgress shows the workloads of the release being installed while helm waits for it. On a terminal
+// it redraws a table below the log, otherwise it logs a summary line periodically.
+type RolloutProgress struct {
+	clientset     kubernetes.Interface
+	dynamicClient dynamic.Interface
+	namespace     string
+	interactive   bool
+	now           func() time.Time
+
+	mu      sync.Mutex
+	done    []rolloutPhase
+	current *rolloutPhase
+
+	area    *log.LiveArea
+	stop    context.CancelFunc
+	stopped chan struct{}
+}
+
+func StartRolloutProgress(kubeConfigPath, kubeContext, namespace string) (*RolloutProgress, error) {
+	clientset, err := k8s.NewClientset(kubeConfigPath, kubeContext)
+	if err != nil {
+		return nil, fmt.Errorf("rollout progress: %w", err)
+	}
+	dynamicClient, err := k8s.NewDynamicClient(kubeConfigPath, kubeContext)
+	if err != nil {
+		return nil, fmt.Errorf("rollout progress: %w", err)
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	p := &RolloutProgress{
+		clientset:     clientset,
+		dynamicClient: dynamicClient,
+		namespace:     namespace,
+		interactive:   log.IsInteractiveOutput(),
+		now:           time.Now,
+		stop:          stop,
+		stopped:       make(chan struct{}),
+	}
+	if p.interactive {
+		p.area = log.StartLiveArea()
+	}
+	go p.run(ctx)
+	return p, nil
+}
+
+// StartPhase ends the current phase and starts showing the workloads of the given release
+func (p *RolloutProgress) StartPhase(name, release string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.endPhase()
+	p.current = &rolloutPhase{name: name, release: release, started: p.now()}
+}
+
+// Stop ends the current phase and leaves the last table on the terminal, the time of the phases is in the timeline
+func (p *RolloutProgress) Stop() {
+	p.stop()
+	<-p.stopped
+	p.mu.Lock()
+	p.endPhase()
+	p.mu.Unlock()
+	if p.area != nil {
+		p.area.Stop()
+	}
+}
+
+func (p *RolloutProgress) endPhase() {
+	if p.current == nil {
+		return
+	}
+	p.current.duration = p.now().Sub(p.current.started)
+	p.done = append(p.done, *p.current)
+	p.current = nil
+}
+
+func (p *RolloutProgress) run(ctx context.Context) {
+	defer close(p.stopped)
+
+	ticker := time.NewTicker(progressRefreshInterval)
+	defer ticker.Stop()
+	var lastLogged time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if !p.interactive && p.now().Sub(lastLogged) < progressLogInterval {
+			continue
+		}
+		status, ok := p.snapshot(ctx)
+		if !ok {
+			continue
+		}
+		now := p.now()
+		if p.interactive {
+			p.area.Update(renderRolloutStatus(status, now))
+		} else {
+			log.Info(summarizeRolloutStatus(status, now))
+			lastLogged = now
+		}
+	}
+}
+
+// snapshot lists the workloads of the current phase, listing errors are ignored since the api server
+// may be restarting and helm reports the failures
+func (p *RolloutProgress) snapshot(ctx context.Context) (rolloutStatus, bool) {
+	p.mu.Lock()
+	status := rolloutStatus{done: append([]rolloutPhase{}, p.done...)}
+	if p.current != nil {
+		current := *p.current
+		status.current = &current
+	}
+	p.mu.Unlock()
+	if status.current == nil {
+		return status, false
+	}
+
+	workloads, err := k8s.ListReleaseWorkloads(ctx, p.clientset, p.dynamicClient, p.namespace, status.current.release)
+	if err != nil {
+		return status, false
+	}
+	status.workloads = workloads
+	if pulls, err := k8s.ListPullingImages(ctx, p.clientset, p.namespace); err == nil {
+		status.pulls = pulls
+	}
+	return status, true
+}
+
+func renderRolloutStatus(status rolloutStatus, now time.Time) []string {
+	lines := []string{}
+	for _, phase := range status.done {
+		lines = append(lines, fmt.Sprintf("%s done in %s", phase.name, phase.duration.Round(time.Second)))
+	}
+	if status.current == nil {
+		return lines
+	}
+	ready, total := countReady(status.workloads)
+	lines = append(lines, fmt.Sprintf("%s running for %s, %d/%d ready", status.current.name, now.Sub(status.current.started).Round(time.Second), ready, total))
+
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  KIND\tNAME\tREADY")
+	for _, workload := range status.workloads {
+		fmt.Fprintf(w, "  %s\t%s\t%d/%d\n", workload.Kind, workload.Name, workload.Ready, workload.Desired)
+	}
+	w.Flush()
+	lines = append(lines, strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")...)
+
+	if len(status.pulls) > 0 {
+		lines = append(lines, "  Pulling images:")
+		for i, pull := range status.pulls {
+			if i == progressMaxPulls {
+				lines = append(lines, fmt.Sprintf("    and %d more", len(status.pulls)-progressMaxPulls))
+				break
+			}
+			lines = append(lines, fmt.Sprintf("    %s for %s (%s)", pull.Image, pull.Pod, now.Sub(pull.Since).Round(time.Second)))
+		}
+	}
+	return lines
+}
+
+func summarizeRolloutStatus(status rolloutStatus, now time.Time) string {
+	ready, total := countReady(status.workloads)
+	summary := fmt.Sprintf("%s: %d/%d workloads ready after %s", status.current.name, ready, total, now.Sub(status.current.started).Round(time.Second))
+
+	waiting := []string{}
+	for _, workload := range status.workloads {
+		if !workload.IsReady() {
+			waiting = append(waiting, fmt.Sprintf("%s %d/%d", workload.Name, workload.Ready, workload.Desired))
+		}
+	}
+	if len(waiting) > 0 {
+		summary += ", waiting for " + strings.Join(waiting, ", ")
+	}
+	if len(status.pulls) > 0 {
+		images := []string{}
+		for _, pull := range status.pulls {
+			images = append(images, pull.Image)
+		}
+		summary += ", pulling " + strings.Join(images, ", ")
+	}
+	return summary
+}
+
+func countReady(workloads []k8s.Workload) (ready, total int) {
+	for _, workload := range workloads {
+		if workload.IsReady() {
+			ready++
+		}
+	}
+	return ready, len(workloads)
+}
@@ -0,0 +1,56 @@
+package k3d
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tensorleap/helm-charts/pkg/k8s"
+)
+
+func newTestRolloutStatus(now time.Time) rolloutStatus {
+	return rolloutStatus{
+		done:    []rolloutPhase{{name: "Installing infra", duration: 95 * time.Second}},
+		current: &rolloutPhase{name: "Installing server", started: now.Add(-2 * time.Minute)},
+		workloads: []k8s.Workload{
+			{Kind: "Deployment", Name: "engine", Ready: 0, Desired: 1},
+			{Kind: "StatefulSet", Name: "mongodb", Ready: 1, Desired: 1},
+		},
+		pulls: []k8s.ImagePull{{Pod: "engine-0", Image: "engine:v2", Since: now.Add(-40 * time.Second)}},
+	}
+}
+
+func TestRenderRolloutStatus(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, []string{
+		"Installing infra done in 1m35s",
+		"Installing server running for 2m0s, 1/2 ready",
+		"  KIND         NAME     READY",
+		"  Deployment   engine   0/1",
+		"  StatefulSet  mongodb  1/1",
+		"  Pulling images:",
+		"    engine:v2 for engine-0 (40s)",
+	}, renderRolloutStatus(newTestRolloutStatus(now), now))
+
+	status := newTestRolloutStatus(now)
+	status.pulls = nil
+	for i := 0; i < progressMaxPulls+2; i++ {
+		status.pulls = append(status.pulls, k8s.ImagePull{Pod: "engine-0", Image: "engine:v2", Since: now})
+	}
+	lines := renderRolloutStatus(status, now)
+	assert.Equal(t, "    and 2 more", lines[len(lines)-1])
+}
+
+func TestSummarizeRolloutStatus(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, "Installing server: 1/2 workloads ready after 2m0s, waiting for engine 0/1, pulling engine:v2",
+		summarizeRolloutStatus(newTestRolloutStatus(now), now))
+
+	status := newTestRolloutStatus(now)
+	status.workloads[0].Ready = 1
+	status.pulls = nil
+	assert.Equal(t, "Installing server: 2/2 workloads ready after 2m0s", summarizeRolloutStatus(status, now))
+}
@@ -38,6 +38,11 @@ const (
 	PUSH_IMAGE_RETRY           = 3
 )
 
+var (
+	ErrDockerNotInstalled = errors.New("docker is not installed. docker is prerequisite, please install it and retry. https://docs.docker.com/engine/install/")
+	ErrDockerNotRunning   = errors.New("docker is not running")
+)
+
 type RegistryTagListResponse struct {
 	Name string
 	Tags []string
@@ -56,12 +61,13 @@ func IsRegistryReady(ctx context.Context, regPort string) (bool, error) {
 
 // WaitForRegistry waits for the in-cluster Zot registry to become reachable
 func WaitForRegistry(ctx context.Context, regPort string) error {
-	return utils.WaitForCondition(func() (bool, error) {
+	return utils.WaitForCondition(ctx, func() (bool, error) {
 		return IsRegistryReady(ctx, regPort)
 	}, 5*time.Second, 3*time.Minute)
 }
 
-func isImageInRegistry(ctx context.Context, image string, regPort string) (bool, error) {
+// IsImageInRegistry reports whether the tag of the image is in the local registry
+func IsImageInRegistry(ctx context.Context, image string, regPort string) (bool, error) {
 	imageParts := strings.SplitN(image, ":", 2)
 	imageTag := imageParts[1]
 	urlLength := strings.IndexRune(imageParts[0], '/')
@@ -132,7 +138,9 @@ func PullingImage(ctx context.Context, dockerClient docker.Client, image string)
 
 		if attempt < maxRetries {
 			log.Printf("Retrying in %s...\n", retryDelay)
-			time.Sleep(retryDelay)
+			if err := utils.Sleep(ctx, retryDelay); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -140,14 +148,19 @@ func PullingImage(ctx context.Context, dockerClient docker.Client, image string)
 	return fmt.Errorf("failed to pull image '%s' after %d attempts: %w", image, maxRetries, lastErr)
 }
 
-func CacheImage(ctx context.Context, dockerClient docker.Client, image string, regPort string) error {
-	targetImage := fmt.Sprintf(
+// GetRegistryImageName is the name of the image in the local registry, its registry host is replaced by the local one
+func GetRegistryImageName(image string, regPort string) string {
+	return fmt.Sprintf(
 		"127.0.0.1:%s%s",
 		regPort,
 		strings.TrimLeftFunc(image, func(r rune) bool {
 			return r != '/'
 		}),
 	)
+}
+
+func CacheImage(ctx context.Context, dockerClient docker.Client, image string, regPort string) error {
+	targetImage := GetRegistryImageName(image, regPort)
 
 	if err := dockerClient.ImageTag(ctx, image, targetImage); err != nil {
 		return err
@@ -170,7 +183,7 @@ func CacheImage(ctx context.Context, dockerClient docker.Client, image string, r
 			return fmt.Errorf("couldn't get docker output: %v", err)
 		}
 
-		imageAlreadyInRegistry, err := isImageInRegistry(ctx, image, regPort)
+		imageAlreadyInRegistry, err := IsImageInRegistry(ctx, image, regPort)
 		if err != nil {
 			return fmt.Errorf("failed to re-check image(%s) existents", image)
 		}
@@ -179,7 +192,9 @@ func CacheImage(ctx context.Context, dockerClient docker.Client, image string, r
 
 			if retry > 0 {
 				retry--
-				time.Sleep(10 * time.Second)
+				if err := utils.Sleep(ctx, 10*time.Second); err != nil {
+					return err
+				}
 				log.Warnf("Retry to push image %s ", image)
 				continue
 			}
@@ -198,7 +213,7 @@ func CacheImagesInParallel(ctx context.Context, images []string, regPort string,
 
 	imagesNotInRegistry := []string{}
 	for _, img := range images {
-		imageInRegistry, err := isImageInRegistry(ctx, img, regPort)
+		imageInRegistry, err := IsImageInRegistry(ctx, img, regPort)
 		if err != nil {
 			return fmt.Errorf("failed to check if image %s is in registry: %s", img, err)
 		}
@@ -215,40 +230,93 @@ func CacheImagesInParallel(ctx context.Context, images []string, regPort string,
 	}
 	if !isAirgap && len(imagesNotInRegistry) > 0 {
 		log.Info("Downloading docker images...")
-		if err := docker.PullDockerImages(dockerClient, imagesNotInRegistry); err != nil {
+		if err := log.TimePhase("Pulling images", func() error {
+			return docker.PullDockerImages(ctx, dockerClient, imagesNotInRegistry)
+		}); err != nil {
 			return fmt.Errorf("failed to pull images: %w", err)
 		}
 	}
 
+	// the first failure stops the other pushes, an interrupted push leaves no tag in the registry
+	pushCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	endPushPhase := log.StartPhase("Pushing docker images to Zot")
 	tm := utils.NewTaskManager(MAX_CONCURRENT_CACHE_IMAGE)
 	for _, img := range imagesNotInRegistry {
+		if pushCtx.Err() != nil {
+			break
+		}
 		tm.Add()
 		go func(img string) {
 			defer tm.Done()
-			if err := CacheImage(ctx, dockerClient, img, regPort); err != nil {
+			if err := CacheImage(pushCtx, dockerClient, img, regPort); err != nil && pushCtx.Err() == nil {
 				log.SendCloudReport("error", "Failed caching image", "Failed", &map[string]interface{}{"image": img, "error": err.Error()})
-				log.Fatalf("failed to cache %s: %s", img, err)
+				cancel(fmt.Errorf("failed to cache %s: %w", img, err))
 			}
 		}(img)
 	}
 	tm.Wait()
+	endPushPhase()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if pushCtx.Err() != nil {
+		return context.Cause(pushCtx)
+	}
 	log.SendCloudReport("info", "Successfully cached images in parallel", "Running", nil)
 	return nil
 }
 
-func CheckDockerRequirements(checkDockerRequirementImage string, isAirgap bool) error {
-	if os.Getenv("DISABLE_DOCKER_CHECKS") == "true" {
-		return nil
-	}
+// CheckDockerRunning checks that docker is installed and its daemon is reachable
+func CheckDockerRunning() error {
 	_, err := exec.LookPath("docker")
 	if err != nil {
-		return errors.New("docker is not installed. docker is prerequisite, please install it and retry. https://docs.docker.com/engine/install/")
+		return ErrDockerNotInstalled
 	}
 
 	cmd := exec.Command("docker", "ps")
 	err = cmd.Run()
 	if err != nil {
-		return errors.New("docker is not running")
+		return ErrDockerNotRunning
+	}
+	return nil
+}
+
+// GetDockerStorageKB returns the total and free storage (in KB) available to containers,
+// measured by running df inside the given image
+func GetDockerStorageKB(checkDockerRequirementImage string) (totalKB int64, freeKB int64, err error) {
+	runCmdStr := fmt.Sprintf("docker run --rm %s df -P /", checkDockerRequirementImage)
+	cmd := exec.Command("sh", "-c", runCmdStr)
+	dfOutputBytes, err := cmd.Output()
+	if err != nil {
+		return 0, 0, err
+	}
+	return parseDfOutput(string(dfOutputBytes))
+}
+
+// the output looks like this:
+// Filesystem           1024-blocks    Used Available Capacity Mounted on
+// overlay              345672852  98074428 229966016  30% /
+func parseDfOutput(dfOutput string) (totalKB int64, freeKB int64, err error) {
+	dfOutputLines := strings.Split(dfOutput, "\n")
+	if len(dfOutputLines) < 2 {
+		return 0, 0, fmt.Errorf("unexpected df output: %q", dfOutput)
+	}
+	dfOutputWords := strings.Fields(dfOutputLines[1])
+	if len(dfOutputWords) < 4 {
+		return 0, 0, fmt.Errorf("unexpected df output: %q", dfOutput)
+	}
+	totalKB, _ = strconv.ParseInt(dfOutputWords[1], 10, 64)
+	freeKB, _ = strconv.ParseInt(dfOutputWords[3], 10, 64)
+	return totalKB, freeKB, nil
+}
+
+func CheckDockerRequirements(ctx context.Context, checkDockerRequirementImage string, isAirgap bool) error {
+	if os.Getenv("DISABLE_DOCKER_CHECKS") == "true" {
+		return nil
+	}
+	if err := CheckDockerRunning(); err != nil {
+		return err
 	}
 
 	log.Println("Checking docker memory limits...")
@@ -256,10 +324,9 @@ func CheckDockerRequirements(checkDockerRequirementImage string, isAirgap bool)
 	if err != nil {
 		return fmt.Errorf("docker failed to get client: %w", err)
 	}
-	dockerInfo, err := dockerClient.Info(context.Background())
+	dockerInfo, err := dockerClient.Info(ctx)
 	if err != nil {
-		log.Fatalf("Failed getting docker info, %s", err)
-		return err
+		return fmt.Errorf("failed getting docker info: %w", err)
 	}
 	dockerMemoryPretty := fmt.Sprintf("%dGb", dockerInfo.MemTotal/(1024*1024*1024))
 	log.Printf("Docker has %s memory available.\n", dockerMemoryPretty)
@@ -268,15 +335,13 @@ func CheckDockerRequirements(checkDockerRequirementImage string, isAirgap bool)
 	log.Printf("Docker data root: %s\n", dockerInfo.DockerRootDir)
 
 	if !isAirgap {
-		_, err = dockerClient.ImagePull(context.Background(), checkDockerRequirementImage, dockerimage.PullOptions{})
+		_, err = dockerClient.ImagePull(ctx, checkDockerRequirementImage, dockerimage.PullOptions{})
 		if err != nil {
-			log.Fatalf("Failed pulling  %s image, %s", checkDockerRequirementImage, err)
+			return fmt.Errorf("failed pulling %s image: %w", checkDockerRequirementImage, err)
 		}
 	}
 
-	runCmdStr := fmt.Sprintf("docker run --rm %s df -P /", checkDockerRequirementImage)
-	cmd = exec.Command("sh", "-c", runCmdStr)
-	dfOutputBytes, err := cmd.Output()
+	dockerTotalStorageKB, dockerFreeStorageKB, err := GetDockerStorageKB(checkDockerRequirementImage)
 	if err != nil {
 		log.Warnf("Failed checking docker storage: %s", err)
 		if err := askToContinueWithStorageIssue("Unable to check docker storage. Do you want to continue anyway?"); err != nil {
@@ -284,15 +349,7 @@ func CheckDockerRequirements(checkDockerRequirementImage string, isAirgap bool)
 		}
 		return nil
 	}
-	// the output looks like this:
-	// Filesystem           1024-blocks    Used Available Capacity Mounted on
-	// overlay              345672852  98074428 229966016  30% /
-	dfOutput := string(dfOutputBytes)
-	dfOutputLines := strings.Split(dfOutput, "\n")
-	dfOutputWords := strings.Fields(dfOutputLines[1])
-	dockerTotalStorageKB, _ := strconv.Atoi(dfOutputWords[1])
 	dockerTotalStoragePretty := fmt.Sprintf("%dGb", dockerTotalStorageKB/(1024*1024))
-	dockerFreeStorageKB, _ := strconv.Atoi(dfOutputWords[3])
 	dockerFreeStoragePretty := fmt.Sprintf("%dGb", dockerFreeStorageKB/(1024*1024))
 	log.Printf("Docker has %s free storage available (%s total).\n", dockerFreeStoragePretty, dockerTotalStoragePretty)
 	var noResources bool
@@ -302,7 +359,7 @@ func CheckDockerRequirements(checkDockerRequirementImage string, isAirgap bool)
 		noResources = true
 	}
 
-	if int64(dockerFreeStorageKB) < REQUIRED_STORAGE_KB {
+	if dockerFreeStorageKB < REQUIRED_STORAGE_KB {
 		log.Printf("Please increase docker storage limit, tensorleap requires at least %s free storage\n", REQUIRED_STORAGE_PRETTY)
 		noResources = true
 	}
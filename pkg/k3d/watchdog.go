@@ -0,0 +1,196 @@
+package k3d
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/tensorleap/helm-charts/pkg/k8s"
+	"github.com/tensorleap/helm-charts/pkg/log"
+)
+
+const (
+	watchdogCheckInterval = 15 * time.Second
+	watchdogLogLines      = 20
+
+	DefaultWatchdogGracePeriod       = 5 * time.Minute
+	DefaultWatchdogCrashLoopRestarts = 5
+)
+
+// ErrUnrecoverablePods is the cause of stopping a helm wait by the watchdog
+var ErrUnrecoverablePods = errors.New("pods cannot become ready without intervention")
+
+// WatchdogError lists the issues that outlasted the grace period
+type WatchdogError struct {
+	Issues []k8s.PodIssue
+}
+
+func (e *WatchdogError) Error() string {
+	lines := make([]string, len(e.Issues))
+	for i, issue := range e.Issues {
+		lines[i] = "  " + issue.String()
+	}
+	return fmt.Sprintf("%s:\n%s", ErrUnrecoverablePods, strings.Join(lines, "\n"))
+}
+
+func (e *WatchdogError) Unwrap() error {
+	return ErrUnrecoverablePods
+}
+
+type WatchdogOptions struct {
+	Namespace string
+	// GracePeriod is how long an unrecoverable issue may last before the watchdog cancels its context
+	GracePeriod time.Duration
+	// CrashLoopRestarts is the number of restarts after which a crash loop is unrecoverable
+	CrashLoopRestarts int32
+	// RemediateDiskPressure, when set, is called to free space when the node has DiskPressure
+	RemediateDiskPressure DiskPressureRemediation
+}
+
+// Watchdog watches the node and the pods of a namespace while helm waits for a release. It warns about
+// DiskPressure and failing pods, and when a pod stays in an unrecoverable state for the grace period it
+// prints a diagnosis and cancels its context, which the helm actions run with. The context is also
+// canceled with the parent context given to StartWatchdog.
+type Watchdog struct {
+	ctx  context.Context
+	stop context.CancelFunc
+	done chan struct{}
+}
+
+func StartWatchdog(parent context.Context, kubeConfigPath, kubeContext string, opts WatchdogOptions) (*Watchdog, error) {
+	clientset, err := k8s.NewClientset(kubeConfigPath, kubeContext)
+	if err != nil {
+		return nil, fmt.Errorf("watchdog: %w", err)
+	}
+	if opts.GracePeriod <= 0 {
+		opts.GracePeriod = DefaultWatchdogGracePeriod
+	}
+	if opts.CrashLoopRestarts <= 0 {
+		opts.CrashLoopRestarts = DefaultWatchdogCrashLoopRestarts
+	}
+
+	ctx, cancel := context.WithCancelCause(parent)
+	runCtx, stop := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	disk := newDiskPressureWatcher(clientset, opts.RemediateDiskPressure, emitDiskPressureWarning)
+	pods := newPodWatcher(clientset, opts)
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(watchdogCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-runCtx.Done():
+				return
+			case <-ticker.C:
+				disk.check(runCtx)
+				if err := pods.check(runCtx); err != nil {
+					cancel(err)
+					return
+				}
+			}
+		}
+	}()
+
+	return &Watchdog{ctx: ctx, stop: stop, done: done}, nil
+}
+
+// Context is canceled when the watchdog gives up on the pods
+func (w *Watchdog) Context() context.Context {
+	return w.ctx
+}
+
+func (w *Watchdog) Stop() {
+	w.stop()
+	<-w.done
+}
+
+// Err returns the *WatchdogError when the watchdog canceled its context, nil otherwise
+func (w *Watchdog) Err() error {
+	var err *WatchdogError
+	if errors.As(context.Cause(w.ctx), &err) {
+		return err
+	}
+	return nil
+}
+
+type podWatcher struct {
+	clientset kubernetes.Interface
+	opts      WatchdogOptions
+	now       func() time.Time
+	// firstSeen is when each current unrecoverable issue was first seen
+	firstSeen map[string]time.Time
+}
+
+func newPodWatcher(clientset kubernetes.Interface, opts WatchdogOptions) *podWatcher {
+	return &podWatcher{clientset: clientset, opts: opts, now: time.Now, firstSeen: map[string]time.Time{}}
+}
+
+func podIssueKey(issue k8s.PodIssue) string {
+	return issue.Pod + "/" + issue.Container + "/" + issue.Reason
+}
+
+// check returns a *WatchdogError when unrecoverable issues lasted the grace period, failing
+// to list the pods is not an error since the api server may be restarting
+func (w *podWatcher) check(ctx context.Context) error {
+	_, issues, err := k8s.ListPodIssues(ctx, w.clientset, w.opts.Namespace)
+	if err != nil {
+		return nil
+	}
+	if pvcIssues, err := k8s.ListPVCIssues(ctx, w.clientset, w.opts.Namespace); err == nil {
+		issues = append(issues, pvcIssues...)
+	}
+
+	now := w.now()
+	current := map[string]bool{}
+	var expired []k8s.PodIssue
+	for _, issue := range issues {
+		if !k8s.IsUnrecoverable(issue, w.opts.CrashLoopRestarts) {
+			continue
+		}
+		key := podIssueKey(issue)
+		current[key] = true
+		firstSeen, ok := w.firstSeen[key]
+		if !ok {
+			w.firstSeen[key] = now
+			log.Warnf("%s, stopping if it does not recover within %s", issue.String(), w.opts.GracePeriod)
+			continue
+		}
+		if now.Sub(firstSeen) >= w.opts.GracePeriod {
+			expired = append(expired, issue)
+		}
+	}
+	for key := range w.firstSeen {
+		if !current[key] {
+			delete(w.firstSeen, key)
+		}
+	}
+	if len(expired) == 0 {
+		return nil
+	}
+
+	w.printDiagnosis(ctx, expired)
+	log.SendCloudReport("error", "Watchdog stopped helm wait", "Failed", &map[string]interface{}{"issues": expired})
+	return &WatchdogError{Issues: expired}
+}
+
+func (w *podWatcher) printDiagnosis(ctx context.Context, issues []k8s.PodIssue) {
+	for _, issue := range issues {
+		log.Errorf("%s did not recover within %s", issue.String(), w.opts.GracePeriod)
+		if issue.Container == "" || issue.Reason == k8s.ReasonImagePull {
+			continue
+		}
+		previous := issue.Restarts > 0
+		logs, err := k8s.GetLogTail(ctx, w.clientset, w.opts.Namespace, issue.Pod, issue.Container, watchdogLogLines, previous)
+		if err != nil || logs == "" {
+			continue
+		}
+		log.Errorf("Last log lines of %s/%s:\n%s", issue.Pod, issue.Container, logs)
+	}
+}
@@ -0,0 +1,75 @@
+package k3d
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/tensorleap/helm-charts/pkg/k8s"
+)
+
+func newWaitingPod(name, reason string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "tensorleap"},
+		Status: corev1.PodStatus{Phase: corev1.PodPending, ContainerStatuses: []corev1.ContainerStatus{{
+			Name:  "main",
+			State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: reason, Message: "back-off pulling image"}},
+		}}},
+	}
+}
+
+func TestPodWatcherGracePeriod(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset(newWaitingPod("engine", "ImagePullBackOff"), newWaitingPod("web", "ContainerCreating"))
+	watcher := newPodWatcher(clientset, WatchdogOptions{Namespace: "tensorleap", GracePeriod: time.Minute, CrashLoopRestarts: 3})
+	now := time.Now()
+	watcher.now = func() time.Time { return now }
+
+	require.NoError(t, watcher.check(ctx))
+	assert.Len(t, watcher.firstSeen, 1)
+
+	now = now.Add(30 * time.Second)
+	require.NoError(t, watcher.check(ctx), "within the grace period")
+
+	now = now.Add(30 * time.Second)
+	err := watcher.check(ctx)
+	var watchdogErr *WatchdogError
+	require.ErrorAs(t, err, &watchdogErr)
+	assert.ErrorIs(t, err, ErrUnrecoverablePods)
+	assert.Equal(t, []k8s.PodIssue{{Pod: "engine", Container: "main", Reason: k8s.ReasonImagePull, Message: "back-off pulling image"}}, watchdogErr.Issues)
+	assert.Contains(t, err.Error(), "engine/main: ImagePullBackOff")
+}
+
+func TestPodWatcherRecoveredIssueRestartsGracePeriod(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset(newWaitingPod("engine", "ErrImagePull"))
+	watcher := newPodWatcher(clientset, WatchdogOptions{Namespace: "tensorleap", GracePeriod: time.Minute, CrashLoopRestarts: 3})
+	now := time.Now()
+	watcher.now = func() time.Time { return now }
+
+	require.NoError(t, watcher.check(ctx))
+
+	running := newWaitingPod("engine", "")
+	running.Status.ContainerStatuses[0].State = corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}
+	_, err := clientset.CoreV1().Pods("tensorleap").UpdateStatus(ctx, running, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	now = now.Add(2 * time.Minute)
+	require.NoError(t, watcher.check(ctx))
+	assert.Empty(t, watcher.firstSeen)
+}
+
+func TestWatchdogErr(t *testing.T) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	watchdog := &Watchdog{ctx: ctx}
+	assert.NoError(t, watchdog.Err())
+
+	cancel(&WatchdogError{Issues: []k8s.PodIssue{{Pod: "engine", Reason: k8s.ReasonOOMKilled}}})
+	assert.True(t, errors.Is(watchdog.Err(), ErrUnrecoverablePods))
+}
@@ -0,0 +1,49 @@
+package k8s
+
+import (
+	"fmt"
+
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// NewClientset creates a kubernetes clientset from a kubeconfig file and context
+func NewClientset(kubeConfigPath, kubeContext string) (kubernetes.Interface, error) {
+	restConfig, err := newRestConfig(kubeConfigPath, kubeContext)
+	if err != nil {
+		return nil, err
+	}
+
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+	return clientset, nil
+}
+
+// NewDynamicClient creates a client for custom resources from a kubeconfig file and context
+func NewDynamicClient(kubeConfigPath, kubeContext string) (dynamic.Interface, error) {
+	restConfig, err := newRestConfig(kubeConfigPath, kubeContext)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes dynamic client: %w", err)
+	}
+	return client, nil
+}
+
+func newRestConfig(kubeConfigPath, kubeContext string) (*rest.Config, error) {
+	restConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		&clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeConfigPath},
+		&clientcmd.ConfigOverrides{CurrentContext: kubeContext},
+	).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build kubeconfig: %w", err)
+	}
+	return restConfig, nil
+}
@@ -0,0 +1,196 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	ReasonImagePull     = "ImagePullBackOff"
+	ReasonCrashLoop     = "CrashLoopBackOff"
+	ReasonOOMKilled     = "OOMKilled"
+	ReasonUnschedulable = "Unschedulable"
+	ReasonConfigError   = "CreateContainerConfigError"
+	ReasonFailed        = "Failed"
+	ReasonPVCBinding    = "PVCBindingFailed"
+)
+
+// PodIssue describes a pod that is stuck or failing
+type PodIssue struct {
+	Pod       string `json:"pod"`
+	Container string `json:"container,omitempty"`
+	Reason    string `json:"reason"`
+	Message   string `json:"message,omitempty"`
+	Restarts  int32  `json:"restarts,omitempty"`
+}
+
+func (i PodIssue) String() string {
+	name := i.Pod
+	if i.Container != "" {
+		name = fmt.Sprintf("%s/%s", i.Pod, i.Container)
+	}
+	if i.Message == "" {
+		return fmt.Sprintf("%s: %s", name, i.Reason)
+	}
+	return fmt.Sprintf("%s: %s (%s)", name, i.Reason, i.Message)
+}
+
+// ListPodIssues lists the pods in the namespace and returns all of them along with the detected issues
+func ListPodIssues(ctx context.Context, clientset kubernetes.Interface, namespace string) ([]corev1.Pod, []PodIssue, error) {
+	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list pods in namespace %s: %w", namespace, err)
+	}
+
+	var issues []PodIssue
+	for i := range pods.Items {
+		issues = append(issues, GetPodIssues(&pods.Items[i])...)
+	}
+	return pods.Items, issues, nil
+}
+
+// GetPodIssues returns the issues of a single pod, completed pods never have issues
+func GetPodIssues(pod *corev1.Pod) []PodIssue {
+	if pod.Status.Phase == corev1.PodSucceeded {
+		return nil
+	}
+	if pod.Status.Phase == corev1.PodFailed {
+		return []PodIssue{{Pod: pod.Name, Reason: ReasonFailed, Message: pod.Status.Message}}
+	}
+
+	var issues []PodIssue
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodScheduled && cond.Status == corev1.ConditionFalse && cond.Reason == corev1.PodReasonUnschedulable {
+			issues = append(issues, PodIssue{Pod: pod.Name, Reason: ReasonUnschedulable, Message: cond.Message})
+		}
+	}
+
+	statuses := append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...)
+	statuses = append(statuses, pod.Status.ContainerStatuses...)
+	for _, cs := range statuses {
+		if issue, ok := getContainerIssue(pod.Name, cs); ok {
+			issues = append(issues, issue)
+		}
+	}
+	return issues
+}
+
+func getContainerIssue(podName string, cs corev1.ContainerStatus) (PodIssue, bool) {
+	issue := PodIssue{Pod: podName, Container: cs.Name, Restarts: cs.RestartCount}
+
+	if waiting := cs.State.Waiting; waiting != nil {
+		switch waiting.Reason {
+		case "ImagePullBackOff", "ErrImagePull", "InvalidImageName", "ErrImageNeverPull":
+			issue.Reason = ReasonImagePull
+		case "CrashLoopBackOff":
+			issue.Reason = ReasonCrashLoop
+			if last := cs.LastTerminationState.Terminated; last != nil && last.Reason == ReasonOOMKilled {
+				issue.Reason = ReasonOOMKilled
+			}
+		case "CreateContainerConfigError", "CreateContainerError":
+			issue.Reason = ReasonConfigError
+		default:
+			return PodIssue{}, false
+		}
+		issue.Message = waiting.Message
+		return issue, true
+	}
+
+	if terminated := cs.State.Terminated; terminated != nil && terminated.Reason == ReasonOOMKilled {
+		issue.Reason = ReasonOOMKilled
+		return issue, true
+	}
+	return PodIssue{}, false
+}
+
+// IsPodReady reports whether the pod has the Ready condition, completed pods count as ready
+func IsPodReady(pod *corev1.Pod) bool {
+	if pod.Status.Phase == corev1.PodSucceeded {
+		return true
+	}
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// IsUnrecoverable reports whether the issue needs intervention: image pull errors, OOM kills,
+// crash loops with at least crashLoopRestarts restarts, pods that do not fit the node resources
+// or wait for volume claims that cannot be bound. Pods waiting for other pods are not unrecoverable.
+func IsUnrecoverable(issue PodIssue, crashLoopRestarts int32) bool {
+	switch issue.Reason {
+	case ReasonImagePull, ReasonOOMKilled, ReasonPVCBinding, ReasonConfigError:
+		return true
+	case ReasonCrashLoop:
+		return issue.Restarts >= crashLoopRestarts
+	case ReasonUnschedulable:
+		for _, cause := range []string{"Insufficient cpu", "Insufficient memory", "Insufficient nvidia.com/gpu", "unbound immediate PersistentVolumeClaims"} {
+			if strings.Contains(issue.Message, cause) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ListPVCIssues returns the pending volume claims of the namespace that have provisioning or binding warnings
+func ListPVCIssues(ctx context.Context, clientset kubernetes.Interface, namespace string) ([]PodIssue, error) {
+	pvcs, err := clientset.CoreV1().PersistentVolumeClaims(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list volume claims in namespace %s: %w", namespace, err)
+	}
+	pending := map[string]bool{}
+	for _, pvc := range pvcs.Items {
+		if pvc.Status.Phase == corev1.ClaimPending {
+			pending[pvc.Name] = true
+		}
+	}
+	if len(pending) == 0 {
+		return nil, nil
+	}
+
+	events, err := clientset.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: "involvedObject.kind=PersistentVolumeClaim,type=Warning",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events in namespace %s: %w", namespace, err)
+	}
+	sort.SliceStable(events.Items, func(i, j int) bool {
+		return events.Items[i].LastTimestamp.After(events.Items[j].LastTimestamp.Time)
+	})
+	var issues []PodIssue
+	seen := map[string]bool{}
+	for _, event := range events.Items {
+		name := event.InvolvedObject.Name
+		if event.InvolvedObject.Kind != "PersistentVolumeClaim" || event.Type != corev1.EventTypeWarning || !pending[name] || seen[name] {
+			continue
+		}
+		if event.Reason != "ProvisioningFailed" && event.Reason != "FailedBinding" {
+			continue
+		}
+		seen[name] = true
+		issues = append(issues, PodIssue{Pod: "pvc/" + name, Reason: ReasonPVCBinding, Message: event.Message})
+	}
+	return issues, nil
+}
+
+// GetLogTail returns the last lines of a container log, previous gets the log of the last terminated run
+func GetLogTail(ctx context.Context, clientset kubernetes.Interface, namespace, pod, container string, lines int64, previous bool) (string, error) {
+	data, err := clientset.CoreV1().Pods(namespace).GetLogs(pod, &corev1.PodLogOptions{
+		Container: container,
+		Previous:  previous,
+		TailLines: &lines,
+	}).DoRaw(ctx)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\n"), nil
+}
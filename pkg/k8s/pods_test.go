@@ -0,0 +1,116 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestGetPodIssues(t *testing.T) {
+	newPod := func(status corev1.PodStatus) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "engine"}, Status: status}
+	}
+	waiting := func(reason string) corev1.ContainerStatus {
+		return corev1.ContainerStatus{Name: "main", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: reason}}}
+	}
+
+	tests := []struct {
+		name    string
+		pod     *corev1.Pod
+		reasons []string
+	}{
+		{
+			name: "healthy pod",
+			pod: newPod(corev1.PodStatus{Phase: corev1.PodRunning, ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "main", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+			}}),
+		},
+		{
+			name: "completed pod is ignored",
+			pod:  newPod(corev1.PodStatus{Phase: corev1.PodSucceeded}),
+		},
+		{
+			name:    "image pull back off",
+			pod:     newPod(corev1.PodStatus{Phase: corev1.PodPending, ContainerStatuses: []corev1.ContainerStatus{waiting("ErrImagePull")}}),
+			reasons: []string{ReasonImagePull},
+		},
+		{
+			name: "crash loop after OOM",
+			pod: newPod(corev1.PodStatus{Phase: corev1.PodRunning, ContainerStatuses: []corev1.ContainerStatus{{
+				Name:                 "main",
+				State:                corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+				LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: ReasonOOMKilled}},
+			}}}),
+			reasons: []string{ReasonOOMKilled},
+		},
+		{
+			name:    "crash loop in init container",
+			pod:     newPod(corev1.PodStatus{Phase: corev1.PodPending, InitContainerStatuses: []corev1.ContainerStatus{waiting("CrashLoopBackOff")}}),
+			reasons: []string{ReasonCrashLoop},
+		},
+		{
+			name: "unschedulable",
+			pod: newPod(corev1.PodStatus{Phase: corev1.PodPending, Conditions: []corev1.PodCondition{
+				{Type: corev1.PodScheduled, Status: corev1.ConditionFalse, Reason: corev1.PodReasonUnschedulable, Message: "0/1 nodes are available"},
+			}}),
+			reasons: []string{ReasonUnschedulable},
+		},
+		{
+			name:    "container creating is not an issue",
+			pod:     newPod(corev1.PodStatus{Phase: corev1.PodPending, ContainerStatuses: []corev1.ContainerStatus{waiting("ContainerCreating")}}),
+			reasons: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reasons []string
+			for _, issue := range GetPodIssues(tt.pod) {
+				reasons = append(reasons, issue.Reason)
+			}
+			assert.Equal(t, tt.reasons, reasons)
+		})
+	}
+}
+
+func TestIsUnrecoverable(t *testing.T) {
+	assert.True(t, IsUnrecoverable(PodIssue{Reason: ReasonImagePull}, 5))
+	assert.True(t, IsUnrecoverable(PodIssue{Reason: ReasonOOMKilled}, 5))
+	assert.False(t, IsUnrecoverable(PodIssue{Reason: ReasonCrashLoop, Restarts: 2}, 5))
+	assert.True(t, IsUnrecoverable(PodIssue{Reason: ReasonCrashLoop, Restarts: 5}, 5))
+	assert.True(t, IsUnrecoverable(PodIssue{Reason: ReasonUnschedulable, Message: "0/1 nodes are available: 1 Insufficient memory."}, 5))
+	assert.True(t, IsUnrecoverable(PodIssue{Reason: ReasonUnschedulable, Message: "0/1 nodes are available: pod has unbound immediate PersistentVolumeClaims."}, 5))
+	assert.False(t, IsUnrecoverable(PodIssue{Reason: ReasonUnschedulable, Message: "0/1 nodes are available: 1 node(s) had untolerated taint."}, 5))
+	assert.False(t, IsUnrecoverable(PodIssue{Reason: ReasonFailed}, 5))
+}
+
+func TestListPVCIssues(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset(
+		&corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "mongo", Namespace: "tensorleap"}, Status: corev1.PersistentVolumeClaimStatus{Phase: corev1.ClaimPending}},
+		&corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "minio", Namespace: "tensorleap"}, Status: corev1.PersistentVolumeClaimStatus{Phase: corev1.ClaimBound}},
+		&corev1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Name: "mongo.1", Namespace: "tensorleap"},
+			InvolvedObject: corev1.ObjectReference{Kind: "PersistentVolumeClaim", Name: "mongo"},
+			Type:           corev1.EventTypeWarning,
+			Reason:         "ProvisioningFailed",
+			Message:        "failed to provision volume: no space left on device",
+		},
+		&corev1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Name: "minio.1", Namespace: "tensorleap"},
+			InvolvedObject: corev1.ObjectReference{Kind: "PersistentVolumeClaim", Name: "minio"},
+			Type:           corev1.EventTypeWarning,
+			Reason:         "ProvisioningFailed",
+			Message:        "resolved since",
+		},
+	)
+
+	issues, err := ListPVCIssues(ctx, clientset, "tensorleap")
+	require.NoError(t, err)
+	assert.Equal(t, []PodIssue{{Pod: "pvc/mongo", Reason: ReasonPVCBinding, Message: "failed to provision volume: no space left on device"}}, issues)
+}
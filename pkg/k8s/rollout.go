@@ -0,0 +1,151 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// helmReleaseAnnotation is set by helm on every resource of a release
+const helmReleaseAnnotation = "meta.helm.sh/release-name"
+
+var elasticsearchResource = schema.GroupVersionResource{Group: "elasticsearch.k8s.elastic.co", Version: "v1", Resource: "elasticsearches"}
+
+// ImagePull is an image a pod is pulling
+type ImagePull struct {
+	Pod   string    `json:"pod"`
+	Image string    `json:"image"`
+	Since time.Time `json:"since"`
+}
+
+// ListReleaseWorkloads returns the deployments, statefulsets, jobs and elasticsearch clusters of a helm release.
+// Elasticsearch clusters are skipped when dynamicClient is nil or the CRD is not installed yet.
+func ListReleaseWorkloads(ctx context.Context, clientset kubernetes.Interface, dynamicClient dynamic.Interface, namespace, release string) ([]Workload, error) {
+	inRelease := func(meta metav1.ObjectMeta) bool {
+		return meta.Annotations[helmReleaseAnnotation] == release
+	}
+	workloads, err := listWorkloads(ctx, clientset, namespace, inRelease)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs, err := clientset.BatchV1().Jobs(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs in namespace %s: %w", namespace, err)
+	}
+	for _, job := range jobs.Items {
+		if !inRelease(job.ObjectMeta) {
+			continue
+		}
+		desired := int32(1)
+		if job.Spec.Completions != nil {
+			desired = *job.Spec.Completions
+		}
+		workloads = append(workloads, Workload{Kind: "Job", Name: job.Name, Ready: job.Status.Succeeded, Desired: desired})
+	}
+
+	if dynamicClient != nil {
+		clusters, err := dynamicClient.Resource(elasticsearchResource).Namespace(namespace).List(ctx, metav1.ListOptions{})
+		if err == nil {
+			for _, cluster := range clusters.Items {
+				if cluster.GetAnnotations()[helmReleaseAnnotation] != release {
+					continue
+				}
+				workloads = append(workloads, elasticsearchWorkload(&cluster))
+			}
+		}
+	}
+
+	sortWorkloads(workloads)
+	return workloads, nil
+}
+
+func elasticsearchWorkload(cluster *unstructured.Unstructured) Workload {
+	workload := Workload{Kind: "Elasticsearch", Name: cluster.GetName()}
+	nodeSets, _, _ := unstructured.NestedSlice(cluster.Object, "spec", "nodeSets")
+	for _, nodeSet := range nodeSets {
+		if m, ok := nodeSet.(map[string]interface{}); ok {
+			count, _, _ := unstructured.NestedInt64(m, "count")
+			workload.Desired += int32(count)
+		}
+	}
+	available, _, _ := unstructured.NestedInt64(cluster.Object, "status", "availableNodes")
+	workload.Ready = int32(available)
+	return workload
+}
+
+// ListPullingImages returns the images the pods of the namespace started pulling and did not finish, oldest first
+func ListPullingImages(ctx context.Context, clientset kubernetes.Interface, namespace string) ([]ImagePull, error) {
+	events, err := clientset.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{FieldSelector: "involvedObject.kind=Pod"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events in namespace %s: %w", namespace, err)
+	}
+	sort.SliceStable(events.Items, func(i, j int) bool {
+		return eventTime(&events.Items[i]).Before(eventTime(&events.Items[j]))
+	})
+
+	latest := map[string]*ImagePull{}
+	for i := range events.Items {
+		event := &events.Items[i]
+		if event.InvolvedObject.Kind != "Pod" {
+			continue
+		}
+		image := quotedValue(event.Message)
+		if image == "" {
+			continue
+		}
+		key := event.InvolvedObject.Name + " " + image
+		switch event.Reason {
+		case "Pulling":
+			if _, ok := latest[key]; !ok {
+				latest[key] = &ImagePull{Pod: event.InvolvedObject.Name, Image: image, Since: eventTime(event)}
+			}
+		case "Pulled", "Failed", "BackOff":
+			delete(latest, key)
+		}
+	}
+
+	pulls := []ImagePull{}
+	for _, pull := range latest {
+		pulls = append(pulls, *pull)
+	}
+	sort.Slice(pulls, func(i, j int) bool {
+		if !pulls[i].Since.Equal(pulls[j].Since) {
+			return pulls[i].Since.Before(pulls[j].Since)
+		}
+		return pulls[i].Pod < pulls[j].Pod
+	})
+	return pulls, nil
+}
+
+func eventTime(event *corev1.Event) time.Time {
+	switch {
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	}
+	return event.CreationTimestamp.Time
+}
+
+// quotedValue returns the first double quoted value of an event message, e.g. the image of `Pulling image "mongo:6"`
+func quotedValue(message string) string {
+	_, rest, ok := strings.Cut(message, `"`)
+	if !ok {
+		return ""
+	}
+	value, _, ok := strings.Cut(rest, `"`)
+	if !ok {
+		return ""
+	}
+	return value
+}
@@ -0,0 +1,87 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestListReleaseWorkloads(t *testing.T) {
+	meta := func(name, release string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Name: name, Namespace: "tensorleap", Annotations: map[string]string{helmReleaseAnnotation: release}}
+	}
+	replicas := int32(2)
+	clientset := fake.NewSimpleClientset(
+		&appsv1.Deployment{ObjectMeta: meta("node-server", "tensorleap"), Spec: appsv1.DeploymentSpec{Replicas: &replicas}, Status: appsv1.DeploymentStatus{ReadyReplicas: 1}},
+		&appsv1.Deployment{ObjectMeta: meta("zot", "tensorleap-infra"), Status: appsv1.DeploymentStatus{ReadyReplicas: 1}},
+		&appsv1.StatefulSet{ObjectMeta: meta("mongodb", "tensorleap"), Status: appsv1.StatefulSetStatus{ReadyReplicas: 1}},
+		&batchv1.Job{ObjectMeta: meta("migrate", "tensorleap")},
+	)
+	elasticsearch := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "elasticsearch.k8s.elastic.co/v1",
+		"kind":       "Elasticsearch",
+		"metadata": map[string]interface{}{
+			"name":        "elastic",
+			"namespace":   "tensorleap",
+			"annotations": map[string]interface{}{helmReleaseAnnotation: "tensorleap"},
+		},
+		"spec":   map[string]interface{}{"nodeSets": []interface{}{map[string]interface{}{"count": int64(1)}, map[string]interface{}{"count": int64(2)}}},
+		"status": map[string]interface{}{"availableNodes": int64(3)},
+	}}
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{elasticsearchResource: "ElasticsearchList"})
+	_, err := dynamicClient.Resource(elasticsearchResource).Namespace("tensorleap").Create(context.Background(), elasticsearch, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	workloads, err := ListReleaseWorkloads(context.Background(), clientset, dynamicClient, "tensorleap", "tensorleap")
+	require.NoError(t, err)
+	assert.Equal(t, []Workload{
+		{Kind: "Deployment", Name: "node-server", Ready: 1, Desired: 2},
+		{Kind: "Elasticsearch", Name: "elastic", Ready: 3, Desired: 3},
+		{Kind: "Job", Name: "migrate", Ready: 0, Desired: 1},
+		{Kind: "StatefulSet", Name: "mongodb", Ready: 1, Desired: 1},
+	}, workloads)
+
+	workloads, err = ListReleaseWorkloads(context.Background(), clientset, nil, "tensorleap", "tensorleap-infra")
+	require.NoError(t, err)
+	assert.Equal(t, []Workload{{Kind: "Deployment", Name: "zot", Ready: 1, Desired: 1}}, workloads)
+}
+
+func TestListPullingImages(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	event := func(name, pod, reason, message string, at time.Duration) *corev1.Event {
+		return &corev1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Name: name, Namespace: "tensorleap"},
+			InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: pod},
+			Reason:         reason,
+			Message:        message,
+			LastTimestamp:  metav1.NewTime(start.Add(at)),
+		}
+	}
+	clientset := fake.NewSimpleClientset(
+		event("e1", "engine", "Pulling", `Pulling image "engine:v2"`, 2*time.Second),
+		event("e2", "mongodb", "Pulling", `Pulling image "mongo:6"`, time.Second),
+		event("e3", "mongodb", "Pulled", `Successfully pulled image "mongo:6" in 3s`, 4*time.Second),
+		event("e4", "web-ui", "Pulling", `Pulling image "web-ui:v2"`, time.Second),
+		event("e5", "web-ui", "Started", `Started container web-ui`, 5*time.Second),
+	)
+
+	pulls, err := ListPullingImages(context.Background(), clientset, "tensorleap")
+	require.NoError(t, err)
+	assert.Equal(t, []ImagePull{
+		{Pod: "web-ui", Image: "web-ui:v2", Since: start.Add(time.Second)},
+		{Pod: "engine", Image: "engine:v2", Since: start.Add(2 * time.Second)},
+	}, pulls)
+}
@@ -0,0 +1,73 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Workload is a readiness summary of a deployment or statefulset
+type Workload struct {
+	Kind    string `json:"kind"`
+	Name    string `json:"name"`
+	Ready   int32  `json:"ready"`
+	Desired int32  `json:"desired"`
+}
+
+func (w Workload) IsReady() bool {
+	return w.Ready >= w.Desired
+}
+
+// ListWorkloads returns the deployments and statefulsets of the namespace sorted by kind and name
+func ListWorkloads(ctx context.Context, clientset kubernetes.Interface, namespace string) ([]Workload, error) {
+	return listWorkloads(ctx, clientset, namespace, func(metav1.ObjectMeta) bool { return true })
+}
+
+func listWorkloads(ctx context.Context, clientset kubernetes.Interface, namespace string, include func(metav1.ObjectMeta) bool) ([]Workload, error) {
+	var workloads []Workload
+
+	deployments, err := clientset.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deployments in namespace %s: %w", namespace, err)
+	}
+	for _, d := range deployments.Items {
+		if !include(d.ObjectMeta) {
+			continue
+		}
+		desired := int32(1)
+		if d.Spec.Replicas != nil {
+			desired = *d.Spec.Replicas
+		}
+		workloads = append(workloads, Workload{Kind: "Deployment", Name: d.Name, Ready: d.Status.ReadyReplicas, Desired: desired})
+	}
+
+	statefulSets, err := clientset.AppsV1().StatefulSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list statefulsets in namespace %s: %w", namespace, err)
+	}
+	for _, s := range statefulSets.Items {
+		if !include(s.ObjectMeta) {
+			continue
+		}
+		desired := int32(1)
+		if s.Spec.Replicas != nil {
+			desired = *s.Spec.Replicas
+		}
+		workloads = append(workloads, Workload{Kind: "StatefulSet", Name: s.Name, Ready: s.Status.ReadyReplicas, Desired: desired})
+	}
+
+	sortWorkloads(workloads)
+	return workloads, nil
+}
+
+func sortWorkloads(workloads []Workload) {
+	sort.Slice(workloads, func(i, j int) bool {
+		if workloads[i].Kind != workloads[j].Kind {
+			return workloads[i].Kind < workloads[j].Kind
+		}
+		return workloads[i].Name < workloads[j].Name
+	})
+}
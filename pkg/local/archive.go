@@ -0,0 +1,140 @@
+package local
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// AddDirToTar writes srcDir recursively into the tar under prefix, keeping modes and ownership
+func AddDirToTar(tarWriter *tar.Writer, srcDir, prefix string) error {
+	return filepath.Walk(srcDir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsPermission(err) {
+				return fmt.Errorf("%w, try running the command with sudo", err)
+			}
+			return err
+		}
+		relPath, err := filepath.Rel(srcDir, filePath)
+		if err != nil {
+			return err
+		}
+
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(filePath); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = path.Join(prefix, filepath.ToSlash(relPath))
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		file, err := os.Open(filePath)
+		if err != nil {
+			if os.IsPermission(err) {
+				return fmt.Errorf("%w, try running the command with sudo", err)
+			}
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(tarWriter, file)
+		return err
+	})
+}
+
+// ExtractTarEntry writes a single tar entry under destDir, entries escaping destDir are rejected
+func ExtractTarEntry(header *tar.Header, reader io.Reader, destDir, name string) error {
+	target := filepath.Join(destDir, filepath.FromSlash(name))
+	if !isInDir(destDir, target) {
+		return fmt.Errorf("invalid archive entry: %s", header.Name)
+	}
+	mode := os.FileMode(header.Mode).Perm()
+
+	switch header.Typeflag {
+	case tar.TypeDir:
+		if err := os.MkdirAll(target, 0777); err != nil {
+			return err
+		}
+		if err := os.Chmod(target, mode); err != nil {
+			return err
+		}
+	case tar.TypeReg:
+		if err := os.MkdirAll(filepath.Dir(target), 0777); err != nil {
+			return err
+		}
+		// a directory of the path may be a link extracted before, the file must still land under destDir
+		if err := checkResolvedInDir(destDir, filepath.Dir(target), header.Name); err != nil {
+			return err
+		}
+		file, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(file, reader); err != nil {
+			file.Close()
+			return err
+		}
+		if err := file.Close(); err != nil {
+			return err
+		}
+	case tar.TypeSymlink:
+		// links may only point inside destDir, otherwise a later entry could be written through them outside of it
+		linkTarget := filepath.Join(filepath.Dir(target), filepath.FromSlash(header.Linkname))
+		if filepath.IsAbs(header.Linkname) || !isInDir(destDir, linkTarget) {
+			return fmt.Errorf("invalid archive entry: %s links outside of the archive to %s", header.Name, header.Linkname)
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0777); err != nil {
+			return err
+		}
+		if err := checkResolvedInDir(destDir, filepath.Dir(target), header.Name); err != nil {
+			return err
+		}
+		if err := os.Symlink(header.Linkname, target); err != nil {
+			return err
+		}
+	default:
+		return nil
+	}
+
+	// Keep the owners the database containers expect, only possible when running as root
+	_ = os.Lchown(target, header.Uid, header.Gid)
+	return nil
+}
+
+func isInDir(dir, target string) bool {
+	dir = filepath.Clean(dir)
+	target = filepath.Clean(target)
+	return target == dir || strings.HasPrefix(target, dir+string(os.PathSeparator))
+}
+
+// checkResolvedInDir checks that subDir, with its links resolved, is still under dir
+func checkResolvedInDir(dir, subDir, entryName string) error {
+	resolvedDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	resolvedSubDir, err := filepath.EvalSymlinks(subDir)
+	if err != nil {
+		return err
+	}
+	if !isInDir(resolvedDir, resolvedSubDir) {
+		return fmt.Errorf("invalid archive entry: %s is written through a link outside of the archive", entryName)
+	}
+	return nil
+}
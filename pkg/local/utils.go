@@ -1,12 +1,14 @@
 package local
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/tensorleap/helm-charts/pkg/k8s"
@@ -25,7 +27,10 @@ const (
 	MINIO_STORAGE_DIR_NAME          = "storage/minio"
 	HOSTNAME_FILE                   = "hostname"
 	MANIFEST_DIR_NAME               = "manifests"
+	MANIFEST_HISTORY_DIR_NAME       = "manifests/history"
 	INSTALLATION_PARAMS_FILE_NAME   = "params.yaml"
+	PENDING_PARAMS_FILE_NAME        = "params.pending.yaml"
+	INSTALL_CHECKPOINTS_FILE_NAME   = "install-checkpoints.yaml"
 	INSTALLATION_MANIFEST_FILE_NAME = "manifest.yaml"
 	KUBECONFIG_FILE_NAME            = "kubeconfig.yaml"
 	CONTAINERD_DIR_NAME             = "containerd"
@@ -118,7 +123,10 @@ func initStandaloneSubDirs() error {
 	return nil
 }
 
-// SetupInfra init VAR_DIR, setup VerboseLog and connect its output into a file
+// logFilePath is the log file of the command, set by SetupInfra
+var logFilePath string
+
+// SetupInfra init VAR_DIR, setup VerboseLog and connect its output into a file, and starts the timeline of the command
 func SetupInfra(cmdName string) (closeLogFile func(), err error) {
 	err = InitStandaloneDir()
 	if err != nil {
@@ -131,11 +139,44 @@ func SetupInfra(cmdName string) (closeLogFile func(), err error) {
 
 	logPath := createLogFilePath(cmdName)
 	closeLogFile, err = log.ConnectFileToVerboseLogOutput(logPath)
+	logFilePath = logPath
+	log.StartTimeline(cmdName)
 
 	log.SendCloudReport("info", "Finished setting cli infra", "Running", nil)
 	return
 }
 
+// ReportTimeline prints how long the phases of the command took and writes them next to its log file.
+// It returns payload with the timeline added, for the final cloud report of the command.
+func ReportTimeline(payload map[string]interface{}) *map[string]interface{} {
+	if payload == nil {
+		payload = map[string]interface{}{}
+	}
+	timeline := log.FinishTimeline()
+	if timeline == nil {
+		return &payload
+	}
+	payload["timeline"] = timeline.ReportPayload()
+
+	log.Info("Timeline:")
+	for _, line := range timeline.Table() {
+		log.Println(line)
+	}
+	if logFilePath != "" {
+		timelinePath := strings.TrimSuffix(logFilePath, ".log") + "_timeline.json"
+		data, err := json.MarshalIndent(timeline, "", "  ")
+		if err == nil {
+			err = os.WriteFile(timelinePath, data, 0666)
+		}
+		if err != nil {
+			log.Warnf("Failed writing the timeline: %v", err)
+		} else {
+			log.VerboseLogger.Infof("Timeline written to %s", timelinePath)
+		}
+	}
+	return &payload
+}
+
 func createLogFilePath(cmdName string) string {
 	filePath := fmt.Sprintf("%s/logs/%s_%s.log",
 		GetServerDataDir(),
@@ -256,10 +297,24 @@ func GetInstallationHostnamePath() string {
 	return path.Join(GetServerDataDir(), HOSTNAME_FILE)
 }
 
+func GetInstallationHistoryDir() string {
+	return path.Join(GetServerDataDir(), MANIFEST_HISTORY_DIR_NAME)
+}
+
 func GetInstallationParamsPath() string {
 	return path.Join(GetServerDataDir(), MANIFEST_DIR_NAME, INSTALLATION_PARAMS_FILE_NAME)
 }
 
+// GetPendingParamsPath holds config changes that were set but not yet applied
+func GetPendingParamsPath() string {
+	return path.Join(GetServerDataDir(), MANIFEST_DIR_NAME, PENDING_PARAMS_FILE_NAME)
+}
+
+// GetInstallCheckpointsPath holds the phases an unfinished install completed
+func GetInstallCheckpointsPath() string {
+	return path.Join(GetServerDataDir(), MANIFEST_DIR_NAME, INSTALL_CHECKPOINTS_FILE_NAME)
+}
+
 // GetKubeConfigPath is the shared kubeconfig any local user's kubectl/helm can
 // point at via $KUBECONFIG. Lives in the manifest dir alongside the other
 // install artifacts.
@@ -0,0 +1,85 @@
+package log
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"golang.org/x/term"
+)
+
+const (
+	ansiCursorUp      = "\033[%dA"
+	ansiClearToScreen = "\033[J"
+)
+
+// IsInteractiveOutput reports whether the log lines go to a terminal that can be redrawn in place
+func IsInteractiveOutput() bool {
+	return stdoutLogger.Out == os.Stderr && term.IsTerminal(int(os.Stderr.Fd()))
+}
+
+// LiveArea is a block of lines below the log that is redrawn in place, log lines
+// printed while it is shown are written above it
+type LiveArea struct {
+	mu    sync.Mutex
+	out   io.Writer
+	lines []string
+}
+
+// StartLiveArea shows an empty live area, it must only be used when IsInteractiveOutput
+func StartLiveArea() *LiveArea {
+	area := &LiveArea{out: stdoutLogger.Out}
+	stdoutLogger.SetOutput(&liveAreaLogWriter{area: area})
+	return area
+}
+
+// Update replaces the lines of the area, lines wider than the terminal are cut
+func (a *LiveArea) Update(lines []string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.clear()
+	width, _, err := term.GetSize(int(os.Stderr.Fd()))
+	if err == nil && width > 0 {
+		for i, line := range lines {
+			if runes := []rune(line); len(runes) > width {
+				lines[i] = string(runes[:width])
+			}
+		}
+	}
+	a.lines = lines
+	a.draw()
+}
+
+// Stop leaves the last lines on the screen and restores the log output
+func (a *LiveArea) Stop() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	stdoutLogger.SetOutput(a.out)
+	a.lines = nil
+}
+
+func (a *LiveArea) clear() {
+	if len(a.lines) > 0 {
+		fmt.Fprintf(a.out, ansiCursorUp+ansiClearToScreen, len(a.lines))
+	}
+}
+
+func (a *LiveArea) draw() {
+	for _, line := range a.lines {
+		fmt.Fprintln(a.out, line)
+	}
+}
+
+type liveAreaLogWriter struct {
+	area *LiveArea
+}
+
+func (w *liveAreaLogWriter) Write(p []byte) (int, error) {
+	w.area.mu.Lock()
+	defer w.area.mu.Unlock()
+	w.area.clear()
+	n, err := w.area.out.Write(p)
+	w.area.draw()
+	return n, err
+}
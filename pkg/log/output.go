@@ -42,3 +42,13 @@ func (lw *LoggerWriters) Set() {
 	// Create a multi-writer that writes to all the writers in the slice
 	lw.logger.SetOutput(io.MultiWriter(lw.writers...))
 }
+
+// Replace swaps a writer for another one, if the writer is used
+func (lw *LoggerWriters) Replace(old, new io.Writer) {
+	for i, writer := range lw.writers {
+		if writer == old {
+			lw.writers[i] = new
+		}
+	}
+	lw.Set()
+}
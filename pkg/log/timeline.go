@@ -0,0 +1,135 @@
+package log
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TimelinePhase is a named step of a command, Depth is the number of phases it runs in
+type TimelinePhase struct {
+	Name     string        `json:"name"`
+	Depth    int           `json:"depth"`
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration"`
+	Done     bool          `json:"done"`
+}
+
+// Timeline records the phases a command ran and how long they took
+type Timeline struct {
+	Command  string          `json:"command"`
+	Start    time.Time       `json:"start"`
+	Duration time.Duration   `json:"duration"`
+	Phases   []TimelinePhase `json:"phases"`
+
+	mu    sync.Mutex
+	depth int
+}
+
+var timeline *Timeline
+
+// StartTimeline starts recording the phases of the command, phases started before it are not recorded
+func StartTimeline(command string) {
+	timeline = &Timeline{Command: command, Start: time.Now(), Phases: []TimelinePhase{}}
+}
+
+// StartPhase records a phase of the current timeline, the returned function ends it.
+// Phases started before the end of another one are nested in it.
+func StartPhase(name string) (end func()) {
+	t := timeline
+	if t == nil {
+		return func() {}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	index := len(t.Phases)
+	t.Phases = append(t.Phases, TimelinePhase{Name: name, Depth: t.depth, Start: time.Now()})
+	t.depth++
+	VerboseLogger.Infof("Phase started: %s", name)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			phase := &t.Phases[index]
+			phase.Duration = time.Since(phase.Start)
+			phase.Done = true
+			t.depth--
+			VerboseLogger.Infof("Phase ended: %s (%s)", name, phase.Duration.Round(time.Millisecond))
+		})
+	}
+}
+
+// TimePhase runs the phase and records its duration
+func TimePhase(name string, run func() error) error {
+	end := StartPhase(name)
+	defer end()
+	return run()
+}
+
+// FinishTimeline stops recording and returns the timeline, nil when none was started.
+// Phases that did not end, e.g. when the command failed, keep the time they ran until now.
+func FinishTimeline() *Timeline {
+	t := timeline
+	if t == nil {
+		return nil
+	}
+	timeline = nil
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	t.Duration = now.Sub(t.Start)
+	for i := range t.Phases {
+		if !t.Phases[i].Done {
+			t.Phases[i].Duration = now.Sub(t.Phases[i].Start)
+		}
+	}
+	return t
+}
+
+// Table renders the phases as aligned lines, nested phases are indented and unfinished ones are marked
+func (t *Timeline) Table() []string {
+	rows := [][2]string{}
+	for _, phase := range t.Phases {
+		name := strings.Repeat("  ", phase.Depth) + phase.Name
+		duration := formatPhaseDuration(phase.Duration)
+		if !phase.Done {
+			duration += " (not finished)"
+		}
+		rows = append(rows, [2]string{name, duration})
+	}
+	rows = append(rows, [2]string{"Total", formatPhaseDuration(t.Duration)})
+
+	width := len("PHASE")
+	for _, row := range rows {
+		width = max(width, len(row[0]))
+	}
+	lines := []string{fmt.Sprintf("%-*s  %s", width, "PHASE", "DURATION")}
+	for _, row := range rows {
+		lines = append(lines, fmt.Sprintf("%-*s  %s", width, row[0], row[1]))
+	}
+	return lines
+}
+
+// ReportPayload is the timeline in the form sent with the cloud reports, durations in seconds
+func (t *Timeline) ReportPayload() map[string]interface{} {
+	phases := []map[string]interface{}{}
+	for _, phase := range t.Phases {
+		phases = append(phases, map[string]interface{}{
+			"name":     phase.Name,
+			"depth":    phase.Depth,
+			"seconds":  phase.Duration.Seconds(),
+			"finished": phase.Done,
+		})
+	}
+	return map[string]interface{}{"command": t.Command, "seconds": t.Duration.Seconds(), "phases": phases}
+}
+
+func formatPhaseDuration(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
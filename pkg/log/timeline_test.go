@@ -0,0 +1,56 @@
+package log
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeline(t *testing.T) {
+	StartTimeline("install")
+	endCluster := StartPhase("Creating cluster")
+	endCluster()
+	err := TimePhase("Installing charts", func() error {
+		StartPhase("Installing server")
+		return errors.New("failed")
+	})
+	assert.Error(t, err)
+
+	timeline := FinishTimeline()
+	require.NotNil(t, timeline)
+	assert.Nil(t, FinishTimeline(), "the timeline is only finished once")
+	require.Len(t, timeline.Phases, 3)
+	assert.Equal(t, "install", timeline.Command)
+	assert.Equal(t, []int{0, 0, 1}, []int{timeline.Phases[0].Depth, timeline.Phases[1].Depth, timeline.Phases[2].Depth})
+	assert.True(t, timeline.Phases[1].Done)
+	assert.False(t, timeline.Phases[2].Done)
+
+	payload := timeline.ReportPayload()
+	assert.Equal(t, "install", payload["command"])
+	assert.Len(t, payload["phases"], 3)
+}
+
+func TestTimelineTable(t *testing.T) {
+	timeline := &Timeline{
+		Duration: 95 * time.Second,
+		Phases: []TimelinePhase{
+			{Name: "Installing charts", Duration: 90 * time.Second, Done: true},
+			{Name: "Installing server", Depth: 1, Duration: 80 * time.Second},
+		},
+	}
+	assert.Equal(t, []string{
+		"PHASE                DURATION",
+		"Installing charts    1m30s",
+		"  Installing server  1m20s (not finished)",
+		"Total                1m35s",
+	}, timeline.Table())
+}
+
+func TestStartPhaseWithoutTimeline(t *testing.T) {
+	FinishTimeline()
+	StartPhase("Creating cluster")()
+	assert.Nil(t, FinishTimeline())
+}
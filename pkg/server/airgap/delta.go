@@ -0,0 +1,122 @@
+package airgap
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/tensorleap/helm-charts/pkg/log"
+	"github.com/tensorleap/helm-charts/pkg/server/manifest"
+	"gopkg.in/yaml.v3"
+)
+
+// DeltaInfo identifies the base installation of a delta pack and what the pack omits because the base has it.
+// A delta pack is installed over its base: the omitted images must already be in docker or in the registry,
+// and the omitted charts in the helm cache.
+type DeltaInfo struct {
+	BaseTag        string                   `yaml:"baseTag"`
+	BaseAppVersion string                   `yaml:"baseAppVersion"`
+	OmittedImages  []string                 `yaml:"omittedImages"`
+	OmittedCharts  []manifest.HelmChartMeta `yaml:"omittedCharts"`
+}
+
+// NewDeltaInfo returns what a pack of mnf can omit when installed over base
+func NewDeltaInfo(mnf, base *manifest.InstallationManifest) *DeltaInfo {
+	delta := &DeltaInfo{
+		BaseTag:        base.Tag,
+		BaseAppVersion: base.AppVersion,
+		OmittedImages:  []string{},
+		OmittedCharts:  []manifest.HelmChartMeta{},
+	}
+	baseImages := map[string]bool{}
+	for _, image := range base.GetAllImages() {
+		baseImages[image] = true
+	}
+	for _, image := range requiredPackImages(mnf) {
+		if baseImages[image] {
+			delta.OmittedImages = append(delta.OmittedImages, image)
+		}
+	}
+	for _, charts := range [][2]manifest.HelmChartMeta{{mnf.ServerHelmChart, base.ServerHelmChart}, {mnf.InfraHelmChart, base.InfraHelmChart}} {
+		if charts[0].ChartName == charts[1].ChartName && charts[0].Version == charts[1].Version {
+			delta.OmittedCharts = append(delta.OmittedCharts, charts[0])
+		}
+	}
+	return delta
+}
+
+// IsChartOmitted reports whether the pack omits the chart, a nil delta omits nothing
+func (d *DeltaInfo) IsChartOmitted(chartMeta manifest.HelmChartMeta) bool {
+	if d == nil {
+		return false
+	}
+	for _, omitted := range d.OmittedCharts {
+		if omitted.ChartName == chartMeta.ChartName && omitted.Version == chartMeta.Version {
+			return true
+		}
+	}
+	return false
+}
+
+// PackedImages are the images of mnf the pack holds, a nil delta omits nothing
+func (d *DeltaInfo) PackedImages(mnf *manifest.InstallationManifest) []string {
+	if d == nil {
+		return requiredPackImages(mnf)
+	}
+	omitted := map[string]bool{}
+	for _, image := range d.OmittedImages {
+		omitted[image] = true
+	}
+	images := []string{}
+	for _, image := range requiredPackImages(mnf) {
+		if !omitted[image] {
+			images = append(images, image)
+		}
+	}
+	return images
+}
+
+// LoadDeltaInfo reads the delta info of a pack without loading its resources, nil for a full pack.
+// The reader will be consumed; reopen or seek before further use.
+func LoadDeltaInfo(file io.Reader) (*DeltaInfo, error) {
+	tarReader := tar.NewReader(file)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if filepath.Clean(header.Name) == DELTA_FILE_NAME {
+			return readDeltaInfo(tarReader)
+		}
+	}
+}
+
+func readDeltaInfo(reader io.Reader) (*DeltaInfo, error) {
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	delta := &DeltaInfo{}
+	if err := yaml.Unmarshal(content, delta); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", DELTA_FILE_NAME, err)
+	}
+	return delta, nil
+}
+
+func AddDeltaInfo(tarWriter *tar.Writer, delta *DeltaInfo) error {
+	deltaBytes, err := yaml.Marshal(delta)
+	if err != nil {
+		return fmt.Errorf("failed to marshal delta info: %v", err)
+	}
+	if err := tarWriter.WriteHeader(&tar.Header{Name: DELTA_FILE_NAME, Mode: 0600, Size: int64(len(deltaBytes))}); err != nil {
+		return err
+	}
+	if _, err := tarWriter.Write(deltaBytes); err != nil {
+		return err
+	}
+	log.Infof("Packed delta info: base tag %s, %d images and %d charts omitted", delta.BaseTag, len(delta.OmittedImages), len(delta.OmittedCharts))
+	return nil
+}
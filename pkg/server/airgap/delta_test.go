@@ -0,0 +1,55 @@
+package airgap
+
+import (
+	"archive/tar"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewDeltaInfo(t *testing.T) {
+	base := testPackManifest()
+	base.Tag = "v1.2.2"
+	base.ServerHelmChart.Version = "1.2.2"
+	mnf := testPackManifest()
+	mnf.Images.ServerImages = append(mnf.Images.ServerImages, "public.ecr.aws/tensorleap/node-server:v2")
+
+	delta := NewDeltaInfo(mnf, base)
+	assert.Equal(t, "v1.2.2", delta.BaseTag)
+	assert.ElementsMatch(t, []string{"rancher/k3s:v1.30", "public.ecr.aws/tensorleap/engine:v1"}, delta.OmittedImages)
+	assert.Equal(t, []string{"public.ecr.aws/tensorleap/node-server:v2"}, delta.PackedImages(mnf))
+	assert.True(t, delta.IsChartOmitted(mnf.InfraHelmChart))
+	assert.False(t, delta.IsChartOmitted(mnf.ServerHelmChart))
+
+	var fullPack *DeltaInfo
+	assert.Len(t, fullPack.PackedImages(mnf), 3)
+	assert.False(t, fullPack.IsChartOmitted(mnf.InfraHelmChart))
+}
+
+func TestLoadDeltaInfo(t *testing.T) {
+	mnf := testPackManifest()
+	full := testPack(t, mnf, testImageArchive(t), "")
+	delta, err := LoadDeltaInfo(full)
+	require.NoError(t, err)
+	assert.Nil(t, delta)
+
+	var buf bytes.Buffer
+	tarWriter := tar.NewWriter(&buf)
+	require.NoError(t, AddManifest(tarWriter, mnf))
+	require.NoError(t, AddDeltaInfo(tarWriter, NewDeltaInfo(mnf, mnf)))
+	require.NoError(t, tarWriter.Close())
+
+	delta, err = LoadDeltaInfo(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	require.NotNil(t, delta)
+	assert.Equal(t, "v1.2.3", delta.BaseTag)
+	assert.Len(t, delta.OmittedImages, 2)
+	assert.Len(t, delta.OmittedCharts, 2)
+
+	// a delta pack of the same version holds nothing but its manifest and delta info
+	report := NewVerifyReport("delta.tar")
+	Verify(bytes.NewReader(buf.Bytes()), report)
+	assert.True(t, report.Passed, report.Checks)
+}
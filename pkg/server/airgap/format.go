@@ -0,0 +1,60 @@
+package airgap
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Pack format versions, recorded in pack.yaml. A pack without pack.yaml has the docker archive format.
+const (
+	PackFormatDockerArchive = 1
+	PackFormatOCILayout     = 2
+
+	SupportedPackFormatVersion = PackFormatOCILayout
+)
+
+// PackInfo describes how the pack is laid out, it is written first so installers check it before anything else
+type PackInfo struct {
+	FormatVersion int `yaml:"formatVersion"`
+}
+
+func AddPackInfo(tarWriter *tar.Writer, info *PackInfo) error {
+	infoBytes, err := yaml.Marshal(info)
+	if err != nil {
+		return fmt.Errorf("failed to marshal pack info: %v", err)
+	}
+	if err := tarWriter.WriteHeader(&tar.Header{Name: PACK_INFO_FILE_NAME, Mode: 0600, Size: int64(len(infoBytes))}); err != nil {
+		return err
+	}
+	_, err = tarWriter.Write(infoBytes)
+	return err
+}
+
+// readPackInfo reads pack.yaml and rejects a format this installer does not support
+func readPackInfo(reader io.Reader) (*PackInfo, error) {
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	info := &PackInfo{}
+	if err := yaml.Unmarshal(content, info); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", PACK_INFO_FILE_NAME, err)
+	}
+	if err := checkPackFormat(info.FormatVersion); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func checkPackFormat(formatVersion int) error {
+	if formatVersion < PackFormatDockerArchive {
+		return fmt.Errorf("invalid pack format version %d in %s", formatVersion, PACK_INFO_FILE_NAME)
+	}
+	if formatVersion > SupportedPackFormatVersion {
+		return fmt.Errorf("the pack has format version %d but this installer supports up to version %d, upgrade the installer to install it", formatVersion, SupportedPackFormatVersion)
+	}
+	return nil
+}
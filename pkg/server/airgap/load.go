@@ -7,8 +7,12 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
 	"github.com/k3d-io/k3d/v5/pkg/types"
 	"github.com/tensorleap/helm-charts/pkg/docker"
+	helmchart "github.com/tensorleap/helm-charts/pkg/helm/chart"
 	"github.com/tensorleap/helm-charts/pkg/local"
 	"github.com/tensorleap/helm-charts/pkg/log"
 	"github.com/tensorleap/helm-charts/pkg/server/manifest"
@@ -19,7 +23,7 @@ import (
 
 // Load loads manifest + resources (images, charts) from the tarball using a seekable reader (e.g., *os.File).
 // It reads the manifest from the tar and then loads resources.
-func Load(file io.ReadSeeker) (
+func Load(file PackReader) (
 	installationManifest *manifest.InstallationManifest,
 	infraChart, serverChart *chart.Chart,
 	err error,
@@ -38,7 +42,9 @@ func Load(file io.ReadSeeker) (
 
 // LoadResources loads images and helm charts from the tar file using an already-known manifest.
 // The reader must be positioned at the start of the tar archive.
-func LoadResources(file io.Reader, installationManifest *manifest.InstallationManifest) (infraChart, serverChart *chart.Chart, err error) {
+// Of an OCI image layout pack only the images of HostDaemonImages are loaded into docker, the others are
+// pushed from the pack into the registry by PushPackImages.
+func LoadResources(file PackReader, installationManifest *manifest.InstallationManifest) (infraChart, serverChart *chart.Chart, err error) {
 	if installationManifest == nil {
 		return nil, nil, fmt.Errorf("installation manifest is required to load resources")
 	}
@@ -47,6 +53,8 @@ func LoadResources(file io.Reader, installationManifest *manifest.InstallationMa
 	var imageLoaded bool
 	var infraChartLoaded bool
 	var serverChartLoaded bool
+	var delta *DeltaInfo
+	var hasImageLayout bool
 
 	dockerClient, err := docker.NewClient()
 	if err != nil {
@@ -63,9 +71,24 @@ func LoadResources(file io.Reader, installationManifest *manifest.InstallationMa
 
 		fileName := filepath.Clean(header.Name)
 
+		if isOCIImagesEntry(fileName) {
+			// the images of the layout are read in place once its index is known
+			hasImageLayout = true
+			continue
+		}
+
 		switch fileName {
+		case PACK_INFO_FILE_NAME:
+			if _, err := readPackInfo(tarReader); err != nil {
+				return nil, nil, err
+			}
 		case MANIFEST_FILE_NAME:
 			// manifest already provided
+		case DELTA_FILE_NAME:
+			delta, err = readDeltaInfo(tarReader)
+			if err != nil {
+				return nil, nil, err
+			}
 		case IMAGES_FILE_NAME:
 			imageLoaded = true
 			_, notFound, err := docker.GetExistedAndNotExistedImages(dockerClient, installationManifest.GetAllImages())
@@ -80,33 +103,55 @@ func LoadResources(file io.Reader, installationManifest *manifest.InstallationMa
 				}
 				break
 			}
-			err = docker.LoadingImages(dockerClient, tarReader)
+			err = log.TimePhase("Loading images into docker", func() error {
+				return docker.LoadingImages(dockerClient, tarReader)
+			})
 			if err != nil {
 				return nil, nil, err
 			}
 		case INFRA_HELM_CHART_FILE_NAME:
 			infraChartLoaded = true
-			infraChart, err = loadChart(tarReader)
+			infraChart, err = loadChart(tarReader, &installationManifest.InfraHelmChart)
 			if err != nil {
 				return nil, nil, err
 			}
 		case SERVER_HELM_CHART_FILE_NAME:
 			serverChartLoaded = true
-			serverChart, err = loadChart(tarReader)
+			serverChart, err = loadChart(tarReader, &installationManifest.ServerHelmChart)
 			if err != nil {
 				return nil, nil, err
 			}
 		}
 	}
 
-	if !imageLoaded {
+	if hasImageLayout {
+		imageLoaded = true
+		packImages, err := OpenPackImages(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		err = log.TimePhase("Loading images into docker", func() error {
+			return loadPackImages(dockerClient, packImages, HostDaemonImages(installationManifest))
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if !imageLoaded && delta == nil {
 		return nil, nil, fmt.Errorf("not found %s", IMAGES_FILE_NAME)
 	}
 	if !infraChartLoaded {
-		return nil, nil, fmt.Errorf("not found %s", INFRA_HELM_CHART_FILE_NAME)
+		infraChart, err = loadOmittedChart(delta, &installationManifest.InfraHelmChart, INFRA_HELM_CHART_FILE_NAME)
+		if err != nil {
+			return nil, nil, err
+		}
 	}
 	if !serverChartLoaded {
-		return nil, nil, fmt.Errorf("not found %s", SERVER_HELM_CHART_FILE_NAME)
+		serverChart, err = loadOmittedChart(delta, &installationManifest.ServerHelmChart, SERVER_HELM_CHART_FILE_NAME)
+		if err != nil {
+			return nil, nil, err
+		}
 	}
 
 	SetupEnvForK3dToolsImage(installationManifest.Images.K3dTools)
@@ -114,6 +159,53 @@ func LoadResources(file io.Reader, installationManifest *manifest.InstallationMa
 	return infraChart, serverChart, nil
 }
 
+// HostDaemonImages are the images docker needs for an airgap install: the images it runs and the k3s system
+// images imported into the cluster before its registry runs
+func HostDaemonImages(mnf *manifest.InstallationManifest) []string {
+	images := mnf.GetRunningOnMachineImages()
+	images = append(images, mnf.Images.K3sImages...)
+	images = append(images, mnf.Images.K3sGpuImages...)
+	return images
+}
+
+// loadPackImages loads the images of the pack docker does not have into docker.
+// The images the pack does not hold, omitted by a delta pack, are left to the delta pack base check.
+func loadPackImages(dockerClient docker.Client, packImages *PackImages, images []string) error {
+	packed := []string{}
+	for _, image := range images {
+		if image != "" && packImages.Has(image) {
+			packed = append(packed, image)
+		}
+	}
+	_, notFound, err := docker.GetExistedAndNotExistedImages(dockerClient, packed)
+	if err != nil {
+		return err
+	}
+	if len(notFound) == 0 {
+		log.Info("All images already exist, skipping loading images from the pack")
+		return nil
+	}
+
+	refToImage := map[name.Reference]v1.Image{}
+	for _, image := range notFound {
+		ref, err := name.ParseReference(image)
+		if err != nil {
+			return err
+		}
+		refToImage[ref], err = packImages.Image(image)
+		if err != nil {
+			return err
+		}
+	}
+	// the images are written as a docker archive while docker reads it
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(tarball.MultiRefWrite(refToImage, writer))
+	}()
+	defer reader.Close()
+	return docker.LoadingImages(dockerClient, reader)
+}
+
 // LoadManifestOnly reads only the manifest from the airgap tar without loading images or charts.
 // The reader will be consumed; reopen or seek before further use.
 func LoadManifestOnly(file io.Reader) (*manifest.InstallationManifest, error) {
@@ -131,6 +223,10 @@ func LoadManifestOnly(file io.Reader) (*manifest.InstallationManifest, error) {
 		fileName := filepath.Clean(header.Name)
 
 		switch fileName {
+		case PACK_INFO_FILE_NAME:
+			if _, err := readPackInfo(tarReader); err != nil {
+				return nil, err
+			}
 		case MANIFEST_FILE_NAME:
 			content, err := io.ReadAll(tarReader)
 			if err != nil {
@@ -153,7 +249,8 @@ func LoadManifestOnly(file io.Reader) (*manifest.InstallationManifest, error) {
 	return installationManifest, nil
 }
 
-func loadChart(tarReader io.Reader) (*chart.Chart, error) {
+// loadChart loads a chart of the pack and keeps it in the helm cache, where a later delta pack that omits it finds it
+func loadChart(tarReader io.Reader, chartMeta *manifest.HelmChartMeta) (*chart.Chart, error) {
 	tempHelmFile, err := os.CreateTemp("", "helm-*.tgz")
 	if err != nil {
 		return nil, err
@@ -167,9 +264,42 @@ func loadChart(tarReader io.Reader) (*chart.Chart, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := cacheChart(tempHelmFile, chartMeta); err != nil {
+		log.Warnf("Failed to cache helm chart %s %s: %v", chartMeta.ChartName, chartMeta.Version, err)
+	}
 	return chart, nil
 }
 
+func cacheChart(chartFile *os.File, chartMeta *manifest.HelmChartMeta) error {
+	cachedPath := filepath.Join(local.GetHelmCacheDir(), chartMeta.ChartName, fmt.Sprintf("%s.tgz", chartMeta.Version))
+	if err := local.EnsureDirExists(filepath.Dir(cachedPath)); err != nil {
+		return err
+	}
+	if _, err := chartFile.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	cachedFile, err := os.Create(cachedPath)
+	if err != nil {
+		return err
+	}
+	defer cachedFile.Close()
+	_, err = io.Copy(cachedFile, chartFile)
+	return err
+}
+
+// loadOmittedChart loads a chart the pack does not have from the helm cache, when the pack is a delta pack that omits it
+func loadOmittedChart(delta *DeltaInfo, chartMeta *manifest.HelmChartMeta, fileName string) (*chart.Chart, error) {
+	if !delta.IsChartOmitted(*chartMeta) {
+		return nil, fmt.Errorf("not found %s", fileName)
+	}
+	loadedChart, err := helmchart.LoadCached(chartMeta.ChartName, chartMeta.Version)
+	if err != nil {
+		return nil, fmt.Errorf("the delta pack omits chart %s %s of base %s, but it is not in the helm cache (install with a full pack): %w",
+			chartMeta.ChartName, chartMeta.Version, delta.BaseTag, err)
+	}
+	return loadedChart, nil
+}
+
 func SetupEnvForK3dToolsImage(image string) {
 	// k3d take the image from this env variable
 	if err := os.Setenv(types.K3dEnvImageTools, image); err != nil {
@@ -0,0 +1,269 @@
+package airgap
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/tensorleap/helm-charts/pkg/log"
+)
+
+const (
+	OCI_LAYOUT_FILE_NAME = "oci-layout"
+	OCI_INDEX_FILE_NAME  = "index.json"
+
+	ociImageNameAnnotation = "io.containerd.image.name"
+	ociRefNameAnnotation   = "org.opencontainers.image.ref.name"
+	// manifests and configs are kept in memory while verifying, layers are only hashed
+	maxVerifiedMetadataBlobSize = 4 << 20
+)
+
+var DefaultImagePlatform = v1.Platform{OS: "linux", Architecture: "amd64"}
+
+// ociBlobPath is the path in the pack of a blob of the OCI image layout
+func ociBlobPath(digest v1.Hash) string {
+	return path.Join(OCI_IMAGES_DIR_NAME, "blobs", digest.Algorithm, digest.Hex)
+}
+
+// ociImageFetcher fetches an image from its registry, replaced in tests
+type ociImageFetcher func(image string, platform v1.Platform) (v1.Image, error)
+
+func fetchRemoteImage(image string, platform v1.Platform) (v1.Image, error) {
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return nil, err
+	}
+	return remote.Image(ref, remote.WithAuthFromKeychain(authn.DefaultKeychain), remote.WithPlatform(platform))
+}
+
+// addOCIImages fetches the images from their registries into an OCI image layout under images/ of the pack.
+// Blobs are written once by digest, so layers shared by images are stored once, and no docker daemon is used.
+func addOCIImages(tarWriter *tar.Writer, images []string, platform v1.Platform, fetch ociImageFetcher) error {
+	err := addTarBytes(tarWriter, path.Join(OCI_IMAGES_DIR_NAME, OCI_LAYOUT_FILE_NAME), []byte(`{"imageLayoutVersion":"1.0.0"}`))
+	if err != nil {
+		return err
+	}
+
+	written := map[v1.Hash]bool{}
+	index := v1.IndexManifest{SchemaVersion: 2, MediaType: types.OCIImageIndex, Manifests: []v1.Descriptor{}}
+	var totalLayers, sharedLayers int
+	for _, image := range images {
+		img, err := fetch(image, platform)
+		if err != nil {
+			return fmt.Errorf("failed to fetch image %s: %w", image, err)
+		}
+		layers, err := img.Layers()
+		if err != nil {
+			return fmt.Errorf("failed to read the layers of image %s: %w", image, err)
+		}
+		for _, layer := range layers {
+			digest, err := layer.Digest()
+			if err != nil {
+				return err
+			}
+			totalLayers++
+			if written[digest] {
+				sharedLayers++
+				continue
+			}
+			if err := addLayerBlob(tarWriter, digest, layer); err != nil {
+				return fmt.Errorf("failed to pack a layer of image %s: %w", image, err)
+			}
+			written[digest] = true
+		}
+
+		descriptor, err := addImageMetadataBlobs(tarWriter, img, written)
+		if err != nil {
+			return fmt.Errorf("failed to pack image %s: %w", image, err)
+		}
+		descriptor.Annotations = map[string]string{ociImageNameAnnotation: image}
+		if ref, err := name.ParseReference(image); err == nil {
+			descriptor.Annotations[ociRefNameAnnotation] = ref.Identifier()
+		}
+		index.Manifests = append(index.Manifests, *descriptor)
+		log.VerboseLogger.Infof("Packed image %s", image)
+	}
+
+	indexBytes, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	if err := addTarBytes(tarWriter, path.Join(OCI_IMAGES_DIR_NAME, OCI_INDEX_FILE_NAME), indexBytes); err != nil {
+		return err
+	}
+	log.Infof("Packed %d images as an OCI image layout (%d layers, %d stored once for several images)", len(images), totalLayers, sharedLayers)
+	return nil
+}
+
+func addLayerBlob(tarWriter *tar.Writer, digest v1.Hash, layer v1.Layer) error {
+	size, err := layer.Size()
+	if err != nil {
+		return err
+	}
+	reader, err := layer.Compressed()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	err = tarWriter.WriteHeader(&tar.Header{Name: ociBlobPath(digest), Mode: 0644, Size: size})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tarWriter, reader)
+	return err
+}
+
+// addImageMetadataBlobs writes the config and the manifest of the image and returns the descriptor of its manifest
+func addImageMetadataBlobs(tarWriter *tar.Writer, img v1.Image, written map[v1.Hash]bool) (*v1.Descriptor, error) {
+	configDigest, err := img.ConfigName()
+	if err != nil {
+		return nil, err
+	}
+	rawConfig, err := img.RawConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	rawManifest, err := img.RawManifest()
+	if err != nil {
+		return nil, err
+	}
+	digest, err := img.Digest()
+	if err != nil {
+		return nil, err
+	}
+	mediaType, err := img.MediaType()
+	if err != nil {
+		return nil, err
+	}
+	for _, blob := range []struct {
+		digest  v1.Hash
+		content []byte
+	}{{configDigest, rawConfig}, {digest, rawManifest}} {
+		if written[blob.digest] {
+			continue
+		}
+		if err := addTarBytes(tarWriter, ociBlobPath(blob.digest), blob.content); err != nil {
+			return nil, err
+		}
+		written[blob.digest] = true
+	}
+	return &v1.Descriptor{MediaType: mediaType, Size: int64(len(rawManifest)), Digest: digest}, nil
+}
+
+func addTarBytes(tarWriter *tar.Writer, fileName string, content []byte) error {
+	err := tarWriter.WriteHeader(&tar.Header{Name: fileName, Mode: 0644, Size: int64(len(content))})
+	if err != nil {
+		return err
+	}
+	_, err = tarWriter.Write(content)
+	return err
+}
+
+// isOCIImagesEntry tells whether the pack file belongs to the OCI image layout
+func isOCIImagesEntry(fileName string) bool {
+	return strings.HasPrefix(fileName, OCI_IMAGES_DIR_NAME+"/")
+}
+
+// ociLayoutContent checks the blobs of the OCI image layout of a pack while it is streamed
+type ociLayoutContent struct {
+	hasLayout bool
+	index     *v1.IndexManifest
+	blobs     map[v1.Hash]bool
+	metadata  map[v1.Hash][]byte
+	problems  []string
+}
+
+func newOCILayoutContent() *ociLayoutContent {
+	return &ociLayoutContent{blobs: map[v1.Hash]bool{}, metadata: map[v1.Hash][]byte{}}
+}
+
+func (c *ociLayoutContent) add(fileName string, size int64, reader io.Reader) error {
+	relPath := strings.TrimPrefix(fileName, OCI_IMAGES_DIR_NAME+"/")
+	switch {
+	case relPath == OCI_LAYOUT_FILE_NAME:
+		c.hasLayout = true
+	case relPath == OCI_INDEX_FILE_NAME:
+		c.index = &v1.IndexManifest{}
+		if err := json.NewDecoder(reader).Decode(c.index); err != nil {
+			return fmt.Errorf("failed parsing the image layout index: %w", err)
+		}
+	case strings.HasPrefix(relPath, "blobs/sha256/"):
+		digest := v1.Hash{Algorithm: "sha256", Hex: strings.TrimPrefix(relPath, "blobs/sha256/")}
+		hash := sha256.New()
+		var content bytes.Buffer
+		writer := io.Writer(hash)
+		if size <= maxVerifiedMetadataBlobSize {
+			writer = io.MultiWriter(hash, &content)
+		}
+		if _, err := io.Copy(writer, reader); err != nil {
+			return err
+		}
+		if sum := hex.EncodeToString(hash.Sum(nil)); sum != digest.Hex {
+			c.problems = append(c.problems, fmt.Sprintf("blob %s is corrupt (sha256 %s)", digest.Hex, sum))
+			return nil
+		}
+		c.blobs[digest] = true
+		if size <= maxVerifiedMetadataBlobSize {
+			c.metadata[digest] = content.Bytes()
+		}
+	}
+	return nil
+}
+
+// imageNames checks that every image of the index has all its blobs and returns the normalized names of the images
+func (c *ociLayoutContent) imageNames() (map[string]bool, error) {
+	problems := append([]string{}, c.problems...)
+	if !c.hasLayout {
+		problems = append(problems, fmt.Sprintf("not found %s", OCI_LAYOUT_FILE_NAME))
+	}
+	if c.index == nil {
+		problems = append(problems, fmt.Sprintf("not found %s", OCI_INDEX_FILE_NAME))
+	}
+
+	names := map[string]bool{}
+	if c.index != nil {
+		for _, descriptor := range c.index.Manifests {
+			imageName := descriptor.Annotations[ociImageNameAnnotation]
+			if missing := c.missingImageBlobs(descriptor.Digest); len(missing) > 0 {
+				problems = append(problems, fmt.Sprintf("image %s is missing %d blobs, e.g. %s", imageName, len(missing), missing[0]))
+				continue
+			}
+			if imageName != "" {
+				names[normalizeImageName(imageName)] = true
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("the image layout is invalid: %s", strings.Join(problems, "; "))
+	}
+	return names, nil
+}
+
+func (c *ociLayoutContent) missingImageBlobs(manifestDigest v1.Hash) []string {
+	rawManifest, ok := c.metadata[manifestDigest]
+	if !ok {
+		return []string{manifestDigest.String()}
+	}
+	imageManifest, err := v1.ParseManifest(bytes.NewReader(rawManifest))
+	if err != nil {
+		return []string{manifestDigest.String()}
+	}
+	missing := []string{}
+	for _, descriptor := range append([]v1.Descriptor{imageManifest.Config}, imageManifest.Layers...) {
+		if !c.blobs[descriptor.Digest] {
+			missing = append(missing, descriptor.Digest.String())
+		}
+	}
+	return missing
+}
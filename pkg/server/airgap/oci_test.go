@@ -0,0 +1,188 @@
+package airgap
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/google/go-containerregistry/pkg/v1/validate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tensorleap/helm-charts/pkg/server/manifest"
+	"gopkg.in/yaml.v3"
+)
+
+// testOCIImages are the images of testPackManifest, built on a shared base of two layers
+func testOCIImages(t *testing.T) map[string]v1.Image {
+	base, err := random.Image(256, 2)
+	require.NoError(t, err)
+	images := map[string]v1.Image{}
+	for _, image := range []string{"rancher/k3s:v1.30", "public.ecr.aws/tensorleap/engine:v1"} {
+		layer, err := random.Layer(256, types.DockerLayer)
+		require.NoError(t, err)
+		images[image], err = mutate.AppendLayers(base, layer)
+		require.NoError(t, err)
+	}
+	return images
+}
+
+func testFetcher(images map[string]v1.Image) ociImageFetcher {
+	return func(image string, platform v1.Platform) (v1.Image, error) {
+		img, ok := images[image]
+		if !ok {
+			return nil, fmt.Errorf("image %s not found", image)
+		}
+		return img, nil
+	}
+}
+
+func testOCIPack(t *testing.T, mnf *manifest.InstallationManifest, images map[string]v1.Image) []byte {
+	var buf bytes.Buffer
+	tarWriter := tar.NewWriter(&buf)
+	require.NoError(t, AddPackInfo(tarWriter, &PackInfo{FormatVersion: PackFormatOCILayout}))
+	manifestBytes, err := yaml.Marshal(mnf)
+	require.NoError(t, err)
+	addTarFile(t, tarWriter, MANIFEST_FILE_NAME, manifestBytes)
+	require.NoError(t, addOCIImages(tarWriter, requiredPackImages(mnf), DefaultImagePlatform, testFetcher(images)))
+	addTarFile(t, tarWriter, SERVER_HELM_CHART_FILE_NAME, testChartArchive(t, "tensorleap", "1.2.3"))
+	addTarFile(t, tarWriter, INFRA_HELM_CHART_FILE_NAME, testChartArchive(t, "tensorleap-infra", "0.1.0"))
+	require.NoError(t, tarWriter.Close())
+	return buf.Bytes()
+}
+
+// rewritePack copies the pack, replacing the content of the files edit returns non-nil for
+func rewritePack(t *testing.T, pack []byte, edit func(name string, data []byte) []byte) []byte {
+	var buf bytes.Buffer
+	tarWriter := tar.NewWriter(&buf)
+	tarReader := tar.NewReader(bytes.NewReader(pack))
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		data, err := io.ReadAll(tarReader)
+		require.NoError(t, err)
+		if edited := edit(header.Name, data); edited != nil {
+			data = edited
+		}
+		addTarFile(t, tarWriter, header.Name, data)
+	}
+	require.NoError(t, tarWriter.Close())
+	return buf.Bytes()
+}
+
+func TestAddOCIImages(t *testing.T) {
+	mnf := testPackManifest()
+	images := testOCIImages(t)
+	pack := testOCIPack(t, mnf, images)
+
+	blobs := map[string]int{}
+	tarReader := tar.NewReader(bytes.NewReader(pack))
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		if strings.HasPrefix(header.Name, OCI_IMAGES_DIR_NAME+"/blobs/") {
+			blobs[header.Name]++
+		}
+	}
+	// 2 shared layers, a layer, a config and a manifest per image
+	assert.Len(t, blobs, 8)
+	for name, count := range blobs {
+		assert.Equal(t, 1, count, name)
+	}
+
+	report := NewVerifyReport("pack.tar")
+	Verify(bytes.NewReader(pack), report)
+	assert.True(t, report.Passed, report.Checks)
+
+	packImages, err := OpenPackImages(bytes.NewReader(pack))
+	require.NoError(t, err)
+	for image, img := range images {
+		require.True(t, packImages.Has(image), image)
+		packed, err := packImages.Image(image)
+		require.NoError(t, err)
+		// the blobs of the image are read from the pack and checked against their digests
+		require.NoError(t, validate.Image(packed))
+		expected, err := img.Digest()
+		require.NoError(t, err)
+		digest, err := packed.Digest()
+		require.NoError(t, err)
+		assert.Equal(t, expected, digest)
+	}
+	assert.False(t, packImages.Has("public.ecr.aws/tensorleap/node-server:v2"))
+
+	// a docker archive pack has no image layout
+	packImages, err = OpenPackImages(testPack(t, mnf, testImageArchive(t), ""))
+	require.NoError(t, err)
+	assert.Nil(t, packImages)
+}
+
+func TestVerifyOCIPack(t *testing.T) {
+	mnf := testPackManifest()
+	images := testOCIImages(t)
+	pack := testOCIPack(t, mnf, images)
+
+	t.Run("corrupt layer", func(t *testing.T) {
+		layers, err := images["rancher/k3s:v1.30"].Layers()
+		require.NoError(t, err)
+		digest, err := layers[2].Digest()
+		require.NoError(t, err)
+		corrupt := rewritePack(t, pack, func(name string, data []byte) []byte {
+			if name == ociBlobPath(digest) {
+				return bytes.Repeat([]byte{0}, len(data))
+			}
+			return nil
+		})
+
+		report := NewVerifyReport("pack.tar")
+		Verify(bytes.NewReader(corrupt), report)
+		failed := failedChecks(report)
+		require.Contains(t, failed, "images")
+		assert.Contains(t, failed["images"], fmt.Sprintf("blob %s is corrupt", digest.Hex))
+		assert.Contains(t, failed["images"], "image rancher/k3s:v1.30 is missing 1 blobs")
+	})
+
+	t.Run("missing image", func(t *testing.T) {
+		changed := testPackManifest()
+		changed.Images.ServerImages = append(changed.Images.ServerImages, "public.ecr.aws/tensorleap/node-server:v2")
+		incomplete := rewritePack(t, pack, func(name string, data []byte) []byte {
+			if name == MANIFEST_FILE_NAME {
+				manifestBytes, err := yaml.Marshal(changed)
+				require.NoError(t, err)
+				return manifestBytes
+			}
+			return nil
+		})
+
+		report := NewVerifyReport("pack.tar")
+		Verify(bytes.NewReader(incomplete), report)
+		assert.Equal(t, map[string]string{"images": "1 of 3 images are missing from images/index.json: public.ecr.aws/tensorleap/node-server:v2"}, failedChecks(report))
+	})
+}
+
+func TestPackFormatVersion(t *testing.T) {
+	var buf bytes.Buffer
+	tarWriter := tar.NewWriter(&buf)
+	require.NoError(t, AddPackInfo(tarWriter, &PackInfo{FormatVersion: SupportedPackFormatVersion + 1}))
+	require.NoError(t, AddManifest(tarWriter, testPackManifest()))
+	require.NoError(t, tarWriter.Close())
+
+	_, err := LoadManifestOnly(bytes.NewReader(buf.Bytes()))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "upgrade the installer")
+
+	report := NewVerifyReport("pack.tar")
+	assert.Nil(t, Verify(bytes.NewReader(buf.Bytes()), report))
+	assert.Contains(t, failedChecks(report), "pack format")
+}
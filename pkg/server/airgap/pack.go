@@ -6,6 +6,7 @@ import (
 	"io"
 	"os"
 
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/tensorleap/helm-charts/pkg/docker"
 	"github.com/tensorleap/helm-charts/pkg/helm/chart"
 	"github.com/tensorleap/helm-charts/pkg/local"
@@ -14,29 +15,75 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
-func Pack(mnf *manifest.InstallationManifest, outputFile io.Writer) error {
+// PackOptions choose what a pack holds and how its images are stored
+type PackOptions struct {
+	// Base makes a delta pack of only the images and charts of the manifest that base does not have
+	Base *manifest.InstallationManifest
+	// DockerArchive saves the images with the docker daemon as images.tgz, the format of installers older than the OCI image layout
+	DockerArchive bool
+	// Platform of the images fetched into the OCI image layout
+	Platform v1.Platform
+}
+
+func Pack(mnf *manifest.InstallationManifest, outputFile io.Writer, opts PackOptions) error {
+	var delta *DeltaInfo
+	if opts.Base != nil {
+		delta = NewDeltaInfo(mnf, opts.Base)
+	}
+	info := &PackInfo{FormatVersion: PackFormatOCILayout}
+	if opts.DockerArchive {
+		info.FormatVersion = PackFormatDockerArchive
+	}
+	if opts.Platform.OS == "" {
+		opts.Platform = DefaultImagePlatform
+	}
 
 	tarWriter := tar.NewWriter(outputFile)
 	defer tarWriter.Close()
 
-	err := AddManifest(tarWriter, mnf)
+	// the pack info is written first, so installers reject a format they do not support before reading the rest
+	err := AddPackInfo(tarWriter, info)
 	if err != nil {
 		return err
 	}
 
-	err = AddImages(tarWriter, mnf)
+	err = AddManifest(tarWriter, mnf)
 	if err != nil {
 		return err
 	}
 
-	err = AddHelm(tarWriter, &mnf.ServerHelmChart, SERVER_HELM_CHART_FILE_NAME)
-	if err != nil {
-		return err
+	// the delta info is written before the resources, so it can be checked before loading them
+	if delta != nil {
+		err = AddDeltaInfo(tarWriter, delta)
+		if err != nil {
+			return err
+		}
 	}
 
-	err = AddHelm(tarWriter, &mnf.InfraHelmChart, INFRA_HELM_CHART_FILE_NAME)
-	if err != nil {
-		return err
+	images := delta.PackedImages(mnf)
+	if len(images) > 0 {
+		if opts.DockerArchive {
+			err = addImages(tarWriter, images)
+		} else {
+			err = addOCIImages(tarWriter, images, opts.Platform, fetchRemoteImage)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if !delta.IsChartOmitted(mnf.ServerHelmChart) {
+		err = AddHelm(tarWriter, &mnf.ServerHelmChart, SERVER_HELM_CHART_FILE_NAME)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !delta.IsChartOmitted(mnf.InfraHelmChart) {
+		err = AddHelm(tarWriter, &mnf.InfraHelmChart, INFRA_HELM_CHART_FILE_NAME)
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -76,13 +123,15 @@ func AddHelm(tarWriter *tar.Writer, chartMeta *manifest.HelmChartMeta, fileName
 }
 
 func AddImages(tarWriter *tar.Writer, mnf *manifest.InstallationManifest) error {
+	return addImages(tarWriter, mnf.GetAllImages())
+}
+
+func addImages(tarWriter *tar.Writer, images []string) error {
 	dockerClient, err := docker.NewClient()
 	if err != nil {
 		return err
 	}
 
-	images := mnf.GetAllImages()
-
 	// create temp file to store images
 	// we can't stream the images directly to the tar writer, because we need to know the size of the images file before writing it to the tar
 	tempImagesFile, err := os.CreateTemp("", "images.tgz")
@@ -120,7 +169,7 @@ func AddImages(tarWriter *tar.Writer, mnf *manifest.InstallationManifest) error
 	if err != nil {
 		return err
 	}
-	log.Infof("Packed docker images")
+	log.Infof("Packed %d docker images", len(images))
 	return nil
 }
 
@@ -0,0 +1,177 @@
+package airgap
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// PackReader reads a pack in sequence and at random, as an opened PackFile does
+type PackReader interface {
+	io.ReadSeeker
+	io.ReaderAt
+}
+
+// PackImages reads the images of the OCI image layout of a pack in place, the blobs are read from the pack when used
+type PackImages struct {
+	file   io.ReaderAt
+	blobs  map[v1.Hash]packEntry
+	images map[string]v1.Descriptor
+}
+
+// packEntry is where the content of a file is in the pack
+type packEntry struct {
+	offset int64
+	size   int64
+}
+
+// OpenPackImages indexes the OCI image layout of the pack, it returns nil when the pack has no layout:
+// a docker archive pack, or a delta pack that omits all its images
+func OpenPackImages(file PackReader) (*PackImages, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	packImages := &PackImages{file: file, blobs: map[v1.Hash]packEntry{}, images: map[string]v1.Descriptor{}}
+	var index *v1.IndexManifest
+	blobsPrefix := path.Join(OCI_IMAGES_DIR_NAME, "blobs", "sha256") + "/"
+	// the tar reader seeks over the files it does not read, so indexing does not read the blobs
+	tarReader := tar.NewReader(file)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed reading the pack tar: %w", err)
+		}
+		fileName := filepath.Clean(header.Name)
+		if fileName == path.Join(OCI_IMAGES_DIR_NAME, OCI_INDEX_FILE_NAME) {
+			index = &v1.IndexManifest{}
+			if err := json.NewDecoder(tarReader).Decode(index); err != nil {
+				return nil, fmt.Errorf("failed parsing the image layout index of the pack: %w", err)
+			}
+		} else if hex, ok := strings.CutPrefix(fileName, blobsPrefix); ok {
+			offset, err := file.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return nil, err
+			}
+			packImages.blobs[v1.Hash{Algorithm: "sha256", Hex: hex}] = packEntry{offset: offset, size: header.Size}
+		}
+	}
+	if index == nil {
+		if len(packImages.blobs) > 0 {
+			return nil, fmt.Errorf("the pack has image blobs but no %s", path.Join(OCI_IMAGES_DIR_NAME, OCI_INDEX_FILE_NAME))
+		}
+		return nil, nil
+	}
+	for _, descriptor := range index.Manifests {
+		if imageName := descriptor.Annotations[ociImageNameAnnotation]; imageName != "" {
+			packImages.images[normalizeImageName(imageName)] = descriptor
+		}
+	}
+	return packImages, nil
+}
+
+// Has tells whether the image is in the pack
+func (p *PackImages) Has(image string) bool {
+	if p == nil {
+		return false
+	}
+	_, ok := p.images[normalizeImageName(image)]
+	return ok
+}
+
+// Image returns the image of the pack, its layers are streamed from the pack
+func (p *PackImages) Image(image string) (v1.Image, error) {
+	descriptor, ok := p.images[normalizeImageName(image)]
+	if !ok {
+		return nil, fmt.Errorf("image %s is not in the pack", image)
+	}
+	rawManifest, err := p.readBlob(descriptor.Digest)
+	if err != nil {
+		return nil, err
+	}
+	imageManifest, err := v1.ParseManifest(bytes.NewReader(rawManifest))
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing the manifest of image %s: %w", image, err)
+	}
+	return partial.CompressedToImage(&packImage{pack: p, mediaType: descriptor.MediaType, rawManifest: rawManifest, manifest: imageManifest})
+}
+
+func (p *PackImages) blob(digest v1.Hash) (*io.SectionReader, error) {
+	entry, ok := p.blobs[digest]
+	if !ok {
+		return nil, fmt.Errorf("blob %s is not in the pack", digest)
+	}
+	return io.NewSectionReader(p.file, entry.offset, entry.size), nil
+}
+
+func (p *PackImages) readBlob(digest v1.Hash) ([]byte, error) {
+	reader, err := p.blob(digest)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(reader)
+}
+
+// packImage is an image of the pack, as the compressed image core of go-containerregistry
+type packImage struct {
+	pack        *PackImages
+	mediaType   types.MediaType
+	rawManifest []byte
+	manifest    *v1.Manifest
+}
+
+func (i *packImage) RawConfigFile() ([]byte, error) {
+	return i.pack.readBlob(i.manifest.Config.Digest)
+}
+
+func (i *packImage) MediaType() (types.MediaType, error) {
+	return i.mediaType, nil
+}
+
+func (i *packImage) RawManifest() ([]byte, error) {
+	return i.rawManifest, nil
+}
+
+func (i *packImage) LayerByDigest(digest v1.Hash) (partial.CompressedLayer, error) {
+	for _, descriptor := range append([]v1.Descriptor{i.manifest.Config}, i.manifest.Layers...) {
+		if descriptor.Digest == digest {
+			return &packLayer{pack: i.pack, descriptor: descriptor}, nil
+		}
+	}
+	return nil, fmt.Errorf("blob %s is not in the image manifest", digest)
+}
+
+type packLayer struct {
+	pack       *PackImages
+	descriptor v1.Descriptor
+}
+
+func (l *packLayer) Digest() (v1.Hash, error) {
+	return l.descriptor.Digest, nil
+}
+
+func (l *packLayer) Compressed() (io.ReadCloser, error) {
+	reader, err := l.pack.blob(l.descriptor.Digest)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(reader), nil
+}
+
+func (l *packLayer) Size() (int64, error) {
+	return l.descriptor.Size, nil
+}
+
+func (l *packLayer) MediaType() (types.MediaType, error) {
+	return l.descriptor.MediaType, nil
+}
@@ -0,0 +1,72 @@
+package airgap
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/tensorleap/helm-charts/pkg/k3d"
+	"github.com/tensorleap/helm-charts/pkg/log"
+)
+
+// PUSH_IMAGE_JOBS is the number of blobs of an image uploaded to the registry at once
+const PUSH_IMAGE_JOBS = 4
+
+// PushPackImages pushes the images held by the OCI image layout of the pack into the local registry, streaming
+// their blobs from the pack over the registry API without docker. Images already in the registry are skipped,
+// as are the blobs it already has. It returns the images the pack does not hold, all of them for a docker archive pack.
+func PushPackImages(ctx context.Context, packPath string, images []string, regPort string) (notInPack []string, err error) {
+	file, err := OpenPack(packPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	packImages, err := OpenPackImages(file)
+	if err != nil {
+		return nil, err
+	}
+	return pushPackImages(ctx, packImages, images, regPort)
+}
+
+func pushPackImages(ctx context.Context, packImages *PackImages, images []string, regPort string) ([]string, error) {
+	notInPack := []string{}
+	for _, image := range images {
+		if !packImages.Has(image) {
+			notInPack = append(notInPack, image)
+			continue
+		}
+		imageInRegistry, err := k3d.IsImageInRegistry(ctx, image, regPort)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check if image %s is in registry: %s", image, err)
+		}
+		if imageInRegistry {
+			log.Infof("Image already cached '%s'\n", image)
+			continue
+		}
+		if err := pushPackImage(ctx, packImages, image, regPort); err != nil {
+			log.SendCloudReport("error", "Failed caching image", "Failed", &map[string]interface{}{"image": image, "error": err.Error()})
+			return nil, err
+		}
+	}
+	return notInPack, nil
+}
+
+func pushPackImage(ctx context.Context, packImages *PackImages, image string, regPort string) error {
+	img, err := packImages.Image(image)
+	if err != nil {
+		return err
+	}
+	targetImage := k3d.GetRegistryImageName(image, regPort)
+	target, err := name.ParseReference(targetImage, name.Insecure)
+	if err != nil {
+		return err
+	}
+	log.Infof("Pushing image '%s' from the pack\n", targetImage)
+	// the registry is asked for each blob before it is uploaded, so the layers it has are not sent again
+	if err := remote.Write(target, img, remote.WithContext(ctx), remote.WithJobs(PUSH_IMAGE_JOBS)); err != nil {
+		return fmt.Errorf("failed to push image %s into the registry: %w", image, err)
+	}
+	log.Printf("Pushed image '%s'\n", targetImage)
+	return nil
+}
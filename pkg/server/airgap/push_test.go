@@ -0,0 +1,71 @@
+package airgap
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tensorleap/helm-charts/pkg/k3d"
+)
+
+func TestPushPackImages(t *testing.T) {
+	mnf := testPackManifest()
+	images := testOCIImages(t)
+	packImages, err := OpenPackImages(bytes.NewReader(testOCIPack(t, mnf, images)))
+	require.NoError(t, err)
+
+	var blobUploads atomic.Int32
+	handler := registry.New()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/blobs/uploads/") {
+			blobUploads.Add(1)
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	serverUrl, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	regPort := serverUrl.Port()
+	ctx := context.Background()
+
+	notInPack, err := pushPackImages(ctx, packImages, []string{"rancher/k3s:v1.30", "public.ecr.aws/tensorleap/node-server:v2"}, regPort)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"public.ecr.aws/tensorleap/node-server:v2"}, notInPack)
+	// 3 layers and the config
+	assert.EqualValues(t, 4, blobUploads.Load())
+
+	// the base layers pushed with the first image are not uploaded again, only the image layer and config are
+	blobUploads.Store(0)
+	notInPack, err = pushPackImages(ctx, packImages, requiredPackImages(mnf), regPort)
+	require.NoError(t, err)
+	assert.Empty(t, notInPack)
+	assert.LessOrEqual(t, blobUploads.Load(), int32(2))
+
+	for image, img := range images {
+		ref, err := name.ParseReference(k3d.GetRegistryImageName(image, regPort), name.Insecure)
+		require.NoError(t, err)
+		pushed, err := remote.Image(ref)
+		require.NoError(t, err)
+		expected, err := img.Digest()
+		require.NoError(t, err)
+		digest, err := pushed.Digest()
+		require.NoError(t, err)
+		assert.Equal(t, expected, digest, image)
+	}
+
+	// images already in the registry are skipped
+	blobUploads.Store(0)
+	_, err = pushPackImages(ctx, packImages, requiredPackImages(mnf), regPort)
+	require.NoError(t, err)
+	assert.Zero(t, blobUploads.Load())
+}
@@ -0,0 +1,361 @@
+package airgap
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/tensorleap/helm-charts/pkg/log"
+)
+
+const SHA256SUMS_FILE_NAME = "SHA256SUMS"
+
+var partSuffixPattern = regexp.MustCompile(`\.part\d+$`)
+
+// PartPath is the path of the n-th part (starting at 1) of a split pack
+func PartPath(packPath string, n int) string {
+	return fmt.Sprintf("%s.part%03d", packPath, n)
+}
+
+// ChecksumEntry is a line of a SHA256SUMS index, File is relative to the index
+type ChecksumEntry struct {
+	Sum  string
+	File string
+}
+
+// SplitWriter writes a pack as numbered parts of at most partSize bytes, and on Close
+// writes the SHA256SUMS index of the parts next to them
+type SplitWriter struct {
+	packPath string
+	partSize int64
+	entries  []ChecksumEntry
+
+	part     *os.File
+	partHash hash.Hash
+	written  int64
+}
+
+func NewSplitWriter(packPath string, partSize int64) (*SplitWriter, error) {
+	if partSize <= 0 {
+		return nil, fmt.Errorf("invalid split size %d", partSize)
+	}
+	return &SplitWriter{packPath: packPath, partSize: partSize}, nil
+}
+
+func (w *SplitWriter) Write(p []byte) (int, error) {
+	total := 0
+	for len(p) > 0 {
+		if w.part == nil || w.written == w.partSize {
+			if err := w.nextPart(); err != nil {
+				return total, err
+			}
+		}
+		chunk := p[:min(int64(len(p)), w.partSize-w.written)]
+		n, err := io.MultiWriter(w.part, w.partHash).Write(chunk)
+		w.written += int64(n)
+		total += n
+		if err != nil {
+			return total, err
+		}
+		p = p[n:]
+	}
+	return total, nil
+}
+
+func (w *SplitWriter) nextPart() error {
+	if err := w.closePart(); err != nil {
+		return err
+	}
+	part, err := os.Create(PartPath(w.packPath, len(w.entries)+1))
+	if err != nil {
+		return err
+	}
+	w.part = part
+	w.partHash = sha256.New()
+	w.written = 0
+	return nil
+}
+
+func (w *SplitWriter) closePart() error {
+	if w.part == nil {
+		return nil
+	}
+	part := w.part
+	w.part = nil
+	if err := part.Close(); err != nil {
+		return err
+	}
+	w.entries = append(w.entries, ChecksumEntry{Sum: hex.EncodeToString(w.partHash.Sum(nil)), File: filepath.Base(part.Name())})
+	log.Infof("Packed part %s", part.Name())
+	return nil
+}
+
+// Close closes the last part and writes the parts to the SHA256SUMS index. An existing index is kept with the
+// entries of other files, only the entries of earlier parts of this pack are replaced.
+func (w *SplitWriter) Close() error {
+	if err := w.closePart(); err != nil {
+		return err
+	}
+	entries, err := ReadChecksums(w.IndexPath())
+	if os.IsNotExist(err) {
+		entries = []ChecksumEntry{}
+	} else if err != nil {
+		return err
+	}
+	packFile := filepath.Base(w.packPath)
+	merged := []ChecksumEntry{}
+	for _, entry := range entries {
+		if !isPartOf(entry.File, packFile) {
+			merged = append(merged, entry)
+		}
+	}
+	return WriteChecksums(w.IndexPath(), append(merged, w.entries...))
+}
+
+// isPartOf tells whether fileName is a part of the split pack file packFile
+func isPartOf(fileName, packFile string) bool {
+	return partSuffixPattern.MatchString(fileName) && partSuffixPattern.ReplaceAllString(fileName, "") == packFile
+}
+
+// IndexPath is the path of the SHA256SUMS index of the parts
+func (w *SplitWriter) IndexPath() string {
+	return filepath.Join(filepath.Dir(w.packPath), SHA256SUMS_FILE_NAME)
+}
+
+// WriteChecksums writes the entries in the format of sha256sum
+func WriteChecksums(indexPath string, entries []ChecksumEntry) error {
+	var content strings.Builder
+	for _, entry := range entries {
+		fmt.Fprintf(&content, "%s  %s\n", entry.Sum, entry.File)
+	}
+	return os.WriteFile(indexPath, []byte(content.String()), 0644)
+}
+
+// ReadChecksums reads a SHA256SUMS index written by WriteChecksums or sha256sum
+func ReadChecksums(indexPath string) ([]ChecksumEntry, error) {
+	file, err := os.Open(indexPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries := []ChecksumEntry{}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		sum, fileName, ok := strings.Cut(text, " ")
+		if !ok || len(sum) != sha256.Size*2 {
+			return nil, fmt.Errorf("invalid line %d of %s", line, indexPath)
+		}
+		// sha256sum marks binary mode files with '*'
+		fileName = strings.TrimPrefix(strings.TrimSpace(fileName), "*")
+		entries = append(entries, ChecksumEntry{Sum: strings.ToLower(sum), File: fileName})
+	}
+	return entries, scanner.Err()
+}
+
+// FileSha256 returns the hex sha256 of the file content
+func FileSha256(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// VerifyChecksums checks every file of the index, the error names each missing or corrupt file
+func VerifyChecksums(indexPath string, entries []ChecksumEntry) error {
+	dir := filepath.Dir(indexPath)
+	problems := []string{}
+	for _, entry := range entries {
+		sum, err := FileSha256(filepath.Join(dir, entry.File))
+		if os.IsNotExist(err) {
+			problems = append(problems, fmt.Sprintf("%s is missing", entry.File))
+		} else if err != nil {
+			problems = append(problems, fmt.Sprintf("%s could not be read: %v", entry.File, err))
+		} else if sum != entry.Sum {
+			problems = append(problems, fmt.Sprintf("%s is corrupt (sha256 %s, expected %s)", entry.File, sum, entry.Sum))
+		} else {
+			log.Infof("Verified %s", entry.File)
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("installation pack verification failed: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// PackFile is an opened installation pack, of one file or of all the parts of a split pack
+type PackFile interface {
+	PackReader
+	io.Closer
+}
+
+// verifiedPacks avoids hashing a pack again when it is opened more than once by a command
+var verifiedPacks sync.Map
+
+// OpenPack opens an installation pack given as a single file, the first part of a split pack or its SHA256SUMS index.
+// The parts of a split pack, and a single file listed in a SHA256SUMS next to it, are verified before it is opened.
+func OpenPack(packPath string) (PackFile, error) {
+	indexPath, entries, err := findPackChecksums(packPath)
+	if err != nil {
+		return nil, err
+	}
+	if entries == nil {
+		return os.Open(packPath)
+	}
+	// the index may be shared by several packs
+	verifiedKey := indexPath + ":" + entries[0].File
+	if _, verified := verifiedPacks.Load(verifiedKey); !verified {
+		log.Infof("Verifying the checksums of %d pack file(s) listed in %s", len(entries), indexPath)
+		if err := VerifyChecksums(indexPath, entries); err != nil {
+			return nil, err
+		}
+		verifiedPacks.Store(verifiedKey, true)
+	}
+	paths := []string{}
+	for _, entry := range entries {
+		paths = append(paths, filepath.Join(filepath.Dir(indexPath), entry.File))
+	}
+	return openParts(paths)
+}
+
+// findPackChecksums returns the index and the entries of the pack files, nil entries when the pack is not checksummed
+func findPackChecksums(packPath string) (string, []ChecksumEntry, error) {
+	if filepath.Base(packPath) == SHA256SUMS_FILE_NAME {
+		entries, err := ReadChecksums(packPath)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(entries) == 0 {
+			return "", nil, fmt.Errorf("%s lists no pack files", packPath)
+		}
+		packs := map[string]bool{}
+		for _, entry := range entries {
+			packs[partSuffixPattern.ReplaceAllString(entry.File, "")] = true
+		}
+		if len(packs) > 1 {
+			return "", nil, fmt.Errorf("%s lists the files of %d packs, pass the first part or the file of the pack instead", packPath, len(packs))
+		}
+		return packPath, entries, nil
+	}
+
+	indexPath := filepath.Join(filepath.Dir(packPath), SHA256SUMS_FILE_NAME)
+	isPart := partSuffixPattern.MatchString(packPath)
+	if isPart && packPath != PartPath(partSuffixPattern.ReplaceAllString(packPath, ""), 1) {
+		return "", nil, fmt.Errorf("%s is not the first part of the pack, pass the first part or %s", packPath, SHA256SUMS_FILE_NAME)
+	}
+	entries, err := ReadChecksums(indexPath)
+	if os.IsNotExist(err) {
+		if isPart {
+			return "", nil, fmt.Errorf("%s is part of a split pack but %s was not found next to it", packPath, SHA256SUMS_FILE_NAME)
+		}
+		return "", nil, nil
+	} else if err != nil {
+		return "", nil, err
+	}
+
+	// the index may list files of other packs, only the files of this pack are used
+	packFile := filepath.Base(packPath)
+	if isPart {
+		packFile = partSuffixPattern.ReplaceAllString(packFile, "")
+	}
+	packEntries := []ChecksumEntry{}
+	for _, entry := range entries {
+		if entry.File == packFile || (isPart && isPartOf(entry.File, packFile)) {
+			packEntries = append(packEntries, entry)
+		}
+	}
+	if len(packEntries) == 0 {
+		if isPart {
+			return "", nil, fmt.Errorf("%s does not list the parts of %s", indexPath, packPath)
+		}
+		return "", nil, nil
+	}
+	return indexPath, packEntries, nil
+}
+
+// partsFile reads the parts of a split pack as one file
+type partsFile struct {
+	*io.SectionReader
+	files   []*os.File
+	offsets []int64
+}
+
+func openParts(paths []string) (*partsFile, error) {
+	parts := &partsFile{}
+	var size int64
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			parts.Close()
+			return nil, err
+		}
+		parts.files = append(parts.files, file)
+		stat, err := file.Stat()
+		if err != nil {
+			parts.Close()
+			return nil, err
+		}
+		parts.offsets = append(parts.offsets, size)
+		size += stat.Size()
+	}
+	parts.SectionReader = io.NewSectionReader(readerAtFunc(parts.readAt), 0, size)
+	return parts, nil
+}
+
+func (p *partsFile) readAt(b []byte, off int64) (int, error) {
+	total := 0
+	for i := len(p.files) - 1; i >= 0 && len(b) > 0; i-- {
+		if off < p.offsets[i] {
+			continue
+		}
+		// the part holding off is found, read it and continue with the next parts
+		for ; i < len(p.files) && len(b) > 0; i++ {
+			n, err := p.files[i].ReadAt(b, off-p.offsets[i])
+			total += n
+			off += int64(n)
+			b = b[n:]
+			if err != nil && err != io.EOF {
+				return total, err
+			}
+		}
+		break
+	}
+	if len(b) > 0 {
+		return total, io.EOF
+	}
+	return total, nil
+}
+
+func (p *partsFile) Close() error {
+	var firstErr error
+	for _, file := range p.files {
+		if err := file.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+type readerAtFunc func(b []byte, off int64) (int, error)
+
+func (f readerAtFunc) ReadAt(b []byte, off int64) (int, error) {
+	return f(b, off)
+}
@@ -0,0 +1,127 @@
+package airgap
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeSplitPack(t *testing.T, content string, partSize int64) string {
+	packPath := filepath.Join(t.TempDir(), "pack.tar")
+	writer, err := NewSplitWriter(packPath, partSize)
+	require.NoError(t, err)
+	// several writes that do not align with the parts
+	for _, chunk := range []string{content[:3], content[3:11], content[11:]} {
+		_, err := writer.Write([]byte(chunk))
+		require.NoError(t, err)
+	}
+	require.NoError(t, writer.Close())
+	return packPath
+}
+
+func TestSplitPack(t *testing.T) {
+	content := "0123456789abcdefghijklmnopqrstuvwxyz"
+	packPath := writeSplitPack(t, content, 10)
+	indexPath := filepath.Join(filepath.Dir(packPath), SHA256SUMS_FILE_NAME)
+
+	entries, err := ReadChecksums(indexPath)
+	require.NoError(t, err)
+	require.Len(t, entries, 4)
+	assert.Equal(t, "pack.tar.part001", entries[0].File)
+	assert.Equal(t, "pack.tar.part004", entries[3].File)
+
+	for _, openPath := range []string{indexPath, PartPath(packPath, 1)} {
+		file, err := OpenPack(openPath)
+		require.NoError(t, err)
+		data, err := io.ReadAll(file)
+		require.NoError(t, err)
+		assert.Equal(t, content, string(data))
+
+		// reads across the parts after seeking
+		_, err = file.Seek(8, io.SeekStart)
+		require.NoError(t, err)
+		buf := make([]byte, 14)
+		_, err = io.ReadFull(file, buf)
+		require.NoError(t, err)
+		assert.Equal(t, content[8:22], string(buf))
+		require.NoError(t, file.Close())
+	}
+
+	_, err = OpenPack(PartPath(packPath, 2))
+	assert.ErrorContains(t, err, "not the first part")
+}
+
+func TestSplitPacksShareTheIndex(t *testing.T) {
+	packPath := writeSplitPack(t, "0123456789abcdefghijklmnopqrstuvwxyz", 10)
+	dir := filepath.Dir(packPath)
+	otherPath := filepath.Join(dir, "other.tar")
+	writer, err := NewSplitWriter(otherPath, 10)
+	require.NoError(t, err)
+	_, err = writer.Write([]byte("other pack"))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	// packing again replaces only the parts of that pack
+	writer, err = NewSplitWriter(packPath, 20)
+	require.NoError(t, err)
+	_, err = writer.Write([]byte("0123456789abcdefghijklmnopqrstuvwxyz"))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	entries, err := ReadChecksums(filepath.Join(dir, SHA256SUMS_FILE_NAME))
+	require.NoError(t, err)
+	files := []string{}
+	for _, entry := range entries {
+		files = append(files, entry.File)
+	}
+	assert.Equal(t, []string{"other.tar.part001", "pack.tar.part001", "pack.tar.part002"}, files)
+
+	for path, content := range map[string]string{PartPath(packPath, 1): "0123456789abcdefghijklmnopqrstuvwxyz", PartPath(otherPath, 1): "other pack"} {
+		file, err := OpenPack(path)
+		require.NoError(t, err)
+		data, err := io.ReadAll(file)
+		require.NoError(t, err)
+		assert.Equal(t, content, string(data))
+		require.NoError(t, file.Close())
+	}
+
+	_, err = OpenPack(filepath.Join(dir, SHA256SUMS_FILE_NAME))
+	assert.ErrorContains(t, err, "lists the files of 2 packs")
+}
+
+func TestOpenPackReportsCorruptParts(t *testing.T) {
+	packPath := writeSplitPack(t, "0123456789abcdefghijklmnopqrstuvwxyz", 10)
+	require.NoError(t, os.WriteFile(PartPath(packPath, 3), []byte("corrupted!"), 0644))
+	require.NoError(t, os.Remove(PartPath(packPath, 4)))
+
+	_, err := OpenPack(PartPath(packPath, 1))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "pack.tar.part003 is corrupt")
+	assert.Contains(t, err.Error(), "pack.tar.part004 is missing")
+	assert.NotContains(t, err.Error(), "part001")
+}
+
+func TestOpenPackSingleFile(t *testing.T) {
+	dir := t.TempDir()
+	packPath := filepath.Join(dir, "pack.tar")
+	require.NoError(t, os.WriteFile(packPath, []byte("pack"), 0644))
+
+	file, err := OpenPack(packPath)
+	require.NoError(t, err)
+	data, err := io.ReadAll(file)
+	require.NoError(t, err)
+	assert.Equal(t, "pack", string(data))
+	require.NoError(t, file.Close())
+
+	// a single file listed in a SHA256SUMS next to it is verified
+	sum, err := FileSha256(packPath)
+	require.NoError(t, err)
+	require.NoError(t, WriteChecksums(filepath.Join(dir, SHA256SUMS_FILE_NAME), []ChecksumEntry{{Sum: strings.Repeat("0", len(sum)), File: "pack.tar"}}))
+	_, err = OpenPack(packPath)
+	assert.ErrorContains(t, err, "pack.tar is corrupt")
+}
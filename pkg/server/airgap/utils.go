@@ -1,8 +1,11 @@
 package airgap
 
 const (
+	PACK_INFO_FILE_NAME         = "pack.yaml"
 	IMAGES_FILE_NAME            = "images.tgz"
+	OCI_IMAGES_DIR_NAME         = "images"
 	MANIFEST_FILE_NAME          = "manifest.yaml"
+	DELTA_FILE_NAME             = "delta.yaml"
 	SERVER_HELM_CHART_FILE_NAME = "tensorleap-chart.tgz"
 	INFRA_HELM_CHART_FILE_NAME  = "tensorleap-infra-chart.tgz"
 )
@@ -0,0 +1,363 @@
+package airgap
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/distribution/reference"
+	"github.com/tensorleap/helm-charts/pkg/server/manifest"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+)
+
+// VerifyCheck is one check of a pack verification
+type VerifyCheck struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// VerifyReport is the result of verifying an installation pack without installing it
+type VerifyReport struct {
+	Pack   string        `json:"pack"`
+	Tag    string        `json:"tag,omitempty"`
+	Passed bool          `json:"passed"`
+	Checks []VerifyCheck `json:"checks"`
+}
+
+func (r *VerifyReport) Add(name string, err error, passedDetail string) {
+	check := VerifyCheck{Name: name, Passed: err == nil, Detail: passedDetail}
+	if err != nil {
+		check.Detail = err.Error()
+	}
+	r.Checks = append(r.Checks, check)
+	r.Passed = r.Passed && check.Passed
+}
+
+func NewVerifyReport(packPath string) *VerifyReport {
+	return &VerifyReport{Pack: packPath, Passed: true, Checks: []VerifyCheck{}}
+}
+
+// packContent is what a single pass over the pack found
+type packContent struct {
+	files       map[string]int
+	packInfo    *PackInfo
+	packInfoErr error
+	oci         *ociLayoutContent
+	manifest    []byte
+	delta       *DeltaInfo
+	deltaErr    error
+	imageNames  map[string]bool
+	imagesErr   error
+	infraChart  *chart.Chart
+	infraErr    error
+	serverChart *chart.Chart
+	serverErr   error
+}
+
+// Verify reads the pack once and adds the checks of its structure, manifest, images and charts to the report.
+// The images are checked against the index of the image archive, they are not loaded into docker.
+// It returns the manifest of the pack, nil when it could not be parsed.
+func Verify(file io.Reader, report *VerifyReport) *manifest.InstallationManifest {
+	content, err := readPackContent(file)
+	report.Add("tar structure", verifyStructure(content, err), fmt.Sprintf("%d files", len(content.files)))
+	if err != nil {
+		return nil
+	}
+
+	if content.packInfoErr != nil {
+		report.Add("pack format", content.packInfoErr, "")
+		return nil
+	}
+	report.Add("pack format", nil, packFormatDetail(content.packInfo))
+
+	var mnf *manifest.InstallationManifest
+	if content.manifest != nil {
+		mnf, err = manifest.LoadFromBytes(content.manifest)
+		if err != nil {
+			err = fmt.Errorf("failed to parse %s: %w", MANIFEST_FILE_NAME, err)
+		}
+		report.Add("manifest", err, "")
+		if mnf != nil {
+			report.Tag = mnf.Tag
+			report.Checks[len(report.Checks)-1].Detail = fmt.Sprintf("tag %s, app version %s", mnf.Tag, mnf.AppVersion)
+		}
+	}
+
+	if content.files[DELTA_FILE_NAME] > 0 {
+		detail := ""
+		if content.delta != nil {
+			detail = fmt.Sprintf("base tag %s, %d images and %d charts omitted", content.delta.BaseTag, len(content.delta.OmittedImages), len(content.delta.OmittedCharts))
+		}
+		report.Add("delta", content.deltaErr, detail)
+		if content.deltaErr != nil {
+			return nil
+		}
+	}
+
+	if mnf != nil {
+		images := content.delta.PackedImages(mnf)
+		switch {
+		case content.imagesErr != nil:
+			report.Add("images", content.imagesErr, "")
+		case content.imageNames != nil:
+			report.Add("images", verifyImages(images, content.imageNames, content.imagesFileName()), fmt.Sprintf("%d images", len(images)))
+		case content.delta != nil && len(images) > 0:
+			report.Add("images", fmt.Errorf("not found %s", content.imagesFileName()), "")
+		case content.delta != nil:
+			report.Add("images", nil, "all images omitted")
+		}
+	} else if content.imagesErr != nil {
+		report.Add("images", content.imagesErr, "")
+	}
+
+	var infraChartMeta, serverChartMeta *manifest.HelmChartMeta
+	if mnf != nil {
+		infraChartMeta, serverChartMeta = &mnf.InfraHelmChart, &mnf.ServerHelmChart
+	}
+	verifyPackChart(report, "infra chart", content, INFRA_HELM_CHART_FILE_NAME, content.infraChart, content.infraErr, infraChartMeta)
+	verifyPackChart(report, "server chart", content, SERVER_HELM_CHART_FILE_NAME, content.serverChart, content.serverErr, serverChartMeta)
+	return mnf
+}
+
+func verifyPackChart(report *VerifyReport, name string, content *packContent, fileName string, helmChart *chart.Chart, loadErr error, chartMeta *manifest.HelmChartMeta) {
+	if content.files[fileName] == 0 {
+		// a chart missing from a full pack fails the tar structure check
+		if chartMeta == nil || content.delta == nil {
+			return
+		}
+		if content.delta.IsChartOmitted(*chartMeta) {
+			report.Add(name, nil, fmt.Sprintf("%s %s omitted, installed from the helm cache", chartMeta.ChartName, chartMeta.Version))
+		} else {
+			report.Add(name, fmt.Errorf("not found %s", fileName), "")
+		}
+		return
+	}
+	report.Add(name, verifyChart(helmChart, loadErr, chartMeta), chartDetail(helmChart))
+}
+
+func readPackContent(file io.Reader) (*packContent, error) {
+	content := &packContent{files: map[string]int{}}
+	tarReader := tar.NewReader(file)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			if content.oci != nil {
+				content.imageNames, content.imagesErr = content.oci.imageNames()
+			}
+			return content, nil
+		} else if err != nil {
+			return content, fmt.Errorf("failed reading the pack tar: %w", err)
+		}
+		fileName := filepath.Clean(header.Name)
+		content.files[fileName]++
+
+		if isOCIImagesEntry(fileName) {
+			if content.oci == nil {
+				content.oci = newOCILayoutContent()
+			}
+			if err := content.oci.add(fileName, header.Size, tarReader); err != nil {
+				return content, fmt.Errorf("failed reading %s from the pack tar: %w", fileName, err)
+			}
+			continue
+		}
+
+		switch fileName {
+		case PACK_INFO_FILE_NAME:
+			content.packInfo, content.packInfoErr = readPackInfo(tarReader)
+		case MANIFEST_FILE_NAME:
+			content.manifest, err = io.ReadAll(tarReader)
+		case DELTA_FILE_NAME:
+			content.delta, content.deltaErr = readDeltaInfo(tarReader)
+		case IMAGES_FILE_NAME:
+			content.imageNames, content.imagesErr = readImageArchiveIndex(tarReader)
+		case INFRA_HELM_CHART_FILE_NAME:
+			content.infraChart, content.infraErr = loader.LoadArchive(tarReader)
+		case SERVER_HELM_CHART_FILE_NAME:
+			content.serverChart, content.serverErr = loader.LoadArchive(tarReader)
+		}
+		if err != nil {
+			return content, fmt.Errorf("failed reading %s from the pack tar: %w", fileName, err)
+		}
+	}
+}
+
+func verifyStructure(content *packContent, readErr error) error {
+	if readErr != nil {
+		return readErr
+	}
+	problems := []string{}
+	for _, fileName := range []string{PACK_INFO_FILE_NAME, MANIFEST_FILE_NAME, DELTA_FILE_NAME, content.imagesFileName(), INFRA_HELM_CHART_FILE_NAME, SERVER_HELM_CHART_FILE_NAME} {
+		// a delta pack may omit its resources, the checks of the resources tell whether it may.
+		// packs of the docker archive format written before the pack info have none
+		isOptional := fileName == DELTA_FILE_NAME || fileName == PACK_INFO_FILE_NAME ||
+			(content.files[DELTA_FILE_NAME] > 0 && fileName != MANIFEST_FILE_NAME)
+		switch content.files[fileName] {
+		case 0:
+			if isOptional {
+				continue
+			}
+			problems = append(problems, fmt.Sprintf("not found %s", fileName))
+		case 1:
+		default:
+			problems = append(problems, fmt.Sprintf("%s found %d times", fileName, content.files[fileName]))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// imagesFileName is the file of the pack that indexes its images
+func (c *packContent) imagesFileName() string {
+	if c.packInfo != nil && c.packInfo.FormatVersion == PackFormatOCILayout {
+		return path.Join(OCI_IMAGES_DIR_NAME, OCI_INDEX_FILE_NAME)
+	}
+	return IMAGES_FILE_NAME
+}
+
+func packFormatDetail(info *PackInfo) string {
+	if info == nil || info.FormatVersion == PackFormatDockerArchive {
+		return fmt.Sprintf("version %d (docker archive)", PackFormatDockerArchive)
+	}
+	return fmt.Sprintf("version %d (OCI image layout)", info.FormatVersion)
+}
+
+// dockerArchiveManifest is an entry of the manifest.json of a docker save archive
+type dockerArchiveManifest struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+// ociIndex is the index.json of an OCI image layout, docker save writes one since docker 25
+type ociIndex struct {
+	Manifests []struct {
+		Annotations map[string]string `json:"annotations"`
+	} `json:"manifests"`
+}
+
+// readImageArchiveIndex reads the gzipped docker save archive and returns the normalized names of its images.
+// The archive is streamed, the files referenced by its manifest.json must all be in it.
+func readImageArchiveIndex(reader io.Reader) (map[string]bool, error) {
+	gzipReader, err := gzip.NewReader(reader)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not gzipped: %w", IMAGES_FILE_NAME, err)
+	}
+	defer gzipReader.Close()
+
+	tarReader := tar.NewReader(gzipReader)
+	entries := map[string]bool{}
+	var archiveManifests []dockerArchiveManifest
+	var index *ociIndex
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed reading the image archive %s: %w", IMAGES_FILE_NAME, err)
+		}
+		name := filepath.Clean(header.Name)
+		entries[name] = true
+		switch name {
+		case "manifest.json":
+			if err := json.NewDecoder(tarReader).Decode(&archiveManifests); err != nil {
+				return nil, fmt.Errorf("failed parsing manifest.json of the image archive: %w", err)
+			}
+		case "index.json":
+			index = &ociIndex{}
+			if err := json.NewDecoder(tarReader).Decode(index); err != nil {
+				return nil, fmt.Errorf("failed parsing index.json of the image archive: %w", err)
+			}
+		}
+	}
+	if archiveManifests == nil {
+		return nil, fmt.Errorf("manifest.json not found in the image archive %s", IMAGES_FILE_NAME)
+	}
+
+	names := map[string]bool{}
+	missingFiles := []string{}
+	for _, archiveManifest := range archiveManifests {
+		for _, file := range append([]string{archiveManifest.Config}, archiveManifest.Layers...) {
+			if !entries[filepath.Clean(file)] {
+				missingFiles = append(missingFiles, file)
+			}
+		}
+		for _, tag := range archiveManifest.RepoTags {
+			names[normalizeImageName(tag)] = true
+		}
+	}
+	if index != nil {
+		for _, indexManifest := range index.Manifests {
+			for _, key := range []string{"io.containerd.image.name", "org.opencontainers.image.ref.name"} {
+				if name := indexManifest.Annotations[key]; name != "" {
+					names[normalizeImageName(name)] = true
+				}
+			}
+		}
+	}
+	if len(missingFiles) > 0 {
+		return nil, fmt.Errorf("the image archive is missing %d files of its images, e.g. %s", len(missingFiles), missingFiles[0])
+	}
+	return names, nil
+}
+
+// requiredPackImages are the images of the manifest the pack must hold
+func requiredPackImages(mnf *manifest.InstallationManifest) []string {
+	images := []string{}
+	seen := map[string]bool{}
+	for _, image := range mnf.GetAllImages() {
+		if image != "" && !seen[image] {
+			seen[image] = true
+			images = append(images, image)
+		}
+	}
+	return images
+}
+
+func verifyImages(images []string, archiveNames map[string]bool, imagesFileName string) error {
+	missing := []string{}
+	for _, image := range images {
+		if !archiveNames[normalizeImageName(image)] {
+			missing = append(missing, image)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("%d of %d images are missing from %s: %s", len(missing), len(images), imagesFileName, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func normalizeImageName(image string) string {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return image
+	}
+	return reference.TagNameOnly(named).String()
+}
+
+func verifyChart(helmChart *chart.Chart, loadErr error, chartMeta *manifest.HelmChartMeta) error {
+	if loadErr != nil {
+		return fmt.Errorf("failed loading the chart: %w", loadErr)
+	}
+	if chartMeta != nil && helmChart.Metadata.Version != chartMeta.Version {
+		return fmt.Errorf("chart version is %s but the manifest requires %s", helmChart.Metadata.Version, chartMeta.Version)
+	}
+	return nil
+}
+
+func chartDetail(helmChart *chart.Chart) string {
+	if helmChart == nil || helmChart.Metadata == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s %s", helmChart.Metadata.Name, helmChart.Metadata.Version)
+}
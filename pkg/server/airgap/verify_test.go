@@ -0,0 +1,155 @@
+package airgap
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tensorleap/helm-charts/pkg/server/manifest"
+	"gopkg.in/yaml.v3"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+func addTarFile(t *testing.T, tarWriter *tar.Writer, name string, data []byte) {
+	require.NoError(t, tarWriter.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(data))}))
+	_, err := tarWriter.Write(data)
+	require.NoError(t, err)
+}
+
+// testImageArchive is a gzipped docker save archive of images that share one config and layer
+func testImageArchive(t *testing.T, repoTags ...string) []byte {
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzipWriter)
+	addTarFile(t, tarWriter, "blobs/sha256/config", []byte("{}"))
+	addTarFile(t, tarWriter, "blobs/sha256/layer", []byte("layer"))
+	archiveManifest, err := json.Marshal([]dockerArchiveManifest{{Config: "blobs/sha256/config", RepoTags: repoTags, Layers: []string{"blobs/sha256/layer"}}})
+	require.NoError(t, err)
+	addTarFile(t, tarWriter, "manifest.json", archiveManifest)
+	require.NoError(t, tarWriter.Close())
+	require.NoError(t, gzipWriter.Close())
+	return buf.Bytes()
+}
+
+func testChartArchive(t *testing.T, name, version string) []byte {
+	dir := t.TempDir()
+	chartPath, err := chartutil.Save(&chart.Chart{Metadata: &chart.Metadata{Name: name, Version: version, APIVersion: chart.APIVersionV2}}, dir)
+	require.NoError(t, err)
+	data, err := os.ReadFile(chartPath)
+	require.NoError(t, err)
+	return data
+}
+
+func testPackManifest() *manifest.InstallationManifest {
+	mnf := &manifest.InstallationManifest{
+		Version:          manifest.CurrentManifestVersion,
+		InstallerVersion: "v0.10.0",
+		Tag:              "v1.2.3",
+		ServerHelmChart:  manifest.HelmChartMeta{ChartName: "tensorleap", Version: "1.2.3"},
+		InfraHelmChart:   manifest.HelmChartMeta{ChartName: "tensorleap-infra", Version: "0.1.0"},
+	}
+	mnf.Images.K3s = "rancher/k3s:v1.30"
+	mnf.Images.ServerImages = []string{"public.ecr.aws/tensorleap/engine:v1"}
+	return mnf
+}
+
+func testPack(t *testing.T, mnf *manifest.InstallationManifest, images []byte, skip string) *bytes.Reader {
+	var buf bytes.Buffer
+	tarWriter := tar.NewWriter(&buf)
+	manifestBytes, err := yaml.Marshal(mnf)
+	require.NoError(t, err)
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{MANIFEST_FILE_NAME, manifestBytes},
+		{IMAGES_FILE_NAME, images},
+		{SERVER_HELM_CHART_FILE_NAME, testChartArchive(t, "tensorleap", "1.2.3")},
+		{INFRA_HELM_CHART_FILE_NAME, testChartArchive(t, "tensorleap-infra", "0.1.0")},
+	}
+	for _, file := range files {
+		if file.name != skip {
+			addTarFile(t, tarWriter, file.name, file.data)
+		}
+	}
+	require.NoError(t, tarWriter.Close())
+	return bytes.NewReader(buf.Bytes())
+}
+
+func failedChecks(report *VerifyReport) map[string]string {
+	failed := map[string]string{}
+	for _, check := range report.Checks {
+		if !check.Passed {
+			failed[check.Name] = check.Detail
+		}
+	}
+	return failed
+}
+
+func TestVerify(t *testing.T) {
+	mnf := testPackManifest()
+
+	t.Run("valid pack", func(t *testing.T) {
+		report := NewVerifyReport("pack.tar")
+		// docker save writes docker hub images by their short names
+		images := testImageArchive(t, "rancher/k3s:v1.30", "public.ecr.aws/tensorleap/engine:v1")
+		packMnf := Verify(testPack(t, mnf, images, ""), report)
+		require.NotNil(t, packMnf)
+		assert.Empty(t, failedChecks(report))
+		assert.True(t, report.Passed)
+		assert.Equal(t, "v1.2.3", report.Tag)
+	})
+
+	t.Run("missing image", func(t *testing.T) {
+		report := NewVerifyReport("pack.tar")
+		Verify(testPack(t, mnf, testImageArchive(t, "rancher/k3s:v1.30"), ""), report)
+		assert.False(t, report.Passed)
+		assert.Equal(t, map[string]string{"images": "1 of 2 images are missing from images.tgz: public.ecr.aws/tensorleap/engine:v1"}, failedChecks(report))
+	})
+
+	t.Run("missing chart", func(t *testing.T) {
+		report := NewVerifyReport("pack.tar")
+		Verify(testPack(t, mnf, testImageArchive(t, "rancher/k3s:v1.30", "public.ecr.aws/tensorleap/engine:v1"), INFRA_HELM_CHART_FILE_NAME), report)
+		assert.Equal(t, map[string]string{"tar structure": "not found tensorleap-infra-chart.tgz"}, failedChecks(report))
+	})
+
+	t.Run("chart version mismatch", func(t *testing.T) {
+		changed := testPackManifest()
+		changed.ServerHelmChart.Version = "1.2.4"
+		report := NewVerifyReport("pack.tar")
+		Verify(testPack(t, changed, testImageArchive(t, "rancher/k3s:v1.30", "public.ecr.aws/tensorleap/engine:v1"), ""), report)
+		assert.Equal(t, map[string]string{"server chart": "chart version is 1.2.3 but the manifest requires 1.2.4"}, failedChecks(report))
+	})
+
+	t.Run("unsupported manifest version", func(t *testing.T) {
+		changed := testPackManifest()
+		changed.Version = "0.0.1"
+		report := NewVerifyReport("pack.tar")
+		assert.Nil(t, Verify(testPack(t, changed, testImageArchive(t), ""), report))
+		assert.Contains(t, failedChecks(report)["manifest"], "unsupported installation manifest version")
+	})
+
+	t.Run("split pack", func(t *testing.T) {
+		pack := testPack(t, mnf, testImageArchive(t, "rancher/k3s:v1.30", "public.ecr.aws/tensorleap/engine:v1"), "")
+		packPath := filepath.Join(t.TempDir(), "pack.tar")
+		writer, err := NewSplitWriter(packPath, 1000)
+		require.NoError(t, err)
+		_, err = pack.WriteTo(writer)
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+
+		file, err := OpenPack(writer.IndexPath())
+		require.NoError(t, err)
+		defer file.Close()
+		report := NewVerifyReport(packPath)
+		Verify(file, report)
+		assert.Empty(t, failedChecks(report))
+	})
+}
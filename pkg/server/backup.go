@@ -0,0 +1,485 @@
+package server
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tensorleap/helm-charts/pkg/k3d"
+	"github.com/tensorleap/helm-charts/pkg/local"
+	"github.com/tensorleap/helm-charts/pkg/log"
+	"github.com/tensorleap/helm-charts/pkg/server/manifest"
+	"github.com/tensorleap/helm-charts/pkg/version"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	BackupFormatVersion    = 1
+	backupMetadataFileName = "backup-metadata.yaml"
+	backupStoragePrefix    = "storage"
+	backupConfigPrefix     = "config"
+)
+
+var ErrIncompatibleBackup = errors.New("backup is not compatible with the current installation")
+
+// backupStoreDirs maps the application data targets to their directory under the data dir
+var backupStoreDirs = map[CustomTarget]string{
+	TargetMongo:    local.MONGODB_STORAGE_DIR_NAME,
+	TargetMinio:    local.MINIO_STORAGE_DIR_NAME,
+	TargetElastic:  local.ELASTIC_STORAGE_DIR_NAME,
+	TargetKeycloak: local.KEYCLOAK_DB_STORAGE_DIR_NAME,
+}
+
+// BackupStores are the stores a backup can hold, in archive order
+var BackupStores = []CustomTarget{TargetMongo, TargetMinio, TargetElastic, TargetKeycloak}
+
+// BackupMetadata is the first entry of the backup archive
+type BackupMetadata struct {
+	FormatVersion    int            `yaml:"formatVersion" json:"formatVersion"`
+	CreatedAt        time.Time      `yaml:"createdAt" json:"createdAt"`
+	InstallerVersion string         `yaml:"installerVersion" json:"installerVersion"`
+	Tag              string         `yaml:"tag,omitempty" json:"tag,omitempty"`
+	AppVersion       string         `yaml:"appVersion,omitempty" json:"appVersion,omitempty"`
+	Stores           []CustomTarget `yaml:"stores" json:"stores"`
+}
+
+func (meta *BackupMetadata) HasStore(target CustomTarget) bool {
+	for _, store := range meta.Stores {
+		if store == target {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseBackupStores validates store names, an empty list or "all-app-data" selects all stores
+func ParseBackupStores(names []string) ([]CustomTarget, error) {
+	if len(names) == 0 {
+		return BackupStores, nil
+	}
+	selected := map[CustomTarget]bool{}
+	for _, name := range names {
+		target := CustomTarget(strings.TrimSpace(name))
+		if target == TargetAllAppData {
+			return BackupStores, nil
+		}
+		if _, ok := backupStoreDirs[target]; !ok {
+			return nil, fmt.Errorf("unknown store '%s', expected one of: %s", name, joinTargets(append(BackupStores, TargetAllAppData)))
+		}
+		selected[target] = true
+	}
+	stores := []CustomTarget{}
+	for _, target := range BackupStores {
+		if selected[target] {
+			stores = append(stores, target)
+		}
+	}
+	return stores, nil
+}
+
+func joinTargets(targets []CustomTarget) string {
+	names := make([]string, len(targets))
+	for i, t := range targets {
+		names[i] = string(t)
+	}
+	return strings.Join(names, ", ")
+}
+
+// withClusterStopped stops a running cluster so the databases are not written while
+// their files are copied, and starts it again afterwards
+func withClusterStopped(ctx context.Context, fn func() error) error {
+	cluster, err := k3d.GetCluster(ctx)
+	if err != nil {
+		return err
+	}
+	wasRunning := false
+	if cluster != nil {
+		running, _ := cluster.ServerCountRunning()
+		wasRunning = running > 0
+	}
+	if wasRunning {
+		if err := k3d.StopCluster(ctx); err != nil {
+			return err
+		}
+	}
+
+	fnErr := fn()
+
+	if wasRunning {
+		if err := k3d.RunCluster(ctx); err != nil {
+			if fnErr != nil {
+				return fmt.Errorf("%w (also failed restarting the cluster: %v)", fnErr, err)
+			}
+			return err
+		}
+	}
+	return fnErr
+}
+
+// Backup stops the cluster and archives the selected stores together with the installation config
+func Backup(ctx context.Context, output io.Writer, stores []CustomTarget) (*BackupMetadata, error) {
+	meta := &BackupMetadata{
+		FormatVersion:    BackupFormatVersion,
+		CreatedAt:        time.Now().UTC(),
+		InstallerVersion: version.Version,
+		Stores:           stores,
+	}
+	mnf, err := manifest.Load(local.GetInstallationManifestPath())
+	if err != nil && err != manifest.ErrManifestNotFound {
+		return nil, err
+	}
+	if mnf != nil {
+		meta.Tag = mnf.Tag
+		meta.AppVersion = mnf.AppVersion
+	}
+
+	err = withClusterStopped(ctx, func() error {
+		return writeBackupArchive(output, meta)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+func writeBackupArchive(output io.Writer, meta *BackupMetadata) error {
+	dataDir := local.GetServerDataDir()
+	gzipWriter := gzip.NewWriter(output)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	// only stores that have data are recorded, so restore never wipes a store it cannot refill
+	stores := []CustomTarget{}
+	for _, store := range meta.Stores {
+		storeDir := path.Join(dataDir, backupStoreDirs[store])
+		if _, err := os.Stat(storeDir); os.IsNotExist(err) {
+			log.Warnf("Store %s has no data at %s, skipping", store, storeDir)
+			continue
+		}
+		stores = append(stores, store)
+	}
+	meta.Stores = stores
+
+	metaBytes, err := yaml.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	if err := tarWriter.WriteHeader(&tar.Header{Name: backupMetadataFileName, Mode: 0644, Size: int64(len(metaBytes)), ModTime: meta.CreatedAt}); err != nil {
+		return err
+	}
+	if _, err := tarWriter.Write(metaBytes); err != nil {
+		return err
+	}
+
+	for _, fileName := range backupConfigFiles() {
+		filePath := path.Join(dataDir, fileName)
+		if _, err := os.Stat(filePath); os.IsNotExist(err) {
+			continue
+		}
+		if err := local.AddDirToTar(tarWriter, filePath, path.Join(backupConfigPrefix, path.Base(fileName))); err != nil {
+			return err
+		}
+	}
+
+	for _, store := range meta.Stores {
+		storeDir := path.Join(dataDir, backupStoreDirs[store])
+		log.Infof("Backing up %s...", store)
+		if err := local.AddDirToTar(tarWriter, storeDir, path.Join(backupStoragePrefix, string(store))); err != nil {
+			return fmt.Errorf("failed backing up %s: %w", store, err)
+		}
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
+	return gzipWriter.Close()
+}
+
+func backupConfigFiles() []string {
+	return []string{
+		path.Join(local.MANIFEST_DIR_NAME, local.INSTALLATION_PARAMS_FILE_NAME),
+		path.Join(local.MANIFEST_DIR_NAME, local.INSTALLATION_MANIFEST_FILE_NAME),
+		local.HOSTNAME_FILE,
+	}
+}
+
+// ReadBackupMetadata reads only the metadata header of a backup archive
+func ReadBackupMetadata(archivePath string) (*BackupMetadata, error) {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("not a backup archive: %w", err)
+	}
+	defer gzipReader.Close()
+	return readBackupMetadata(tar.NewReader(gzipReader))
+}
+
+func readBackupMetadata(tarReader *tar.Reader) (*BackupMetadata, error) {
+	header, err := tarReader.Next()
+	if err != nil {
+		return nil, fmt.Errorf("not a backup archive: %w", err)
+	}
+	if header.Name != backupMetadataFileName {
+		return nil, fmt.Errorf("not a backup archive: missing %s", backupMetadataFileName)
+	}
+	metaBytes, err := io.ReadAll(tarReader)
+	if err != nil {
+		return nil, err
+	}
+	meta := &BackupMetadata{}
+	if err := yaml.Unmarshal(metaBytes, meta); err != nil {
+		return nil, fmt.Errorf("invalid backup metadata: %w", err)
+	}
+	return meta, nil
+}
+
+// CheckBackupCompatibility verifies the backup can be restored on top of the installed manifest.
+// Data is only portable between installations of the same app version.
+func CheckBackupCompatibility(meta *BackupMetadata, currentMnf *manifest.InstallationManifest) error {
+	if meta.FormatVersion > BackupFormatVersion {
+		return fmt.Errorf("%w: backup format version %d is newer than supported (%d), upgrade the CLI", ErrIncompatibleBackup, meta.FormatVersion, BackupFormatVersion)
+	}
+	if currentMnf == nil || meta.AppVersion == "" {
+		return nil
+	}
+	if currentMnf.AppVersion != meta.AppVersion {
+		return fmt.Errorf("%w: backup app version is %s (tag %s) but the installed app version is %s (tag %s), install tag %s before restoring",
+			ErrIncompatibleBackup, meta.AppVersion, meta.Tag, currentMnf.AppVersion, currentMnf.Tag, meta.Tag)
+	}
+	return nil
+}
+
+type RestoreOptions struct {
+	// Stores to restore, all the stores of the backup when empty
+	Stores        []CustomTarget
+	RestoreConfig bool
+	Force         bool
+	// TargetMnf is the version the data is restored for, the installed one when nil
+	TargetMnf *manifest.InstallationManifest
+}
+
+// Restore stops the cluster, replaces the selected stores with the backup content and starts the cluster again
+func Restore(ctx context.Context, archivePath string, opts RestoreOptions) (*BackupMetadata, error) {
+	meta, err := ReadBackupMetadata(archivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	currentMnf := opts.TargetMnf
+	if currentMnf == nil {
+		currentMnf, err = manifest.Load(local.GetInstallationManifestPath())
+		if err != nil && err != manifest.ErrManifestNotFound {
+			return nil, err
+		}
+	}
+	if err := CheckBackupCompatibility(meta, currentMnf); err != nil {
+		if !opts.Force || meta.FormatVersion > BackupFormatVersion {
+			return nil, err
+		}
+		log.Warnf("%s, restoring anyway (--force)", err)
+	}
+
+	if len(opts.Stores) == 0 {
+		opts.Stores = meta.Stores
+	}
+	for _, store := range opts.Stores {
+		if !meta.HasStore(store) {
+			return nil, fmt.Errorf("backup does not contain %s, it contains: %s", store, joinTargets(meta.Stores))
+		}
+	}
+
+	err = withClusterStopped(ctx, func() error {
+		return extractBackupArchive(archivePath, opts)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// extractBackupArchive restores the selected stores and config of the archive. They are extracted into a staging
+// dir next to the data dir and swapped in with renames only once the whole archive was read and checked, so a
+// corrupt or cut-off backup leaves the live data as it was.
+func extractBackupArchive(archivePath string, opts RestoreOptions) error {
+	dataDir := filepath.Clean(local.GetServerDataDir())
+	stagingDir, err := os.MkdirTemp(filepath.Dir(dataDir), "."+filepath.Base(dataDir)+"-restore-")
+	if err != nil {
+		return fmt.Errorf("failed creating the restore staging dir: %w", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(stagingDir); err != nil {
+			log.Warnf("Failed removing the restore staging dir %s: %v", stagingDir, err)
+		}
+	}()
+
+	stagedDataDir := filepath.Join(stagingDir, "data")
+	restored, err := stageBackupArchive(archivePath, opts, stagedDataDir)
+	if err != nil {
+		return err
+	}
+	return swapInRestored(dataDir, stagedDataDir, filepath.Join(stagingDir, "previous"), restored)
+}
+
+// stageBackupArchive extracts the selected content of the archive into stagedDataDir, laid out as the data dir,
+// and returns the paths it restores relative to the data dir
+func stageBackupArchive(archivePath string, opts RestoreOptions, stagedDataDir string) ([]string, error) {
+	selected := map[string]bool{}
+	for _, store := range opts.Stores {
+		selected[string(store)] = true
+	}
+
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer gzipReader.Close()
+	tarReader := tar.NewReader(gzipReader)
+	if _, err := readBackupMetadata(tarReader); err != nil {
+		return nil, err
+	}
+
+	configDestinations := map[string]string{}
+	for _, fileName := range backupConfigFiles() {
+		configDestinations[path.Join(backupConfigPrefix, path.Base(fileName))] = fileName
+	}
+
+	restored := []string{}
+	foundStores := map[string]bool{}
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("the backup archive is corrupt or incomplete: %w", err)
+		}
+		name := strings.TrimSuffix(header.Name, "/")
+
+		if dest, ok := configDestinations[name]; ok {
+			if !opts.RestoreConfig {
+				continue
+			}
+			log.Infof("Restoring %s", dest)
+			if err := extractBackupEntry(header, tarReader, stagedDataDir, dest); err != nil {
+				return nil, err
+			}
+			restored = append(restored, dest)
+			continue
+		}
+
+		parts := strings.SplitN(name, "/", 3)
+		if len(parts) < 2 || parts[0] != backupStoragePrefix || !selected[parts[1]] {
+			continue
+		}
+		if !foundStores[parts[1]] {
+			log.Infof("Restoring %s...", parts[1])
+			foundStores[parts[1]] = true
+		}
+		storeDir := backupStoreDirs[CustomTarget(parts[1])]
+		relPath := ""
+		if len(parts) == 3 {
+			relPath = parts[2]
+		}
+		if err := extractBackupEntry(header, tarReader, filepath.Join(stagedDataDir, storeDir), relPath); err != nil {
+			return nil, fmt.Errorf("failed restoring %s: %w", parts[1], err)
+		}
+	}
+	// reading to the end of the gzip stream checks its checksum and length
+	if _, err := io.Copy(io.Discard, gzipReader); err != nil {
+		return nil, fmt.Errorf("the backup archive is corrupt or incomplete: %w", err)
+	}
+
+	for _, store := range opts.Stores {
+		if !foundStores[string(store)] {
+			return nil, fmt.Errorf("the backup archive is incomplete: it has no data for %s", store)
+		}
+		restored = append(restored, backupStoreDirs[store])
+	}
+	return restored, nil
+}
+
+// extractBackupEntry extracts the entry and checks a file got all the bytes its header declares
+func extractBackupEntry(header *tar.Header, reader io.Reader, destDir, name string) error {
+	if err := local.ExtractTarEntry(header, reader, destDir, name); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return fmt.Errorf("the backup archive is corrupt or incomplete: %w", err)
+		}
+		return err
+	}
+	if header.Typeflag == tar.TypeReg {
+		info, err := os.Stat(filepath.Join(destDir, filepath.FromSlash(name)))
+		if err != nil {
+			return err
+		}
+		if info.Size() != header.Size {
+			return fmt.Errorf("the backup archive is incomplete: %s has %d of %d bytes", header.Name, info.Size(), header.Size)
+		}
+	}
+	return nil
+}
+
+// swapInRestored moves the live paths into previousDir and the staged ones into their place.
+// When a rename fails the paths already swapped are moved back, so the data dir is restored fully or not at all.
+func swapInRestored(dataDir, stagedDataDir, previousDir string, restored []string) (err error) {
+	type swap struct{ live, staged, previous string }
+	done := []swap{}
+	defer func() {
+		if err == nil {
+			return
+		}
+		for i := len(done) - 1; i >= 0; i-- {
+			s := done[i]
+			if rbErr := os.Rename(s.live, s.staged); rbErr != nil {
+				log.Warnf("Failed moving back restored %s: %v", s.live, rbErr)
+				continue
+			}
+			if _, statErr := os.Lstat(s.previous); statErr == nil {
+				if rbErr := os.Rename(s.previous, s.live); rbErr != nil {
+					log.Warnf("Failed moving back %s, it was kept at %s: %v", s.live, s.previous, rbErr)
+				}
+			}
+		}
+	}()
+
+	for _, relPath := range restored {
+		s := swap{
+			live:     filepath.Join(dataDir, relPath),
+			staged:   filepath.Join(stagedDataDir, relPath),
+			previous: filepath.Join(previousDir, relPath),
+		}
+		if err := os.MkdirAll(filepath.Dir(s.previous), 0700); err != nil {
+			return err
+		}
+		if _, statErr := os.Lstat(s.live); statErr == nil {
+			if err := os.Rename(s.live, s.previous); err != nil {
+				return fmt.Errorf("failed moving aside %s: %w", s.live, err)
+			}
+		}
+		if err := os.MkdirAll(filepath.Dir(s.live), 0755); err != nil {
+			_ = os.Rename(s.previous, s.live)
+			return err
+		}
+		if err := os.Rename(s.staged, s.live); err != nil {
+			_ = os.Rename(s.previous, s.live)
+			return fmt.Errorf("failed moving restored %s into place: %w", relPath, err)
+		}
+		done = append(done, s)
+	}
+	return nil
+}
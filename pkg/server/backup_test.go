@@ -0,0 +1,146 @@
+package server
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tensorleap/helm-charts/pkg/local"
+	"github.com/tensorleap/helm-charts/pkg/server/manifest"
+)
+
+func writeTestFile(t *testing.T, filePath, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(path.Dir(filePath), 0755))
+	require.NoError(t, os.WriteFile(filePath, []byte(content), 0644))
+}
+
+func TestBackupArchiveRoundTrip(t *testing.T) {
+	dataDir := t.TempDir()
+	t.Setenv(local.DATA_DIR_ENV_NAME, dataDir)
+
+	writeTestFile(t, path.Join(dataDir, local.MONGODB_STORAGE_DIR_NAME, "db", "collection.wt"), "mongo-data")
+	writeTestFile(t, path.Join(dataDir, local.MINIO_STORAGE_DIR_NAME, "bucket", "object"), "minio-data")
+	writeTestFile(t, local.GetInstallationParamsPath(), "domain: example.com\n")
+	writeTestFile(t, local.GetInstallationHostnamePath(), "brave-otter.on-prem")
+
+	meta := &BackupMetadata{FormatVersion: BackupFormatVersion, AppVersion: "1.2.3", Stores: BackupStores}
+	archivePath := path.Join(t.TempDir(), "backup.tar.gz")
+	var archive bytes.Buffer
+	require.NoError(t, writeBackupArchive(&archive, meta))
+	require.NoError(t, os.WriteFile(archivePath, archive.Bytes(), 0644))
+
+	// stores without data are not recorded
+	assert.Equal(t, []CustomTarget{TargetMongo, TargetMinio}, meta.Stores)
+
+	readMeta, err := ReadBackupMetadata(archivePath)
+	require.NoError(t, err)
+	assert.Equal(t, "1.2.3", readMeta.AppVersion)
+	assert.Equal(t, meta.Stores, readMeta.Stores)
+
+	// change the data, then restore only mongodb without the config
+	writeTestFile(t, path.Join(dataDir, local.MONGODB_STORAGE_DIR_NAME, "db", "collection.wt"), "changed")
+	writeTestFile(t, path.Join(dataDir, local.MONGODB_STORAGE_DIR_NAME, "db", "new.wt"), "new")
+	writeTestFile(t, path.Join(dataDir, local.MINIO_STORAGE_DIR_NAME, "bucket", "object"), "changed")
+	writeTestFile(t, local.GetInstallationHostnamePath(), "other-host.on-prem")
+
+	require.NoError(t, extractBackupArchive(archivePath, RestoreOptions{Stores: []CustomTarget{TargetMongo}}))
+
+	content, err := os.ReadFile(path.Join(dataDir, local.MONGODB_STORAGE_DIR_NAME, "db", "collection.wt"))
+	require.NoError(t, err)
+	assert.Equal(t, "mongo-data", string(content))
+	assert.NoFileExists(t, path.Join(dataDir, local.MONGODB_STORAGE_DIR_NAME, "db", "new.wt"))
+
+	content, err = os.ReadFile(path.Join(dataDir, local.MINIO_STORAGE_DIR_NAME, "bucket", "object"))
+	require.NoError(t, err)
+	assert.Equal(t, "changed", string(content))
+
+	content, err = os.ReadFile(local.GetInstallationHostnamePath())
+	require.NoError(t, err)
+	assert.Equal(t, "other-host.on-prem", string(content))
+
+	require.NoError(t, extractBackupArchive(archivePath, RestoreOptions{Stores: []CustomTarget{TargetMinio}, RestoreConfig: true}))
+	content, err = os.ReadFile(local.GetInstallationHostnamePath())
+	require.NoError(t, err)
+	assert.Equal(t, "brave-otter.on-prem", string(content))
+}
+
+func TestRestoreKeepsDataOnBadArchive(t *testing.T) {
+	dataDir := t.TempDir()
+	t.Setenv(local.DATA_DIR_ENV_NAME, dataDir)
+	mongoFile := path.Join(dataDir, local.MONGODB_STORAGE_DIR_NAME, "db", "collection.wt")
+	writeTestFile(t, mongoFile, "mongo-data")
+
+	meta := &BackupMetadata{FormatVersion: BackupFormatVersion, Stores: []CustomTarget{TargetMongo}}
+	var archive bytes.Buffer
+	require.NoError(t, writeBackupArchive(&archive, meta))
+	writeTestFile(t, mongoFile, "live")
+
+	t.Run("truncated", func(t *testing.T) {
+		archivePath := path.Join(t.TempDir(), "backup.tar.gz")
+		require.NoError(t, os.WriteFile(archivePath, archive.Bytes()[:archive.Len()-20], 0644))
+
+		err := extractBackupArchive(archivePath, RestoreOptions{Stores: []CustomTarget{TargetMongo}})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "corrupt or incomplete")
+		content, err := os.ReadFile(mongoFile)
+		require.NoError(t, err)
+		assert.Equal(t, "live", string(content))
+	})
+
+	t.Run("link outside of the data dir", func(t *testing.T) {
+		outsideDir := t.TempDir()
+		var buf bytes.Buffer
+		gzipWriter := gzip.NewWriter(&buf)
+		tarWriter := tar.NewWriter(gzipWriter)
+		metaBytes := []byte("formatVersion: 1\nstores: [mongodb]\n")
+		require.NoError(t, tarWriter.WriteHeader(&tar.Header{Name: backupMetadataFileName, Mode: 0644, Size: int64(len(metaBytes))}))
+		_, err := tarWriter.Write(metaBytes)
+		require.NoError(t, err)
+		require.NoError(t, tarWriter.WriteHeader(&tar.Header{Name: "storage/mongodb/db", Typeflag: tar.TypeSymlink, Linkname: outsideDir}))
+		require.NoError(t, tarWriter.WriteHeader(&tar.Header{Name: "storage/mongodb/db/collection.wt", Mode: 0644, Size: 4}))
+		_, err = tarWriter.Write([]byte("evil"))
+		require.NoError(t, err)
+		require.NoError(t, tarWriter.Close())
+		require.NoError(t, gzipWriter.Close())
+		archivePath := path.Join(t.TempDir(), "backup.tar.gz")
+		require.NoError(t, os.WriteFile(archivePath, buf.Bytes(), 0644))
+
+		err = extractBackupArchive(archivePath, RestoreOptions{Stores: []CustomTarget{TargetMongo}})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "links outside of the archive")
+		assert.NoFileExists(t, path.Join(outsideDir, "collection.wt"))
+		content, err := os.ReadFile(mongoFile)
+		require.NoError(t, err)
+		assert.Equal(t, "live", string(content))
+	})
+}
+
+func TestCheckBackupCompatibility(t *testing.T) {
+	meta := &BackupMetadata{FormatVersion: BackupFormatVersion, AppVersion: "1.2.3", Tag: "v1"}
+
+	assert.NoError(t, CheckBackupCompatibility(meta, nil))
+	assert.NoError(t, CheckBackupCompatibility(meta, &manifest.InstallationManifest{AppVersion: "1.2.3"}))
+	assert.ErrorIs(t, CheckBackupCompatibility(meta, &manifest.InstallationManifest{AppVersion: "1.3.0"}), ErrIncompatibleBackup)
+
+	newer := &BackupMetadata{FormatVersion: BackupFormatVersion + 1}
+	assert.ErrorIs(t, CheckBackupCompatibility(newer, nil), ErrIncompatibleBackup)
+}
+
+func TestParseBackupStores(t *testing.T) {
+	stores, err := ParseBackupStores(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, BackupStores, stores)
+
+	stores, err = ParseBackupStores([]string{"keycloak", "mongodb"})
+	assert.NoError(t, err)
+	assert.Equal(t, []CustomTarget{TargetMongo, TargetKeycloak}, stores)
+
+	_, err = ParseBackupStores([]string{"registry"})
+	assert.Error(t, err)
+}
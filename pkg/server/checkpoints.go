@@ -0,0 +1,148 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path"
+	"time"
+
+	"github.com/tensorleap/helm-charts/pkg/local"
+	"github.com/tensorleap/helm-charts/pkg/log"
+	"github.com/tensorleap/helm-charts/pkg/server/manifest"
+	"gopkg.in/yaml.v3"
+)
+
+type InstallPhase string
+
+// The checkpointed phases of an install, in order. Pruning is the last phase and is not checkpointed,
+// the checkpoints are removed when it is done.
+const (
+	PhaseCluster         InstallPhase = "cluster"
+	PhaseBootstrapImport InstallPhase = "bootstrap-import"
+	PhaseInfraChart      InstallPhase = "infra-chart"
+	PhaseImagePush       InstallPhase = "image-push"
+	PhaseCharts          InstallPhase = "charts"
+)
+
+type InstallCheckpoint struct {
+	Phase InstallPhase `yaml:"phase" json:"phase"`
+	// InputsHash covers the inputs of the phase and of the phases before it,
+	// so changing an input invalidates the phase and every phase after it
+	InputsHash  string    `yaml:"inputsHash" json:"inputsHash"`
+	CompletedAt time.Time `yaml:"completedAt" json:"completedAt"`
+}
+
+// InstallCheckpoints records the phases an unfinished install completed, so a rerun with the same inputs skips them
+type InstallCheckpoints struct {
+	Checkpoints []InstallCheckpoint `yaml:"checkpoints"`
+	path        string
+}
+
+// LoadInstallCheckpoints reads the checkpoints of the data dir, a missing or unreadable file means no checkpoints
+func LoadInstallCheckpoints() *InstallCheckpoints {
+	checkpoints := &InstallCheckpoints{path: local.GetInstallCheckpointsPath()}
+	data, err := os.ReadFile(checkpoints.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("Failed reading install checkpoints, running all phases: %v", err)
+		}
+		return checkpoints
+	}
+	if err := yaml.Unmarshal(data, checkpoints); err != nil {
+		log.Warnf("Failed parsing install checkpoints, running all phases: %v", err)
+		checkpoints.Checkpoints = nil
+	}
+	return checkpoints
+}
+
+// IsDone reports whether the phase was completed with the same inputs
+func (c *InstallCheckpoints) IsDone(phase InstallPhase, inputsHash string) bool {
+	for _, checkpoint := range c.Checkpoints {
+		if checkpoint.Phase == phase {
+			return checkpoint.InputsHash == inputsHash
+		}
+	}
+	return false
+}
+
+// Run runs the phase unless it was completed with the same inputs, and records it when it succeeds
+func (c *InstallCheckpoints) Run(phase InstallPhase, inputsHash string, run func() error) error {
+	if c.IsDone(phase, inputsHash) {
+		log.Infof("Skipping the %s phase, it was completed by a previous install with the same inputs", phase)
+		return nil
+	}
+	if err := run(); err != nil {
+		return err
+	}
+	return c.Record(phase, inputsHash)
+}
+
+// RecordRun records a phase that runs on every install, such as the cluster phase. When it completed before with
+// the same inputs the checkpoints of the later phases are kept, so they are still skipped.
+func (c *InstallCheckpoints) RecordRun(phase InstallPhase, inputsHash string) error {
+	if c.IsDone(phase, inputsHash) {
+		return nil
+	}
+	return c.Record(phase, inputsHash)
+}
+
+// Record marks the phase as completed, dropping the checkpoints of the phases that ran after it with other inputs
+func (c *InstallCheckpoints) Record(phase InstallPhase, inputsHash string) error {
+	checkpoints := []InstallCheckpoint{}
+	for _, checkpoint := range c.Checkpoints {
+		if checkpoint.Phase == phase {
+			break
+		}
+		checkpoints = append(checkpoints, checkpoint)
+	}
+	c.Checkpoints = append(checkpoints, InstallCheckpoint{Phase: phase, InputsHash: inputsHash, CompletedAt: time.Now().UTC()})
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(path.Dir(c.path), 0777); err != nil {
+		return err
+	}
+	return os.WriteFile(c.path, data, 0644)
+}
+
+// Clear removes the checkpoints once the install completed
+func (c *InstallCheckpoints) Clear() error {
+	c.Checkpoints = nil
+	if err := os.Remove(c.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// hashPhaseInputs chains the hash of the previous phase with the json of the inputs of a phase
+func hashPhaseInputs(previous string, inputs ...interface{}) string {
+	hash := sha256.New()
+	hash.Write([]byte(previous))
+	for _, input := range inputs {
+		data, err := json.Marshal(input)
+		if err != nil {
+			// never matches a recorded hash, so the phase runs
+			data = []byte(time.Now().String())
+		}
+		hash.Write(data)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func clusterPhaseInputs(mnf *manifest.InstallationManifest, installationParams *InstallationParams) string {
+	return hashPhaseInputs("", installationParams.GetCreateK3sClusterParams(), GetClusterK3sImage(mnf, installationParams))
+}
+
+// IsResumableInstall reports whether the cluster was created by an unfinished install with the same cluster inputs,
+// such an install is resumed rather than reinstalled
+func IsResumableInstall(mnf *manifest.InstallationManifest, installationParams *InstallationParams) bool {
+	return LoadInstallCheckpoints().IsDone(PhaseCluster, clusterPhaseInputs(mnf, installationParams))
+}
+
+// ClearInstallCheckpoints removes the checkpoints of the data dir, e.g. when the cluster is removed
+func ClearInstallCheckpoints() error {
+	return LoadInstallCheckpoints().Clear()
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tensorleap/helm-charts/pkg/local"
+	"github.com/tensorleap/helm-charts/pkg/server/manifest"
+)
+
+func TestInstallCheckpoints(t *testing.T) {
+	t.Setenv(local.DATA_DIR_ENV_NAME, t.TempDir())
+	runs := map[InstallPhase]int{}
+	runPhases := func(clusterInputs, chartsInputs string) {
+		checkpoints := LoadInstallCheckpoints()
+		hash := hashPhaseInputs("", clusterInputs)
+		require.NoError(t, checkpoints.Run(PhaseCluster, hash, func() error { runs[PhaseCluster]++; return nil }))
+		hash = hashPhaseInputs(hash, chartsInputs)
+		require.NoError(t, checkpoints.Run(PhaseCharts, hash, func() error { runs[PhaseCharts]++; return nil }))
+	}
+
+	runPhases("cluster", "charts")
+	runPhases("cluster", "charts")
+	assert.Equal(t, map[InstallPhase]int{PhaseCluster: 1, PhaseCharts: 1}, runs, "identical inputs skip the completed phases")
+
+	runPhases("cluster", "other charts")
+	assert.Equal(t, map[InstallPhase]int{PhaseCluster: 1, PhaseCharts: 2}, runs, "changed inputs run the phase again")
+
+	runPhases("other cluster", "other charts")
+	assert.Equal(t, map[InstallPhase]int{PhaseCluster: 2, PhaseCharts: 3}, runs, "changed inputs invalidate the later phases")
+
+	require.NoError(t, ClearInstallCheckpoints())
+	runPhases("other cluster", "other charts")
+	assert.Equal(t, map[InstallPhase]int{PhaseCluster: 3, PhaseCharts: 4}, runs)
+}
+
+func TestInstallCheckpointsResume(t *testing.T) {
+	t.Setenv(local.DATA_DIR_ENV_NAME, t.TempDir())
+	runs := map[InstallPhase]int{}
+	// the sequence of Install: the cluster phase always runs, the later phases run through the checkpoints
+	install := func(clusterInputs string) {
+		checkpoints := LoadInstallCheckpoints()
+		hash := hashPhaseInputs("", clusterInputs)
+		require.NoError(t, checkpoints.RecordRun(PhaseCluster, hash))
+		for _, phase := range []InstallPhase{PhaseBootstrapImport, PhaseInfraChart, PhaseImagePush, PhaseCharts} {
+			hash = hashPhaseInputs(hash, phase)
+			require.NoError(t, checkpoints.Run(phase, hash, func() error { runs[phase]++; return nil }))
+		}
+	}
+
+	install("cluster")
+	install("cluster")
+	assert.Equal(t, map[InstallPhase]int{PhaseBootstrapImport: 1, PhaseInfraChart: 1, PhaseImagePush: 1, PhaseCharts: 1}, runs,
+		"a rerun skips the phases after the cluster")
+
+	install("other cluster")
+	assert.Equal(t, map[InstallPhase]int{PhaseBootstrapImport: 2, PhaseInfraChart: 2, PhaseImagePush: 2, PhaseCharts: 2}, runs)
+}
+
+func TestInstallCheckpointsFailedPhase(t *testing.T) {
+	t.Setenv(local.DATA_DIR_ENV_NAME, t.TempDir())
+	checkpoints := LoadInstallCheckpoints()
+	require.NoError(t, checkpoints.Record(PhaseCluster, "a"))
+	require.NoError(t, checkpoints.Record(PhaseCharts, "b"))
+
+	// rerunning an earlier phase drops the checkpoints recorded after it
+	require.NoError(t, checkpoints.Record(PhaseCluster, "a"))
+	assert.False(t, LoadInstallCheckpoints().IsDone(PhaseCharts, "b"))
+
+	err := checkpoints.Run(PhaseCharts, "b", func() error { return errors.New("failed") })
+	assert.Error(t, err)
+	assert.False(t, LoadInstallCheckpoints().IsDone(PhaseCharts, "b"), "a failed phase is not recorded")
+	assert.True(t, LoadInstallCheckpoints().IsDone(PhaseCluster, "a"))
+}
+
+func TestIsResumableInstall(t *testing.T) {
+	t.Setenv(local.DATA_DIR_ENV_NAME, t.TempDir())
+	mnf := &manifest.InstallationManifest{}
+	mnf.Images.K3s = "k3s:v1"
+	params := &InstallationParams{DatasetVolumes: []string{}}
+	assert.False(t, IsResumableInstall(mnf, params))
+
+	require.NoError(t, LoadInstallCheckpoints().Record(PhaseCluster, clusterPhaseInputs(mnf, params)))
+	assert.True(t, IsResumableInstall(mnf, params))
+
+	mnf.Images.K3s = "k3s:v2"
+	assert.False(t, IsResumableInstall(mnf, params), "a different k3s image needs a new cluster")
+}
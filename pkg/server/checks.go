@@ -3,7 +3,6 @@ package server
 import (
 	"context"
 	"fmt"
-	"reflect"
 
 	"github.com/tensorleap/helm-charts/pkg/helm"
 	"github.com/tensorleap/helm-charts/pkg/k3d"
@@ -40,7 +39,13 @@ func IsNeedsToReinstall(ctx context.Context, mnf, previousMnf *manifest.Installa
 		return false, nil
 	}
 
+	// the cluster of an unfinished install with the same cluster inputs is resumed, see InstallCheckpoints
+	resuming := IsResumableInstall(mnf, installationParams)
 	if previousInstallationParams == nil || previousMnf == nil {
+		if resuming {
+			log.Info("Resuming the unfinished install of the existing cluster")
+			return false, nil
+		}
 		return true, nil
 	}
 
@@ -53,71 +58,97 @@ func IsNeedsToReinstall(ctx context.Context, mnf, previousMnf *manifest.Installa
 		return true, nil
 	}
 
-	newK3sImage := ""
-	currentK3sImage := ""
+	helmReason, err := IsHelmRequiredReinstallReason(ctx, mnf, cluster, resuming)
+	if err != nil {
+		return false, err
+	}
+	reasons := GetReinstallReasons(mnf, previousMnf, installationParams, previousInstallationParams)
+	if helmReason != "" {
+		reasons = append(reasons, helmReason)
+	}
+	for _, reason := range reasons {
+		log.Infof("Reinstall required: %s", reason)
+	}
+	return len(reasons) > 0, nil
+}
 
+// GetClusterK3sImage returns the k3s image the cluster runs with
+func GetClusterK3sImage(mnf *manifest.InstallationManifest, installationParams *InstallationParams) string {
 	if installationParams.IsUseGpu() {
-		newK3sImage = mnf.Images.K3sGpu
-	} else {
-		newK3sImage = mnf.Images.K3sGpu
+		return mnf.Images.K3sGpu
 	}
+	return mnf.Images.K3s
+}
 
-	if previousInstallationParams.IsUseGpu() {
-		currentK3sImage = previousMnf.Images.K3sGpu
-	} else {
-		currentK3sImage = previousMnf.Images.K3sGpu
-	}
+// GetReinstallReasons lists the manifest and params changes that cannot be applied to the existing cluster
+func GetReinstallReasons(mnf, previousMnf *manifest.InstallationManifest, installationParams, previousInstallationParams *InstallationParams) []string {
+	reasons := []string{}
 
-	isChartsRequiredReinstall, err := IsHelmRequiredReinstall(ctx, mnf, cluster)
-	if err != nil {
-		return false, err
+	currentK3sImage := GetClusterK3sImage(previousMnf, previousInstallationParams)
+	newK3sImage := GetClusterK3sImage(mnf, installationParams)
+	if currentK3sImage != newK3sImage {
+		reasons = append(reasons, fmt.Sprintf("k3s image changes from %s to %s", currentK3sImage, newK3sImage))
+	}
+	if mnf.AppVersion != previousMnf.AppVersion {
+		reasons = append(reasons, fmt.Sprintf("app version changes from %s to %s", previousMnf.AppVersion, mnf.AppVersion))
 	}
-	IsK3sImageChange := currentK3sImage != newK3sImage
-	isAppVersionChanged := mnf.AppVersion != previousMnf.AppVersion
+
 	newSyncRegistries := k3d.BuildZotSyncRegistries(mnf)
 	prevSyncRegistries := k3d.BuildZotSyncRegistries(previousMnf)
-	isInfraHelmChartParamsChanged := !reflect.DeepEqual(
+	infraChanges := DiffFields(
 		previousInstallationParams.GetInfraHelmValuesParams(prevSyncRegistries, previousMnf.Images.Zot),
 		installationParams.GetInfraHelmValuesParams(newSyncRegistries, mnf.Images.Zot),
 	)
-	isCreateClusterParamsChanged := !reflect.DeepEqual(previousInstallationParams.GetCreateK3sClusterParams(), installationParams.GetCreateK3sClusterParams())
-
-	// Check if installation mode changed (airgap <-> regular)
-	isInstallationModeChanged := previousInstallationParams.IsAirgap != installationParams.IsAirgap
-	if isInstallationModeChanged {
-		log.Infof("Installation mode changed from %s to %s, reinstall required",
-			modeString(previousInstallationParams.IsAirgap), modeString(installationParams.IsAirgap))
+	for _, change := range infraChanges {
+		reasons = append(reasons, fmt.Sprintf("infra helm value %s changes", change.Field))
 	}
-
-	shouldReinstall := isChartsRequiredReinstall || IsK3sImageChange || isAppVersionChanged || isInfraHelmChartParamsChanged || isCreateClusterParamsChanged || isInstallationModeChanged
-	if shouldReinstall {
-		return true, nil
+	clusterChanges := DiffFields(previousInstallationParams.GetCreateK3sClusterParams(), installationParams.GetCreateK3sClusterParams())
+	for _, change := range clusterChanges {
+		reasons = append(reasons, fmt.Sprintf("cluster param %s changes", change.Field))
 	}
 
-	return false, nil
+	// Check if installation mode changed (airgap <-> regular)
+	if previousInstallationParams.IsAirgap != installationParams.IsAirgap {
+		reasons = append(reasons, fmt.Sprintf("installation mode changes from %s to %s",
+			modeString(previousInstallationParams.IsAirgap), modeString(installationParams.IsAirgap)))
+	}
+	return reasons
 }
 
 func IsHelmRequiredReinstall(ctx context.Context, mnf *manifest.InstallationManifest, cluster *k3d.Cluster) (bool, error) {
+	reason, err := IsHelmRequiredReinstallReason(ctx, mnf, cluster, false)
+	return reason != "", err
+}
+
+// IsHelmRequiredReinstallReason explains why the deployed releases cannot be upgraded in place, empty when they can
+func IsHelmRequiredReinstallReason(ctx context.Context, mnf *manifest.InstallationManifest, cluster *k3d.Cluster, resuming bool) (string, error) {
 	kubeConfigPath, clean, err := k3d.CreateTmpClusterKubeConfig(ctx, cluster)
 	if err != nil {
-		return false, err
+		return "", err
 	}
 	defer clean()
 
-	helmConfig, err := helm.CreateHelmConfig(kubeConfigPath, KUBE_CONTEXT, KUBE_NAMESPACE)
+	helmConfig, err := helm.CreateHelmConfig(ctx, kubeConfigPath, KUBE_CONTEXT, KUBE_NAMESPACE)
 	if err != nil {
-		return false, err
+		return "", err
 	}
+	return helmReinstallReason(helmConfig, mnf, resuming)
+}
 
+// helmReinstallReason returns why the releases require a reinstall, when resuming an unfinished install
+// a pending or failed release is not a reason, the install resets it (see helm.ResetUnfinishedRelease)
+func helmReinstallReason(helmConfig *helm.HelmConfig, mnf *manifest.InstallationManifest, resuming bool) (string, error) {
 	// Check if any release is stuck in pending or failed state from previous interrupted installation
 	for _, releaseName := range []string{mnf.InfraHelmChart.ReleaseName, mnf.ServerHelmChart.ReleaseName} {
 		isPendingOrFailed, status, err := helm.IsHelmReleasePendingOrFailed(helmConfig, releaseName)
 		if err != nil {
-			return false, err
+			return "", err
 		}
-		if isPendingOrFailed {
+		if isPendingOrFailed && resuming {
+			log.Infof("Helm release '%s' is in '%s' state from the unfinished installation, it will be reset", releaseName, status)
+		} else if isPendingOrFailed {
 			log.Warnf("Helm release '%s' is in '%s' state from previous failed/interrupted installation. Reinstalling...", releaseName, status)
-			return true, nil
+			return fmt.Sprintf("helm release %s is in %s state", releaseName, status), nil
 		}
 	}
 
@@ -125,32 +156,36 @@ func IsHelmRequiredReinstall(ctx context.Context, mnf *manifest.InstallationMani
 	if err == helm.ErrNoRelease {
 		iServerReleaseExists, err := helm.IsHelmReleaseExists(helmConfig, mnf.ServerHelmChart.ReleaseName)
 		if err != nil {
-			return false, err
+			return "", err
 		}
 		if iServerReleaseExists {
-			return true, nil
+			return fmt.Sprintf("helm release %s exists without release %s", mnf.ServerHelmChart.ReleaseName, mnf.InfraHelmChart.ReleaseName), nil
 		}
-		return false, nil
+		return "", nil
 
 	} else if err != nil {
-		return false, err
+		return "", err
 	}
 	currentServerVersion, err := helm.GetHelmReleaseVersion(helmConfig, mnf.ServerHelmChart.ReleaseName)
 	if err == helm.ErrNoRelease {
-		return false, nil
+		return "", nil
 	} else if err != nil {
-		return false, err
+		return "", err
 	}
 
 	isMinorVersionSmaller := version.IsMinorVersionChange(currentServerVersion, mnf.ServerHelmChart.Version) && version.IsMinorVersionSmaller(currentInfraVersion, mnf.InfraHelmChart.Version)
 	if isMinorVersionSmaller {
-		return false, ErrOldManifest
+		return "", ErrOldManifest
 	}
 
-	isVersionChange := currentInfraVersion != mnf.InfraHelmChart.Version != version.IsMinorVersionChange(currentServerVersion, mnf.ServerHelmChart.Version)
-	if isVersionChange {
-		return true, nil
+	isInfraVersionChange := currentInfraVersion != mnf.InfraHelmChart.Version
+	isServerMinorVersionChange := version.IsMinorVersionChange(currentServerVersion, mnf.ServerHelmChart.Version)
+	if isInfraVersionChange && !isServerMinorVersionChange {
+		return fmt.Sprintf("infra chart version changes from %s to %s", currentInfraVersion, mnf.InfraHelmChart.Version), nil
+	}
+	if isServerMinorVersionChange && !isInfraVersionChange {
+		return fmt.Sprintf("server chart minor version changes from %s to %s", currentServerVersion, mnf.ServerHelmChart.Version), nil
 	}
 
-	return false, nil
+	return "", nil
 }
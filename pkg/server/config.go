@@ -0,0 +1,495 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/tensorleap/helm-charts/pkg/helm"
+	"github.com/tensorleap/helm-charts/pkg/k3d"
+	"github.com/tensorleap/helm-charts/pkg/local"
+	"github.com/tensorleap/helm-charts/pkg/log"
+	"github.com/tensorleap/helm-charts/pkg/server/manifest"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigKey is a single installation param that can be changed with `server config`
+type ConfigKey struct {
+	Name        string
+	Description string
+	// redact hides the value when printed, changes are still detected on the raw value
+	redact bool
+	get    func(params *InstallationParams) string
+	set    func(params *InstallationParams, value string) error
+	unset  func(params *InstallationParams)
+	// restore sets a value saved by get, for keys whose set takes another form of the value
+	restore func(params *InstallationParams, value string)
+}
+
+// setPending sets a value saved in the pending changes
+func (key *ConfigKey) setPending(params *InstallationParams, value string) error {
+	if key.restore != nil {
+		key.restore(params, value)
+		return nil
+	}
+	return key.set(params, value)
+}
+
+func stringConfigKey(name, description string, field func(params *InstallationParams) *string, validate func(string) error) ConfigKey {
+	return ConfigKey{
+		Name:        name,
+		Description: description,
+		get:         func(params *InstallationParams) string { return *field(params) },
+		set: func(params *InstallationParams, value string) error {
+			if validate != nil {
+				if err := validate(value); err != nil {
+					return err
+				}
+			}
+			*field(params) = value
+			return nil
+		},
+		unset: func(params *InstallationParams) { *field(params) = "" },
+	}
+}
+
+func boolConfigKey(name, description string, field func(params *InstallationParams) *bool) ConfigKey {
+	return ConfigKey{
+		Name:        name,
+		Description: description,
+		get:         func(params *InstallationParams) string { return strconv.FormatBool(*field(params)) },
+		set: func(params *InstallationParams, value string) error {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("invalid boolean '%s'", value)
+			}
+			*field(params) = b
+			return nil
+		},
+		unset: func(params *InstallationParams) { *field(params) = false },
+	}
+}
+
+func uintConfigKey(name, description string, field func(params *InstallationParams) *uint, defaultValue uint) ConfigKey {
+	return ConfigKey{
+		Name:        name,
+		Description: description,
+		get:         func(params *InstallationParams) string { return strconv.FormatUint(uint64(*field(params)), 10) },
+		set: func(params *InstallationParams, value string) error {
+			n, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				return fmt.Errorf("invalid number '%s'", value)
+			}
+			*field(params) = uint(n)
+			return nil
+		},
+		unset: func(params *InstallationParams) { *field(params) = defaultValue },
+	}
+}
+
+// pemFileConfigKey is set from a file path, the content is stored in the params and never printed
+func pemFileConfigKey(name, description string, field func(params *InstallationParams) *string) ConfigKey {
+	return ConfigKey{
+		Name:        name,
+		Description: description,
+		redact:      true,
+		get:         func(params *InstallationParams) string { return *field(params) },
+		set: func(params *InstallationParams, value string) error {
+			content, err := os.ReadFile(value)
+			if err != nil {
+				return fmt.Errorf("failed to read %s file: %v", name, err)
+			}
+			*field(params) = string(content)
+			return nil
+		},
+		unset:   func(params *InstallationParams) { *field(params) = "" },
+		restore: func(params *InstallationParams, value string) { *field(params) = value },
+	}
+}
+
+func validateConfigUrl(value string) error {
+	if value == "" {
+		return nil
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("invalid url '%s'", value)
+	}
+	return nil
+}
+
+func validateConfigPort(value uint) error {
+	if value == 0 || value > 65535 {
+		return fmt.Errorf("port number must be between 1 and 65535")
+	}
+	return nil
+}
+
+func validateConfigCPULimit(value string) error {
+	if value == "" {
+		return nil
+	}
+	_, err := k3d.ParseCPULimit(value)
+	return err
+}
+
+var ConfigKeys = []ConfigKey{
+	stringConfigKey("domain", "Domain the server is accessed with", func(p *InstallationParams) *string { return &p.Domain }, nil),
+	stringConfigKey("proxy-url", "Url of the proxy in front of the server", func(p *InstallationParams) *string { return &p.ProxyUrl }, validateConfigUrl),
+	stringConfigKey("pip-index-url", "Pip index url used by the engine", func(p *InstallationParams) *string { return &p.PipIndexUrl }, validateConfigUrl),
+	stringConfigKey("pip-extra-index-url", "Pip extra index url used by the engine", func(p *InstallationParams) *string { return &p.PipExtraIndexUrl }, validateConfigUrl),
+	boolConfigKey("disable-metrics", "Disable sending metrics", func(p *InstallationParams) *bool { return &p.DisableMetrics }),
+	boolConfigKey("disable-auth", "Disable authentication (keycloak)", func(p *InstallationParams) *bool { return &p.DisabledAuth }),
+	boolConfigKey("tls-enabled", "Serve the server over https", func(p *InstallationParams) *bool { return &p.TLSParams.Enabled }),
+	pemFileConfigKey("tls-cert", "Path of the TLS certificate (including the chain)", func(p *InstallationParams) *string { return &p.TLSParams.Cert }),
+	pemFileConfigKey("tls-key", "Path of the TLS private key", func(p *InstallationParams) *string { return &p.TLSParams.Key }),
+	uintConfigKey("tls-port", "Https port", func(p *InstallationParams) *uint { return &p.TLSParams.Port }, DefaultHttpsPort),
+	uintConfigKey("port", "Http port", func(p *InstallationParams) *uint { return &p.Port }, DefaultHttpPort),
+	uintConfigKey("registry-port", "Port of the local registry", func(p *InstallationParams) *uint { return &p.RegistryPort }, DefaultRegistryPort),
+	uintConfigKey("gpus", "Number of gpus to use", func(p *InstallationParams) *uint { return &p.Gpus }, 0),
+	stringConfigKey("gpu-devices", "Gpu devices to use ('all', indexes or UUIDs)", func(p *InstallationParams) *string { return &p.GpuDevices }, nil),
+	{
+		Name:        "dataset-volumes",
+		Description: "Comma separated dataset volumes (<host path>[:<container path>])",
+		get:         func(p *InstallationParams) string { return strings.Join(p.DatasetVolumes, ",") },
+		set: func(p *InstallationParams, value string) error {
+			volumes := []string{}
+			for _, volume := range strings.Split(value, ",") {
+				volume = strings.TrimSpace(volume)
+				if volume == "" {
+					continue
+				}
+				if err := ValidateDatasetVolumeSpec(volume); err != nil {
+					return err
+				}
+				if !strings.Contains(volume, ":") {
+					volume = fmt.Sprintf("%s:%s", volume, volume)
+				}
+				volumes = append(volumes, volume)
+			}
+			p.DatasetVolumes = volumes
+			return nil
+		},
+		unset: func(p *InstallationParams) { p.DatasetVolumes = []string{} },
+	},
+	stringConfigKey("cpu-limit", "Cpu limit of the cluster", func(p *InstallationParams) *string { return &p.CpuLimit }, validateConfigCPULimit),
+	uintConfigKey("cluster-memory-gb", "Memory budget of the server in GiB (0 for auto)", func(p *InstallationParams) *uint { return &p.ClusterMemoryGb }, 0),
+}
+
+func GetConfigKey(name string) (*ConfigKey, error) {
+	for i := range ConfigKeys {
+		if ConfigKeys[i].Name == name {
+			return &ConfigKeys[i], nil
+		}
+	}
+	names := make([]string, len(ConfigKeys))
+	for i, key := range ConfigKeys {
+		names[i] = key.Name
+	}
+	return nil, fmt.Errorf("unknown config key '%s', expected one of: %s", name, strings.Join(names, ", "))
+}
+
+// Get returns the printable value of the key
+func (key *ConfigKey) Get(params *InstallationParams) string {
+	value := key.get(params)
+	if key.redact && value != "" {
+		return fmt.Sprintf("<pem, %d bytes>", len(value))
+	}
+	return value
+}
+
+// LoadConfigParams returns the installed params and the params with the pending changes merged onto them,
+// pending is nil when nothing was set
+func LoadConfigParams() (current, pending *InstallationParams, err error) {
+	current, err = LoadInstallationParamsFromPrevious()
+	if err == ErrNoInstallationParams {
+		return nil, nil, fmt.Errorf("no installation found, run `leap server install` first")
+	} else if err != nil {
+		return nil, nil, err
+	}
+	changes, err := loadPendingChanges()
+	if err != nil || len(changes) == 0 {
+		return current, nil, err
+	}
+	pending, err = mergePendingChanges(changes)
+	if err != nil {
+		return nil, nil, err
+	}
+	return current, pending, nil
+}
+
+// loadPendingChanges reads the values of the keys that were set or unset but not applied yet
+func loadPendingChanges() (map[string]string, error) {
+	b, err := os.ReadFile(local.GetPendingParamsPath())
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	changes := map[string]string{}
+	if err := yaml.Unmarshal(b, &changes); err != nil {
+		return nil, fmt.Errorf("invalid pending config %s: %w", local.GetPendingParamsPath(), err)
+	}
+	return changes, nil
+}
+
+// mergePendingChanges sets the changed keys on a fresh copy of the installed params, so an install or upgrade
+// done after the changes were set is not undone by them
+func mergePendingChanges(changes map[string]string) (*InstallationParams, error) {
+	params, err := LoadInstallationParamsFromPrevious()
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range changes {
+		key, err := GetConfigKey(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pending config %s: %w", local.GetPendingParamsPath(), err)
+		}
+		if err := key.setPending(params, value); err != nil {
+			return nil, fmt.Errorf("invalid pending value of %s: %w", name, err)
+		}
+	}
+	return params, nil
+}
+
+// SetConfigValue stages a change, it takes effect on `server config apply`
+func SetConfigValue(name, value string) error {
+	return updatePendingConfig(name, func(key *ConfigKey, params *InstallationParams) error {
+		return key.set(params, value)
+	})
+}
+
+// UnsetConfigValue stages resetting the key to its default
+func UnsetConfigValue(name string) error {
+	return updatePendingConfig(name, func(key *ConfigKey, params *InstallationParams) error {
+		key.unset(params)
+		return nil
+	})
+}
+
+// updatePendingConfig saves only the value of the changed key, a key set back to its installed value is dropped
+func updatePendingConfig(name string, update func(key *ConfigKey, params *InstallationParams) error) error {
+	key, err := GetConfigKey(name)
+	if err != nil {
+		return err
+	}
+	current, pending, err := LoadConfigParams()
+	if err != nil {
+		return err
+	}
+	if pending == nil {
+		pending, err = mergePendingChanges(nil)
+		if err != nil {
+			return err
+		}
+	}
+	if err := update(key, pending); err != nil {
+		return err
+	}
+	changes, err := loadPendingChanges()
+	if err != nil {
+		return err
+	}
+	if value := key.get(pending); value != key.get(current) {
+		changes[key.Name] = value
+	} else {
+		delete(changes, key.Name)
+	}
+	if len(changes) == 0 {
+		return DiscardPendingConfig()
+	}
+	b, err := yaml.Marshal(changes)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(local.GetPendingParamsPath(), b, 0777)
+}
+
+// DiscardPendingConfig drops all the changes that were not applied yet
+func DiscardPendingConfig() error {
+	err := os.Remove(local.GetPendingParamsPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+type ConfigChange struct {
+	Key  string `json:"key"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+func DiffConfig(current, pending *InstallationParams) []ConfigChange {
+	changes := []ConfigChange{}
+	for _, key := range ConfigKeys {
+		if key.get(current) != key.get(pending) {
+			changes = append(changes, ConfigChange{Key: key.Name, From: key.Get(current), To: key.Get(pending)})
+		}
+	}
+	return changes
+}
+
+type ConfigApplyAction string
+
+const (
+	ConfigApplyNone        ConfigApplyAction = "none"
+	ConfigApplyHelmUpgrade ConfigApplyAction = "helm-upgrade"
+	ConfigApplyReinstall   ConfigApplyAction = "reinstall"
+)
+
+type ConfigApplyPlan struct {
+	Changes       []ConfigChange    `json:"changes"`
+	Action        ConfigApplyAction `json:"action"`
+	upgradeInfra  bool
+	mnf           *manifest.InstallationManifest
+	currentParams *InstallationParams
+	params        *InstallationParams
+}
+
+// PlanConfigApply computes the minimal action needed to apply the pending changes:
+// changes of the cluster params recreate the cluster, anything else is a helm upgrade
+func PlanConfigApply() (*ConfigApplyPlan, error) {
+	current, pending, err := LoadConfigParams()
+	if err != nil {
+		return nil, err
+	}
+	mnf, err := manifest.Load(local.GetInstallationManifestPath())
+	if err != nil {
+		return nil, err
+	}
+	plan := &ConfigApplyPlan{Action: ConfigApplyNone, mnf: mnf, currentParams: current, params: pending}
+	if pending == nil {
+		plan.Changes = []ConfigChange{}
+		return plan, nil
+	}
+	if err := validateConfigParams(pending); err != nil {
+		return nil, err
+	}
+	plan.Changes = DiffConfig(current, pending)
+	plan.Action, plan.upgradeInfra = configApplyAction(mnf, current, pending)
+	return plan, nil
+}
+
+func validateConfigParams(params *InstallationParams) error {
+	if params.TLSParams.Enabled {
+		if params.TLSParams.Cert == "" || params.TLSParams.Key == "" {
+			return fmt.Errorf("tls-enabled requires tls-cert and tls-key to be set")
+		}
+		if err := validateConfigPort(params.TLSParams.Port); err != nil {
+			return fmt.Errorf("tls-port: %w", err)
+		}
+	}
+	if err := validateConfigPort(params.Port); err != nil {
+		return fmt.Errorf("port: %w", err)
+	}
+	if err := validateConfigPort(params.RegistryPort); err != nil {
+		return fmt.Errorf("registry-port: %w", err)
+	}
+	warnIfPlaintextOnRealDomain(params.Domain, params.TLSParams.Enabled)
+	return nil
+}
+
+func configApplyAction(mnf *manifest.InstallationManifest, current, pending *InstallationParams) (action ConfigApplyAction, upgradeInfra bool) {
+	if len(DiffConfig(current, pending)) == 0 {
+		return ConfigApplyNone, false
+	}
+	if !reflect.DeepEqual(current.GetCreateK3sClusterParams(), pending.GetCreateK3sClusterParams()) {
+		return ConfigApplyReinstall, false
+	}
+	syncRegistries := k3d.BuildZotSyncRegistries(mnf)
+	upgradeInfra = !reflect.DeepEqual(
+		current.GetInfraHelmValuesParams(syncRegistries, mnf.Images.Zot),
+		pending.GetInfraHelmValuesParams(syncRegistries, mnf.Images.Zot),
+	)
+	return ConfigApplyHelmUpgrade, upgradeInfra
+}
+
+// ApplyConfig applies the pending changes and saves them as the installation params.
+// airgapPackPath is only needed to reinstall an airgap installation.
+func ApplyConfig(ctx context.Context, plan *ConfigApplyPlan, airgapPackPath string) (*InstallationResult, error) {
+	if plan.Action == ConfigApplyNone {
+		if plan.params != nil {
+			return plan.params.GetInstallationResult(), DiscardPendingConfig()
+		}
+		return plan.currentParams.GetInstallationResult(), nil
+	}
+	log.SendCloudReport("info", "Applying config changes", "Starting", &map[string]interface{}{"changes": plan.Changes, "action": plan.Action})
+
+	var err error
+	switch plan.Action {
+	case ConfigApplyHelmUpgrade:
+		err = upgradeChartsInPlace(ctx, plan.mnf, plan.params, plan.upgradeInfra)
+		if err == nil {
+			err = SaveInstallation(plan.mnf, plan.params)
+		}
+	case ConfigApplyReinstall:
+		mnf, infraChart, serverChart, loadErr := loadInstallationCharts(ctx, plan.mnf, plan.params.IsAirgap, airgapPackPath)
+		if loadErr != nil {
+			return nil, loadErr
+		}
+		plan.params.AirgapPack = airgapPackPath
+		_, err = Reinstall(ctx, mnf, plan.params.IsAirgap, plan.params, infraChart, serverChart)
+	}
+	if err != nil {
+		log.SendCloudReport("error", "Failed applying config changes", "Failed", &map[string]interface{}{"error": err.Error()})
+		return nil, err
+	}
+
+	if err := DiscardPendingConfig(); err != nil {
+		return nil, err
+	}
+	log.SendCloudReport("info", "Successfully applied config changes", "Success", nil)
+	return plan.params.GetInstallationResult(), nil
+}
+
+// upgradeChartsInPlace runs helm upgrade with the new params, using the charts the releases are deployed with
+func upgradeChartsInPlace(ctx context.Context, mnf *manifest.InstallationManifest, params *InstallationParams, upgradeInfra bool) error {
+	cluster, err := k3d.GetCluster(ctx)
+	if err != nil {
+		return err
+	}
+	if cluster == nil {
+		return fmt.Errorf("cluster not found, run `leap server install` first")
+	}
+	if err := k3d.RunCluster(ctx); err != nil {
+		return err
+	}
+	kubeConfigPath, clean, err := k3d.CreateTmpClusterKubeConfig(ctx, cluster)
+	if err != nil {
+		return err
+	}
+	defer clean()
+
+	helmConfig, err := helm.CreateHelmConfig(ctx, kubeConfigPath, KUBE_CONTEXT, KUBE_NAMESPACE)
+	if err != nil {
+		return err
+	}
+	infraChart, err := helm.GetReleaseChart(helmConfig, mnf.InfraHelmChart.ReleaseName)
+	if err != nil {
+		return fmt.Errorf("failed getting the deployed %s chart: %w", mnf.InfraHelmChart.ReleaseName, err)
+	}
+	serverChart, err := helm.GetReleaseChart(helmConfig, mnf.ServerHelmChart.ReleaseName)
+	if err != nil {
+		return fmt.Errorf("failed getting the deployed %s chart: %w", mnf.ServerHelmChart.ReleaseName, err)
+	}
+
+	if upgradeInfra {
+		var syncRegistries []helm.ZotSyncRegistry
+		if params.IsAirgap {
+			syncRegistries = k3d.BuildZotSyncRegistries(mnf)
+		}
+		infraValues := helm.CreateInfraChartValues(params.GetInfraHelmValuesParams(syncRegistries, mnf.Images.Zot))
+		if err := helm.UpgradeChart(helmConfig, mnf.InfraHelmChart.ReleaseName, infraChart, infraValues); err != nil {
+			if ctx.Err() != nil {
+				rollbackInterruptedRelease(helmConfig, mnf.InfraHelmChart.ReleaseName)
+			}
+			return err
+		}
+	}
+	return InstallCharts(ctx, mnf, params, infraChart, serverChart)
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tensorleap/helm-charts/pkg/local"
+	"github.com/tensorleap/helm-charts/pkg/server/manifest"
+)
+
+func testConfigParams() *InstallationParams {
+	return &InstallationParams{
+		Port:           DefaultHttpPort,
+		RegistryPort:   DefaultRegistryPort,
+		Domain:         "localhost",
+		DatasetVolumes: []string{"/data:/data"},
+	}
+}
+
+func TestPendingConfig(t *testing.T) {
+	t.Setenv(local.DATA_DIR_ENV_NAME, t.TempDir())
+	require.NoError(t, os.MkdirAll(path.Dir(local.GetInstallationParamsPath()), 0755))
+	require.NoError(t, testConfigParams().Save())
+
+	require.NoError(t, SetConfigValue("domain", "tl.example.com"))
+	require.NoError(t, SetConfigValue("dataset-volumes", "/data, /mnt/a:/a"))
+	require.NoError(t, UnsetConfigValue("port"))
+	assert.Error(t, SetConfigValue("proxy-url", "not a url"))
+	assert.Error(t, SetConfigValue("cpu-limit", "two"))
+	assert.Error(t, SetConfigValue("dataset-volumes", "/data,relative/path"))
+	assert.Error(t, SetConfigValue("no-such-key", "value"))
+
+	current, pending, err := LoadConfigParams()
+	require.NoError(t, err)
+	require.NotNil(t, pending)
+	assert.Equal(t, "localhost", current.Domain)
+	assert.Equal(t, []ConfigChange{
+		{Key: "domain", From: "localhost", To: "tl.example.com"},
+		{Key: "dataset-volumes", From: "/data:/data", To: "/data:/data,/mnt/a:/a"},
+	}, DiffConfig(current, pending))
+
+	// only the changed keys are pending, an upgrade done meanwhile is kept
+	installed := testConfigParams()
+	installed.Gpus = 2
+	require.NoError(t, installed.Save())
+	_, pending, err = LoadConfigParams()
+	require.NoError(t, err)
+	assert.Equal(t, uint(2), pending.Gpus)
+	assert.Equal(t, "tl.example.com", pending.Domain)
+
+	// a key set back to its installed value is no longer pending
+	require.NoError(t, SetConfigValue("domain", "localhost"))
+	require.NoError(t, SetConfigValue("dataset-volumes", "/data"))
+	_, pending, err = LoadConfigParams()
+	require.NoError(t, err)
+	assert.Nil(t, pending)
+
+	require.NoError(t, SetConfigValue("domain", "tl.example.com"))
+	require.NoError(t, DiscardPendingConfig())
+	_, pending, err = LoadConfigParams()
+	require.NoError(t, err)
+	assert.Nil(t, pending)
+}
+
+func TestConfigApplyAction(t *testing.T) {
+	mnf := &manifest.InstallationManifest{}
+	tests := []struct {
+		name         string
+		change       func(params *InstallationParams)
+		action       ConfigApplyAction
+		upgradeInfra bool
+	}{
+		{"no change", func(p *InstallationParams) {}, ConfigApplyNone, false},
+		{"domain", func(p *InstallationParams) { p.Domain = "tl.example.com" }, ConfigApplyHelmUpgrade, false},
+		{"pip index", func(p *InstallationParams) { p.PipIndexUrl = "https://pypi.example.com/simple" }, ConfigApplyHelmUpgrade, false},
+		{"auth", func(p *InstallationParams) { p.DisabledAuth = true }, ConfigApplyHelmUpgrade, false},
+		{"port", func(p *InstallationParams) { p.Port = 8080 }, ConfigApplyReinstall, false},
+		{"volumes", func(p *InstallationParams) { p.DatasetVolumes = nil }, ConfigApplyReinstall, false},
+		{"gpu", func(p *InstallationParams) { p.Gpus = 1 }, ConfigApplyReinstall, false},
+		{"tls", func(p *InstallationParams) { p.TLSParams = TLSParams{Enabled: true, Port: 443} }, ConfigApplyReinstall, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pending := testConfigParams()
+			tt.change(pending)
+			action, upgradeInfra := configApplyAction(mnf, testConfigParams(), pending)
+			assert.Equal(t, tt.action, action)
+			assert.Equal(t, tt.upgradeInfra, upgradeInfra)
+		})
+	}
+}
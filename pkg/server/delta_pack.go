@@ -0,0 +1,74 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/tensorleap/helm-charts/pkg/docker"
+	"github.com/tensorleap/helm-charts/pkg/k3d"
+	"github.com/tensorleap/helm-charts/pkg/log"
+	"github.com/tensorleap/helm-charts/pkg/server/airgap"
+)
+
+var ErrDeltaPackBaseMissing = errors.New("the installation this delta pack is based on is missing")
+
+// checkDeltaPackBase fails when the pack is a delta pack and an image it omits is neither in docker
+// nor in the registry of the previous installation. The pack is left at its start.
+func checkDeltaPackBase(ctx context.Context, file airgap.PackFile) error {
+	delta, err := airgap.LoadDeltaInfo(file)
+	if _, seekErr := file.Seek(0, io.SeekStart); seekErr != nil {
+		return seekErr
+	}
+	if err != nil || delta == nil {
+		return err
+	}
+	log.Infof("Delta pack over tag %s, checking the %d images it omits are present locally", delta.BaseTag, len(delta.OmittedImages))
+
+	missing, err := findMissingLocalImages(ctx, delta.OmittedImages)
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %d images omitted by the delta pack are neither in docker nor in the registry: %s. Install tag %s first or use a full pack",
+			ErrDeltaPackBaseMissing, len(missing), strings.Join(missing, ", "), delta.BaseTag)
+	}
+	return nil
+}
+
+// findMissingLocalImages returns the images that are neither in docker nor in the registry of the previous installation
+func findMissingLocalImages(ctx context.Context, images []string) ([]string, error) {
+	dockerClient, err := docker.NewClient()
+	if err != nil {
+		return nil, err
+	}
+	_, notInDocker, err := docker.GetExistedAndNotExistedImages(dockerClient, images)
+	if err != nil {
+		return nil, err
+	}
+	if len(notInDocker) == 0 {
+		return nil, nil
+	}
+
+	params, err := LoadInstallationParamsFromPrevious()
+	if err != nil {
+		// without a previous installation there is no registry to check
+		return notInDocker, nil
+	}
+	regPort := strconv.FormatUint(uint64(params.RegistryPort), 10)
+	missing := []string{}
+	for _, image := range notInDocker {
+		inRegistry, err := k3d.IsImageInRegistry(ctx, image, regPort)
+		if err != nil {
+			// an unreachable registry says nothing about the images, reporting them as missing would be wrong
+			return nil, fmt.Errorf("failed checking image %s in the registry on port %s, make sure the cluster is running (leap server run): %w", image, regPort, err)
+		}
+		if !inRegistry {
+			missing = append(missing, image)
+		}
+	}
+	return missing, nil
+}
@@ -0,0 +1,290 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/tensorleap/helm-charts/pkg/docker"
+	"github.com/tensorleap/helm-charts/pkg/helm"
+	"github.com/tensorleap/helm-charts/pkg/k3d"
+	"github.com/tensorleap/helm-charts/pkg/k8s"
+	"github.com/tensorleap/helm-charts/pkg/local"
+	"github.com/tensorleap/helm-charts/pkg/server/manifest"
+	"k8s.io/client-go/kubernetes"
+)
+
+type CheckStatus string
+
+const (
+	CheckPass CheckStatus = "pass"
+	CheckWarn CheckStatus = "warn"
+	CheckFail CheckStatus = "fail"
+)
+
+var ErrDoctorChecksFailed = errors.New("some checks failed")
+
+type CheckResult struct {
+	Name        string      `json:"name"`
+	Status      CheckStatus `json:"status"`
+	Message     string      `json:"message"`
+	Remediation string      `json:"remediation,omitempty"`
+}
+
+type DoctorReport struct {
+	Checks []CheckResult `json:"checks"`
+}
+
+func (r *DoctorReport) add(name string, status CheckStatus, message, remediation string) {
+	r.Checks = append(r.Checks, CheckResult{Name: name, Status: status, Message: message, Remediation: remediation})
+}
+
+func (r *DoctorReport) HasFailures() bool {
+	for _, check := range r.Checks {
+		if check.Status == CheckFail {
+			return true
+		}
+	}
+	return false
+}
+
+// doctorEnv holds what the checks learned so far, later checks are skipped when their prerequisites failed
+type doctorEnv struct {
+	mnf            *manifest.InstallationManifest
+	cluster        *k3d.Cluster
+	kubeConfigPath string
+	clientset      kubernetes.Interface
+}
+
+// RunDoctor runs the installation health checks, it never prompts and never changes the installation
+func RunDoctor(ctx context.Context) *DoctorReport {
+	report := &DoctorReport{}
+	env := &doctorEnv{}
+
+	env.mnf, _ = manifest.Load(local.GetInstallationManifestPath())
+
+	if !checkDocker(ctx, report, env) {
+		return report
+	}
+	clean := checkCluster(ctx, report, env)
+	if clean == nil {
+		return report
+	}
+	defer clean()
+
+	checkHelmReleases(ctx, report, env)
+	checkRegistry(ctx, report, env)
+	checkDiskPressure(ctx, report, env)
+	checkPods(ctx, report, env)
+	return report
+}
+
+func checkDocker(ctx context.Context, report *DoctorReport, env *doctorEnv) bool {
+	if err := k3d.CheckDockerRunning(); err != nil {
+		remediation := "Start the docker daemon (e.g. 'sudo systemctl start docker' or open Docker Desktop)"
+		if err == k3d.ErrDockerNotInstalled {
+			remediation = "Install docker: https://docs.docker.com/engine/install/"
+		}
+		report.add("docker", CheckFail, err.Error(), remediation)
+		return false
+	}
+
+	dockerClient, err := docker.NewClient()
+	if err != nil {
+		report.add("docker", CheckFail, fmt.Sprintf("failed to create docker client: %s", err), "Make sure the current user can access the docker daemon")
+		return false
+	}
+	dockerInfo, err := dockerClient.Info(ctx)
+	if err != nil {
+		report.add("docker", CheckFail, fmt.Sprintf("failed getting docker info: %s", err), "Make sure the current user can access the docker daemon")
+		return false
+	}
+	report.add("docker", CheckPass, fmt.Sprintf("docker %s is running (data root: %s)", dockerInfo.ServerVersion, dockerInfo.DockerRootDir), "")
+
+	memoryPretty := fmt.Sprintf("%dGb", dockerInfo.MemTotal/(1024*1024*1024))
+	if dockerInfo.MemTotal < k3d.REQUIRED_MEMORY {
+		report.add("docker-memory", CheckWarn, fmt.Sprintf("docker has %s memory available", memoryPretty),
+			fmt.Sprintf("Increase docker memory limit to at least %s", k3d.REQUIRED_MEMORY_PRETTY))
+	} else {
+		report.add("docker-memory", CheckPass, fmt.Sprintf("docker has %s memory available", memoryPretty), "")
+	}
+
+	checkDockerStorage(report, env, dockerClient)
+	return true
+}
+
+func checkDockerStorage(report *DoctorReport, env *doctorEnv, dockerClient docker.Client) {
+	// Avoid pulling anything, the check has to work offline as well
+	if env.mnf == nil || env.mnf.Images.CheckDockerRequirement == "" {
+		report.add("docker-storage", CheckWarn, "cannot check docker storage without an installation manifest", "Run 'leap server install'")
+		return
+	}
+	image := env.mnf.Images.CheckDockerRequirement
+	found, _, err := docker.GetExistedAndNotExistedImages(dockerClient, []string{image})
+	if err != nil || len(found) == 0 {
+		report.add("docker-storage", CheckWarn, fmt.Sprintf("cannot check docker storage, image %s is not available locally", image), fmt.Sprintf("Run 'docker pull %s' and check again", image))
+		return
+	}
+	totalKB, freeKB, err := k3d.GetDockerStorageKB(image)
+	if err != nil {
+		report.add("docker-storage", CheckWarn, fmt.Sprintf("failed checking docker storage: %s", err), "")
+		return
+	}
+	message := fmt.Sprintf("docker has %dGb free storage available (%dGb total)", freeKB/(1024*1024), totalKB/(1024*1024))
+	if freeKB < k3d.REQUIRED_STORAGE_KB {
+		report.add("docker-storage", CheckWarn, message,
+			fmt.Sprintf("Free up disk space (e.g. 'docker system prune') or increase docker storage, tensorleap requires at least %s free storage", k3d.REQUIRED_STORAGE_PRETTY))
+		return
+	}
+	report.add("docker-storage", CheckPass, message, "")
+}
+
+// checkCluster returns a cleanup func once a kubeconfig for the running cluster is available, nil otherwise
+func checkCluster(ctx context.Context, report *DoctorReport, env *doctorEnv) func() {
+	cluster, err := k3d.GetCluster(ctx)
+	if err != nil {
+		report.add("cluster", CheckFail, fmt.Sprintf("failed to get cluster: %s", err), "Make sure docker is running and accessible")
+		return nil
+	}
+	if cluster == nil {
+		report.add("cluster", CheckFail, "tensorleap cluster not found", "Run 'leap server install'")
+		return nil
+	}
+	env.cluster = cluster
+
+	running, total := cluster.ServerCountRunning()
+	if running == 0 {
+		report.add("cluster", CheckFail, "tensorleap cluster is stopped", "Run 'leap server run'")
+		return nil
+	}
+	if running < total {
+		report.add("cluster", CheckWarn, fmt.Sprintf("%d/%d cluster servers are running", running, total), "Run 'leap server run'")
+	} else {
+		report.add("cluster", CheckPass, "tensorleap cluster is running", "")
+	}
+
+	kubeConfigPath, clean, err := k3d.CreateTmpClusterKubeConfig(ctx, cluster)
+	if err != nil {
+		report.add("kubeconfig", CheckFail, fmt.Sprintf("failed to get cluster kubeconfig: %s", err), "Run 'leap server stop' and then 'leap server run'")
+		return nil
+	}
+	env.kubeConfigPath = kubeConfigPath
+
+	clientset, err := k8s.NewClientset(kubeConfigPath, KUBE_CONTEXT)
+	if err != nil {
+		report.add("kubeconfig", CheckFail, err.Error(), "Run 'leap server stop' and then 'leap server run'")
+		clean()
+		return nil
+	}
+	env.clientset = clientset
+	return clean
+}
+
+func checkHelmReleases(ctx context.Context, report *DoctorReport, env *doctorEnv) {
+	if env.mnf == nil {
+		report.add("helm", CheckFail, "installation manifest not found", "Run 'leap server install'")
+		return
+	}
+	helmConfig, err := helm.CreateHelmConfig(ctx, env.kubeConfigPath, KUBE_CONTEXT, KUBE_NAMESPACE)
+	if err != nil {
+		report.add("helm", CheckFail, fmt.Sprintf("failed creating helm config: %s", err), "")
+		return
+	}
+
+	for _, chartMeta := range []manifest.HelmChartMeta{env.mnf.InfraHelmChart, env.mnf.ServerHelmChart} {
+		name := fmt.Sprintf("helm:%s", chartMeta.ReleaseName)
+		version, err := helm.GetHelmReleaseVersion(helmConfig, chartMeta.ReleaseName)
+		if err == helm.ErrNoRelease {
+			report.add(name, CheckFail, "release not found", "Run 'leap server install'")
+			continue
+		} else if err != nil {
+			report.add(name, CheckFail, err.Error(), "")
+			continue
+		}
+
+		isPendingOrFailed, status, err := helm.IsHelmReleasePendingOrFailed(helmConfig, chartMeta.ReleaseName)
+		if err != nil {
+			report.add(name, CheckFail, err.Error(), "")
+			continue
+		}
+		if isPendingOrFailed {
+			report.add(name, CheckFail, fmt.Sprintf("release is in '%s' state", status), "Run 'leap server install' to recover the release, or 'leap server reinstall' if it keeps failing")
+			continue
+		}
+		if version != chartMeta.Version {
+			report.add(name, CheckWarn, fmt.Sprintf("release version %s does not match the installed manifest version %s", version, chartMeta.Version), "Run 'leap server install'")
+			continue
+		}
+		report.add(name, CheckPass, fmt.Sprintf("release %s is %s", version, status), "")
+	}
+}
+
+func checkRegistry(ctx context.Context, report *DoctorReport, env *doctorEnv) {
+	registryPort := GetSavedRegistryPort()
+	ready, _ := k3d.IsRegistryReady(ctx, fmt.Sprint(registryPort))
+	if !ready {
+		report.add("registry", CheckFail, fmt.Sprintf("zot registry is not reachable on port %d", registryPort),
+			fmt.Sprintf("Check the registry pod with 'leap server tools kubectl get pods -n %s', run 'leap server reinstall' if it does not recover", KUBE_NAMESPACE))
+		return
+	}
+	report.add("registry", CheckPass, fmt.Sprintf("zot registry is reachable on port %d", registryPort), "")
+}
+
+func checkDiskPressure(ctx context.Context, report *DoctorReport, env *doctorEnv) {
+	pressure, err := k3d.HasDiskPressure(ctx, env.clientset)
+	if err != nil {
+		report.add("disk-pressure", CheckWarn, fmt.Sprintf("failed checking node conditions: %s", err), "")
+		return
+	}
+	if pressure {
+		report.add("disk-pressure", CheckFail, "cluster node reports DiskPressure, pods may be evicted and images garbage collected",
+			"Free up disk space available to docker (e.g. 'docker system prune') or increase docker storage")
+		return
+	}
+	report.add("disk-pressure", CheckPass, "no disk pressure", "")
+}
+
+func checkPods(ctx context.Context, report *DoctorReport, env *doctorEnv) {
+	pods, issues, err := k8s.ListPodIssues(ctx, env.clientset, KUBE_NAMESPACE)
+	if err != nil {
+		report.add("pods", CheckFail, err.Error(), "")
+		return
+	}
+	if len(pods) == 0 {
+		report.add("pods", CheckFail, fmt.Sprintf("no pods found in namespace %s", KUBE_NAMESPACE), "Run 'leap server install'")
+		return
+	}
+	if len(issues) == 0 {
+		notReady := 0
+		for i := range pods {
+			if !k8s.IsPodReady(&pods[i]) {
+				notReady++
+			}
+		}
+		if notReady > 0 {
+			report.add("pods", CheckWarn, fmt.Sprintf("%d/%d pods are not ready yet", notReady, len(pods)), "Wait a few minutes and check again")
+			return
+		}
+		report.add("pods", CheckPass, fmt.Sprintf("all %d pods are healthy", len(pods)), "")
+		return
+	}
+	for _, issue := range issues {
+		report.add(fmt.Sprintf("pod:%s", issue.Pod), CheckFail, issue.String(), podIssueRemediation(issue))
+	}
+}
+
+func podIssueRemediation(issue k8s.PodIssue) string {
+	switch issue.Reason {
+	case k8s.ReasonImagePull:
+		return "Check network and proxy settings, for airgap installations make sure the pack includes the image"
+	case k8s.ReasonCrashLoop, k8s.ReasonFailed, k8s.ReasonConfigError:
+		return fmt.Sprintf("Inspect the logs with 'leap server tools kubectl logs -n %s %s --previous'", KUBE_NAMESPACE, issue.Pod)
+	case k8s.ReasonOOMKilled:
+		return fmt.Sprintf("Increase docker memory limit (at least %s is required)", k3d.REQUIRED_MEMORY_PRETTY)
+	case k8s.ReasonUnschedulable:
+		return "Increase the CPU and memory available to docker"
+	case k8s.ReasonPVCBinding:
+		return fmt.Sprintf("Check the volume claim with 'leap server tools kubectl describe -n %s %s' and the disk space of the data directory", KUBE_NAMESPACE, issue.Pod)
+	}
+	return fmt.Sprintf("Inspect the pod with 'leap server tools kubectl describe pod -n %s %s'", KUBE_NAMESPACE, issue.Pod)
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"context"
+	"errors"
+
+	"github.com/tensorleap/helm-charts/pkg/k3d"
+)
+
+var (
+	ErrInvalidInstallFlags  = errors.New("invalid install flags")
+	ErrInvalidInstallConfig = errors.New("invalid install config")
+	ErrNotInstalled         = errors.New("tensorleap is not installed")
+	ErrReinstallAborted     = errors.New("reinstall aborted")
+	ErrInterrupted          = errors.New("interrupted")
+)
+
+type ErrorCategory string
+
+const (
+	ErrorCategoryInvalidInput    ErrorCategory = "invalid-input"
+	ErrorCategoryVersionMismatch ErrorCategory = "version-mismatch"
+	ErrorCategoryDocker          ErrorCategory = "docker"
+	ErrorCategoryNotInstalled    ErrorCategory = "not-installed"
+	ErrorCategoryAborted         ErrorCategory = "aborted"
+	ErrorCategoryCanceled        ErrorCategory = "canceled"
+	ErrorCategoryPodsFailing     ErrorCategory = "pods-failing"
+	ErrorCategoryInternal        ErrorCategory = "internal"
+)
+
+// CommandError is the machine-readable form of a failed command
+type CommandError struct {
+	Category ErrorCategory `json:"category"`
+	Message  string        `json:"message"`
+}
+
+func NewCommandError(err error) *CommandError {
+	return &CommandError{Category: GetErrorCategory(err), Message: err.Error()}
+}
+
+// GetErrorCategory classifies an error so wrapper CLIs can react without parsing the message
+func GetErrorCategory(err error) ErrorCategory {
+	switch {
+	case errors.Is(err, ErrInvalidInstallFlags), errors.Is(err, ErrInvalidInstallConfig), errors.Is(err, ErrPackVerificationFailed),
+		errors.Is(err, ErrDeltaPackBaseMissing):
+		return ErrorCategoryInvalidInput
+	case errors.Is(err, ErrCliUpgradeRequired), errors.Is(err, ErrOldManifest):
+		return ErrorCategoryVersionMismatch
+	case errors.Is(err, k3d.ErrDockerNotInstalled), errors.Is(err, k3d.ErrDockerNotRunning):
+		return ErrorCategoryDocker
+	case errors.Is(err, ErrNotInstalled), errors.Is(err, ErrNoInstallationParams):
+		return ErrorCategoryNotInstalled
+	case errors.Is(err, ErrReinstallAborted):
+		return ErrorCategoryAborted
+	case errors.Is(err, k3d.ErrUnrecoverablePods):
+		return ErrorCategoryPodsFailing
+	case errors.Is(err, context.Canceled), errors.Is(err, ErrInterrupted):
+		return ErrorCategoryCanceled
+	}
+	return ErrorCategoryInternal
+}
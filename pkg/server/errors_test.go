@@ -0,0 +1,26 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tensorleap/helm-charts/pkg/k3d"
+)
+
+func TestGetErrorCategory(t *testing.T) {
+	assert.Equal(t, ErrorCategoryInvalidInput, GetErrorCategory(ValidateInstallFlags(&InstallFlags{}, &InstallationSourceFlags{})))
+	assert.Equal(t, ErrorCategoryVersionMismatch, GetErrorCategory(ErrCliUpgradeRequired))
+	assert.Equal(t, ErrorCategoryDocker, GetErrorCategory(fmt.Errorf("checking docker: %w", k3d.ErrDockerNotRunning)))
+	assert.Equal(t, ErrorCategoryNotInstalled, GetErrorCategory(ErrNoInstallationParams))
+	assert.Equal(t, ErrorCategoryAborted, GetErrorCategory(ErrReinstallAborted))
+	assert.Equal(t, ErrorCategoryCanceled, GetErrorCategory(context.Canceled))
+	assert.Equal(t, ErrorCategoryCanceled, GetErrorCategory(fmt.Errorf("installing: %w", ErrInterrupted)))
+	assert.Equal(t, ErrorCategoryPodsFailing, GetErrorCategory(fmt.Errorf("installing: %w", &k3d.WatchdogError{})))
+	assert.Equal(t, ErrorCategoryInternal, GetErrorCategory(errors.New("boom")))
+
+	commandErr := NewCommandError(ErrReinstallAborted)
+	assert.Equal(t, &CommandError{Category: ErrorCategoryAborted, Message: "reinstall aborted"}, commandErr)
+}
@@ -4,8 +4,10 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/tensorleap/helm-charts/pkg/k3d"
 	"github.com/tensorleap/helm-charts/pkg/log"
 )
 
@@ -18,7 +20,7 @@ type InstallationSourceFlags struct {
 
 func (flags *InstallationSourceFlags) SetFlags(cmd *cobra.Command) {
 	cmd.Flags().StringVarP(&flags.Tag, "tag", "t", "", "Tag to be used for tensorleap installation, default is latest")
-	cmd.Flags().StringVar(&flags.AirGapInstallationFilePath, "airgap", "", "Installation file path for air-gap installation")
+	cmd.Flags().StringVar(&flags.AirGapInstallationFilePath, "airgap", "", "Installation file path for air-gap installation, for a split pack its first part or SHA256SUMS index")
 	cmd.Flags().BoolVar(&flags.Local, "local", false, "Install tensorleap from local helm charts (current directory)")
 	cmd.Flags().StringVar(&flags.LocalDir, "local-dir", "", "Install tensorleap from local helm charts at the specified directory path")
 }
@@ -66,23 +68,25 @@ func (flags *TLSFlags) IsEnabled() bool {
 }
 
 type InstallFlags struct {
-	Port                    uint     `json:"port"`
-	RegistryPort            uint     `json:"registryPort"`
-	GpuDevices              string   `json:"gpuDevices,omitempty"`
-	Gpus                    uint     `json:"gpus,omitempty"`
-	UseCpu                  bool     `json:",omitempty"`
-	DatasetVolumes          []string `json:"datasetVolumes"`
-	DisableMetrics          bool     `json:"disableMetrics"`
-	Domain                  string   `json:"domain"`
-	DataDir                 string   `json:"dataDir"`
-	ProxyUrl                string   `json:"ProxyUrl"`
-	PipIndexUrl             string   `json:"pipIndexUrl,omitempty"`
-	PipExtraIndexUrl        string   `json:"pipExtraIndexUrl,omitempty"`
-	CpuLimit                string   `json:"cpuLimit,omitempty"`
-	ClusterMemoryGb         uint     `json:"clusterMemoryGb,omitempty"`
-	DisableAuth             *bool    `json:"disableAuth,omitempty"`
-	ClearInstallationImages *bool    `json:"removeInstallationImages,omitempty"`
-	ImageCachingMethod      string   `json:"imageCachingMethod,omitempty"`
+	Port                    uint          `json:"port"`
+	RegistryPort            uint          `json:"registryPort"`
+	GpuDevices              string        `json:"gpuDevices,omitempty"`
+	Gpus                    uint          `json:"gpus,omitempty"`
+	UseCpu                  bool          `json:",omitempty"`
+	DatasetVolumes          []string      `json:"datasetVolumes"`
+	DisableMetrics          bool          `json:"disableMetrics"`
+	Domain                  string        `json:"domain"`
+	DataDir                 string        `json:"dataDir"`
+	ProxyUrl                string        `json:"ProxyUrl"`
+	PipIndexUrl             string        `json:"pipIndexUrl,omitempty"`
+	PipExtraIndexUrl        string        `json:"pipExtraIndexUrl,omitempty"`
+	CpuLimit                string        `json:"cpuLimit,omitempty"`
+	ClusterMemoryGb         uint          `json:"clusterMemoryGb,omitempty"`
+	DisableAuth             *bool         `json:"disableAuth,omitempty"`
+	ClearInstallationImages *bool         `json:"removeInstallationImages,omitempty"`
+	ImageCachingMethod      string        `json:"imageCachingMethod,omitempty"`
+	DiskPressureCleanup     *bool         `json:"diskPressureCleanup,omitempty"`
+	WatchdogGracePeriod     time.Duration `json:"watchdogGracePeriod,omitempty"`
 	TLSFlags
 }
 
@@ -103,6 +107,8 @@ func (flags *InstallFlags) SetFlags(cmd *cobra.Command) {
 	cmd.Flags().UintVar(&flags.ClusterMemoryGb, "cluster-memory-gb", 0, "Total RAM (GiB) the orchestrator may schedule engine jobs against; 0 auto-detects from Docker")
 	setNilBoolFlag(cmd, &flags.DisableAuth, "disable-auth", "Disable authentication for the tensorleap server")
 	setNilBoolFlag(cmd, &flags.ClearInstallationImages, "clear-images", "Clear installation images after installation")
+	cmd.Flags().DurationVar(&flags.WatchdogGracePeriod, "watchdog-grace", k3d.DefaultWatchdogGracePeriod, "How long pods may stay in a failing state (image pull errors, crash loops, not enough resources) before the install stops")
+	setNilBoolFlag(cmd, &flags.DiskPressureCleanup, "disk-pressure-cleanup", "Prune the images not used by the installed version when the node reports DiskPressure during install")
 	cmd.Flags().StringVar(&flags.ImageCachingMethod, "image-caching", "", "Image caching method: docker-volume (Docker volume to containerd), local-volume (volume from local computer to containerd), or registry (caching by registry). Default is detected based on environment: Linux uses local-volume, macOS uses docker-volume, airgap uses registry")
 
 	deprecatedFlag_datasetDir(cmd)
@@ -122,6 +128,9 @@ func (flags *InstallFlags) BeforeRun(cmd *cobra.Command) {
 	if !cmd.Flags().Changed("disable-auth") {
 		flags.DisableAuth = nil
 	}
+	if !cmd.Flags().Changed("disk-pressure-cleanup") {
+		flags.DiskPressureCleanup = nil
+	}
 }
 
 func setNilBoolFlag(cmd *cobra.Command, ref **bool, flagName string, message string) {
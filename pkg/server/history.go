@@ -0,0 +1,164 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/tensorleap/helm-charts/pkg/local"
+	"github.com/tensorleap/helm-charts/pkg/log"
+	"github.com/tensorleap/helm-charts/pkg/server/manifest"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	maxInstallationHistoryEntries = 10
+	historyEntryTimeFormat        = "20060102-150405"
+)
+
+var historyEntryNameUnsafeChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// InstallationHistoryEntry is a previously installed manifest and params, saved before being replaced
+type InstallationHistoryEntry struct {
+	ID         string    `json:"id"`
+	SavedAt    time.Time `json:"savedAt"`
+	Tag        string    `json:"tag"`
+	AppVersion string    `json:"appVersion"`
+	dir        string
+}
+
+func (entry *InstallationHistoryEntry) Load() (*manifest.InstallationManifest, *InstallationParams, error) {
+	mnf, err := manifest.Load(path.Join(entry.dir, local.INSTALLATION_MANIFEST_FILE_NAME))
+	if err != nil {
+		return nil, nil, err
+	}
+	paramsBytes, err := os.ReadFile(path.Join(entry.dir, local.INSTALLATION_PARAMS_FILE_NAME))
+	if err != nil {
+		return nil, nil, err
+	}
+	params, err := LoadInstallationParams(paramsBytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	backwardCompatibility_datasetDirectory(params)
+	return mnf, params, nil
+}
+
+// archiveCurrentInstallation copies the saved manifest and params into the history
+// when they are about to be replaced with different ones
+func archiveCurrentInstallation(mnf *manifest.InstallationManifest, params *InstallationParams) error {
+	currentMnfBytes, err := os.ReadFile(local.GetInstallationManifestPath())
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	currentParamsBytes, err := os.ReadFile(local.GetInstallationParamsPath())
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	newMnfBytes, err := yaml.Marshal(*mnf)
+	if err != nil {
+		return err
+	}
+	newParamsBytes, err := yaml.Marshal(params)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(currentMnfBytes, newMnfBytes) && bytes.Equal(currentParamsBytes, newParamsBytes) {
+		return nil
+	}
+
+	currentMnf := &manifest.InstallationManifest{}
+	if err := yaml.Unmarshal(currentMnfBytes, currentMnf); err != nil {
+		return err
+	}
+	entryName := fmt.Sprintf("%s_%s", time.Now().UTC().Format(historyEntryTimeFormat), historyEntryNameUnsafeChars.ReplaceAllString(currentMnf.Tag, "-"))
+	entryDir := path.Join(local.GetInstallationHistoryDir(), entryName)
+	if err := os.MkdirAll(entryDir, 0777); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path.Join(entryDir, local.INSTALLATION_MANIFEST_FILE_NAME), currentMnfBytes, 0777); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path.Join(entryDir, local.INSTALLATION_PARAMS_FILE_NAME), currentParamsBytes, 0777); err != nil {
+		return err
+	}
+	log.Infof("Saved previous installation (tag %s) to history", currentMnf.Tag)
+
+	return pruneInstallationHistory()
+}
+
+func pruneInstallationHistory() error {
+	entries, err := ListInstallationHistory()
+	if err != nil {
+		return err
+	}
+	for i := maxInstallationHistoryEntries; i < len(entries); i++ {
+		if err := os.RemoveAll(entries[i].dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListInstallationHistory returns the previous installations, newest first
+func ListInstallationHistory() ([]InstallationHistoryEntry, error) {
+	historyDir := local.GetInstallationHistoryDir()
+	dirEntries, err := os.ReadDir(historyDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	entries := []InstallationHistoryEntry{}
+	for _, dirEntry := range dirEntries {
+		if !dirEntry.IsDir() {
+			continue
+		}
+		entryDir := path.Join(historyDir, dirEntry.Name())
+		mnf, err := manifest.Load(path.Join(entryDir, local.INSTALLATION_MANIFEST_FILE_NAME))
+		if err != nil {
+			log.Warnf("Skipping invalid installation history entry %s: %v", dirEntry.Name(), err)
+			continue
+		}
+		savedAt := time.Time{}
+		if len(dirEntry.Name()) >= len(historyEntryTimeFormat) {
+			savedAt, _ = time.Parse(historyEntryTimeFormat, dirEntry.Name()[:len(historyEntryTimeFormat)])
+		}
+		entries = append(entries, InstallationHistoryEntry{
+			ID:         dirEntry.Name(),
+			SavedAt:    savedAt,
+			Tag:        mnf.Tag,
+			AppVersion: mnf.AppVersion,
+			dir:        entryDir,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID > entries[j].ID })
+	return entries, nil
+}
+
+// FindInstallationHistoryEntry returns the newest entry, or the newest entry of the given tag
+func FindInstallationHistoryEntry(tag string) (*InstallationHistoryEntry, error) {
+	entries, err := ListInstallationHistory()
+	if err != nil {
+		return nil, err
+	}
+	for i := range entries {
+		if tag == "" || entries[i].Tag == tag {
+			return &entries[i], nil
+		}
+	}
+	if tag != "" {
+		return nil, fmt.Errorf("no previous installation of tag %s found in the installation history", tag)
+	}
+	return nil, fmt.Errorf("no previous installation found in the installation history")
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tensorleap/helm-charts/pkg/local"
+	"github.com/tensorleap/helm-charts/pkg/server/manifest"
+)
+
+func TestSaveInstallationKeepsHistory(t *testing.T) {
+	t.Setenv(local.DATA_DIR_ENV_NAME, t.TempDir())
+	params := &InstallationParams{DatasetVolumes: []string{}}
+
+	require.NoError(t, SaveInstallation(&manifest.InstallationManifest{Tag: "v1", AppVersion: "1.0.0"}, params))
+	entries, err := ListInstallationHistory()
+	require.NoError(t, err)
+	assert.Empty(t, entries, "first installation has nothing to archive")
+
+	require.NoError(t, SaveInstallation(&manifest.InstallationManifest{Tag: "v2", AppVersion: "1.1.0"}, params))
+	// saving the same installation again does not add an entry
+	require.NoError(t, SaveInstallation(&manifest.InstallationManifest{Tag: "v2", AppVersion: "1.1.0"}, params))
+
+	entries, err = ListInstallationHistory()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "v1", entries[0].Tag)
+	assert.Equal(t, "1.0.0", entries[0].AppVersion)
+
+	entry, err := FindInstallationHistoryEntry("v1")
+	require.NoError(t, err)
+	mnf, _, err := entry.Load()
+	require.NoError(t, err)
+	assert.Equal(t, "v1", mnf.Tag)
+
+	_, err = FindInstallationHistoryEntry("v0")
+	assert.Error(t, err)
+}
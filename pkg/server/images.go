@@ -0,0 +1,158 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/tensorleap/helm-charts/pkg/containerd"
+	"github.com/tensorleap/helm-charts/pkg/k3d"
+	"github.com/tensorleap/helm-charts/pkg/local"
+	"github.com/tensorleap/helm-charts/pkg/log"
+	"github.com/tensorleap/helm-charts/pkg/server/manifest"
+	"github.com/tensorleap/helm-charts/pkg/zot"
+)
+
+type ImagesPruneOptions struct {
+	Containerd bool
+	Registry   bool
+	DryRun     bool
+}
+
+type ImagesPruneReport struct {
+	DryRun     bool                    `json:"dryRun"`
+	Containerd *containerd.PruneReport `json:"containerd,omitempty"`
+	Registry   *zot.PruneReport        `json:"registry,omitempty"`
+	// Retention are the preserved registry images exceeding the retention policy
+	Retention *zot.PruneReport `json:"retention,omitempty"`
+}
+
+// PruneImages removes the images that are not in the installed manifest from the node containerd and from Zot,
+// and applies the registry retention policy, like the cleanup after every install does
+func PruneImages(ctx context.Context, opts ImagesPruneOptions) (*ImagesPruneReport, error) {
+	mnf, err := manifest.Load(local.GetInstallationManifestPath())
+	if err == manifest.ErrManifestNotFound {
+		return nil, fmt.Errorf("%w: no installation manifest found", ErrNotInstalled)
+	} else if err != nil {
+		return nil, err
+	}
+	if err := validateClusterRunning(ctx); err != nil {
+		return nil, err
+	}
+
+	keepImages := mnf.GetAllImages()
+	report := &ImagesPruneReport{DryRun: opts.DryRun}
+	if opts.Containerd {
+		log.Info("Pruning images from the node containerd")
+		report.Containerd, err = containerd.PruneContainerdExceptImageList(ctx, k3d.CONTAINER_NAME, keepImages, opts.DryRun)
+		if err != nil {
+			return nil, fmt.Errorf("pruning containerd images: %w", err)
+		}
+	}
+	if opts.Registry {
+		if err := CheckRegistryReachable(); err != nil {
+			return nil, err
+		}
+		log.Info("Pruning images from the registry")
+		report.Registry, err = zot.PruneExceptImageList(GetRegistryURL(), keepImages, zot.DnDPreserveRepos(keepImages), opts.DryRun)
+		if err != nil {
+			return nil, fmt.Errorf("pruning registry images: %w", err)
+		}
+		if params, err := LoadInstallationParamsFromPrevious(); err == nil && !params.RegistryRetention.IsEmpty() {
+			report.Retention, err = ApplyRegistryRetention(ctx, GetRegistryURL(), mnf, *params.RegistryRetention, opts.DryRun)
+			if err != nil {
+				return nil, fmt.Errorf("applying registry retention: %w", err)
+			}
+		}
+	}
+	return report, nil
+}
+
+// RunRegistryRetention applies the retention policy saved in the installation params
+func RunRegistryRetention(ctx context.Context, dryRun bool) (*zot.PruneReport, error) {
+	policy, err := GetRegistryRetention()
+	if err != nil {
+		return nil, err
+	}
+	if policy.IsEmpty() {
+		return nil, fmt.Errorf("no retention policy is set, set one with 'leap server registry retention set'")
+	}
+	mnf, err := manifest.Load(local.GetInstallationManifestPath())
+	if err == manifest.ErrManifestNotFound {
+		return nil, fmt.Errorf("%w: no installation manifest found", ErrNotInstalled)
+	} else if err != nil {
+		return nil, err
+	}
+	if err := validateClusterRunning(ctx); err != nil {
+		return nil, err
+	}
+	if err := CheckRegistryReachable(); err != nil {
+		return nil, err
+	}
+	return ApplyRegistryRetention(ctx, GetRegistryURL(), mnf, *policy, dryRun)
+}
+
+// ApplyRegistryRetention deletes the images of the preserved repos that exceed the policy.
+// Images of the installed version and digests of running pods are never deleted, so it fails
+// when the running pods cannot be listed.
+func ApplyRegistryRetention(ctx context.Context, registryURL string, mnf *manifest.InstallationManifest, policy zot.RetentionPolicy, dryRun bool) (*zot.PruneReport, error) {
+	inventory, err := containerd.GetInventory(ctx, k3d.CONTAINER_NAME)
+	if err != nil {
+		return nil, fmt.Errorf("listing the images of running pods: %w", err)
+	}
+	keepImages := mnf.GetAllImages()
+	inUseDigests := []string{}
+	for _, image := range inventory.RunningImages() {
+		keepImages = append(keepImages, image.Refs...)
+		for _, repoDigest := range image.RepoDigests {
+			if _, digest, ok := strings.Cut(repoDigest, "@"); ok {
+				inUseDigests = append(inUseDigests, digest)
+			}
+		}
+	}
+	log.Infof("Applying the registry retention policy (%s)", policy.String())
+	return zot.ApplyRetention(registryURL, zot.DnDPreserveRepos(mnf.GetAllImages()), policy, keepImages, inUseDigests, dryRun)
+}
+
+// GetRegistryRetention returns the retention policy of the installation, empty when not set
+func GetRegistryRetention() (*zot.RetentionPolicy, error) {
+	params, err := LoadInstallationParamsFromPrevious()
+	if err == ErrNoInstallationParams {
+		return nil, fmt.Errorf("%w: no installation params found", ErrNotInstalled)
+	} else if err != nil {
+		return nil, err
+	}
+	if params.RegistryRetention == nil {
+		return &zot.RetentionPolicy{}, nil
+	}
+	return params.RegistryRetention, nil
+}
+
+// SaveRegistryRetention saves the retention policy to the installation params, an empty policy removes it
+func SaveRegistryRetention(policy zot.RetentionPolicy) error {
+	params, err := LoadInstallationParamsFromPrevious()
+	if err == ErrNoInstallationParams {
+		return fmt.Errorf("%w: no installation params found", ErrNotInstalled)
+	} else if err != nil {
+		return err
+	}
+	params.RegistryRetention = nil
+	if !policy.IsEmpty() {
+		params.RegistryRetention = &policy
+	}
+	return params.Save()
+}
+
+func validateClusterRunning(ctx context.Context) error {
+	cluster, err := k3d.GetCluster(ctx)
+	if err != nil {
+		return err
+	}
+	if cluster == nil {
+		return fmt.Errorf("%w: cluster not found", ErrNotInstalled)
+	}
+	if running, _ := cluster.ServerCountRunning(); running == 0 {
+		return fmt.Errorf("cluster is stopped, start it with 'leap server run'")
+	}
+	return nil
+}
@@ -8,9 +8,16 @@ import (
 
 type InitDataDirFuncType func(ctx context.Context, flag string) (isDataTransfer bool, err error)
 
-func defaultDataDirFunc(ctx context.Context, flag string) (bool, error) {
+// InitDataDirNoTransferFuncType resolves the data dir like InitDataDirFuncType without transferring data to it
+type InitDataDirNoTransferFuncType func(ctx context.Context, flag string) error
+
+func defaultDataDirNoTransferFunc(ctx context.Context, flag string) error {
 	previousDataDir := local.DEFAULT_DATA_DIR
-	err := local.SetDataDir(previousDataDir, flag)
+	return local.SetDataDir(previousDataDir, flag)
+}
+
+func defaultDataDirFunc(ctx context.Context, flag string) (bool, error) {
+	err := defaultDataDirNoTransferFunc(ctx, flag)
 	if err != nil {
 		return false, err
 	}
@@ -23,6 +30,14 @@ func defaultDataDirFunc(ctx context.Context, flag string) (bool, error) {
 
 var InitDataDirFunc InitDataDirFuncType = defaultDataDirFunc
 
+// InitDataDirNoTransferFunc is used by commands that must not change anything, it is replaced along with
+// InitDataDirFunc
+var InitDataDirNoTransferFunc InitDataDirNoTransferFuncType = defaultDataDirNoTransferFunc
+
 func SetInitDataDirFunc(f InitDataDirFuncType) {
 	InitDataDirFunc = f
 }
+
+func SetInitDataDirNoTransferFunc(f InitDataDirNoTransferFuncType) {
+	InitDataDirNoTransferFunc = f
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/tensorleap/helm-charts/pkg/k3d"
 	"github.com/tensorleap/helm-charts/pkg/local"
 	"github.com/tensorleap/helm-charts/pkg/log"
+	"github.com/tensorleap/helm-charts/pkg/server/airgap"
 	"github.com/tensorleap/helm-charts/pkg/server/manifest"
 	"helm.sh/helm/v3/pkg/chart"
 )
@@ -21,44 +22,71 @@ func Install(ctx context.Context, mnf *manifest.InstallationManifest, isAirgap b
 	if err != nil && err != manifest.ErrManifestNotFound {
 		return nil, err
 	}
+	checkpoints := LoadInstallCheckpoints()
 
 	k3d.FixDockerDns()
 
-	cluster, _, err := InitCluster(
+	// the cluster phase always runs, InitCluster reuses the cluster an unfinished install created
+	endClusterPhase := log.StartPhase("Creating cluster")
+	cluster, createdCluster, err := InitCluster(
 		ctx,
 		mnf,
 		prvMnf,
 		installationParams,
 		prvInstallationParams,
 	)
+	endClusterPhase()
 	if err != nil {
 		return nil, err
 	}
+	// checkpoints left by an earlier install do not describe a new cluster
+	if createdCluster {
+		if err := checkpoints.Clear(); err != nil {
+			log.Warnf("Failed removing the install checkpoints: %v", err)
+		}
+	}
+	inputsHash := clusterPhaseInputs(mnf, installationParams)
+	if err := checkpoints.RecordRun(PhaseCluster, inputsHash); err != nil {
+		log.Warnf("Failed saving the install checkpoint: %v", err)
+	}
 
 	regPortStr := strconv.FormatUint(uint64(installationParams.RegistryPort), 10)
 
 	if isAirgap {
-		if err := airgapBootstrap(ctx, mnf, installationParams, cluster, infraChart, regPortStr); err != nil {
+		inputsHash, err = airgapBootstrap(ctx, checkpoints, inputsHash, mnf, installationParams, cluster, infraChart, regPortStr)
+		if err != nil {
 			return nil, err
 		}
 	}
 
-	if err := InstallCharts(ctx, mnf, installationParams, infraChart, serverChart); err != nil {
+	inputsHash = hashPhaseInputs(inputsHash, mnf, installationParams)
+	if err := checkpoints.Run(PhaseCharts, inputsHash, func() error {
+		return log.TimePhase("Installing charts", func() error {
+			return InstallCharts(ctx, mnf, installationParams, infraChart, serverChart)
+		})
+	}); err != nil {
 		return nil, err
 	}
 
 	_ = SaveInstallation(mnf, installationParams)
-	err = cleanImagesFromContainerd(ctx, mnf, k3d.CONTAINER_NAME)
+	err = log.TimePhase("Cleaning containerd images", func() error {
+		return cleanImagesFromContainerd(ctx, mnf, k3d.CONTAINER_NAME)
+	})
 	if err != nil {
 		log.SendCloudReport("error", "Failed cleaning images from containerd", "Failed", &map[string]interface{}{"error": err.Error()})
 		log.Warnf("Failed cleaning images from containerd: %v", err)
 	}
 
-	if err := cleanImagesFromZot(installationParams.RegistryPort, mnf); err != nil {
+	if err := log.TimePhase("Cleaning Zot images", func() error {
+		return cleanImagesFromZot(ctx, installationParams, mnf)
+	}); err != nil {
 		log.SendCloudReport("error", "Failed cleaning images from Zot", "Failed", &map[string]interface{}{"error": err.Error()})
 		log.Warnf("Failed cleaning images from Zot registry: %v", err)
 	}
 
+	if err := checkpoints.Clear(); err != nil {
+		log.Warnf("Failed removing the install checkpoints: %v", err)
+	}
 	return installationParams.GetInstallationResult(), nil
 }
 
@@ -67,39 +95,78 @@ func Install(ctx context.Context, mnf *manifest.InstallationManifest, isAirgap b
 //
 //	Install infra chart so Zot starts. Wait for Zot readiness.
 //
-// Phase 2: Push ALL application images from host Docker into Zot.
-func airgapBootstrap(ctx context.Context, mnf *manifest.InstallationManifest, installationParams *InstallationParams, cluster *k3d.Cluster, infraChart *chart.Chart, regPortStr string) error {
+// Phase 2: Push ALL application images into Zot, from the pack or else from host Docker.
+//
+// Each step is checkpointed, it returns the inputs hash of the last one.
+func airgapBootstrap(ctx context.Context, checkpoints *InstallCheckpoints, inputsHash string, mnf *manifest.InstallationManifest, installationParams *InstallationParams, cluster *k3d.Cluster, infraChart *chart.Chart, regPortStr string) (string, error) {
 	log.Info("Airgap mode: starting two-phase bootstrap...")
 
 	// Phase 1: Import Zot + k3s system images into containerd
 	bootstrapImages := getBootstrapImages(mnf, installationParams.IsUseGpu())
-	if err := k3d.ImportImagesIntoCluster(ctx, cluster, bootstrapImages); err != nil {
-		return fmt.Errorf("failed to import bootstrap images into containerd: %w", err)
+	inputsHash = hashPhaseInputs(inputsHash, bootstrapImages)
+	if err := checkpoints.Run(PhaseBootstrapImport, inputsHash, func() error {
+		return log.TimePhase("Importing bootstrap images into containerd", func() error {
+			return k3d.ImportImagesIntoCluster(ctx, cluster, bootstrapImages)
+		})
+	}); err != nil {
+		return "", fmt.Errorf("failed to import bootstrap images into containerd: %w", err)
 	}
 
 	// Install infra chart so Zot starts
-	if err := installInfraChart(ctx, mnf, installationParams, infraChart); err != nil {
-		return fmt.Errorf("failed to install infra chart during airgap bootstrap: %w", err)
+	inputsHash = hashPhaseInputs(inputsHash, mnf.InfraHelmChart, installationParams.GetInfraHelmValuesParams(nil, mnf.Images.Zot))
+	if err := checkpoints.Run(PhaseInfraChart, inputsHash, func() error {
+		return log.TimePhase("Installing infra chart", func() error {
+			return installInfraChart(ctx, mnf, installationParams, infraChart)
+		})
+	}); err != nil {
+		return "", fmt.Errorf("failed to install infra chart during airgap bootstrap: %w", err)
 	}
 
-	// Wait for Zot to become ready
-	log.Info("Waiting for in-cluster Zot registry to be ready...")
-	if err := k3d.WaitForRegistry(ctx, regPortStr); err != nil {
-		return fmt.Errorf("zot registry did not become ready: %w", err)
-	}
-	log.Info("Zot registry is ready")
-
 	// Phase 2: Push all application images into Zot
 	imagesToCache := CalcWhichImagesToCache(mnf, installationParams.IsUseGpu(), true)
-	if len(imagesToCache) > 0 {
-		log.Infof("Pushing %d images into Zot registry...", len(imagesToCache))
-		if err := k3d.CacheImagesInParallel(ctx, imagesToCache, regPortStr, true, ""); err != nil {
-			return fmt.Errorf("failed to push images into Zot: %w", err)
+	inputsHash = hashPhaseInputs(inputsHash, regPortStr, imagesToCache)
+	if err := checkpoints.Run(PhaseImagePush, inputsHash, func() error {
+		// Wait for Zot to become ready
+		log.Info("Waiting for in-cluster Zot registry to be ready...")
+		if err := log.TimePhase("Waiting for Zot", func() error {
+			return k3d.WaitForRegistry(ctx, regPortStr)
+		}); err != nil {
+			return fmt.Errorf("zot registry did not become ready: %w", err)
+		}
+		log.Info("Zot registry is ready")
+
+		if len(imagesToCache) > 0 {
+			log.Infof("Pushing %d images into Zot registry...", len(imagesToCache))
+			if err := log.TimePhase("Pushing images to Zot", func() error {
+				return pushAirgapImages(ctx, installationParams.AirgapPack, imagesToCache, regPortStr)
+			}); err != nil {
+				return fmt.Errorf("failed to push images into Zot: %w", err)
+			}
 		}
+		return nil
+	}); err != nil {
+		return "", err
 	}
 
 	log.Info("Airgap bootstrap complete")
-	return nil
+	return inputsHash, nil
+}
+
+// pushAirgapImages pushes the images into Zot straight from the OCI image layout of the pack. The images
+// the pack does not hold, all of them for a docker archive pack, were loaded into docker and are pushed from it.
+func pushAirgapImages(ctx context.Context, packPath string, images []string, regPort string) error {
+	notInPack := images
+	if packPath != "" {
+		var err error
+		notInPack, err = airgap.PushPackImages(ctx, packPath, images, regPort)
+		if err != nil {
+			return err
+		}
+	}
+	if len(notInPack) == 0 {
+		return nil
+	}
+	return k3d.CacheImagesInParallel(ctx, notInPack, regPort, true, "")
 }
 
 // getBootstrapImages returns the set of images that must be imported directly
@@ -136,7 +203,7 @@ func installInfraChart(ctx context.Context, mnf *manifest.InstallationManifest,
 	}
 	defer clean()
 
-	helmConfig, err := helm.CreateHelmConfig(kubeConfigPath, KUBE_CONTEXT, KUBE_NAMESPACE)
+	helmConfig, err := helm.CreateHelmConfig(ctx, kubeConfigPath, KUBE_CONTEXT, KUBE_NAMESPACE)
 	if err != nil {
 		return err
 	}
@@ -152,12 +219,22 @@ func installInfraChart(ctx context.Context, mnf *manifest.InstallationManifest,
 		// Zot, which isn't ready yet. WaitForRegistry polls for Zot specifically;
 		// Phase 2 pushes all images so ECK operator can pull on retry.
 		if err := helm.InstallChartNoWait(helmConfig, infraChartMeta.ReleaseName, infraChart, infraValues); err != nil {
+			if ctx.Err() != nil {
+				rollbackInterruptedRelease(helmConfig, infraChartMeta.ReleaseName)
+			}
 			return err
 		}
 	}
 	return nil
 }
 
+// rollbackInterruptedRelease leaves the release of a helm action stopped by Ctrl-C in a state the next install can continue from
+func rollbackInterruptedRelease(helmConfig *helm.HelmConfig, releaseName string) {
+	if _, err := helm.RollbackInterruptedRelease(helmConfig, releaseName); err != nil {
+		log.Warnf("Failed rolling back the interrupted helm release %s: %v", releaseName, err)
+	}
+}
+
 func InitCluster(ctx context.Context, mnf, previousMnf *manifest.InstallationManifest, installationParams, previousInstallationParams *InstallationParams) (cluster *k3d.Cluster, createNew bool, err error) {
 	cluster, err = k3d.GetCluster(ctx)
 	if err != nil {
@@ -167,9 +244,7 @@ func InitCluster(ctx context.Context, mnf, previousMnf *manifest.InstallationMan
 	clusterNotExists := cluster == nil
 	if clusterNotExists {
 		cluster, err = k3d.CreateCluster(ctx, mnf, installationParams.GetCreateK3sClusterParams(), local.GetContainerdDataDir())
-		if err != nil {
-			createNew = true
-		}
+		createNew = err == nil
 		return
 	}
 
@@ -214,18 +289,70 @@ func InstallCharts(ctx context.Context, mnf *manifest.InstallationManifest, inst
 	}
 	defer clean()
 
-	helmConfig, err := helm.CreateHelmConfig(kubeConfigPath, KUBE_CONTEXT, KUBE_NAMESPACE)
+	helmConfig, err := helm.CreateHelmConfig(ctx, kubeConfigPath, KUBE_CONTEXT, KUBE_NAMESPACE)
 	if err != nil {
 		log.SendCloudReport("error", "Failed creating helm config", "Failed",
 			&map[string]interface{}{"kubeContext": KUBE_CONTEXT, "kubeNamespace": KUBE_NAMESPACE, "error": err.Error()})
 		return err
 	}
 
-	monitor, monitorErr := k3d.StartDiskPressureMonitor(kubeConfigPath, KUBE_CONTEXT)
-	if monitorErr != nil {
-		log.Warnf("Could not start disk-pressure monitor: %v", monitorErr)
+	var remediate k3d.DiskPressureRemediation
+	if installationParams.DiskPressureCleanup {
+		remediate = NewDiskPressureCleanup(fmt.Sprintf("http://localhost:%d", installationParams.RegistryPort), mnf)
+	}
+	// the watchdog cancels the helm wait when pods fail and will not recover
+	watchdog, watchdogErr := k3d.StartWatchdog(ctx, kubeConfigPath, KUBE_CONTEXT, k3d.WatchdogOptions{
+		Namespace:             KUBE_NAMESPACE,
+		GracePeriod:           installationParams.WatchdogGracePeriod,
+		RemediateDiskPressure: remediate,
+	})
+	if watchdogErr != nil {
+		log.Warnf("Could not start the install watchdog: %v", watchdogErr)
+	} else {
+		defer watchdog.Stop()
+		helmConfig.Context = watchdog.Context()
+	}
+	// helmErr handles a helm action stopped before it finished: on Ctrl-C the release is rolled back, and when the
+	// watchdog gave up on the pods the release is marked as failed and the diagnosis is returned
+	helmErr := func(releaseName string, err error) error {
+		if helmConfig.Context.Err() == nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			rollbackInterruptedRelease(helmConfig, releaseName)
+			return err
+		}
+		if watchdog != nil {
+			if diagnosis := watchdog.Err(); diagnosis != nil {
+				if markErr := helm.MarkReleaseFailed(helmConfig, releaseName, k3d.ErrUnrecoverablePods.Error()); markErr != nil {
+					log.Warnf("Failed marking helm release %s as failed: %v", releaseName, markErr)
+				}
+				return diagnosis
+			}
+		}
+		return err
+	}
+
+	// shows the workloads of the release helm waits for, the phases are started before each helm action
+	progress, err := k3d.StartRolloutProgress(kubeConfigPath, KUBE_CONTEXT, KUBE_NAMESPACE)
+	if err != nil {
+		log.Warnf("Could not show the rollout progress: %v", err)
 	} else {
-		defer monitor.Stop()
+		defer progress.Stop()
+	}
+	// the phases are also recorded in the timeline of the command, until the returned function is called
+	startPhase := func(name, release string) (end func()) {
+		if progress != nil {
+			progress.StartPhase(name, release)
+		}
+		return log.StartPhase(name)
+	}
+
+	// releases left pending or failed by an unfinished install are reset so they can be installed or upgraded again
+	for _, releaseName := range []string{mnf.InfraHelmChart.ReleaseName, mnf.ServerHelmChart.ReleaseName} {
+		if _, err := helm.ResetUnfinishedRelease(helmConfig, releaseName); err != nil {
+			return err
+		}
 	}
 
 	infraChartMeta := mnf.InfraHelmChart
@@ -242,15 +369,18 @@ func InstallCharts(ctx context.Context, mnf *manifest.InstallationManifest, inst
 			syncRegistries = k3d.BuildZotSyncRegistries(mnf)
 		}
 		infraValues := helm.CreateInfraChartValues(installationParams.GetInfraHelmValuesParams(syncRegistries, mnf.Images.Zot))
-		if err := helm.InstallChart(
+		endPhase := startPhase("Installing infra", infraChartMeta.ReleaseName)
+		err := helm.InstallChart(
 			helmConfig,
 			infraChartMeta.ReleaseName,
 			infraChart,
 			infraValues,
-		); err != nil {
+		)
+		endPhase()
+		if err != nil {
 			log.SendCloudReport("error", "Failed installing latest chart versions", "Failed",
 				&map[string]interface{}{"version": infraChartMeta.Version, "error": err.Error()})
-			return err
+			return helmErr(infraChartMeta.ReleaseName, err)
 		}
 	}
 
@@ -271,27 +401,33 @@ func InstallCharts(ctx context.Context, mnf *manifest.InstallationManifest, inst
 	}
 	if isServerReleaseExisted {
 		log.SendCloudReport("info", "Running helm upgrade", "Running", &map[string]interface{}{"version": serverChartMeta.Version})
-		if err := helm.UpgradeChart(
+		endPhase := startPhase("Upgrading server", serverChartMeta.ReleaseName)
+		err := helm.UpgradeChart(
 			helmConfig,
 			serverChartMeta.ReleaseName,
 			serverChart,
 			serverValues,
-		); err != nil {
+		)
+		endPhase()
+		if err != nil {
 			log.SendCloudReport("error", "Failed upgrading helm latest charts versions", "Failed",
 				&map[string]interface{}{"version": serverChartMeta.Version, "error": err.Error()})
-			return err
+			return helmErr(serverChartMeta.ReleaseName, err)
 		}
 	} else {
 		log.SendCloudReport("info", "Setting up server helm repo", "Running", &map[string]interface{}{"version": serverChartMeta.Version})
-		if err := helm.InstallChart(
+		endPhase := startPhase("Installing server", serverChartMeta.ReleaseName)
+		err := helm.InstallChart(
 			helmConfig,
 			serverChartMeta.ReleaseName,
 			serverChart,
 			serverValues,
-		); err != nil {
+		)
+		endPhase()
+		if err != nil {
 			log.SendCloudReport("error", "Failed installing latest server chart versions", "Failed",
 				&map[string]interface{}{"version": serverChartMeta.Version, "error": err.Error()})
-			return err
+			return helmErr(serverChartMeta.ReleaseName, err)
 		}
 	}
 
@@ -0,0 +1,297 @@
+package server
+
+import (
+	"bytes"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"github.com/tensorleap/helm-charts/pkg/k3d"
+	"gopkg.in/yaml.v3"
+)
+
+const InstallConfigVersion = "v1"
+
+// InstallConfig is the declarative form of the install flags, fields that are not set keep the flag defaults.
+// Relative paths are resolved against the directory of the config file.
+type InstallConfig struct {
+	Version             string              `yaml:"version"`
+	Source              InstallConfigSource `yaml:"source,omitempty"`
+	DataDir             *string             `yaml:"dataDir,omitempty"`
+	Port                *uint               `yaml:"port,omitempty"`
+	RegistryPort        *uint               `yaml:"registryPort,omitempty"`
+	Domain              *string             `yaml:"domain,omitempty"`
+	ProxyUrl            *string             `yaml:"proxyUrl,omitempty"`
+	PipIndexUrl         *string             `yaml:"pipIndexUrl,omitempty"`
+	PipExtraIndexUrl    *string             `yaml:"pipExtraIndexUrl,omitempty"`
+	Gpus                *uint               `yaml:"gpus,omitempty"`
+	GpuDevices          *string             `yaml:"gpuDevices,omitempty"`
+	Cpu                 *bool               `yaml:"cpu,omitempty"`
+	CpuLimit            *string             `yaml:"cpuLimit,omitempty"`
+	ClusterMemoryGb     *uint               `yaml:"clusterMemoryGb,omitempty"`
+	DatasetVolumes      []string            `yaml:"datasetVolumes,omitempty"`
+	DisableMetrics      *bool               `yaml:"disableMetrics,omitempty"`
+	DisableAuth         *bool               `yaml:"disableAuth,omitempty"`
+	ClearImages         *bool               `yaml:"clearImages,omitempty"`
+	DiskPressureCleanup *bool               `yaml:"diskPressureCleanup,omitempty"`
+	WatchdogGrace       *string             `yaml:"watchdogGrace,omitempty"`
+	ImageCaching        *string             `yaml:"imageCaching,omitempty"`
+	TLS                 InstallConfigTLS    `yaml:"tls,omitempty"`
+	baseDir             string
+}
+
+type InstallConfigSource struct {
+	Tag      *string `yaml:"tag,omitempty"`
+	Airgap   *string `yaml:"airgap,omitempty"`
+	Local    *bool   `yaml:"local,omitempty"`
+	LocalDir *string `yaml:"localDir,omitempty"`
+}
+
+type InstallConfigTLS struct {
+	Cert  *string `yaml:"cert,omitempty"`
+	Key   *string `yaml:"key,omitempty"`
+	Chain *string `yaml:"chain,omitempty"`
+	Port  *uint   `yaml:"port,omitempty"`
+}
+
+// LoadInstallConfig reads and strictly parses an install config file, unknown fields are errors
+func LoadInstallConfig(configPath string) (*InstallConfig, error) {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	cfg := &InstallConfig{}
+	if err := decoder.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("%w %s: %w", ErrInvalidInstallConfig, configPath, err)
+	}
+	if cfg.Version != InstallConfigVersion {
+		return nil, fmt.Errorf("%w %s: unsupported version '%s', expected '%s'", ErrInvalidInstallConfig, configPath, cfg.Version, InstallConfigVersion)
+	}
+	absPath, err := filepath.Abs(configPath)
+	if err != nil {
+		return nil, err
+	}
+	cfg.baseDir = filepath.Dir(absPath)
+	return cfg, nil
+}
+
+func (cfg *InstallConfig) resolvePath(p *string) *string {
+	if p == nil || *p == "" || filepath.IsAbs(*p) {
+		return p
+	}
+	resolved := filepath.Join(cfg.baseDir, *p)
+	return &resolved
+}
+
+type installConfigFlag struct {
+	name   string
+	values []string
+}
+
+func (cfg *InstallConfig) flagValues() []installConfigFlag {
+	flags := []installConfigFlag{}
+	addString := func(name string, value *string) {
+		if value != nil {
+			flags = append(flags, installConfigFlag{name, []string{*value}})
+		}
+	}
+	addUint := func(name string, value *uint) {
+		if value != nil {
+			flags = append(flags, installConfigFlag{name, []string{strconv.FormatUint(uint64(*value), 10)}})
+		}
+	}
+	addBool := func(name string, value *bool) {
+		if value != nil {
+			flags = append(flags, installConfigFlag{name, []string{strconv.FormatBool(*value)}})
+		}
+	}
+
+	addString("tag", cfg.Source.Tag)
+	addString("airgap", cfg.resolvePath(cfg.Source.Airgap))
+	addBool("local", cfg.Source.Local)
+	addString("local-dir", cfg.resolvePath(cfg.Source.LocalDir))
+	addString("data-dir", cfg.resolvePath(cfg.DataDir))
+	addUint("port", cfg.Port)
+	addUint("registry-port", cfg.RegistryPort)
+	addString("domain", cfg.Domain)
+	addString("proxy-url", cfg.ProxyUrl)
+	addString("pip-index-url", cfg.PipIndexUrl)
+	addString("pip-extra-index-url", cfg.PipExtraIndexUrl)
+	addUint("gpus", cfg.Gpus)
+	addString("gpu-devices", cfg.GpuDevices)
+	addBool("cpu", cfg.Cpu)
+	addString("cpu-limit", cfg.CpuLimit)
+	addUint("cluster-memory-gb", cfg.ClusterMemoryGb)
+	if cfg.DatasetVolumes != nil {
+		volumes := []string{}
+		for _, volume := range cfg.DatasetVolumes {
+			hostPath, containerPath, hasContainerPath := strings.Cut(volume, ":")
+			hostPath = *cfg.resolvePath(&hostPath)
+			if hasContainerPath {
+				volume = hostPath + ":" + containerPath
+			} else {
+				volume = hostPath
+			}
+			volumes = append(volumes, volume)
+		}
+		flags = append(flags, installConfigFlag{"dataset-volume", volumes})
+	}
+	addBool("disable-metrics", cfg.DisableMetrics)
+	addBool("disable-auth", cfg.DisableAuth)
+	addBool("clear-images", cfg.ClearImages)
+	addBool("disk-pressure-cleanup", cfg.DiskPressureCleanup)
+	addString("watchdog-grace", cfg.WatchdogGrace)
+	addString("image-caching", cfg.ImageCaching)
+	addString("cert", cfg.resolvePath(cfg.TLS.Cert))
+	addString("key", cfg.resolvePath(cfg.TLS.Key))
+	addString("chain", cfg.resolvePath(cfg.TLS.Chain))
+	addUint("tls-port", cfg.TLS.Port)
+	return flags
+}
+
+// ApplyInstallConfig sets the flags from the config, flags given on the command line take precedence
+func ApplyInstallConfig(flagSet *pflag.FlagSet, cfg *InstallConfig) error {
+	for _, flag := range cfg.flagValues() {
+		if flagSet.Lookup(flag.name) == nil || flagSet.Changed(flag.name) {
+			continue
+		}
+		for _, value := range flag.values {
+			if err := flagSet.Set(flag.name, value); err != nil {
+				return fmt.Errorf("%w: invalid value for %s: %w", ErrInvalidInstallConfig, flag.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateInstallFlags checks the install flags without touching docker, returning all the problems found.
+// It is strict, relative volume paths and urls without a scheme are rejected, so it is only used for flags set from
+// a config file, whose relative paths were resolved, and not for the flags of a plain install or upgrade.
+func ValidateInstallFlags(flags *InstallFlags, source *InstallationSourceFlags) error {
+	errs := []error{}
+	addErr := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	ports := map[uint]string{}
+	checkPort := func(name string, port uint) {
+		if port == 0 || port > 65535 {
+			addErr("%s: %d is not a valid port, must be between 1 and 65535", name, port)
+			return
+		}
+		if other, ok := ports[port]; ok {
+			addErr("%s: port %d is already used by %s", name, port, other)
+			return
+		}
+		ports[port] = name
+	}
+	checkPort("port", flags.Port)
+	checkPort("registry-port", flags.RegistryPort)
+	if flags.TLSFlags.IsEnabled() {
+		checkPort("tls-port", flags.TLSFlags.Port)
+	}
+
+	if flags.CpuLimit != "" {
+		if _, err := k3d.ParseCPULimit(flags.CpuLimit); err != nil {
+			addErr("cpu-limit: %v", err)
+		}
+	}
+	if flags.UseCpu && (flags.Gpus > 0 || flags.GpuDevices != "") {
+		addErr("cpu: cannot be combined with gpus or gpu-devices")
+	}
+	if flags.WatchdogGracePeriod < 0 {
+		addErr("watchdog-grace: must not be negative")
+	}
+
+	for _, volume := range flags.DatasetVolumes {
+		if err := ValidateDatasetVolumeSpec(volume); err != nil {
+			addErr("dataset-volume: %v", err)
+		}
+	}
+
+	for _, u := range [][2]string{{"proxy-url", flags.ProxyUrl}, {"pip-index-url", flags.PipIndexUrl}, {"pip-extra-index-url", flags.PipExtraIndexUrl}} {
+		if err := validateConfigUrl(u[1]); err != nil {
+			addErr("%s: %v", u[0], err)
+		}
+	}
+
+	if (flags.TLSFlags.CertPath == "") != (flags.TLSFlags.KeyPath == "") {
+		addErr("tls: cert and key must be given together")
+	}
+	for _, file := range [][2]string{{"cert", flags.TLSFlags.CertPath}, {"key", flags.TLSFlags.KeyPath}, {"chain", flags.TLSFlags.ChainPath}} {
+		if file[1] == "" {
+			continue
+		}
+		if err := validatePemFile(file[1]); err != nil {
+			addErr("%s: %v", file[0], err)
+		}
+	}
+
+	if flags.ImageCachingMethod != "" {
+		method := k3d.ImageCachingMethod(flags.ImageCachingMethod)
+		if !k3d.IsImageCachingMethodAvailable(method, source.IsAirGap()) {
+			addErr("image-caching: method '%s' is not available for this environment", method)
+		}
+	}
+
+	sources := 0
+	for _, isSet := range []bool{source.Tag != "", source.IsAirGap(), source.IsLocal()} {
+		if isSet {
+			sources++
+		}
+	}
+	if sources > 1 {
+		addErr("source: only one of tag, airgap and local can be set")
+	}
+	if source.IsAirGap() {
+		if _, err := os.Stat(source.AirGapInstallationFilePath); err != nil {
+			addErr("airgap: %v", err)
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w:\n%w", ErrInvalidInstallFlags, errors.Join(errs...))
+}
+
+// ValidateDatasetVolumeSpec checks a <host path>[:<container path>] volume spec, a missing host dir is created on install
+func ValidateDatasetVolumeSpec(spec string) error {
+	parts := strings.Split(spec, ":")
+	if len(parts) > 2 || parts[0] == "" || (len(parts) == 2 && parts[1] == "") {
+		return fmt.Errorf("invalid volume '%s', expected <host path>[:<container path>]", spec)
+	}
+	for _, p := range parts {
+		if !filepath.IsAbs(p) {
+			return fmt.Errorf("invalid volume '%s', paths must be absolute", spec)
+		}
+	}
+	info, err := os.Stat(parts[0])
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("invalid volume '%s': %v", spec, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("invalid volume '%s': %s is not a directory", spec, parts[0])
+	}
+	return nil
+}
+
+func validatePemFile(filePath string) error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	if block, _ := pem.Decode(data); block == nil {
+		return fmt.Errorf("%s is not a PEM file", filePath)
+	}
+	return nil
+}
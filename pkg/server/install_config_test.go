@@ -0,0 +1,111 @@
+package server
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPem = "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n"
+
+func newTestInstallFlags(t *testing.T) (*cobra.Command, *InstallFlags, *InstallationSourceFlags) {
+	t.Helper()
+	cmd := &cobra.Command{}
+	flags := &InstallFlags{}
+	source := &InstallationSourceFlags{}
+	flags.SetFlags(cmd)
+	source.SetFlags(cmd)
+	return cmd, flags, source
+}
+
+func TestApplyInstallConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, path.Join(dir, "certs", "server.crt"), testPem)
+	writeTestFile(t, path.Join(dir, "certs", "server.key"), testPem)
+	configPath := path.Join(dir, "tensorleap.yaml")
+	writeTestFile(t, configPath, `version: v1
+source:
+  tag: tensorleap-1.2.3
+port: 8080
+domain: tl.example.com
+cpuLimit: "4"
+datasetVolumes:
+  - data
+  - /mnt/raw:/raw
+disableAuth: true
+tls:
+  cert: certs/server.crt
+  key: certs/server.key
+`)
+
+	cfg, err := LoadInstallConfig(configPath)
+	require.NoError(t, err)
+
+	cmd, flags, source := newTestInstallFlags(t)
+	require.NoError(t, cmd.Flags().Set("domain", "cli.example.com"))
+	require.NoError(t, ApplyInstallConfig(cmd.Flags(), cfg))
+	flags.BeforeRun(cmd)
+
+	assert.Equal(t, "tensorleap-1.2.3", source.Tag)
+	assert.Equal(t, uint(8080), flags.Port)
+	assert.Equal(t, uint(DefaultRegistryPort), flags.RegistryPort)
+	assert.Equal(t, "cli.example.com", flags.Domain, "command line flags take precedence")
+	assert.Equal(t, "4", flags.CpuLimit)
+	assert.Equal(t, []string{path.Join(dir, "data"), "/mnt/raw:/raw"}, flags.DatasetVolumes)
+	require.NotNil(t, flags.DisableAuth)
+	assert.True(t, *flags.DisableAuth)
+	assert.Nil(t, flags.ClearInstallationImages)
+	assert.Equal(t, path.Join(dir, "certs", "server.crt"), flags.CertPath)
+	assert.NoError(t, ValidateInstallFlags(flags, source))
+}
+
+func TestLoadInstallConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	configPath := path.Join(dir, "tensorleap.yaml")
+
+	writeTestFile(t, configPath, "version: v2\n")
+	_, err := LoadInstallConfig(configPath)
+	assert.ErrorContains(t, err, "unsupported version")
+
+	writeTestFile(t, configPath, "version: v1\nprot: 80\n")
+	_, err = LoadInstallConfig(configPath)
+	assert.ErrorContains(t, err, "field prot not found")
+}
+
+func TestValidateInstallFlags(t *testing.T) {
+	dir := t.TempDir()
+	notDir := path.Join(dir, "file")
+	require.NoError(t, os.WriteFile(notDir, []byte("x"), 0644))
+
+	_, flags, source := newTestInstallFlags(t)
+	flags.Port = 0
+	flags.RegistryPort = DefaultHttpPort
+	flags.CpuLimit = "two"
+	flags.DatasetVolumes = []string{"relative/path", notDir, "/a:/b:/c", path.Join(dir, "new") + ":/data"}
+	flags.CertPath = path.Join(dir, "missing.crt")
+	flags.KeyPath = notDir
+	flags.ProxyUrl = "proxy"
+	source.Tag = "tensorleap-1.2.3"
+	source.Local = true
+
+	err := ValidateInstallFlags(flags, source)
+	require.Error(t, err)
+	for _, expected := range []string{
+		"port: 0 is not a valid port",
+		"cpu-limit: invalid CPU limit: two",
+		"paths must be absolute",
+		"is not a directory",
+		"expected <host path>[:<container path>]",
+		"cert: open",
+		"key: " + notDir + " is not a PEM file",
+		"proxy-url: invalid url",
+		"source: only one of tag, airgap and local can be set",
+	} {
+		assert.ErrorContains(t, err, expected)
+	}
+	assert.NotContains(t, err.Error(), path.Join(dir, "new"), "missing volume dirs are created on install")
+}
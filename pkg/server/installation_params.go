@@ -7,6 +7,7 @@ import (
 	"path"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/AlecAivazis/survey/v2"
 	"github.com/tensorleap/helm-charts/pkg/helm"
@@ -14,6 +15,7 @@ import (
 	"github.com/tensorleap/helm-charts/pkg/local"
 	"github.com/tensorleap/helm-charts/pkg/log"
 	"github.com/tensorleap/helm-charts/pkg/version"
+	"github.com/tensorleap/helm-charts/pkg/zot"
 	"gopkg.in/yaml.v3"
 )
 
@@ -42,6 +44,14 @@ type InstallationParams struct {
 	DisabledAuth                bool                   `json:"disabledAuth,omitempty"`
 	IsAirgap                    bool                   `json:"isAirgap,omitempty"`
 	ImageCachingMethod          k3d.ImageCachingMethod `json:"imageCachingMethod,omitempty"`
+	// DiskPressureCleanup prunes the images not in the manifest when the node reports DiskPressure during helm operations
+	DiskPressureCleanup bool `json:"diskPressureCleanup,omitempty" yaml:"diskPressureCleanup,omitempty"`
+	// WatchdogGracePeriod is how long pods may fail during helm operations before the install stops, 0 for the default
+	WatchdogGracePeriod time.Duration `json:"watchdogGracePeriod,omitempty" yaml:"watchdogGracePeriod,omitempty"`
+	// RegistryRetention limits the images kept in the preserved engine-generic repos of the registry
+	RegistryRetention *zot.RetentionPolicy `json:"registryRetention,omitempty" yaml:"registryRetention,omitempty"`
+	// AirgapPack is the pack the airgap images are pushed from into the registry, it is given on every run and not saved
+	AirgapPack string `json:"-" yaml:"-"`
 	TLSParams
 }
 
@@ -239,6 +249,9 @@ func InitInstallationParamsFromFlags(flags *InstallFlags, isAirgap bool) (*Insta
 		if isDisabledAuthNotSet {
 			flags.DisableAuth = &previousParams.DisabledAuth
 		}
+		if flags.DiskPressureCleanup == nil {
+			flags.DiskPressureCleanup = &previousParams.DiskPressureCleanup
+		}
 	}
 	if flags.ClearInstallationImages == nil {
 		flags.ClearInstallationImages = new(bool)
@@ -248,6 +261,10 @@ func InitInstallationParamsFromFlags(flags *InstallFlags, isAirgap bool) (*Insta
 		flags.DisableAuth = new(bool)
 	}
 
+	if flags.DiskPressureCleanup == nil {
+		flags.DiskPressureCleanup = new(bool)
+	}
+
 	warnIfPlaintextOnRealDomain(flags.Domain, tlsParams.Enabled)
 
 	imageCachingMethod, err := initImageCachingMethod(isAirgap, previousParams, flags.ImageCachingMethod)
@@ -255,6 +272,11 @@ func InitInstallationParamsFromFlags(flags *InstallFlags, isAirgap bool) (*Insta
 		return nil, err
 	}
 
+	var registryRetention *zot.RetentionPolicy
+	if hasInstallationParams {
+		registryRetention = previousParams.RegistryRetention
+	}
+
 	return &InstallationParams{
 		Version:                 CurrentInstallationVersion,
 		Gpus:                    flags.Gpus,
@@ -274,6 +296,9 @@ func InitInstallationParamsFromFlags(flags *InstallFlags, isAirgap bool) (*Insta
 		DisabledAuth:            *flags.DisableAuth,
 		IsAirgap:                isAirgap,
 		ImageCachingMethod:      imageCachingMethod,
+		DiskPressureCleanup:     *flags.DiskPressureCleanup,
+		WatchdogGracePeriod:     flags.WatchdogGracePeriod,
+		RegistryRetention:       registryRetention,
 	}, nil
 }
 
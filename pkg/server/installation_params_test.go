@@ -4,6 +4,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/tensorleap/helm-charts/pkg/zot"
+	"gopkg.in/yaml.v3"
 )
 
 func TestGetCreateK3sClusterParams(t *testing.T) {
@@ -122,3 +124,18 @@ func TestGetEngineProxyEnv(t *testing.T) {
 		assert.Equal(t, "http://lower:3128", env["http_proxy"])
 	})
 }
+
+func TestRegistryRetentionRoundTrip(t *testing.T) {
+	params := InstallationParams{Version: "v1", RegistryRetention: &zot.RetentionPolicy{KeepLast: 5, MaxSizeGb: 20}}
+	b, err := yaml.Marshal(&params)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), "registryRetention:\n    keepLast: 5\n    maxSizeGb: 20\n")
+
+	loaded, err := LoadInstallationParams(b)
+	assert.NoError(t, err)
+	assert.Equal(t, params.RegistryRetention, loaded.RegistryRetention)
+
+	loaded, err = LoadInstallationParams([]byte("version: v1\n"))
+	assert.NoError(t, err)
+	assert.True(t, loaded.RegistryRetention.IsEmpty())
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/tensorleap/helm-charts/pkg/log"
+)
+
+// ExitCodeInterrupted is the exit code of a command stopped by Ctrl-C or SIGTERM, the code shells use for SIGINT
+const ExitCodeInterrupted = 130
+
+// NotifyInterrupt returns a context that is canceled with ErrInterrupted on the first Ctrl-C or SIGTERM, so the
+// running command stops, rolls back what it started and removes its temp files. A second signal kills the process.
+// stop must be called when the command is done.
+func NotifyInterrupt(parent context.Context) (ctx context.Context, stop func()) {
+	ctx, cancel := context.WithCancelCause(parent)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-signals:
+			signal.Stop(signals)
+			log.Warnf("Received %s, stopping and cleaning up, press Ctrl-C again to quit immediately", sig)
+			cancel(ErrInterrupted)
+		case <-done:
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(signals)
+		close(done)
+		cancel(nil)
+	}
+}
+
+// IsInterrupted reports whether ctx was canceled by NotifyInterrupt
+func IsInterrupted(ctx context.Context) bool {
+	return context.Cause(ctx) == ErrInterrupted
+}
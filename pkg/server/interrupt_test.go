@@ -0,0 +1,31 @@
+package server
+
+import (
+	"context"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotifyInterrupt(t *testing.T) {
+	ctx, stop := NotifyInterrupt(context.Background())
+	defer stop()
+	assert.False(t, IsInterrupted(ctx))
+
+	require.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGTERM))
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("context was not canceled by the signal")
+	}
+	assert.True(t, IsInterrupted(ctx))
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
+
+	ctx, stop = NotifyInterrupt(context.Background())
+	stop()
+	assert.Error(t, ctx.Err())
+	assert.False(t, IsInterrupted(ctx))
+}
@@ -132,3 +132,9 @@ func toMap(v interface{}) map[string]interface{} {
 	}
 	return m
 }
+
+func TestSortTagsByVersion(t *testing.T) {
+	tags := []string{"manifest-1.2.10", "latest", "manifest-1.10.0", "manifest-1.2.9", "manifest-1.3.0-rc.1", "manifest-1.3.0"}
+	SortTagsByVersion(tags)
+	assert.Equal(t, []string{"manifest-1.10.0", "manifest-1.3.0", "manifest-1.3.0-rc.1", "manifest-1.2.10", "manifest-1.2.9", "latest"}, tags)
+}
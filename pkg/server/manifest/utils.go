@@ -5,8 +5,10 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 
+	"github.com/Masterminds/semver/v3"
 	"github.com/tensorleap/helm-charts/pkg/github"
 	"github.com/tensorleap/helm-charts/pkg/helm/chart"
 	"github.com/tensorleap/helm-charts/pkg/version"
@@ -28,6 +30,9 @@ const (
 	checkDockerRequirement = "alpine:3.18.3"
 )
 
+// ServerChartName is the name of the server chart, also its helm cache dir
+const ServerChartName = tensorleapChartName
+
 var (
 	k3sImage    = fmt.Sprintf("docker.io/rancher/k3s:%s", k3sVersion)
 	k3sGpuImage = fmt.Sprintf("public.ecr.aws/tensorleap/k3s:%s-cuda-11.8.0-ubuntu-22.04-v1", k3sVersion)
@@ -80,6 +85,44 @@ func GetLatestManifestTag() (string, error) {
 	return latest, nil
 }
 
+// ListManifestTags returns the tags of all the manifest releases, newest version first
+func ListManifestTags() ([]string, error) {
+	releases, err := github.GetAllReleases(tlOwner, tlRepo)
+	if err != nil {
+		return nil, err
+	}
+	tags := []string{}
+	for _, release := range releases {
+		if manifestTagReg.MatchString(release.TagName) {
+			tags = append(tags, release.TagName)
+		}
+	}
+	SortTagsByVersion(tags)
+	return tags, nil
+}
+
+// SortTagsByVersion sorts tags by the semver in them, newest first, tags without a version go last
+func SortTagsByVersion(tags []string) {
+	versions := make(map[string]*semver.Version, len(tags))
+	for _, tag := range tags {
+		if v, err := semver.NewVersion(GetHelmVersionFromTag(tag)); err == nil {
+			versions[tag] = v
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool {
+		a, b := versions[tags[i]], versions[tags[j]]
+		if a == nil || b == nil {
+			return a != nil
+		}
+		return a.GreaterThan(b)
+	})
+}
+
+// GetManifestTagOfServerChart returns the tag of the manifest released with the server chart version
+func GetManifestTagOfServerChart(serverChartVersion string) string {
+	return fmt.Sprintf("manifest-%s", serverChartVersion)
+}
+
 var serverHelmTagReg = regexp.MustCompile(`tensorleap-\d+\.\d+\.\d+`)
 
 func GetLatestServerHelmChartTag() (latestServerTag string, err error) {
@@ -0,0 +1,223 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/tensorleap/helm-charts/pkg/helm"
+	"github.com/tensorleap/helm-charts/pkg/k3d"
+	"github.com/tensorleap/helm-charts/pkg/server/manifest"
+)
+
+type FieldChange struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// DiffFields compares two structs of the same type field by field
+func DiffFields(from, to interface{}) []FieldChange {
+	changes := []FieldChange{}
+	fromValue, toValue := reflect.Indirect(reflect.ValueOf(from)), reflect.Indirect(reflect.ValueOf(to))
+	for i := 0; i < fromValue.NumField(); i++ {
+		field := fromValue.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		a, b := fromValue.Field(i).Interface(), toValue.Field(i).Interface()
+		if !reflect.DeepEqual(a, b) {
+			changes = append(changes, FieldChange{Field: field.Name, From: formatFieldValue(a), To: formatFieldValue(b)})
+		}
+	}
+	return changes
+}
+
+func formatFieldValue(value interface{}) string {
+	v := reflect.ValueOf(value)
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return ""
+		}
+		return fmt.Sprint(v.Elem().Interface())
+	}
+	return fmt.Sprint(value)
+}
+
+type ReleaseAction string
+
+const (
+	ReleaseActionInstall   ReleaseAction = "install"
+	ReleaseActionUpgrade   ReleaseAction = "upgrade"
+	ReleaseActionReinstall ReleaseAction = "reinstall"
+	ReleaseActionKeep      ReleaseAction = "keep"
+)
+
+type ReleasePlan struct {
+	Name        string        `json:"name"`
+	FromVersion string        `json:"fromVersion,omitempty"`
+	ToVersion   string        `json:"toVersion"`
+	Action      ReleaseAction `json:"action"`
+}
+
+// InstallPlan describes what an install or upgrade would change, without changing anything
+type InstallPlan struct {
+	FromTag              string        `json:"fromTag,omitempty"`
+	ToTag                string        `json:"toTag"`
+	FromAppVersion       string        `json:"fromAppVersion,omitempty"`
+	ToAppVersion         string        `json:"toAppVersion"`
+	FromK3sImage         string        `json:"fromK3sImage,omitempty"`
+	ToK3sImage           string        `json:"toK3sImage"`
+	ClusterExists        bool          `json:"clusterExists"`
+	ClusterRunning       bool          `json:"clusterRunning"`
+	ClusterParamsChanges []FieldChange `json:"clusterParamsChanges"`
+	InfraValuesChanges   []FieldChange `json:"infraValuesChanges"`
+	ImagesToDownload     []string      `json:"imagesToDownload"`
+	Releases             []ReleasePlan `json:"releases"`
+	Reinstall            bool          `json:"reinstall"`
+	ReinstallReasons     []string      `json:"reinstallReasons"`
+	Warnings             []string      `json:"warnings,omitempty"`
+}
+
+// PlanInstallation resolves what installing mnf with installationParams would do.
+// Unlike the install itself it never starts the cluster, so helm state is only checked on a running cluster.
+func PlanInstallation(ctx context.Context, mnf, previousMnf *manifest.InstallationManifest, installationParams, previousParams *InstallationParams) (*InstallPlan, error) {
+	plan := &InstallPlan{
+		ToTag:                mnf.Tag,
+		ToAppVersion:         mnf.AppVersion,
+		ToK3sImage:           GetClusterK3sImage(mnf, installationParams),
+		ClusterParamsChanges: []FieldChange{},
+		InfraValuesChanges:   []FieldChange{},
+		ReinstallReasons:     []string{},
+	}
+	if err := ValidateInstallerVersion(mnf.InstallerVersion); err != nil {
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf("installer version %s of the manifest is not supported by this CLI: %v", mnf.InstallerVersion, err))
+	}
+
+	var prevImages []string
+	if previousMnf != nil && previousParams != nil {
+		plan.FromTag = previousMnf.Tag
+		plan.FromAppVersion = previousMnf.AppVersion
+		plan.FromK3sImage = GetClusterK3sImage(previousMnf, previousParams)
+		plan.ClusterParamsChanges = DiffFields(previousParams.GetCreateK3sClusterParams(), installationParams.GetCreateK3sClusterParams())
+		plan.InfraValuesChanges = DiffFields(
+			previousParams.GetInfraHelmValuesParams(k3d.BuildZotSyncRegistries(previousMnf), previousMnf.Images.Zot),
+			installationParams.GetInfraHelmValuesParams(k3d.BuildZotSyncRegistries(mnf), mnf.Images.Zot),
+		)
+		prevImages = requiredImages(previousMnf, previousParams.IsUseGpu())
+	}
+	plan.ImagesToDownload = subtractImages(requiredImages(mnf, installationParams.IsUseGpu()), prevImages)
+
+	cluster, err := k3d.GetCluster(ctx)
+	if err != nil {
+		return nil, err
+	}
+	plan.ClusterExists = cluster != nil
+	resuming := plan.ClusterExists && IsResumableInstall(mnf, installationParams)
+	if resuming {
+		plan.Warnings = append(plan.Warnings, "an unfinished install of the cluster is resumed, its completed phases are skipped")
+	}
+	if plan.ClusterExists {
+		running, _ := cluster.ServerCountRunning()
+		plan.ClusterRunning = running > 0
+		if resuming && (previousMnf == nil || previousParams == nil) {
+			// the cluster was created by the unfinished install, nothing to compare with
+		} else if previousMnf == nil || previousParams == nil {
+			plan.ReinstallReasons = append(plan.ReinstallReasons, "cluster exists without a saved installation manifest and params")
+		} else {
+			plan.ReinstallReasons = append(plan.ReinstallReasons, GetReinstallReasons(mnf, previousMnf, installationParams, previousParams)...)
+		}
+	}
+
+	currentVersions := map[string]string{}
+	if plan.ClusterRunning {
+		helmReason, versions, err := planHelmReleases(ctx, cluster, mnf, resuming)
+		if err == ErrOldManifest {
+			plan.Warnings = append(plan.Warnings, "the target charts are older than the deployed ones, helm cannot downgrade them in place")
+		} else if err != nil {
+			return nil, err
+		}
+		if helmReason != "" {
+			plan.ReinstallReasons = append(plan.ReinstallReasons, helmReason)
+		}
+		currentVersions = versions
+	} else if plan.ClusterExists {
+		plan.Warnings = append(plan.Warnings, "cluster is stopped, the deployed helm releases were not checked (the install starts it and checks them)")
+		if previousMnf != nil {
+			currentVersions[previousMnf.InfraHelmChart.ReleaseName] = previousMnf.InfraHelmChart.Version
+			currentVersions[previousMnf.ServerHelmChart.ReleaseName] = previousMnf.ServerHelmChart.Version
+		}
+	}
+	plan.Reinstall = len(plan.ReinstallReasons) > 0
+
+	for _, chartMeta := range []manifest.HelmChartMeta{mnf.InfraHelmChart, mnf.ServerHelmChart} {
+		release := ReleasePlan{Name: chartMeta.ReleaseName, FromVersion: currentVersions[chartMeta.ReleaseName], ToVersion: chartMeta.Version}
+		switch {
+		case plan.Reinstall:
+			release.Action = ReleaseActionReinstall
+		case release.FromVersion == "":
+			release.Action = ReleaseActionInstall
+		case chartMeta.ReleaseName == mnf.InfraHelmChart.ReleaseName:
+			// the infra release is only installed when missing
+			release.Action = ReleaseActionKeep
+		default:
+			release.Action = ReleaseActionUpgrade
+		}
+		plan.Releases = append(plan.Releases, release)
+	}
+	return plan, nil
+}
+
+func planHelmReleases(ctx context.Context, cluster *k3d.Cluster, mnf *manifest.InstallationManifest, resuming bool) (string, map[string]string, error) {
+	kubeConfigPath, clean, err := k3d.CreateTmpClusterKubeConfig(ctx, cluster)
+	if err != nil {
+		return "", nil, err
+	}
+	defer clean()
+
+	helmConfig, err := helm.CreateHelmConfig(ctx, kubeConfigPath, KUBE_CONTEXT, KUBE_NAMESPACE)
+	if err != nil {
+		return "", nil, err
+	}
+	versions := map[string]string{}
+	for _, releaseName := range []string{mnf.InfraHelmChart.ReleaseName, mnf.ServerHelmChart.ReleaseName} {
+		version, err := helm.GetHelmReleaseVersion(helmConfig, releaseName)
+		if err != nil && err != helm.ErrNoRelease {
+			return "", nil, err
+		}
+		versions[releaseName] = version
+	}
+	reason, err := helmReinstallReason(helmConfig, mnf, resuming)
+	return reason, versions, err
+}
+
+// requiredImages are the images a cluster of the manifest pulls
+func requiredImages(mnf *manifest.InstallationManifest, useGpu bool) []string {
+	images := []string{}
+	if useGpu {
+		images = append(images, mnf.Images.K3sGpu)
+		images = append(images, mnf.Images.K3sGpuImages...)
+	} else {
+		images = append(images, mnf.Images.K3s)
+		images = append(images, mnf.Images.K3sImages...)
+	}
+	if mnf.Images.Zot != "" {
+		images = append(images, mnf.Images.Zot)
+	}
+	return append(images, mnf.Images.ServerImages...)
+}
+
+func subtractImages(images, existing []string) []string {
+	existingSet := map[string]bool{}
+	for _, image := range existing {
+		existingSet[image] = true
+	}
+	result := []string{}
+	for _, image := range images {
+		if !existingSet[image] {
+			result = append(result, image)
+			existingSet[image] = true
+		}
+	}
+	return result
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tensorleap/helm-charts/pkg/k3d"
+	"github.com/tensorleap/helm-charts/pkg/server/manifest"
+)
+
+func TestDiffFields(t *testing.T) {
+	tlsPort := uint(443)
+	from := &k3d.CreateK3sClusterParams{Port: 4589, Volumes: []string{"/a:/a"}}
+	to := &k3d.CreateK3sClusterParams{Port: 8080, Volumes: []string{"/a:/a"}, TLSPort: &tlsPort}
+
+	assert.Equal(t, []FieldChange{
+		{Field: "Port", From: "4589", To: "8080"},
+		{Field: "TLSPort", From: "", To: "443"},
+	}, DiffFields(from, to))
+	assert.Empty(t, DiffFields(from, from))
+}
+
+func TestGetReinstallReasons(t *testing.T) {
+	mnf := func(appVersion, k3s string) *manifest.InstallationManifest {
+		return &manifest.InstallationManifest{AppVersion: appVersion, Images: manifest.ManifestImages{InstallationImages: manifest.InstallationImages{K3s: k3s, K3sGpu: "k3s-gpu:1"}}}
+	}
+	params := func() *InstallationParams {
+		return &InstallationParams{Port: DefaultHttpPort, DatasetVolumes: []string{"/data:/data"}}
+	}
+
+	assert.Empty(t, GetReinstallReasons(mnf("1.0", "k3s:1"), mnf("1.0", "k3s:1"), params(), params()))
+
+	reasons := GetReinstallReasons(mnf("1.1", "k3s:2"), mnf("1.0", "k3s:1"), params(), params())
+	assert.Equal(t, []string{"k3s image changes from k3s:1 to k3s:2", "app version changes from 1.0 to 1.1"}, reasons)
+
+	gpuParams := params()
+	gpuParams.Gpus = 1
+	reasons = GetReinstallReasons(mnf("1.0", "k3s:1"), mnf("1.0", "k3s:1"), gpuParams, params())
+	assert.Contains(t, reasons, "k3s image changes from k3s:1 to k3s-gpu:1")
+	assert.Contains(t, reasons, "infra helm value NvidiaGpuEnable changes")
+	assert.Contains(t, reasons, "cluster param WithGpu changes")
+}
+
+func TestSubtractImages(t *testing.T) {
+	assert.Equal(t, []string{"b", "c"}, subtractImages([]string{"a", "b", "c", "b"}, []string{"a"}))
+	assert.Equal(t, []string{"a"}, subtractImages([]string{"a"}, nil))
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"net/url"
+	"strings"
+)
+
+const redactedValue = "<redacted>"
+
+var sensitiveKeyParts = []string{"password", "secret", "token", "cert", "key", "credentials", "apikey"}
+
+// isSensitiveKey matches keys like "password", "tlsKey" or "clientSecret"
+func isSensitiveKey(key string) bool {
+	lower := strings.ToLower(key)
+	for _, part := range sensitiveKeyParts {
+		if strings.Contains(lower, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactSecrets returns a copy of a decoded yaml/json value where scalar values of
+// sensitive keys and passwords embedded in URLs are replaced
+func RedactSecrets(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			if isSensitiveKey(key) && isScalar(item) {
+				out[key] = redactScalar(item)
+				continue
+			}
+			out[key] = RedactSecrets(item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = RedactSecrets(item)
+		}
+		return out
+	case string:
+		return redactURLPassword(v)
+	}
+	return value
+}
+
+func isScalar(value interface{}) bool {
+	switch value.(type) {
+	case map[string]interface{}, []interface{}:
+		return false
+	}
+	return true
+}
+
+// redactScalar keeps empty values and booleans so the output still shows what is configured
+func redactScalar(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil, bool:
+		return v
+	case string:
+		if v == "" {
+			return v
+		}
+	}
+	return redactedValue
+}
+
+func redactURLPassword(value string) string {
+	if !strings.Contains(value, "@") || !strings.Contains(value, "://") {
+		return value
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.User == nil {
+		return value
+	}
+	if _, hasPassword := u.User.Password(); !hasPassword {
+		return value
+	}
+	u.User = url.UserPassword(u.User.Username(), redactedValue)
+	// url.String escapes the placeholder, keep it readable
+	return strings.Replace(u.String(), url.PathEscape(redactedValue), redactedValue, 1)
+}
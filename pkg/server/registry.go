@@ -0,0 +1,59 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/tensorleap/helm-charts/pkg/docker"
+	"github.com/tensorleap/helm-charts/pkg/local"
+	"github.com/tensorleap/helm-charts/pkg/log"
+	"github.com/tensorleap/helm-charts/pkg/server/manifest"
+	"github.com/tensorleap/helm-charts/pkg/zot"
+)
+
+// GetRegistryURL is the url of the in-cluster Zot registry from the host
+func GetRegistryURL() string {
+	return fmt.Sprintf("http://127.0.0.1:%d", GetSavedRegistryPort())
+}
+
+// CheckRegistryReachable fails with a hint when Zot does not answer, usually because the server is stopped
+func CheckRegistryReachable() error {
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(GetRegistryURL() + "/v2/")
+	if err != nil {
+		return fmt.Errorf("registry is not reachable at %s, make sure the server is running (leap server run): %w", GetRegistryURL(), err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// IsManifestImageRef reports whether a Zot repo and tag is one of the images of the installed manifest
+func IsManifestImageRef(repo, tag string) bool {
+	mnf, err := manifest.Load(local.GetInstallationManifestPath())
+	if err != nil {
+		return false
+	}
+	for _, image := range mnf.GetAllImages() {
+		imageRepo, imageTag, err := zot.ParseRef(image)
+		if err == nil && imageRepo == repo && imageTag == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// PushImageToRegistry pushes a local docker image into Zot as repo:tag, and returns the name pods pull it with
+func PushImageToRegistry(ctx context.Context, image, repo, tag string) (string, error) {
+	dockerClient, err := docker.NewClient()
+	if err != nil {
+		return "", err
+	}
+	target := fmt.Sprintf("127.0.0.1:%d/%s:%s", GetSavedRegistryPort(), repo, tag)
+	log.Infof("Pushing %s to the registry as %s:%s", image, repo, tag)
+	if err := docker.PushImage(ctx, dockerClient, image, target); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/%s:%s", zot.InClusterRegistryHost, repo, tag), nil
+}
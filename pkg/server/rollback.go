@@ -0,0 +1,240 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/tensorleap/helm-charts/pkg/helm"
+	"github.com/tensorleap/helm-charts/pkg/helm/chart"
+	"github.com/tensorleap/helm-charts/pkg/k3d"
+	"github.com/tensorleap/helm-charts/pkg/local"
+	"github.com/tensorleap/helm-charts/pkg/log"
+	"github.com/tensorleap/helm-charts/pkg/server/manifest"
+)
+
+var ErrRollbackNeedsBackup = errors.New("rolling back across app versions requires a data backup")
+
+type RollbackOptions struct {
+	// ToTag selects the newest history entry of this tag, the newest entry when empty
+	ToTag string
+	// BackupPath is a backup taken on the target app version, restored before the target version starts
+	BackupPath string
+	// AirgapPackPath is the pack of the target tag, required for airgap installations
+	AirgapPackPath string
+}
+
+type RollbackMethod string
+
+const (
+	RollbackMethodHelm      RollbackMethod = "helm-rollback"
+	RollbackMethodUpgrade   RollbackMethod = "helm-upgrade"
+	RollbackMethodReinstall RollbackMethod = "reinstall"
+)
+
+type RollbackPlan struct {
+	Entry        *InstallationHistoryEntry
+	CurrentMnf   *manifest.InstallationManifest
+	TargetMnf    *manifest.InstallationManifest
+	TargetParams *InstallationParams
+	Method       RollbackMethod
+	HelmRevision int
+	// InfraHelmRevision is the infra release revision to roll back to, 0 when the infra chart did not change
+	InfraHelmRevision int
+	BackupPath        string
+	isAirgap          bool
+	infraChart        *chart.Chart
+	serverChart       *chart.Chart
+}
+
+// PlanRollback resolves the rollback target, validates it and decides how it will be applied
+func PlanRollback(ctx context.Context, opts RollbackOptions) (*RollbackPlan, error) {
+	currentMnf, err := manifest.Load(local.GetInstallationManifestPath())
+	if err != nil {
+		return nil, err
+	}
+	currentParams, err := LoadInstallationParamsFromPrevious()
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := FindInstallationHistoryEntry(opts.ToTag)
+	if err != nil {
+		return nil, err
+	}
+	targetMnf, targetParams, err := entry.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed loading installation history entry %s: %w", entry.ID, err)
+	}
+	if err := ValidateInstallerVersion(targetMnf.InstallerVersion); err != nil {
+		return nil, err
+	}
+
+	plan := &RollbackPlan{
+		Entry:        entry,
+		CurrentMnf:   currentMnf,
+		TargetMnf:    targetMnf,
+		TargetParams: targetParams,
+		BackupPath:   opts.BackupPath,
+	}
+
+	if targetMnf.AppVersion != currentMnf.AppVersion {
+		if err := validateRollbackBackup(opts.BackupPath, currentMnf, targetMnf); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := plan.loadCharts(ctx, opts.AirgapPackPath); err != nil {
+		return nil, err
+	}
+
+	needsReinstall, err := IsNeedsToReinstall(ctx, targetMnf, currentMnf, targetParams, currentParams)
+	if err != nil && err != ErrOldManifest {
+		return nil, err
+	}
+	// ErrOldManifest means the charts go back a minor version, helm cannot downgrade those in place.
+	// A backup is restored while there is no cluster, so no workload of either version runs on the data meanwhile.
+	if needsReinstall || err == ErrOldManifest || plan.isAirgap || plan.BackupPath != "" {
+		plan.Method = RollbackMethodReinstall
+		return plan, nil
+	}
+
+	plan.Method = RollbackMethodUpgrade
+	infraChanged := targetMnf.InfraHelmChart.Version != currentMnf.InfraHelmChart.Version
+	serverRevision, infraRevision, err := findRollbackRevisions(ctx, targetMnf, infraChanged)
+	if err != nil {
+		return nil, err
+	}
+	// both releases go back together, otherwise the target charts are upgraded onto the cluster
+	if serverRevision > 0 && (!infraChanged || infraRevision > 0) {
+		plan.Method = RollbackMethodHelm
+		plan.HelmRevision = serverRevision
+		plan.InfraHelmRevision = infraRevision
+	}
+	return plan, nil
+}
+
+func validateRollbackBackup(backupPath string, currentMnf, targetMnf *manifest.InstallationManifest) error {
+	if backupPath == "" {
+		return fmt.Errorf("%w: the data may have been migrated by app version %s and cannot be used by app version %s, pass --backup with a backup taken on tag %s",
+			ErrRollbackNeedsBackup, currentMnf.AppVersion, targetMnf.AppVersion, targetMnf.Tag)
+	}
+	meta, err := ReadBackupMetadata(backupPath)
+	if err != nil {
+		return err
+	}
+	if meta.AppVersion != targetMnf.AppVersion {
+		return fmt.Errorf("%w: backup %s was taken on app version %s but the rollback target is app version %s",
+			ErrRollbackNeedsBackup, backupPath, meta.AppVersion, targetMnf.AppVersion)
+	}
+	return nil
+}
+
+func (plan *RollbackPlan) loadCharts(ctx context.Context, airgapPackPath string) (err error) {
+	plan.isAirgap = plan.TargetParams.IsAirgap
+	// images of older tags were pruned from the cluster, so airgap rollbacks reinstall from the pack
+	plan.TargetMnf, plan.infraChart, plan.serverChart, err = loadInstallationCharts(ctx, plan.TargetMnf, plan.isAirgap, airgapPackPath)
+	plan.TargetParams.AirgapPack = airgapPackPath
+	return err
+}
+
+// findRollbackRevisions returns the server and infra release revisions of the target versions, 0 when not found.
+// The infra release is only looked up when its chart changed.
+func findRollbackRevisions(ctx context.Context, targetMnf *manifest.InstallationManifest, infraChanged bool) (serverRevision, infraRevision int, err error) {
+	cluster, err := k3d.GetCluster(ctx)
+	if err != nil || cluster == nil {
+		return 0, 0, err
+	}
+	kubeConfigPath, clean, err := k3d.CreateTmpClusterKubeConfig(ctx, cluster)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer clean()
+
+	helmConfig, err := helm.CreateHelmConfig(ctx, kubeConfigPath, KUBE_CONTEXT, KUBE_NAMESPACE)
+	if err != nil {
+		return 0, 0, err
+	}
+	serverRevision, err = helm.FindRevisionByChartVersion(helmConfig, targetMnf.ServerHelmChart.ReleaseName, targetMnf.ServerHelmChart.Version)
+	if err != nil || !infraChanged {
+		return serverRevision, 0, err
+	}
+	infraRevision, err = helm.FindRevisionByChartVersion(helmConfig, targetMnf.InfraHelmChart.ReleaseName, targetMnf.InfraHelmChart.Version)
+	return serverRevision, infraRevision, err
+}
+
+// ExecuteRollback applies the plan and saves the target as the current installation. A backup is restored after
+// the cluster is removed and before the target version is installed on it.
+func ExecuteRollback(ctx context.Context, plan *RollbackPlan) (*InstallationResult, error) {
+	log.SendCloudReport("info", "Starting rollback", "Starting", &map[string]interface{}{
+		"from": plan.CurrentMnf.Tag, "to": plan.TargetMnf.Tag, "method": plan.Method,
+	})
+
+	var result *InstallationResult
+	var err error
+	switch plan.Method {
+	case RollbackMethodReinstall:
+		result, err = reinstallForRollback(ctx, plan)
+	case RollbackMethodUpgrade:
+		result, err = Install(ctx, plan.TargetMnf, plan.isAirgap, plan.TargetParams, plan.infraChart, plan.serverChart)
+	case RollbackMethodHelm:
+		result, err = helmRollback(ctx, plan)
+	default:
+		err = fmt.Errorf("unknown rollback method %s", plan.Method)
+	}
+	if err != nil {
+		log.SendCloudReport("error", "Failed rollback", "Failed", &map[string]interface{}{"error": err.Error()})
+		return nil, err
+	}
+
+	log.SendCloudReport("info", "Successfully completed rollback", "Success", nil)
+	return result, nil
+}
+
+// reinstallForRollback is Reinstall with the backup restored between removing the cluster and installing the target
+func reinstallForRollback(ctx context.Context, plan *RollbackPlan) (*InstallationResult, error) {
+	if err := Uninstall(ctx, false, false, false); err != nil {
+		return nil, err
+	}
+	if plan.BackupPath != "" {
+		log.Infof("Restoring data from %s", plan.BackupPath)
+		if _, err := Restore(ctx, plan.BackupPath, RestoreOptions{TargetMnf: plan.TargetMnf}); err != nil {
+			return nil, fmt.Errorf("failed restoring the backup, the cluster was removed and the data was kept: %w", err)
+		}
+	}
+	result, err := Install(ctx, plan.TargetMnf, plan.isAirgap, plan.TargetParams, plan.infraChart, plan.serverChart)
+	if err != nil {
+		return nil, err
+	}
+	log.SendCloudReport("info", "Successfully completed reinstall", "Success", nil)
+	return result, nil
+}
+
+func helmRollback(ctx context.Context, plan *RollbackPlan) (*InstallationResult, error) {
+	cluster, err := k3d.GetCluster(ctx)
+	if err != nil {
+		return nil, err
+	}
+	kubeConfigPath, clean, err := k3d.CreateTmpClusterKubeConfig(ctx, cluster)
+	if err != nil {
+		return nil, err
+	}
+	defer clean()
+
+	helmConfig, err := helm.CreateHelmConfig(ctx, kubeConfigPath, KUBE_CONTEXT, KUBE_NAMESPACE)
+	if err != nil {
+		return nil, err
+	}
+	if plan.InfraHelmRevision > 0 {
+		if err := helm.RollbackChart(helmConfig, plan.TargetMnf.InfraHelmChart.ReleaseName, plan.InfraHelmRevision); err != nil {
+			return nil, err
+		}
+	}
+	if err := helm.RollbackChart(helmConfig, plan.TargetMnf.ServerHelmChart.ReleaseName, plan.HelmRevision); err != nil {
+		return nil, err
+	}
+	if err := SaveInstallation(plan.TargetMnf, plan.TargetParams); err != nil {
+		return nil, err
+	}
+	return plan.TargetParams.GetInstallationResult(), nil
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/tensorleap/helm-charts/pkg/helm"
+	"github.com/tensorleap/helm-charts/pkg/k3d"
+	"github.com/tensorleap/helm-charts/pkg/k8s"
+	"github.com/tensorleap/helm-charts/pkg/local"
+	"github.com/tensorleap/helm-charts/pkg/server/manifest"
+)
+
+type ClusterStatus struct {
+	Exists         bool `json:"exists"`
+	Running        bool `json:"running"`
+	ServersRunning int  `json:"serversRunning"`
+	ServersTotal   int  `json:"serversTotal"`
+}
+
+type ReleaseStatus struct {
+	Name            string `json:"name"`
+	Version         string `json:"version,omitempty"`
+	ManifestVersion string `json:"manifestVersion"`
+	// Revision is the helm revision of the latest release
+	Revision int    `json:"revision,omitempty"`
+	Status   string `json:"status,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ServerStatus combines the saved installation with the live state of the cluster
+type ServerStatus struct {
+	Installed        bool                `json:"installed"`
+	Tag              string              `json:"tag,omitempty"`
+	AppVersion       string              `json:"appVersion,omitempty"`
+	InstallerVersion string              `json:"installerVersion,omitempty"`
+	Installation     *InstallationResult `json:"installation,omitempty"`
+	GpuDevices       string              `json:"gpuDevices,omitempty"`
+	Gpus             uint                `json:"gpus,omitempty"`
+	Cluster          ClusterStatus       `json:"cluster"`
+	Releases         []ReleaseStatus     `json:"releases,omitempty"`
+	Workloads        []k8s.Workload      `json:"workloads,omitempty"`
+	Errors           []string            `json:"errors,omitempty"`
+}
+
+// GetServerStatus collects the installation status, live state that cannot be read is reported in Errors
+func GetServerStatus(ctx context.Context) (*ServerStatus, error) {
+	status := &ServerStatus{}
+
+	mnf, err := manifest.Load(local.GetInstallationManifestPath())
+	if err != nil && err != manifest.ErrManifestNotFound {
+		return nil, err
+	}
+	params, err := LoadInstallationParamsFromPrevious()
+	if err != nil && err != ErrNoInstallationParams {
+		return nil, err
+	}
+
+	if mnf != nil {
+		status.Installed = true
+		status.Tag = mnf.Tag
+		status.AppVersion = mnf.AppVersion
+		status.InstallerVersion = mnf.InstallerVersion
+	}
+	if params != nil {
+		status.Installation = params.GetInstallationResult()
+		status.Gpus = params.Gpus
+		status.GpuDevices = params.GpuDevices
+	}
+
+	cluster, err := k3d.GetCluster(ctx)
+	if err != nil {
+		status.Errors = append(status.Errors, fmt.Sprintf("failed to get cluster: %s", err))
+		return status, nil
+	}
+	if cluster == nil {
+		return status, nil
+	}
+	status.Cluster.Exists = true
+	status.Cluster.ServersRunning, status.Cluster.ServersTotal = cluster.ServerCountRunning()
+	status.Cluster.Running = status.Cluster.ServersRunning > 0
+	if !status.Cluster.Running {
+		return status, nil
+	}
+
+	kubeConfigPath, clean, err := k3d.CreateTmpClusterKubeConfig(ctx, cluster)
+	if err != nil {
+		status.Errors = append(status.Errors, fmt.Sprintf("failed to get cluster kubeconfig: %s", err))
+		return status, nil
+	}
+	defer clean()
+
+	if mnf != nil {
+		status.Releases = getReleasesStatus(ctx, kubeConfigPath, mnf)
+	}
+
+	clientset, err := k8s.NewClientset(kubeConfigPath, KUBE_CONTEXT)
+	if err != nil {
+		status.Errors = append(status.Errors, err.Error())
+		return status, nil
+	}
+	status.Workloads, err = k8s.ListWorkloads(ctx, clientset, KUBE_NAMESPACE)
+	if err != nil {
+		status.Errors = append(status.Errors, err.Error())
+	}
+	return status, nil
+}
+
+func getReleasesStatus(ctx context.Context, kubeConfigPath string, mnf *manifest.InstallationManifest) []ReleaseStatus {
+	chartMetas := []manifest.HelmChartMeta{mnf.InfraHelmChart, mnf.ServerHelmChart}
+	releases := make([]ReleaseStatus, 0, len(chartMetas))
+
+	helmConfig, err := helm.CreateHelmConfig(ctx, kubeConfigPath, KUBE_CONTEXT, KUBE_NAMESPACE)
+	for _, chartMeta := range chartMetas {
+		release := ReleaseStatus{Name: chartMeta.ReleaseName, ManifestVersion: chartMeta.Version}
+		if err != nil {
+			release.Error = err.Error()
+			releases = append(releases, release)
+			continue
+		}
+
+		version, versionErr := helm.GetHelmReleaseVersion(helmConfig, chartMeta.ReleaseName)
+		if versionErr == helm.ErrNoRelease {
+			release.Status = "not-installed"
+		} else if versionErr != nil {
+			release.Error = versionErr.Error()
+		} else {
+			release.Version = version
+			history, historyErr := helm.GetReleaseHistory(helmConfig, chartMeta.ReleaseName)
+			if historyErr != nil {
+				release.Error = historyErr.Error()
+			} else if len(history) > 0 {
+				latest := history[len(history)-1]
+				release.Revision = latest.Version
+				if latest.Info != nil {
+					release.Status = string(latest.Info.Status)
+				}
+			}
+		}
+		releases = append(releases, release)
+	}
+	return releases
+}
@@ -0,0 +1,541 @@
+package server
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/tensorleap/helm-charts/pkg/docker"
+	"github.com/tensorleap/helm-charts/pkg/helm"
+	"github.com/tensorleap/helm-charts/pkg/k3d"
+	"github.com/tensorleap/helm-charts/pkg/k8s"
+	"github.com/tensorleap/helm-charts/pkg/local"
+	"github.com/tensorleap/helm-charts/pkg/log"
+	"github.com/tensorleap/helm-charts/pkg/server/manifest"
+	"github.com/tensorleap/helm-charts/pkg/zot"
+	"gopkg.in/yaml.v3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/kubectl/pkg/describe"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+const (
+	supportBundleMaxLogFiles = 30
+	supportBundlePodLogLines = int64(10000)
+	supportBundleNodeLogTail = "10000"
+	supportBundleErrorsFile  = "errors.txt"
+)
+
+// bundleWriter writes entries into the support bundle, collection errors are kept
+// and written at the end so a partial bundle is still useful
+type bundleWriter struct {
+	tarWriter *tar.Writer
+	errors    []string
+}
+
+func (b *bundleWriter) addFile(name string, data []byte) error {
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	}
+	if err := b.tarWriter.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := b.tarWriter.Write(data)
+	return err
+}
+
+func (b *bundleWriter) addLocalFile(name, filePath string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := tar.FileInfoHeader(stat, "")
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if err := b.tarWriter.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = io.Copy(b.tarWriter, file)
+	return err
+}
+
+func (b *bundleWriter) addError(what string, err error) {
+	log.Warnf("Support bundle: failed collecting %s: %s", what, err)
+	b.errors = append(b.errors, fmt.Sprintf("%s: %s", what, err))
+}
+
+// CreateSupportBundle collects logs, configuration and cluster state into a tar.gz.
+// It only talks to local docker, the cluster and the local registry so it works in airgap mode
+func CreateSupportBundle(ctx context.Context, output io.Writer) error {
+	gzipWriter := gzip.NewWriter(output)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	b := &bundleWriter{tarWriter: tarWriter}
+
+	steps := []struct {
+		name    string
+		collect func(ctx context.Context, b *bundleWriter) error
+	}{
+		{"installer logs", collectInstallerLogs},
+		{"installation config", collectInstallationConfig},
+		{"docker info", collectDockerInfo},
+		{"cluster state", collectClusterState},
+		{"registry catalog", collectRegistryCatalog},
+	}
+	for _, step := range steps {
+		log.Infof("Collecting %s...", step.name)
+		if err := step.collect(ctx, b); err != nil {
+			b.addError(step.name, err)
+		}
+	}
+
+	errorsContent := "no errors\n"
+	if len(b.errors) > 0 {
+		errorsContent = strings.Join(b.errors, "\n") + "\n"
+	}
+	if err := b.addFile(supportBundleErrorsFile, []byte(errorsContent)); err != nil {
+		return err
+	}
+	// the writers are closed in order, they write the end of the archive
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
+	return gzipWriter.Close()
+}
+
+func collectInstallerLogs(_ context.Context, b *bundleWriter) error {
+	logsDir := path.Join(local.GetServerDataDir(), local.LOGS_DIR_NAME)
+	entries, err := os.ReadDir(logsDir)
+	if err != nil {
+		return err
+	}
+
+	files := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || info.IsDir() {
+			continue
+		}
+		files = append(files, info)
+	}
+	// newest first, older logs are rarely relevant
+	sort.Slice(files, func(i, j int) bool { return files[i].ModTime().After(files[j].ModTime()) })
+	if len(files) > supportBundleMaxLogFiles {
+		files = files[:supportBundleMaxLogFiles]
+	}
+
+	for _, file := range files {
+		if err := b.addLocalFile(path.Join("installer-logs", file.Name()), path.Join(logsDir, file.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func collectInstallationConfig(_ context.Context, b *bundleWriter) error {
+	for _, file := range []struct {
+		name   string
+		path   string
+		redact bool
+	}{
+		{local.INSTALLATION_PARAMS_FILE_NAME, local.GetInstallationParamsPath(), true},
+		{local.INSTALLATION_MANIFEST_FILE_NAME, local.GetInstallationManifestPath(), false},
+		{local.HOSTNAME_FILE, local.GetInstallationHostnamePath(), false},
+	} {
+		data, err := os.ReadFile(file.path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if file.redact {
+			data, err = redactYaml(data)
+			if err != nil {
+				return fmt.Errorf("failed to redact %s: %w", file.name, err)
+			}
+		}
+		if err := b.addFile(path.Join("config", file.name), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func redactYaml(data []byte) ([]byte, error) {
+	var value interface{}
+	if err := yaml.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(RedactSecrets(value))
+}
+
+func collectDockerInfo(ctx context.Context, b *bundleWriter) error {
+	dockerClient, err := docker.NewClient()
+	if err != nil {
+		return err
+	}
+	info, err := dockerClient.Info(ctx)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := b.addFile("docker/info.json", data); err != nil {
+		return err
+	}
+
+	logs, err := dockerClient.ContainerLogs(ctx, k3d.CONTAINER_NAME, container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Timestamps: true,
+		Tail:       supportBundleNodeLogTail,
+	})
+	if err != nil {
+		b.addError("k3d node logs", err)
+	} else {
+		defer logs.Close()
+		var out bytes.Buffer
+		if _, err := stdcopy.StdCopy(&out, &out, logs); err != nil {
+			b.addError("k3d node logs", err)
+		}
+		if err := b.addFile(path.Join("node", k3d.CONTAINER_NAME+".log"), out.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	ctrImages, err := exec.CommandContext(ctx, "docker", "exec", k3d.CONTAINER_NAME, "ctr", "-n", "k8s.io", "images", "ls").CombinedOutput()
+	if err != nil {
+		b.addError("ctr images ls", fmt.Errorf("%w: %s", err, ctrImages))
+		return nil
+	}
+	return b.addFile("node/ctr-images.txt", ctrImages)
+}
+
+func collectRegistryCatalog(_ context.Context, b *bundleWriter) error {
+	repos, err := zot.ListRepos(GetRegistryURL())
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(map[string][]string{"repositories": repos}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return b.addFile("registry/catalog.json", data)
+}
+
+func collectClusterState(ctx context.Context, b *bundleWriter) error {
+	cluster, err := k3d.GetCluster(ctx)
+	if err != nil {
+		return err
+	}
+	if cluster == nil {
+		return fmt.Errorf("cluster not found")
+	}
+	if running, _ := cluster.ServerCountRunning(); running == 0 {
+		return fmt.Errorf("cluster is not running")
+	}
+
+	kubeConfigPath, clean, err := k3d.CreateTmpClusterKubeConfig(ctx, cluster)
+	if err != nil {
+		return err
+	}
+	defer clean()
+
+	collectHelmReleases(ctx, b, kubeConfigPath)
+
+	clientset, err := k8s.NewClientset(kubeConfigPath, KUBE_CONTEXT)
+	if err != nil {
+		return err
+	}
+	if err := collectPods(ctx, b, clientset); err != nil {
+		b.addError("pods", err)
+	}
+	if err := collectEvents(ctx, b, clientset); err != nil {
+		b.addError("events", err)
+	}
+	if err := collectPVCs(ctx, b, clientset); err != nil {
+		b.addError("pvcs", err)
+	}
+	return nil
+}
+
+func collectHelmReleases(ctx context.Context, b *bundleWriter, kubeConfigPath string) {
+	mnf, err := manifest.Load(local.GetInstallationManifestPath())
+	if err != nil {
+		b.addError("helm releases", err)
+		return
+	}
+	helmConfig, err := helm.CreateHelmConfig(ctx, kubeConfigPath, KUBE_CONTEXT, KUBE_NAMESPACE)
+	if err != nil {
+		b.addError("helm releases", err)
+		return
+	}
+
+	for _, releaseName := range []string{mnf.InfraHelmChart.ReleaseName, mnf.ServerHelmChart.ReleaseName} {
+		values, err := helm.GetValues(helmConfig, releaseName)
+		if err != nil {
+			b.addError(fmt.Sprintf("helm values of %s", releaseName), err)
+		} else {
+			data, err := yaml.Marshal(RedactSecrets(map[string]interface{}(values)))
+			if err == nil {
+				err = b.addFile(path.Join("helm", releaseName+"-values.yaml"), data)
+			}
+			if err != nil {
+				b.addError(fmt.Sprintf("helm values of %s", releaseName), err)
+			}
+		}
+
+		history, err := helm.GetReleaseHistory(helmConfig, releaseName)
+		if err != nil {
+			b.addError(fmt.Sprintf("helm history of %s", releaseName), err)
+			continue
+		}
+		var out bytes.Buffer
+		w := tabwriter.NewWriter(&out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "REVISION\tUPDATED\tSTATUS\tCHART\tAPP VERSION\tDESCRIPTION")
+		for _, rel := range history {
+			updated, status, description := "", "", ""
+			if rel.Info != nil {
+				updated = rel.Info.LastDeployed.String()
+				status = rel.Info.Status.String()
+				description = rel.Info.Description
+			}
+			chartName, appVersion := "", ""
+			if rel.Chart != nil && rel.Chart.Metadata != nil {
+				chartName = fmt.Sprintf("%s-%s", rel.Chart.Metadata.Name, rel.Chart.Metadata.Version)
+				appVersion = rel.Chart.Metadata.AppVersion
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", rel.Version, updated, status, chartName, appVersion, description)
+		}
+		w.Flush()
+		if err := b.addFile(path.Join("helm", releaseName+"-history.txt"), out.Bytes()); err != nil {
+			b.addError(fmt.Sprintf("helm history of %s", releaseName), err)
+		}
+	}
+}
+
+func collectPods(ctx context.Context, b *bundleWriter, clientset kubernetes.Interface) error {
+	pods, err := clientset.CoreV1().Pods(KUBE_NAMESPACE).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	var table bytes.Buffer
+	w := tabwriter.NewWriter(&table, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tREADY\tSTATUS\tRESTARTS\tAGE\tNODE")
+	for _, pod := range pods.Items {
+		ready, restarts := 0, int32(0)
+		for _, cs := range pod.Status.ContainerStatuses {
+			if cs.Ready {
+				ready++
+			}
+			restarts += cs.RestartCount
+		}
+		fmt.Fprintf(w, "%s\t%d/%d\t%s\t%d\t%s\t%s\n", pod.Name, ready, len(pod.Spec.Containers), pod.Status.Phase, restarts, age(pod.CreationTimestamp), pod.Spec.NodeName)
+	}
+	w.Flush()
+	if err := b.addFile("k8s/pods.txt", table.Bytes()); err != nil {
+		return err
+	}
+	redactPodsEnv(pods.Items)
+	if err := addYaml(b, "k8s/pods.yaml", pods); err != nil {
+		return err
+	}
+
+	describer := &describe.PodDescriber{Interface: clientset}
+	var descriptions bytes.Buffer
+	for _, pod := range pods.Items {
+		description, err := describer.Describe(KUBE_NAMESPACE, pod.Name, describe.DescriberSettings{ShowEvents: true, ChunkSize: 500})
+		if err != nil {
+			b.addError(fmt.Sprintf("describe pod %s", pod.Name), err)
+			continue
+		}
+		descriptions.WriteString(redactDescribedEnv(description))
+		descriptions.WriteString("\n---\n")
+	}
+	if err := b.addFile("k8s/describe-pods.txt", descriptions.Bytes()); err != nil {
+		return err
+	}
+
+	for _, pod := range pods.Items {
+		collectPodLogs(ctx, b, clientset, &pod)
+	}
+	return nil
+}
+
+func redactPodsEnv(pods []corev1.Pod) {
+	for i := range pods {
+		spec := &pods[i].Spec
+		for _, containers := range [][]corev1.Container{spec.InitContainers, spec.Containers} {
+			for c := range containers {
+				for e, env := range containers[c].Env {
+					if env.Value != "" && isSensitiveKey(env.Name) {
+						containers[c].Env[e].Value = redactedValue
+					}
+				}
+			}
+		}
+	}
+}
+
+// describedEnvLine matches "      NAME:  value" lines of the Environment section in kubectl describe output
+var describedEnvLine = regexp.MustCompile(`^(\s+)([A-Za-z_][A-Za-z0-9_]*):(\s+)(.+)$`)
+
+func redactDescribedEnv(description string) string {
+	lines := strings.Split(description, "\n")
+	for i, line := range lines {
+		match := describedEnvLine.FindStringSubmatch(line)
+		if match == nil || !isSensitiveKey(match[2]) || strings.HasPrefix(match[4], "<set to") || strings.ToUpper(match[2]) != match[2] {
+			continue
+		}
+		lines[i] = match[1] + match[2] + ":" + match[3] + redactedValue
+	}
+	return strings.Join(lines, "\n")
+}
+
+func collectPodLogs(ctx context.Context, b *bundleWriter, clientset kubernetes.Interface, pod *corev1.Pod) {
+	statuses := append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...)
+	statuses = append(statuses, pod.Status.ContainerStatuses...)
+	tailLines := supportBundlePodLogLines
+
+	for _, cs := range statuses {
+		for _, previous := range []bool{false, true} {
+			if previous && cs.RestartCount == 0 {
+				continue
+			}
+			data, err := clientset.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{
+				Container: cs.Name,
+				Previous:  previous,
+				TailLines: &tailLines,
+			}).DoRaw(ctx)
+			fileName := cs.Name + ".log"
+			if previous {
+				fileName = cs.Name + ".previous.log"
+			}
+			if err != nil {
+				b.addError(fmt.Sprintf("logs of %s/%s", pod.Name, fileName), err)
+				continue
+			}
+			if err := b.addFile(path.Join("pod-logs", pod.Name, fileName), data); err != nil {
+				b.addError(fmt.Sprintf("logs of %s/%s", pod.Name, fileName), err)
+			}
+		}
+	}
+}
+
+func collectEvents(ctx context.Context, b *bundleWriter, clientset kubernetes.Interface) error {
+	events, err := clientset.CoreV1().Events(KUBE_NAMESPACE).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	sort.Slice(events.Items, func(i, j int) bool {
+		return eventTime(&events.Items[i]).Before(eventTime(&events.Items[j]))
+	})
+
+	var table bytes.Buffer
+	w := tabwriter.NewWriter(&table, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LAST SEEN\tTYPE\tREASON\tOBJECT\tCOUNT\tMESSAGE")
+	for _, event := range events.Items {
+		object := fmt.Sprintf("%s/%s", strings.ToLower(event.InvolvedObject.Kind), event.InvolvedObject.Name)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n", eventTime(&event).Format(time.RFC3339), event.Type, event.Reason, object, event.Count, strings.TrimSpace(event.Message))
+	}
+	w.Flush()
+	if err := b.addFile("k8s/events.txt", table.Bytes()); err != nil {
+		return err
+	}
+	return addYaml(b, "k8s/events.yaml", events)
+}
+
+func eventTime(event *corev1.Event) time.Time {
+	if !event.LastTimestamp.IsZero() {
+		return event.LastTimestamp.Time
+	}
+	if !event.EventTime.IsZero() {
+		return event.EventTime.Time
+	}
+	return event.CreationTimestamp.Time
+}
+
+func collectPVCs(ctx context.Context, b *bundleWriter, clientset kubernetes.Interface) error {
+	pvcs, err := clientset.CoreV1().PersistentVolumeClaims(KUBE_NAMESPACE).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	var table bytes.Buffer
+	w := tabwriter.NewWriter(&table, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSTATUS\tVOLUME\tCAPACITY\tSTORAGECLASS\tAGE")
+	for _, pvc := range pvcs.Items {
+		capacity := ""
+		if storage, ok := pvc.Status.Capacity[corev1.ResourceStorage]; ok {
+			capacity = storage.String()
+		}
+		storageClass := ""
+		if pvc.Spec.StorageClassName != nil {
+			storageClass = *pvc.Spec.StorageClassName
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", pvc.Name, pvc.Status.Phase, pvc.Spec.VolumeName, capacity, storageClass, age(pvc.CreationTimestamp))
+	}
+	w.Flush()
+	if err := b.addFile("k8s/pvcs.txt", table.Bytes()); err != nil {
+		return err
+	}
+
+	describer := &describe.PersistentVolumeClaimDescriber{Interface: clientset}
+	var descriptions bytes.Buffer
+	for _, pvc := range pvcs.Items {
+		description, err := describer.Describe(KUBE_NAMESPACE, pvc.Name, describe.DescriberSettings{ShowEvents: true, ChunkSize: 500})
+		if err != nil {
+			b.addError(fmt.Sprintf("describe pvc %s", pvc.Name), err)
+			continue
+		}
+		descriptions.WriteString(description)
+		descriptions.WriteString("\n---\n")
+	}
+	return b.addFile("k8s/describe-pvcs.txt", descriptions.Bytes())
+}
+
+func addYaml(b *bundleWriter, name string, obj interface{}) error {
+	data, err := sigsyaml.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	return b.addFile(name, data)
+}
+
+func age(t metav1.Time) string {
+	if t.IsZero() {
+		return "<unknown>"
+	}
+	return duration.HumanDuration(time.Since(t.Time))
+}
@@ -33,12 +33,17 @@ const (
 // mode: delete the k3d cluster, then best-effort remove the legacy pre-Zot
 // sidecar registry container.
 func removeClusterAndLegacySidecar(ctx context.Context) error {
+	defer log.StartPhase("Removing cluster")()
 	if err := k3d.UninstallCluster(ctx); err != nil {
 		return err
 	}
 	if rmErr := docker.TryRemoveContainer(ctx, legacySidecarRegistryName); rmErr != nil {
 		log.Warnf("Failed to remove legacy registry container: %v", rmErr)
 	}
+	// the checkpoints of an unfinished install belong to the removed cluster
+	if rmErr := ClearInstallCheckpoints(); rmErr != nil {
+		log.Warnf("Failed to remove the install checkpoints: %v", rmErr)
+	}
 	return nil
 }
 
@@ -119,12 +124,15 @@ func Uninstall(ctx context.Context, purge bool, cleanup bool, clearData bool) (e
 	}
 
 	if cleanup || purge {
-		err = k3d.RemoveImageCachingVolume(ctx)
+		err = log.TimePhase("Removing image caching volume", func() error {
+			return k3d.RemoveImageCachingVolume(ctx)
+		})
 		if err != nil {
 			return err
 		}
 	}
 
+	defer log.StartPhase("Removing data")()
 	if purge {
 		// Remove everything: data + cache
 		err = local.PurgeData()
@@ -15,7 +15,7 @@ func ValidateStandaloneDir() error {
 	_, err := os.Stat(standaloneDir)
 	if os.IsNotExist(err) {
 		log.SendCloudReport("error", "Installation dir not found", "Failed", &map[string]interface{}{"error": err.Error()})
-		return fmt.Errorf("not found data directory(%s) on this machine, Please make sure to install before upgrade", standaloneDir)
+		return fmt.Errorf("%w: not found data directory(%s) on this machine, Please make sure to install before upgrade", ErrNotInstalled, standaloneDir)
 	}
 	return err
 }
@@ -27,13 +27,20 @@ const (
 // "use latest version?" prompt and always resolves to the latest tag (unless
 // the caller passed an explicit --tag) — upgrade should never offer to stay
 // on the current version. install/reinstall pass false to keep the prompt.
-func InitInstallationProcess(flags *InstallationSourceFlags, previousMnf *manifest.InstallationManifest, forceLatestVersion bool) (mnf *manifest.InstallationManifest, isAirGap bool, infraHelmChart, serverHelmChart *chart.Chart, err error) {
+// For an airgap pack it sets the pack on installationParams.
+func InitInstallationProcess(ctx context.Context, flags *InstallationSourceFlags, previousMnf *manifest.InstallationManifest, forceLatestVersion bool, installationParams *InstallationParams) (mnf *manifest.InstallationManifest, isAirGap bool, infraHelmChart, serverHelmChart *chart.Chart, err error) {
 	isAirGap = flags.IsAirGap()
 	if isAirGap {
 		log.DisableReporting()
-		var file *os.File
-		file, err = os.Open(flags.AirGapInstallationFilePath)
+		var file airgap.PackFile
+		file, err = airgap.OpenPack(flags.AirGapInstallationFilePath)
 		if err != nil {
+			log.SendCloudReport("error", "Failed to open airgap installation file", "Failed",
+				&map[string]interface{}{"error": err.Error()})
+			return nil, false, nil, nil, err
+		}
+		defer file.Close()
+		if err = checkDeltaPackBase(ctx, file); err != nil {
 			return nil, false, nil, nil, err
 		}
 		mnf, infraHelmChart, serverHelmChart, err = airgap.Load(file)
@@ -42,6 +49,8 @@ func InitInstallationProcess(flags *InstallationSourceFlags, previousMnf *manife
 				&map[string]interface{}{"error": err.Error()})
 			return nil, false, nil, nil, err
 		}
+		// the images of the pack are pushed from it into the registry during the install
+		installationParams.AirgapPack = flags.AirGapInstallationFilePath
 	} else {
 		var err error
 		if flags.IsLocal() {
@@ -106,10 +115,10 @@ func InitInstallationProcess(flags *InstallationSourceFlags, previousMnf *manife
 // LoadManifestOnly loads only the manifest to enable lightweight decisions (e.g. reinstall prompt)
 // before loading heavy assets (images/charts). For airgap installs, it reads the manifest from the
 // tarball; for non-airgap it follows the same tag/local logic as a full install but skips chart loads.
-func LoadManifestOnly(flags *InstallationSourceFlags, previousMnf *manifest.InstallationManifest) (mnf *manifest.InstallationManifest, isAirGap bool, err error) {
+func LoadManifestOnly(flags *InstallationSourceFlags, previousMnf *manifest.InstallationManifest, forceLatestVersion bool) (mnf *manifest.InstallationManifest, isAirGap bool, err error) {
 	isAirGap = flags.IsAirGap()
 	if isAirGap {
-		file, openErr := os.Open(flags.AirGapInstallationFilePath)
+		file, openErr := airgap.OpenPack(flags.AirGapInstallationFilePath)
 		if openErr != nil {
 			return nil, false, openErr
 		}
@@ -132,7 +141,7 @@ func LoadManifestOnly(flags *InstallationSourceFlags, previousMnf *manifest.Inst
 		mnf, err = manifest.GenerateManifestFromLocal(fileGetter, localDir)
 	} else {
 		tag := flags.Tag
-		if previousMnf != nil && tag == "" && previousMnf.Tag != "" {
+		if !forceLatestVersion && previousMnf != nil && tag == "" && previousMnf.Tag != "" {
 
 			isInstallLatestVersion, err := AskUserForIsUseLatestVersion(previousMnf.Tag)
 			if err != nil {
@@ -179,7 +188,7 @@ func EnsureReinstallConsent(ctx context.Context, mnfPreview, previousMnf *manife
 		return false, err
 	}
 	if !isContinue {
-		return false, fmt.Errorf("reinstall aborted")
+		return false, ErrReinstallAborted
 	}
 
 	return true, nil
@@ -200,7 +209,7 @@ func GetCurrentInsalledHelmChartVersion(ctx context.Context) (string, error) {
 	}
 	defer clean()
 
-	helmConfig, err := helm.CreateHelmConfig(kubeConfigPath, KUBE_CONTEXT, KUBE_NAMESPACE)
+	helmConfig, err := helm.CreateHelmConfig(ctx, kubeConfigPath, KUBE_CONTEXT, KUBE_NAMESPACE)
 	if err != nil {
 		return "", nil
 	}
@@ -213,6 +222,9 @@ func GetCurrentInsalledHelmChartVersion(ctx context.Context) (string, error) {
 }
 
 func SaveInstallation(mnf *manifest.InstallationManifest, installationParams *InstallationParams) error {
+	if err := archiveCurrentInstallation(mnf, installationParams); err != nil {
+		log.Warnf("Failed saving previous installation to history: %v", err)
+	}
 	err := mnf.Save(local.GetInstallationManifestPath())
 	if err != nil {
 		return err
@@ -250,6 +262,15 @@ func CalcWhichImagesToCache(mnf *manifest.InstallationManifest, useGpu bool, isA
 	return
 }
 
+// GetSavedRegistryPort returns the registry port of the saved installation, or the default one
+func GetSavedRegistryPort() uint {
+	params, err := LoadInstallationParamsFromPrevious()
+	if err == nil && params.RegistryPort != 0 {
+		return params.RegistryPort
+	}
+	return DefaultRegistryPort
+}
+
 func IsUseDefaultPropOption() bool {
 	return os.Getenv("TL_USE_DEFAULT_OPTION") == "true"
 }
@@ -335,15 +356,59 @@ func getHomePath() string {
 
 func cleanImagesFromContainerd(ctx context.Context, currentMnf *manifest.InstallationManifest, dockerName string) error {
 
-	err := containerd.PruneContainerdExceptImageList(ctx, dockerName, "k8s.io", currentMnf.GetAllImages(), false)
+	_, err := containerd.PruneContainerdExceptImageList(ctx, dockerName, currentMnf.GetAllImages(), false)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func cleanImagesFromZot(registryPort uint, currentMnf *manifest.InstallationManifest) error {
-	registryURL := fmt.Sprintf("http://localhost:%d", registryPort)
+func cleanImagesFromZot(ctx context.Context, installationParams *InstallationParams, currentMnf *manifest.InstallationManifest) error {
+	registryURL := fmt.Sprintf("http://localhost:%d", installationParams.RegistryPort)
 	preserveRepos := zot.DnDPreserveRepos(currentMnf.GetAllImages())
-	return zot.PruneExceptImageList(registryURL, currentMnf.GetAllImages(), preserveRepos)
+	if _, err := zot.PruneExceptImageList(registryURL, currentMnf.GetAllImages(), preserveRepos, false); err != nil {
+		return err
+	}
+	if installationParams.RegistryRetention.IsEmpty() {
+		return nil
+	}
+	_, err := ApplyRegistryRetention(ctx, registryURL, currentMnf, *installationParams.RegistryRetention, false)
+	return err
+}
+
+// loadInstallationCharts loads the charts of the manifest from its chart repo, or for airgap
+// installations from the installation pack, which must be of the same tag
+func loadInstallationCharts(ctx context.Context, mnf *manifest.InstallationManifest, isAirgap bool, airgapPackPath string) (*manifest.InstallationManifest, *chart.Chart, *chart.Chart, error) {
+	if !isAirgap {
+		serverChart, err := chart.Load(mnf.ServerHelmChart.RepoUrl, mnf.ServerHelmChart.ChartName, mnf.ServerHelmChart.Version)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		infraChart, err := chart.Load(mnf.InfraHelmChart.RepoUrl, mnf.InfraHelmChart.ChartName, mnf.InfraHelmChart.Version)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return mnf, infraChart, serverChart, nil
+	}
+
+	if airgapPackPath == "" {
+		return nil, nil, nil, fmt.Errorf("airgap installation: pass --airgap with the installation pack of tag %s", mnf.Tag)
+	}
+	file, err := airgap.OpenPack(airgapPackPath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer file.Close()
+	if err := checkDeltaPackBase(ctx, file); err != nil {
+		return nil, nil, nil, err
+	}
+	packMnf, infraChart, serverChart, err := airgap.Load(file)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if packMnf.Tag != mnf.Tag {
+		return nil, nil, nil, fmt.Errorf("airgap pack is of tag %s but tag %s is required", packMnf.Tag, mnf.Tag)
+	}
+	airgap.SetupEnvForK3dToolsImage(packMnf.Images.K3dTools)
+	return packMnf, infraChart, serverChart, nil
 }
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/tensorleap/helm-charts/pkg/server/airgap"
+	"github.com/tensorleap/helm-charts/pkg/version"
+)
+
+var ErrPackVerificationFailed = errors.New("installation pack verification failed")
+
+// VerifyPack checks an installation pack without installing it: the checksums of its parts, its tar structure,
+// manifest, images and charts (see airgap.Verify), and that this CLI can install it
+func VerifyPack(packPath string) *airgap.VerifyReport {
+	report := airgap.NewVerifyReport(packPath)
+	file, err := airgap.OpenPack(packPath)
+	report.Add("pack files", err, "")
+	if err != nil {
+		return report
+	}
+	defer file.Close()
+
+	mnf := airgap.Verify(file, report)
+	if mnf != nil {
+		report.Add("installer version", validatePackInstallerVersion(mnf.InstallerVersion),
+			fmt.Sprintf("installer version %s, CLI version %s", mnf.InstallerVersion, version.Version))
+	}
+	return report
+}
+
+func validatePackInstallerVersion(installerVersion string) error {
+	if len(strings.Split(strings.TrimPrefix(installerVersion, "v"), ".")) < 3 {
+		return fmt.Errorf("invalid installer version '%s' in the manifest", installerVersion)
+	}
+	return ValidateInstallerVersion(installerVersion)
+}
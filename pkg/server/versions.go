@@ -0,0 +1,242 @@
+package server
+
+import (
+	"fmt"
+	"path"
+	"sync"
+
+	"github.com/tensorleap/helm-charts/pkg/helm/chart"
+	"github.com/tensorleap/helm-charts/pkg/local"
+	"github.com/tensorleap/helm-charts/pkg/log"
+	"github.com/tensorleap/helm-charts/pkg/server/manifest"
+)
+
+const fetchManifestsConcurrency = 8
+
+type VersionSource string
+
+const (
+	VersionSourceGithub    VersionSource = "github"
+	VersionSourceInstalled VersionSource = "installed"
+	VersionSourceHistory   VersionSource = "history"
+	VersionSourceHelmCache VersionSource = "helm-cache"
+)
+
+type VersionCompatibility string
+
+const (
+	VersionCompatible           VersionCompatibility = "compatible"
+	VersionCliUpgradeRequired   VersionCompatibility = "cli-upgrade-required"
+	VersionNotSupported         VersionCompatibility = "not-supported"
+	VersionCompatibilityUnknown VersionCompatibility = "unknown"
+)
+
+// AvailableVersion is a manifest release that can be installed with --tag
+type AvailableVersion struct {
+	Tag                string               `json:"tag"`
+	ServerChartVersion string               `json:"serverChartVersion,omitempty"`
+	InfraChartVersion  string               `json:"infraChartVersion,omitempty"`
+	InstallerVersion   string               `json:"installerVersion,omitempty"`
+	AppVersion         string               `json:"appVersion,omitempty"`
+	Compatibility      VersionCompatibility `json:"compatibility"`
+	Installed          bool                 `json:"installed"`
+	Source             VersionSource        `json:"source"`
+	Error              string               `json:"error,omitempty"`
+}
+
+func newAvailableVersion(mnf *manifest.InstallationManifest, source VersionSource) AvailableVersion {
+	return AvailableVersion{
+		Tag:                mnf.Tag,
+		ServerChartVersion: mnf.ServerHelmChart.Version,
+		InfraChartVersion:  mnf.InfraHelmChart.Version,
+		InstallerVersion:   mnf.InstallerVersion,
+		AppVersion:         mnf.AppVersion,
+		Compatibility:      getVersionCompatibility(mnf.InstallerVersion),
+		Source:             source,
+	}
+}
+
+func getVersionCompatibility(installerVersion string) VersionCompatibility {
+	if installerVersion == "" {
+		return VersionCompatibilityUnknown
+	}
+	switch ValidateInstallerVersion(installerVersion) {
+	case nil:
+		return VersionCompatible
+	case ErrCliUpgradeRequired:
+		return VersionCliUpgradeRequired
+	default:
+		return VersionNotSupported
+	}
+}
+
+// ListAvailableVersions lists the manifest releases newest first, up to limit (0 for all).
+// When github can't be reached it lists the versions known locally, and offline is true.
+func ListAvailableVersions(limit int) (versions []AvailableVersion, offline bool, err error) {
+	installedTag := getInstalledTag()
+
+	tags, err := manifest.ListManifestTags()
+	if err != nil {
+		log.Warnf("Failed listing releases from github (%v), listing the versions known locally", err)
+		versions, err = listLocalVersions()
+		if err != nil {
+			return nil, true, err
+		}
+		markInstalledVersion(versions, installedTag)
+		return versions, true, nil
+	}
+	if limit > 0 && len(tags) > limit {
+		tags = tags[:limit]
+	}
+
+	versions = make([]AvailableVersion, len(tags))
+	semaphore := make(chan struct{}, fetchManifestsConcurrency)
+	wg := sync.WaitGroup{}
+	for i, tag := range tags {
+		wg.Add(1)
+		go func(i int, tag string) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			mnf, err := manifest.GetByTag(tag)
+			if err != nil {
+				versions[i] = AvailableVersion{Tag: tag, Compatibility: VersionCompatibilityUnknown, Source: VersionSourceGithub, Error: err.Error()}
+				return
+			}
+			mnf.Tag = tag
+			versions[i] = newAvailableVersion(mnf, VersionSourceGithub)
+		}(i, tag)
+	}
+	wg.Wait()
+
+	markInstalledVersion(versions, installedTag)
+	return versions, false, nil
+}
+
+// GetVersionManifest returns the manifest of a tag, from github or when offline from the
+// saved manifests, and as a last resort a partial manifest of the server chart in the helm cache
+func GetVersionManifest(tag string) (*manifest.InstallationManifest, VersionSource, error) {
+	mnf, githubErr := manifest.GetByTag(tag)
+	if githubErr == nil {
+		mnf.Tag = tag
+		return mnf, VersionSourceGithub, nil
+	}
+
+	saved, err := listSavedManifests()
+	if err != nil {
+		return nil, "", err
+	}
+	for _, s := range saved {
+		if s.mnf.Tag == tag {
+			log.Warnf("Failed getting the manifest from github (%v), using the saved manifest", githubErr)
+			return s.mnf, s.source, nil
+		}
+	}
+
+	for _, v := range listCachedServerChartVersions() {
+		if manifest.GetManifestTagOfServerChart(v) != tag {
+			continue
+		}
+		serverChart, err := chart.LoadCached(manifest.ServerChartName, v)
+		if err != nil {
+			return nil, "", err
+		}
+		log.Warnf("Failed getting the manifest from github (%v), only the server chart of %s is known from the helm cache", githubErr, tag)
+		return &manifest.InstallationManifest{
+			Tag: tag,
+			ServerHelmChart: manifest.HelmChartMeta{
+				Version:     serverChart.Metadata.Version,
+				ChartName:   serverChart.Metadata.Name,
+				ReleaseName: serverChart.Metadata.Name,
+			},
+		}, VersionSourceHelmCache, nil
+	}
+
+	return nil, "", fmt.Errorf("failed getting manifest %s (%v), and it is not known locally", tag, githubErr)
+}
+
+type savedManifest struct {
+	mnf    *manifest.InstallationManifest
+	source VersionSource
+}
+
+// listSavedManifests returns the installed manifest and the ones in the installation history
+func listSavedManifests() ([]savedManifest, error) {
+	saved := []savedManifest{}
+	installedMnf, err := manifest.Load(local.GetInstallationManifestPath())
+	if err == nil {
+		saved = append(saved, savedManifest{installedMnf, VersionSourceInstalled})
+	} else if err != manifest.ErrManifestNotFound {
+		return nil, err
+	}
+
+	entries, err := ListInstallationHistory()
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		mnf, err := manifest.Load(path.Join(entry.dir, local.INSTALLATION_MANIFEST_FILE_NAME))
+		if err != nil {
+			continue
+		}
+		saved = append(saved, savedManifest{mnf, VersionSourceHistory})
+	}
+	return saved, nil
+}
+
+func listCachedServerChartVersions() []string {
+	versions, err := chart.ListCachedVersions(manifest.ServerChartName)
+	if err != nil {
+		log.Warnf("Failed listing the helm cache: %v", err)
+	}
+	return versions
+}
+
+func listLocalVersions() ([]AvailableVersion, error) {
+	saved, err := listSavedManifests()
+	if err != nil {
+		return nil, err
+	}
+	byTag := map[string]AvailableVersion{}
+	tags := []string{}
+	add := func(v AvailableVersion) {
+		if _, ok := byTag[v.Tag]; ok || v.Tag == "" {
+			return
+		}
+		byTag[v.Tag] = v
+		tags = append(tags, v.Tag)
+	}
+	for _, s := range saved {
+		add(newAvailableVersion(s.mnf, s.source))
+	}
+	for _, v := range listCachedServerChartVersions() {
+		add(AvailableVersion{
+			Tag:                manifest.GetManifestTagOfServerChart(v),
+			ServerChartVersion: v,
+			Compatibility:      VersionCompatibilityUnknown,
+			Source:             VersionSourceHelmCache,
+		})
+	}
+
+	manifest.SortTagsByVersion(tags)
+	versions := make([]AvailableVersion, 0, len(tags))
+	for _, tag := range tags {
+		versions = append(versions, byTag[tag])
+	}
+	return versions, nil
+}
+
+func getInstalledTag() string {
+	mnf, err := manifest.Load(local.GetInstallationManifestPath())
+	if err != nil {
+		return ""
+	}
+	return mnf.Tag
+}
+
+func markInstalledVersion(versions []AvailableVersion, installedTag string) {
+	for i := range versions {
+		versions[i].Installed = installedTag != "" && versions[i].Tag == installedTag
+	}
+}
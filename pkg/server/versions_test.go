@@ -0,0 +1,45 @@
+package server
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tensorleap/helm-charts/pkg/local"
+	"github.com/tensorleap/helm-charts/pkg/server/manifest"
+	"github.com/tensorleap/helm-charts/pkg/version"
+)
+
+func TestListLocalVersions(t *testing.T) {
+	t.Setenv(local.DATA_DIR_ENV_NAME, t.TempDir())
+	params := &InstallationParams{DatasetVolumes: []string{}}
+	require.NoError(t, SaveInstallation(&manifest.InstallationManifest{Tag: "manifest-1.0.0", AppVersion: "0.2.0"}, params))
+	require.NoError(t, SaveInstallation(&manifest.InstallationManifest{Tag: "manifest-1.1.0", AppVersion: "0.2.0"}, params))
+
+	cacheDir := path.Join(local.GetHelmCacheDir(), manifest.ServerChartName)
+	require.NoError(t, os.MkdirAll(cacheDir, 0755))
+	for _, file := range []string{"1.2.0.tgz", "1.1.0.tgz"} {
+		require.NoError(t, os.WriteFile(path.Join(cacheDir, file), []byte{}, 0644))
+	}
+
+	versions, err := listLocalVersions()
+	require.NoError(t, err)
+	markInstalledVersion(versions, getInstalledTag())
+
+	require.Len(t, versions, 3)
+	assert.Equal(t, AvailableVersion{Tag: "manifest-1.2.0", ServerChartVersion: "1.2.0", Compatibility: VersionCompatibilityUnknown, Source: VersionSourceHelmCache}, versions[0])
+	assert.Equal(t, "manifest-1.1.0", versions[1].Tag)
+	assert.Equal(t, VersionSourceInstalled, versions[1].Source)
+	assert.True(t, versions[1].Installed)
+	assert.Equal(t, "manifest-1.0.0", versions[2].Tag)
+	assert.Equal(t, VersionSourceHistory, versions[2].Source)
+	assert.False(t, versions[2].Installed)
+}
+
+func TestGetVersionCompatibility(t *testing.T) {
+	assert.Equal(t, VersionCompatibilityUnknown, getVersionCompatibility(""))
+	assert.Equal(t, VersionCompatible, getVersionCompatibility(version.Version))
+	assert.Equal(t, VersionNotSupported, getVersionCompatibility("v0.0.1"))
+}
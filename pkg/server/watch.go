@@ -0,0 +1,85 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/tensorleap/helm-charts/pkg/containerd"
+	"github.com/tensorleap/helm-charts/pkg/k3d"
+	"github.com/tensorleap/helm-charts/pkg/local"
+	"github.com/tensorleap/helm-charts/pkg/log"
+	"github.com/tensorleap/helm-charts/pkg/server/manifest"
+	"github.com/tensorleap/helm-charts/pkg/zot"
+)
+
+type WatchOptions struct {
+	Interval time.Duration
+	// DiskPressureCleanup overrides the setting of the installation when set
+	DiskPressureCleanup *bool
+}
+
+// Watch monitors the installed server until ctx is done
+func Watch(ctx context.Context, opts WatchOptions) error {
+	if opts.Interval <= 0 {
+		return fmt.Errorf("interval must be positive, got %s", opts.Interval)
+	}
+	mnf, err := manifest.Load(local.GetInstallationManifestPath())
+	if err == manifest.ErrManifestNotFound {
+		return fmt.Errorf("%w: no installation manifest found", ErrNotInstalled)
+	} else if err != nil {
+		return err
+	}
+	params, err := LoadInstallationParamsFromPrevious()
+	if err == ErrNoInstallationParams {
+		return fmt.Errorf("%w: no installation params found", ErrNotInstalled)
+	} else if err != nil {
+		return err
+	}
+	if err := validateClusterRunning(ctx); err != nil {
+		return err
+	}
+	cluster, err := k3d.GetCluster(ctx)
+	if err != nil {
+		return err
+	}
+	kubeConfigPath, clean, err := k3d.CreateTmpClusterKubeConfig(ctx, cluster)
+	if err != nil {
+		return err
+	}
+	defer clean()
+
+	cleanup := params.DiskPressureCleanup
+	if opts.DiskPressureCleanup != nil {
+		cleanup = *opts.DiskPressureCleanup
+	}
+	var remediate k3d.DiskPressureRemediation
+	if cleanup {
+		remediate = NewDiskPressureCleanup(GetRegistryURL(), mnf)
+	}
+	log.Infof("Watching the server every %s (disk pressure cleanup: %t), press Ctrl-C to stop", opts.Interval, cleanup)
+	return k3d.WatchDiskPressure(ctx, kubeConfigPath, KUBE_CONTEXT, opts.Interval, remediate)
+}
+
+// NewDiskPressureCleanup prunes the node containerd images and the registry tags that are not in the manifest.
+// Images in use, pinned images and the preserved repos are kept, like in the cleanup after install.
+func NewDiskPressureCleanup(registryURL string, mnf *manifest.InstallationManifest) k3d.DiskPressureRemediation {
+	return func(ctx context.Context) (int64, error) {
+		keepImages := mnf.GetAllImages()
+		containerdReport, err := containerd.PruneContainerdExceptImageList(ctx, k3d.CONTAINER_NAME, keepImages, false)
+		if err != nil {
+			return 0, fmt.Errorf("pruning containerd images: %w", err)
+		}
+		reclaimed := containerdReport.ReclaimedBytes
+		log.Infof("Removed %d images from containerd", len(containerdReport.Removed))
+
+		// the registry may not be up yet during install, the containerd cleanup is still reported
+		registryReport, err := zot.PruneExceptImageList(registryURL, keepImages, zot.DnDPreserveRepos(keepImages), false)
+		if err != nil {
+			log.Warnf("Failed pruning registry images: %v", err)
+			return reclaimed, nil
+		}
+		log.Infof("Removed %d images from the registry, their space is freed by the registry garbage collection", len(registryReport.Removed))
+		return reclaimed + registryReport.ReclaimedBytes, nil
+	}
+}
@@ -1,17 +1,21 @@
 package utils
 
 import (
+	"context"
 	"fmt"
 	"time"
 )
 
-func WaitForCondition(condition func() (bool, error), interval, timeout time.Duration) error {
+// WaitForCondition checks the condition every interval until it is true, it fails or ctx is done
+func WaitForCondition(ctx context.Context, condition func() (bool, error), interval, timeout time.Duration) error {
 	timeoutCh := time.After(timeout)
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for {
 		select {
+		case <-ctx.Done():
+			return ctx.Err()
 		case <-timeoutCh:
 			return fmt.Errorf("timeout after %v", timeout)
 		case <-ticker.C:
@@ -25,3 +29,15 @@ func WaitForCondition(condition func() (bool, error), interval, timeout time.Dur
 		}
 	}
 }
+
+// Sleep waits for the duration, returning ctx.Err() early when ctx is done
+func Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
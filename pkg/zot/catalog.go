@@ -0,0 +1,12 @@
+package zot
+
+import (
+	"net/http"
+	"time"
+)
+
+// ListRepos returns the repositories in the Zot catalog
+func ListRepos(registryURL string) ([]string, error) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	return listRepos(client, registryURL)
+}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
-	"time"
 
 	"github.com/tensorleap/helm-charts/pkg/log"
 )
@@ -19,6 +18,27 @@ type tagsResponse struct {
 	Tags []string `json:"tags"`
 }
 
+// PrunedImage is a manifest digest in a repo and its tags
+type PrunedImage struct {
+	Repo   string   `json:"repo"`
+	Tags   []string `json:"tags"`
+	Digest string   `json:"digest"`
+	// Size is the size of the blobs only this image uses, freed by Zot's GC once it is deleted
+	Size int64 `json:"size"`
+}
+
+type PruneReport struct {
+	DryRun bool `json:"dryRun"`
+	// Removed are the images deleted, or on dry run the images that would be deleted
+	Removed []PrunedImage `json:"removed"`
+	// InUse are tags not in the keep list that are kept because a kept tag has the same digest
+	InUse []PrunedImage `json:"inUse"`
+	// Skipped are images retention could not check, e.g. without a readable creation time, they are kept
+	Skipped        []PrunedImage `json:"skipped,omitempty"`
+	PreservedRepos []string      `json:"preservedRepos"`
+	ReclaimedBytes int64         `json:"reclaimedBytes"`
+}
+
 // PruneExceptImageList removes all image tags from the Zot registry that are
 // NOT in the keepImages list. Repos listed in preserveRepos are skipped
 // entirely (used to protect DnD-pushed images like custom engine-generic builds).
@@ -26,25 +46,26 @@ type tagsResponse struct {
 //
 // Deletion is digest-safe: since multiple tags can share a manifest digest,
 // we first resolve keep-tag digests, then only delete digests that no
-// keep-tag points to.
-func PruneExceptImageList(registryURL string, keepImages []string, preserveRepos []string) error {
+// keep-tag points to. On dry run nothing is deleted.
+func PruneExceptImageList(registryURL string, keepImages []string, preserveRepos []string, dryRun bool) (*PruneReport, error) {
 	keepSet := buildKeepSet(keepImages)
 	preserveSet := make(map[string]bool, len(preserveRepos))
 	for _, r := range preserveRepos {
 		preserveSet[r] = true
 	}
 
-	client := &http.Client{Timeout: 5 * time.Second}
+	client := newClient()
 
 	repos, err := listRepos(client, registryURL)
 	if err != nil {
-		return fmt.Errorf("listing Zot catalog: %w", err)
+		return nil, fmt.Errorf("listing Zot catalog: %w", err)
 	}
 
-	totalDeleted := 0
+	report := &PruneReport{DryRun: dryRun, Removed: []PrunedImage{}, InUse: []PrunedImage{}, PreservedRepos: []string{}}
 	for _, repo := range repos {
 		if preserveSet[repo] {
 			log.Infof("Preserving Zot repo %s (DnD images)", repo)
+			report.PreservedRepos = append(report.PreservedRepos, repo)
 			continue
 		}
 
@@ -58,50 +79,86 @@ func PruneExceptImageList(registryURL string, keepImages []string, preserveRepos
 		}
 
 		keepDigests := make(map[string]bool)
-		var deleteCandidates []string
+		retainedBlobs := make(map[string]bool)
+		candidates := make(map[string]*PrunedImage)
+		candidateBlobs := make(map[string]map[string]int64)
+		var candidateDigests []string
 		skipRepo := false
 
 		for _, tag := range tags {
-			if keepSet[repo+":"+tag] {
-				digest, err := getManifestDigest(client, registryURL, repo, tag)
-				if err != nil {
+			info, err := inspectImage(client, registryURL, repo, tag)
+			if err != nil {
+				if keepSet[repo+":"+tag] {
 					log.Warnf("Cannot resolve digest for keep-tag %s:%s, skipping repo: %v", repo, tag, err)
 					skipRepo = true
 					break
 				}
-				keepDigests[digest] = true
-			} else {
-				deleteCandidates = append(deleteCandidates, tag)
+				log.Warnf("Failed to get digest for %s:%s: %v", repo, tag, err)
+				continue
+			}
+			if keepSet[repo+":"+tag] {
+				keepDigests[info.Digest] = true
+				for blob := range info.blobs {
+					retainedBlobs[blob] = true
+				}
+				continue
+			}
+			if candidate, ok := candidates[info.Digest]; ok {
+				candidate.Tags = append(candidate.Tags, tag)
+				continue
 			}
+			candidates[info.Digest] = &PrunedImage{Repo: repo, Tags: []string{tag}, Digest: info.Digest}
+			candidateBlobs[info.Digest] = info.blobs
+			candidateDigests = append(candidateDigests, info.Digest)
 		}
 		if skipRepo {
 			continue
 		}
 
-		for _, tag := range deleteCandidates {
-			digest, err := getManifestDigest(client, registryURL, repo, tag)
-			if err != nil {
-				log.Warnf("Failed to get digest for %s:%s: %v", repo, tag, err)
-				continue
-			}
+		var deleteDigests []string
+		for _, digest := range candidateDigests {
 			if keepDigests[digest] {
+				report.InUse = append(report.InUse, *candidates[digest])
 				continue
 			}
+			deleteDigests = append(deleteDigests, digest)
+		}
 
-			if err := deleteByDigest(client, registryURL, repo, digest); err != nil {
-				log.Warnf("Failed to delete %s:%s from Zot: %v", repo, tag, err)
-			} else {
-				totalDeleted++
+		// a blob is freed only when no remaining manifest of the repo uses it
+		counted := make(map[string]bool)
+		for _, digest := range deleteDigests {
+			candidate := candidates[digest]
+			for blob, size := range candidateBlobs[digest] {
+				if retainedBlobs[blob] || counted[blob] {
+					continue
+				}
+				counted[blob] = true
+				candidate.Size += size
 			}
 		}
+
+		for _, digest := range deleteDigests {
+			candidate := candidates[digest]
+			if !dryRun {
+				if err := deleteByDigest(client, registryURL, repo, digest); err != nil {
+					log.Warnf("Failed to delete %s:%s from Zot: %v", repo, strings.Join(candidate.Tags, ","), err)
+					continue
+				}
+			}
+			report.Removed = append(report.Removed, *candidate)
+			report.ReclaimedBytes += candidate.Size
+		}
 	}
 
-	if totalDeleted == 0 {
+	switch {
+	case len(report.Removed) == 0:
 		log.Info("Nothing to delete from Zot registry")
-	} else {
-		log.Infof("Deleted %d image tags from Zot registry", totalDeleted)
+	case dryRun:
+		log.Infof("[dry-run] Would delete %d images from Zot registry", len(report.Removed))
+	default:
+		log.Infof("Deleted %d images from Zot registry", len(report.Removed))
 	}
-	return nil
+	return report, nil
 }
 
 func listRepos(client *http.Client, registryURL string) ([]string, error) {
@@ -160,12 +217,7 @@ func getManifestDigest(client *http.Client, registryURL, repo, tag string) (stri
 		return "", err
 	}
 	// Accept both OCI and Docker manifest types
-	req.Header.Set("Accept", strings.Join([]string{
-		"application/vnd.oci.image.manifest.v1+json",
-		"application/vnd.oci.image.index.v1+json",
-		"application/vnd.docker.distribution.manifest.v2+json",
-		"application/vnd.docker.distribution.manifest.list.v2+json",
-	}, ", "))
+	req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
 
 	resp, err := client.Do(req)
 	if err != nil {
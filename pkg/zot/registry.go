@@ -0,0 +1,271 @@
+package zot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// InClusterRegistryHost is the name pods pull pushed images from, mirrored to Zot by k3s
+const InClusterRegistryHost = "tensorleap-registry:5000"
+
+var ErrDigestShared = errors.New("digest is shared with other tags")
+
+// manifestMediaTypes accepts both OCI and Docker manifest types
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+}
+
+type descriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+	Platform  *struct {
+		Architecture string `json:"architecture"`
+		OS           string `json:"os"`
+		Variant      string `json:"variant,omitempty"`
+	} `json:"platform,omitempty"`
+}
+
+type manifestResponse struct {
+	MediaType string       `json:"mediaType"`
+	Config    descriptor   `json:"config"`
+	Layers    []descriptor `json:"layers"`
+	Manifests []descriptor `json:"manifests"`
+}
+
+func (m *manifestResponse) isIndex() bool {
+	return len(m.Manifests) > 0
+}
+
+type Layer struct {
+	Digest string `json:"digest"`
+	Size   int64  `json:"size"`
+}
+
+type ImagePlatform struct {
+	Platform string  `json:"platform"`
+	Digest   string  `json:"digest"`
+	Size     int64   `json:"size"`
+	Layers   []Layer `json:"layers"`
+}
+
+// ImageInfo describes a tag in Zot, Size is the sum of its blobs as stored in the registry
+type ImageInfo struct {
+	Repo      string          `json:"repo"`
+	Tag       string          `json:"tag"`
+	Digest    string          `json:"digest"`
+	MediaType string          `json:"mediaType"`
+	Size      int64           `json:"size"`
+	Platforms []ImagePlatform `json:"platforms"`
+	blobs     map[string]int64
+	// configDigest is the config of the first platform, used for the creation time
+	configDigest string
+}
+
+type RepoUsage struct {
+	Repo string `json:"repo"`
+	Tags int    `json:"tags"`
+	// Size counts the blobs of the repo once, blobs shared with other repos are counted in each of them
+	Size int64 `json:"size"`
+}
+
+type Usage struct {
+	Repos []RepoUsage `json:"repos"`
+	// TotalSize counts every blob in the registry once
+	TotalSize int64 `json:"totalSize"`
+}
+
+func newClient() *http.Client {
+	return &http.Client{Timeout: 30 * time.Second}
+}
+
+// ParseRef parses an image reference into the Zot repo and tag, a registry host prefix is ignored
+func ParseRef(ref string) (repo, tag string, err error) {
+	if strings.Contains(ref, "@") {
+		return "", "", fmt.Errorf("invalid image reference '%s', digests are not supported, use <repo>:<tag>", ref)
+	}
+	repo, tag = imageToZotRef(ref)
+	if repo == "" || tag == "" || strings.Contains(tag, "/") {
+		return "", "", fmt.Errorf("invalid image reference '%s', expected <repo>:<tag>", ref)
+	}
+	return repo, tag, nil
+}
+
+// ListTags returns the tags of a repo, sorted
+func ListTags(registryURL, repo string) ([]string, error) {
+	tags, err := listTags(newClient(), registryURL, repo)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(tags)
+	return tags, nil
+}
+
+// InspectImage resolves a tag to its digest, platforms and layers
+func InspectImage(registryURL, repo, tag string) (*ImageInfo, error) {
+	return inspectImage(newClient(), registryURL, repo, tag)
+}
+
+func inspectImage(client *http.Client, registryURL, repo, tag string) (*ImageInfo, error) {
+	mnf, digest, err := getManifest(client, registryURL, repo, tag)
+	if err != nil {
+		return nil, err
+	}
+	info := &ImageInfo{Repo: repo, Tag: tag, Digest: digest.Digest, MediaType: digest.MediaType, Platforms: []ImagePlatform{}, blobs: map[string]int64{}}
+	info.blobs[digest.Digest] = digest.Size
+
+	addPlatform := func(platform string, mnfDigest descriptor, m *manifestResponse) {
+		p := ImagePlatform{Platform: platform, Digest: mnfDigest.Digest, Size: m.Config.Size, Layers: []Layer{}}
+		if info.configDigest == "" {
+			info.configDigest = m.Config.Digest
+		}
+		info.blobs[mnfDigest.Digest] = mnfDigest.Size
+		info.blobs[m.Config.Digest] = m.Config.Size
+		for _, layer := range m.Layers {
+			p.Layers = append(p.Layers, Layer{Digest: layer.Digest, Size: layer.Size})
+			p.Size += layer.Size
+			info.blobs[layer.Digest] = layer.Size
+		}
+		info.Platforms = append(info.Platforms, p)
+	}
+
+	if !mnf.isIndex() {
+		addPlatform("", digest, mnf)
+	} else {
+		for _, child := range mnf.Manifests {
+			childMnf, _, err := getManifest(client, registryURL, repo, child.Digest)
+			if err != nil {
+				// indexes often reference platforms that were not synced
+				continue
+			}
+			platform := ""
+			if child.Platform != nil {
+				platform = child.Platform.OS + "/" + child.Platform.Architecture
+				if child.Platform.Variant != "" {
+					platform += "/" + child.Platform.Variant
+				}
+			}
+			addPlatform(platform, child, childMnf)
+		}
+	}
+
+	for _, size := range info.blobs {
+		info.Size += size
+	}
+	return info, nil
+}
+
+// DeleteTag deletes a tag from Zot. Deleting is done by digest, which removes every tag of the digest,
+// so like PruneExceptImageList it refuses when other tags of the repo point to the same digest.
+func DeleteTag(registryURL, repo, tag string) error {
+	client := newClient()
+	digest, err := getManifestDigest(client, registryURL, repo, tag)
+	if err != nil {
+		return err
+	}
+	tags, err := listTags(client, registryURL, repo)
+	if err != nil {
+		return err
+	}
+	sharedWith := []string{}
+	for _, other := range tags {
+		if other == tag {
+			continue
+		}
+		otherDigest, err := getManifestDigest(client, registryURL, repo, other)
+		if err != nil {
+			return fmt.Errorf("cannot resolve digest of %s:%s, not deleting %s:%s: %w", repo, other, repo, tag, err)
+		}
+		if otherDigest == digest {
+			sharedWith = append(sharedWith, other)
+		}
+	}
+	if len(sharedWith) > 0 {
+		sort.Strings(sharedWith)
+		return fmt.Errorf("%w, deleting %s:%s would also delete %s:%s", ErrDigestShared, repo, tag, repo, strings.Join(sharedWith, ", "+repo+":"))
+	}
+	return deleteByDigest(client, registryURL, repo, digest)
+}
+
+// GetUsage reports the storage of each repo, from the blob sizes in the manifests
+func GetUsage(registryURL string) (*Usage, error) {
+	client := newClient()
+	repos, err := listRepos(client, registryURL)
+	if err != nil {
+		return nil, fmt.Errorf("listing Zot catalog: %w", err)
+	}
+
+	usage := &Usage{Repos: []RepoUsage{}}
+	allBlobs := map[string]int64{}
+	for _, repo := range repos {
+		tags, err := listTags(client, registryURL, repo)
+		if err != nil {
+			return nil, err
+		}
+		repoBlobs := map[string]int64{}
+		for _, tag := range tags {
+			info, err := inspectImage(client, registryURL, repo, tag)
+			if err != nil {
+				return nil, fmt.Errorf("inspecting %s:%s: %w", repo, tag, err)
+			}
+			for digest, size := range info.blobs {
+				repoBlobs[digest] = size
+				allBlobs[digest] = size
+			}
+		}
+		repoUsage := RepoUsage{Repo: repo, Tags: len(tags)}
+		for _, size := range repoBlobs {
+			repoUsage.Size += size
+		}
+		usage.Repos = append(usage.Repos, repoUsage)
+	}
+	for _, size := range allBlobs {
+		usage.TotalSize += size
+	}
+	sort.SliceStable(usage.Repos, func(i, j int) bool { return usage.Repos[i].Size > usage.Repos[j].Size })
+	return usage, nil
+}
+
+// getManifest gets the manifest of a tag or digest, and the descriptor of the manifest itself
+func getManifest(client *http.Client, registryURL, repo, reference string) (*manifestResponse, descriptor, error) {
+	url := fmt.Sprintf("%s/v2/%s/manifests/%s", registryURL, repo, reference)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, descriptor{}, err
+	}
+	req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, descriptor{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, descriptor{}, fmt.Errorf("%s:%s not found in the registry", repo, reference)
+	} else if resp.StatusCode != http.StatusOK {
+		return nil, descriptor{}, fmt.Errorf("GET %s returned status %d", url, resp.StatusCode)
+	}
+	mnf := &manifestResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(mnf); err != nil {
+		return nil, descriptor{}, err
+	}
+	mnfDescriptor := descriptor{
+		MediaType: resp.Header.Get("Content-Type"),
+		Digest:    resp.Header.Get("Docker-Content-Digest"),
+		Size:      resp.ContentLength,
+	}
+	if mnfDescriptor.Size < 0 {
+		mnfDescriptor.Size = 0
+	}
+	if mnfDescriptor.MediaType == "" {
+		mnfDescriptor.MediaType = mnf.MediaType
+	}
+	return mnf, mnfDescriptor, nil
+}
@@ -0,0 +1,173 @@
+package zot
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRegistry serves the parts of the registry API used by this package
+type fakeRegistry struct {
+	tags      map[string]map[string]string // repo -> tag -> manifest digest
+	manifests map[string]string            // digest -> manifest json
+	configs   map[string]string            // config digest -> config json
+	deleted   []string
+}
+
+func newFakeRegistry(t *testing.T) (*fakeRegistry, string) {
+	manifest := func(configSize int64, layers ...int64) string {
+		m := manifestResponse{
+			MediaType: "application/vnd.oci.image.manifest.v1+json",
+			Config:    descriptor{Digest: fmt.Sprintf("sha256:config-%d", configSize), Size: configSize},
+		}
+		for _, size := range layers {
+			m.Layers = append(m.Layers, descriptor{Digest: fmt.Sprintf("sha256:layer-%d", size), Size: size})
+		}
+		b, _ := json.Marshal(m)
+		return string(b)
+	}
+	registry := &fakeRegistry{
+		tags: map[string]map[string]string{
+			"tensorleap/engine-generic": {"a": "sha256:m1", "b": "sha256:m1", "c": "sha256:m2"},
+			"library/alpine":            {"3.18": "sha256:m3"},
+		},
+		manifests: map[string]string{
+			"sha256:m1": manifest(1, 100, 200),
+			"sha256:m2": manifest(2, 100, 300),
+			"sha256:m3": manifest(3, 400),
+		},
+	}
+	server := httptest.NewServer(http.HandlerFunc(registry.serve))
+	t.Cleanup(server.Close)
+	return registry, server.URL
+}
+
+func (r *fakeRegistry) serve(w http.ResponseWriter, req *http.Request) {
+	path := strings.TrimPrefix(req.URL.Path, "/v2/")
+	if path == "_catalog" {
+		repos := []string{}
+		for repo := range r.tags {
+			repos = append(repos, repo)
+		}
+		json.NewEncoder(w).Encode(catalogResponse{Repositories: repos})
+		return
+	}
+	if repo, ok := strings.CutSuffix(path, "/tags/list"); ok {
+		tags := []string{}
+		for tag := range r.tags[repo] {
+			tags = append(tags, tag)
+		}
+		json.NewEncoder(w).Encode(tagsResponse{Name: repo, Tags: tags})
+		return
+	}
+	if repo, digest, ok := strings.Cut(path, "/blobs/"); ok {
+		config, found := r.configs[digest]
+		if _, tagged := r.tags[repo]; !found || !tagged {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(config))
+		return
+	}
+	repo, reference, _ := strings.Cut(path, "/manifests/")
+	digest := reference
+	if !strings.HasPrefix(reference, "sha256:") {
+		digest = r.tags[repo][reference]
+	}
+	body, ok := r.manifests[digest]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	switch req.Method {
+	case http.MethodDelete:
+		r.deleted = append(r.deleted, repo+"@"+digest)
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		w.Header().Set("Docker-Content-Digest", digest)
+		w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+		w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+		if req.Method == http.MethodGet {
+			w.Write([]byte(body))
+		}
+	}
+}
+
+func TestParseRef(t *testing.T) {
+	repo, tag, err := ParseRef("tensorleap-registry:5000/tensorleap/engine-generic:a")
+	require.NoError(t, err)
+	assert.Equal(t, "tensorleap/engine-generic", repo)
+	assert.Equal(t, "a", tag)
+
+	for _, ref := range []string{"tensorleap/engine-generic", "localhost:5000/engine", "engine@sha256:abc"} {
+		_, _, err := ParseRef(ref)
+		assert.Error(t, err, ref)
+	}
+}
+
+func TestDeleteTagIsDigestSafe(t *testing.T) {
+	registry, url := newFakeRegistry(t)
+
+	err := DeleteTag(url, "tensorleap/engine-generic", "a")
+	assert.ErrorIs(t, err, ErrDigestShared)
+	assert.ErrorContains(t, err, "tensorleap/engine-generic:b")
+	assert.Empty(t, registry.deleted)
+
+	require.NoError(t, DeleteTag(url, "tensorleap/engine-generic", "c"))
+	assert.Equal(t, []string{"tensorleap/engine-generic@sha256:m2"}, registry.deleted)
+}
+
+func TestInspectImageAndUsage(t *testing.T) {
+	registry, url := newFakeRegistry(t)
+
+	info, err := InspectImage(url, "tensorleap/engine-generic", "a")
+	require.NoError(t, err)
+	assert.Equal(t, "sha256:m1", info.Digest)
+	require.Len(t, info.Platforms, 1)
+	assert.Len(t, info.Platforms[0].Layers, 2)
+	assert.Equal(t, int64(1+100+200+len(registry.manifests["sha256:m1"])), info.Size)
+
+	usage, err := GetUsage(url)
+	require.NoError(t, err)
+	require.Len(t, usage.Repos, 2)
+	engine := usage.Repos[0]
+	assert.Equal(t, "tensorleap/engine-generic", engine.Repo)
+	assert.Equal(t, 3, engine.Tags)
+	// layer-100 is shared by both manifests and counted once
+	m1, m2, m3 := len(registry.manifests["sha256:m1"]), len(registry.manifests["sha256:m2"]), len(registry.manifests["sha256:m3"])
+	assert.Equal(t, int64(1+2+100+200+300+m1+m2), engine.Size)
+	assert.Equal(t, engine.Size+int64(3+400+m3), usage.TotalSize)
+}
+
+func TestPruneExceptImageListDryRun(t *testing.T) {
+	registry, url := newFakeRegistry(t)
+
+	report, err := PruneExceptImageList(url, []string{"public.ecr.aws/tensorleap/engine-generic:a"}, nil, true)
+	require.NoError(t, err)
+	assert.Empty(t, registry.deleted, "dry run deletes nothing")
+
+	require.Len(t, report.InUse, 1)
+	assert.Equal(t, PrunedImage{Repo: "tensorleap/engine-generic", Tags: []string{"b"}, Digest: "sha256:m1"}, report.InUse[0])
+
+	removed := map[string]PrunedImage{}
+	for _, image := range report.Removed {
+		removed[image.Digest] = image
+	}
+	require.Len(t, removed, 2)
+	// layer-100 is shared with the kept tag and is not freed
+	m2, m3 := len(registry.manifests["sha256:m2"]), len(registry.manifests["sha256:m3"])
+	assert.Equal(t, int64(2+300+m2), removed["sha256:m2"].Size)
+	assert.Equal(t, int64(3+400+m3), removed["sha256:m3"].Size)
+	assert.Equal(t, int64(2+300+m2+3+400+m3), report.ReclaimedBytes)
+
+	report, err = PruneExceptImageList(url, []string{"public.ecr.aws/tensorleap/engine-generic:a"}, []string{"library/alpine"}, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"library/alpine"}, report.PreservedRepos)
+	assert.Equal(t, []string{"tensorleap/engine-generic@sha256:m2"}, registry.deleted)
+}
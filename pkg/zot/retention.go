@@ -0,0 +1,211 @@
+package zot
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tensorleap/helm-charts/pkg/log"
+)
+
+// RetentionPolicy limits the images kept in the preserved (DnD) repos, a zero field is not a limit.
+// An image is deleted when it exceeds any of the set limits.
+type RetentionPolicy struct {
+	// KeepLast keeps the N most recently created images of each repo
+	KeepLast uint `json:"keepLast,omitempty" yaml:"keepLast,omitempty"`
+	// MaxAgeDays keeps the images created in the last N days
+	MaxAgeDays uint `json:"maxAgeDays,omitempty" yaml:"maxAgeDays,omitempty"`
+	// MaxSizeGb keeps the most recent images of each repo that fit in N GiB
+	MaxSizeGb uint `json:"maxSizeGb,omitempty" yaml:"maxSizeGb,omitempty"`
+}
+
+func (policy *RetentionPolicy) IsEmpty() bool {
+	return policy == nil || (policy.KeepLast == 0 && policy.MaxAgeDays == 0 && policy.MaxSizeGb == 0)
+}
+
+func (policy *RetentionPolicy) String() string {
+	if policy.IsEmpty() {
+		return "none"
+	}
+	limits := []string{}
+	if policy.KeepLast > 0 {
+		limits = append(limits, fmt.Sprintf("keep last %d", policy.KeepLast))
+	}
+	if policy.MaxAgeDays > 0 {
+		limits = append(limits, fmt.Sprintf("max age %d days", policy.MaxAgeDays))
+	}
+	if policy.MaxSizeGb > 0 {
+		limits = append(limits, fmt.Sprintf("max size %d GiB", policy.MaxSizeGb))
+	}
+	return strings.Join(limits, ", ")
+}
+
+type retentionCandidate struct {
+	image   *PrunedImage
+	blobs   map[string]int64
+	created time.Time
+	// unknownCreated is set when the creation time could not be read, such an image is never deleted
+	unknownCreated bool
+}
+
+// ApplyRetention deletes the images of the repos that exceed the policy, newest images are kept first.
+// Images of keepImages (e.g. the installed version and images of running pods) and the digests in
+// inUseDigests are never deleted, but still count toward the limits. Images whose creation time cannot be read
+// are not deleted either, they are reported as skipped. On dry run nothing is deleted.
+func ApplyRetention(registryURL string, repos []string, policy RetentionPolicy, keepImages []string, inUseDigests []string, dryRun bool) (*PruneReport, error) {
+	report := &PruneReport{DryRun: dryRun, Removed: []PrunedImage{}, InUse: []PrunedImage{}, PreservedRepos: []string{}}
+	if policy.IsEmpty() {
+		return report, nil
+	}
+	keepSet := buildKeepSet(keepImages)
+	protected := make(map[string]bool, len(inUseDigests))
+	for _, digest := range inUseDigests {
+		protected[digest] = true
+	}
+
+	client := newClient()
+	now := time.Now()
+	for _, repo := range repos {
+		tags, err := listTags(client, registryURL, repo)
+		if err != nil {
+			log.Warnf("Failed to list tags for %s: %v", repo, err)
+			continue
+		}
+
+		candidates := map[string]*retentionCandidate{}
+		var ordered []*retentionCandidate
+		skipRepo := false
+		for _, tag := range tags {
+			info, err := inspectImage(client, registryURL, repo, tag)
+			if err != nil {
+				// the digest is unknown, so it could be one of the protected ones
+				log.Warnf("Cannot resolve digest for %s:%s, skipping retention of %s: %v", repo, tag, repo, err)
+				skipRepo = true
+				break
+			}
+			if keepSet[repo+":"+tag] {
+				protected[info.Digest] = true
+			}
+			if candidate, ok := candidates[info.Digest]; ok {
+				candidate.image.Tags = append(candidate.image.Tags, tag)
+				continue
+			}
+			created, err := getImageCreated(client, registryURL, repo, info.configDigest)
+			if err != nil {
+				log.Warnf("Failed to get the creation time of %s:%s, keeping it: %v", repo, tag, err)
+			}
+			candidate := &retentionCandidate{
+				image:          &PrunedImage{Repo: repo, Tags: []string{tag}, Digest: info.Digest},
+				blobs:          info.blobs,
+				created:        created,
+				unknownCreated: err != nil,
+			}
+			candidates[info.Digest] = candidate
+			ordered = append(ordered, candidate)
+		}
+		if skipRepo {
+			continue
+		}
+
+		sort.SliceStable(ordered, func(i, j int) bool {
+			if !ordered[i].created.Equal(ordered[j].created) {
+				return ordered[i].created.After(ordered[j].created)
+			}
+			return ordered[i].image.Digest < ordered[j].image.Digest
+		})
+
+		retainedBlobs := map[string]bool{}
+		var retainedSize int64
+		overBudget := false
+		var deleteCandidates []*retentionCandidate
+		for i, candidate := range ordered {
+			var addedSize int64
+			for blob, size := range candidate.blobs {
+				if !retainedBlobs[blob] {
+					addedSize += size
+				}
+			}
+			exceeds := policy.KeepLast > 0 && uint(i) >= policy.KeepLast
+			if policy.MaxAgeDays > 0 && !candidate.unknownCreated && now.Sub(candidate.created) > time.Duration(policy.MaxAgeDays)*24*time.Hour {
+				exceeds = true
+			}
+			if policy.MaxSizeGb > 0 && (overBudget || retainedSize+addedSize > int64(policy.MaxSizeGb)<<30) {
+				// older images are not kept in place of a newer one that did not fit
+				overBudget = true
+				exceeds = true
+			}
+
+			if !exceeds || protected[candidate.image.Digest] || candidate.unknownCreated {
+				if candidate.unknownCreated {
+					report.Skipped = append(report.Skipped, *candidate.image)
+				} else if exceeds {
+					report.InUse = append(report.InUse, *candidate.image)
+				}
+				for blob := range candidate.blobs {
+					retainedBlobs[blob] = true
+				}
+				retainedSize += addedSize
+				continue
+			}
+			deleteCandidates = append(deleteCandidates, candidate)
+		}
+
+		// a blob is freed only when no retained manifest of the repo uses it
+		counted := map[string]bool{}
+		for _, candidate := range deleteCandidates {
+			for blob, size := range candidate.blobs {
+				if retainedBlobs[blob] || counted[blob] {
+					continue
+				}
+				counted[blob] = true
+				candidate.image.Size += size
+			}
+		}
+
+		for _, candidate := range deleteCandidates {
+			if !dryRun {
+				if err := deleteByDigest(client, registryURL, repo, candidate.image.Digest); err != nil {
+					log.Warnf("Failed to delete %s:%s from Zot: %v", repo, strings.Join(candidate.image.Tags, ","), err)
+					continue
+				}
+			}
+			report.Removed = append(report.Removed, *candidate.image)
+			report.ReclaimedBytes += candidate.image.Size
+		}
+	}
+
+	switch {
+	case len(report.Removed) == 0:
+		log.Infof("No images exceed the retention policy (%s)", policy.String())
+	case dryRun:
+		log.Infof("[dry-run] Would delete %d images exceeding the retention policy (%s)", len(report.Removed), policy.String())
+	default:
+		log.Infof("Deleted %d images exceeding the retention policy (%s)", len(report.Removed), policy.String())
+	}
+	return report, nil
+}
+
+// getImageCreated reads the creation time from the image config blob
+func getImageCreated(client *http.Client, registryURL, repo, configDigest string) (time.Time, error) {
+	if configDigest == "" {
+		return time.Time{}, fmt.Errorf("no image config")
+	}
+	resp, err := client.Get(fmt.Sprintf("%s/v2/%s/blobs/%s", registryURL, repo, configDigest))
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return time.Time{}, fmt.Errorf("unexpected status %d for blob %s", resp.StatusCode, configDigest)
+	}
+	var config struct {
+		Created time.Time `json:"created"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&config); err != nil {
+		return time.Time{}, err
+	}
+	return config.Created, nil
+}
@@ -0,0 +1,109 @@
+package zot
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const mib = int64(1) << 20
+
+// newRetentionRegistry has an engine-generic repo with v1..v4 created 40, 20, 2 and 1 days ago,
+// with layers of 100, 200, 300 and 600 MiB
+func newRetentionRegistry(t *testing.T) (*fakeRegistry, string) {
+	registry := &fakeRegistry{
+		tags:      map[string]map[string]string{"tensorleap/engine-generic": {}},
+		manifests: map[string]string{},
+		configs:   map[string]string{},
+	}
+	ages := []int{40, 20, 2, 1}
+	layers := []int64{100 * mib, 200 * mib, 300 * mib, 600 * mib}
+	for i := range ages {
+		digest := fmt.Sprintf("sha256:m%d", i+1)
+		configDigest := fmt.Sprintf("sha256:config-%d", i+1)
+		m := manifestResponse{
+			MediaType: "application/vnd.oci.image.manifest.v1+json",
+			Config:    descriptor{Digest: configDigest, Size: 1},
+			Layers:    []descriptor{{Digest: fmt.Sprintf("sha256:layer-%d", i+1), Size: layers[i]}},
+		}
+		b, _ := json.Marshal(m)
+		registry.manifests[digest] = string(b)
+		created := time.Now().Add(-time.Duration(ages[i]) * 24 * time.Hour).UTC().Format(time.RFC3339)
+		registry.configs[configDigest] = fmt.Sprintf(`{"created": %q}`, created)
+		registry.tags["tensorleap/engine-generic"][fmt.Sprintf("v%d", i+1)] = digest
+	}
+	server := httptest.NewServer(http.HandlerFunc(registry.serve))
+	t.Cleanup(server.Close)
+	return registry, server.URL
+}
+
+func removedDigests(report *PruneReport) []string {
+	digests := []string{}
+	for _, image := range report.Removed {
+		digests = append(digests, image.Digest)
+	}
+	return digests
+}
+
+func TestApplyRetention(t *testing.T) {
+	repos := []string{"tensorleap/engine-generic"}
+
+	t.Run("keep last", func(t *testing.T) {
+		registry, url := newRetentionRegistry(t)
+		report, err := ApplyRetention(url, repos, RetentionPolicy{KeepLast: 2}, nil, nil, false)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"sha256:m1", "sha256:m2"}, removedDigests(report))
+		assert.ElementsMatch(t, []string{"tensorleap/engine-generic@sha256:m1", "tensorleap/engine-generic@sha256:m2"}, registry.deleted)
+	})
+
+	t.Run("max age", func(t *testing.T) {
+		_, url := newRetentionRegistry(t)
+		report, err := ApplyRetention(url, repos, RetentionPolicy{MaxAgeDays: 30}, nil, nil, true)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"sha256:m1"}, removedDigests(report))
+	})
+
+	t.Run("unknown creation time is skipped", func(t *testing.T) {
+		registry, url := newRetentionRegistry(t)
+		registry.configs["sha256:config-1"] = "not json"
+		report, err := ApplyRetention(url, repos, RetentionPolicy{MaxAgeDays: 30, KeepLast: 2}, nil, nil, false)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"sha256:m2"}, removedDigests(report))
+		require.Len(t, report.Skipped, 1)
+		assert.Equal(t, "sha256:m1", report.Skipped[0].Digest)
+		assert.Equal(t, []string{"tensorleap/engine-generic@sha256:m2"}, registry.deleted)
+	})
+
+	t.Run("max size drops every older image", func(t *testing.T) {
+		_, url := newRetentionRegistry(t)
+		// v4 and v3 take 900 MiB, v2 does not fit and v1 is not kept in its place
+		report, err := ApplyRetention(url, repos, RetentionPolicy{MaxSizeGb: 1}, nil, nil, true)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"sha256:m1", "sha256:m2"}, removedDigests(report))
+		assert.Greater(t, report.ReclaimedBytes, 300*mib)
+	})
+
+	t.Run("protected digests are kept", func(t *testing.T) {
+		registry, url := newRetentionRegistry(t)
+		report, err := ApplyRetention(url, repos, RetentionPolicy{KeepLast: 1},
+			[]string{"public.ecr.aws/tensorleap/engine-generic:v2"}, []string{"sha256:m1"}, false)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"sha256:m3"}, removedDigests(report))
+		assert.Equal(t, []string{"tensorleap/engine-generic@sha256:m3"}, registry.deleted)
+		require.Len(t, report.InUse, 2)
+	})
+
+	t.Run("empty policy", func(t *testing.T) {
+		registry, url := newRetentionRegistry(t)
+		report, err := ApplyRetention(url, repos, RetentionPolicy{}, nil, nil, false)
+		require.NoError(t, err)
+		assert.Empty(t, report.Removed)
+		assert.Empty(t, registry.deleted)
+	})
+}
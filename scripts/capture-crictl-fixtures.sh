@@ -0,0 +1,24 @@
+#!/usr/bin/env bash
+#
+# Captures the crictl fixtures of pkg/containerd from a running k3s node and
+# regenerates the inventory golden file from them.
+#
+# The node should hold a pinned image (the k3s pause image), an image with
+# repoDigests but no tags, a <none> image, a running container and an exited
+# one. The ids in the assertions of pkg/containerd/inventory_test.go have to be
+# updated to the captured ones afterwards.
+#
+# Required tools: docker, jq, go.
+
+set -euo pipefail
+
+REPO_ROOT="$(cd -- "$(dirname -- "${BASH_SOURCE[0]}")/.." && pwd)"
+NODE="${NODE:-k3d-tensorleap-server-0}"
+TESTDATA="${REPO_ROOT}/pkg/containerd/testdata"
+
+docker exec "${NODE}" crictl images -o json | jq . > "${TESTDATA}/crictl-images.json"
+docker exec "${NODE}" crictl ps -a -o json | jq . > "${TESTDATA}/crictl-ps.json"
+
+cd "${REPO_ROOT}"
+go test ./pkg/containerd -run TestParseInventory -update
+echo "Captured the fixtures from ${NODE}, now update the image ids in pkg/containerd/inventory_test.go"